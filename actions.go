@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// The github-actions[bot] identity used when no account is given
+const (
+	actionsBotName  = "github-actions[bot]"
+	actionsBotEmail = "41898282+github-actions[bot]@users.noreply.github.com"
+)
+
+// envOIDCToken passes the job's OIDC token to an --exchange command
+const envOIDCToken = "GHS_OIDC_TOKEN"
+
+// requestOIDCToken asks the Actions runtime for an OIDC ID token. The
+// workflow needs "permissions: id-token: write".
+func requestOIDCToken(audience string) (string, error) {
+	requestURL, requestToken := os.Getenv("ACTIONS_ID_TOKEN_REQUEST_URL"), os.Getenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN")
+	if requestURL == "" || requestToken == "" {
+		return "", fmt.Errorf("no OIDC token available, grant the job \"id-token: write\" permission")
+	}
+	if audience != "" {
+		requestURL += "&audience=" + url.QueryEscape(audience)
+	}
+	req, err := http.NewRequest("GET", requestURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+requestToken)
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to request OIDC token: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to request OIDC token: %s", resp.Status)
+	}
+	var result struct {
+		Value string `json:"value"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || result.Value == "" {
+		return "", fmt.Errorf("unexpected OIDC token response")
+	}
+	return result.Value, nil
+}
+
+// exchangeOIDCToken runs the exchange command with the OIDC token in
+// GHS_OIDC_TOKEN; it prints the GitHub token to use
+func exchangeOIDCToken(command, oidcToken string) (string, error) {
+	cmd := execCommand("sh", "-c", command)
+	cmd.Env = append(os.Environ(), envOIDCToken+"="+oidcToken)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("exchange command failed: %v", err)
+	}
+	token := strings.TrimSpace(string(out))
+	if token == "" {
+		return "", fmt.Errorf("exchange command printed no token")
+	}
+	return token, nil
+}
+
+// appendActionsFile appends lines to one of the files the runner reads
+// after the step, such as GITHUB_ENV or GITHUB_OUTPUT
+func appendActionsFile(name string, lines ...string) error {
+	path := os.Getenv(name)
+	if path == "" {
+		return nil
+	}
+	f, err := openPrivateAppend(path)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %v", name, err)
+	}
+	defer f.Close()
+	_, err = f.WriteString(strings.Join(lines, "\n") + "\n")
+	return err
+}
+
+// actionsSetup handles "actions setup": it picks the identity and token for
+// the job, configures git through ci-setup and reports outputs and a step
+// summary
+func actionsSetup(config Config, args []string) error {
+	flags := flag.NewFlagSet("actions setup", flag.ContinueOnError)
+	alias := flags.String("account", "", "account whose name, email and tokens the job uses (default github-actions[bot])")
+	audience := flags.String("oidc-audience", "", "request an OIDC token for this audience")
+	exchange := flags.String("exchange", "", "command turning $GHS_OIDC_TOKEN into a GitHub token")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return fmt.Errorf("usage: ghs actions setup [--account <alias>] [--oidc-audience <aud> --exchange <command>]")
+	}
+	if *audience != "" && *exchange == "" {
+		return fmt.Errorf("--oidc-audience needs --exchange")
+	}
+	if os.Getenv("GITHUB_ACTIONS") != "true" {
+		return fmt.Errorf("not running in GitHub Actions")
+	}
+
+	name, email := actionsBotName, actionsBotEmail
+	var account GitHubAccount
+	if *alias != "" {
+		var err error
+		if *alias, account, err = config.lookupAccount(*alias); err != nil {
+			return err
+		}
+		name, email = account.Name, account.Email
+	}
+	if value := os.Getenv(envCIName); value != "" {
+		name = value
+	}
+	if value := os.Getenv(envCIEmail); value != "" {
+		email = value
+	}
+
+	// The token for HTTPS: an exchanged OIDC token, GHS_CI_TOKEN, the
+	// account's own token, then the job's GITHUB_TOKEN
+	token, source := "", ""
+	owner, repo, _ := strings.Cut(os.Getenv("GITHUB_REPOSITORY"), "/")
+	switch {
+	case *exchange != "":
+		oidcToken, err := requestOIDCToken(*audience)
+		if err != nil {
+			return err
+		}
+		if token, err = exchangeOIDCToken(*exchange, oidcToken); err != nil {
+			return err
+		}
+		source = "OIDC exchange"
+	case os.Getenv(envCIToken) != "":
+		token, source = os.Getenv(envCIToken), envCIToken
+	case *alias != "" && (len(account.Tokens) > 0 || account.App != nil):
+		if token, source, err = tokenFor(account, owner, repo); err != nil {
+			return err
+		}
+	case os.Getenv("GITHUB_TOKEN") != "":
+		token, source = os.Getenv("GITHUB_TOKEN"), "GITHUB_TOKEN"
+	}
+	os.Setenv(envCIName, name)
+	os.Setenv(envCIEmail, email)
+	if token != "" {
+		// Hide the token in the log and hand it to the later steps, where
+		// the credential helper reads it
+		fmt.Printf("::add-mask::%s\n", token)
+		os.Setenv(envCIToken, token)
+		if err := appendActionsFile("GITHUB_ENV", envCIToken+"="+token); err != nil {
+			return err
+		}
+		// Installation and job tokens go with x-access-token, the
+		// ci-setup default; personal tokens with their user
+		if os.Getenv(envCIUsername) == "" && account.Username != "" && source != "GITHUB_TOKEN" && source != "OIDC exchange" && !hasAppToken(account, owner, repo) {
+			os.Setenv(envCIUsername, account.Username)
+		}
+	}
+	if err := ciSetup(nil); err != nil {
+		return err
+	}
+
+	if source == "" {
+		source = "none"
+	}
+	if err := appendActionsFile("GITHUB_OUTPUT", "name="+name, "email="+email, "token-source="+source); err != nil {
+		return err
+	}
+	return appendActionsFile("GITHUB_STEP_SUMMARY",
+		"### Git identity",
+		"",
+		"| | |",
+		"|---|---|",
+		fmt.Sprintf("| Identity | %s <%s> |", name, email),
+		fmt.Sprintf("| HTTPS token | %s |", source),
+		"")
+}
+
+// runActionsCommand handles "actions <subcommand>"
+func runActionsCommand(config Config, args []string) error {
+	if len(args) == 0 || args[0] != "setup" {
+		return fmt.Errorf("usage: ghs actions setup [--account <alias>] [--oidc-audience <aud> --exchange <command>]")
+	}
+	return actionsSetup(config, args[1:])
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// sshMaxAuthTries is how many keys GitHub lets a client offer before it
+// disconnects, the OpenSSH default MaxAuthTries
+const sshMaxAuthTries = 6
+
+// tooManyKeysPattern matches the disconnect after too many offered keys
+var tooManyKeysPattern = regexp.MustCompile(`Too many authentication failures`)
+
+// sshEffectiveConfig returns the options ssh uses for host, as printed by
+// ssh -G. IdentityFile appears once per file.
+func sshEffectiveConfig(host string) (map[string][]string, error) {
+	out, err := execCommand("ssh", "-G", host).Output()
+	if err != nil {
+		return nil, fmt.Errorf("ssh -G %s failed: %v", host, err)
+	}
+	options := map[string][]string{}
+	for _, line := range strings.Split(string(out), "\n") {
+		if key, value, ok := strings.Cut(strings.TrimSpace(line), " "); ok {
+			options[key] = append(options[key], value)
+		}
+	}
+	return options, nil
+}
+
+// offersAgentKeys reports whether ssh offers every agent key for an
+// account's host instead of only the account's key
+func offersAgentKeys(account GitHubAccount) (bool, error) {
+	options, err := sshEffectiveConfig("github.com-" + account.Username)
+	if err != nil {
+		return false, err
+	}
+	identitiesOnly := len(options["identitiesonly"]) > 0 && options["identitiesonly"][0] == "yes"
+	return !identitiesOnly, nil
+}
+
+// checkAgentKeys warns when the agent holds enough keys for GitHub to give up
+// before ssh offers the account's key
+func checkAgentKeys(alias string, account GitHubAccount) *doctorResult {
+	keys := agentKeyCount()
+	if keys < sshMaxAuthTries {
+		return nil
+	}
+	data := map[string]string{"agent_keys": fmt.Sprint(keys)}
+	offers, err := offersAgentKeys(account)
+	if err != nil || !offers {
+		return &doctorResult{Status: doctorOK, Finding: "ok", Message: fmt.Sprintf("only the account's key is offered, %d keys in the agent don't matter", keys), Data: data}
+	}
+	return &doctorResult{Status: doctorWarn, Finding: "too_many", Message: fmt.Sprintf("the agent holds %d keys and ssh offers them all; GitHub disconnects after %d", keys, sshMaxAuthTries),
+		Hint: "ghs test " + alias + " --fix", Data: data}
+}
+
+// fixAgentKeys makes ssh offer only the account's key: a hand-written Host
+// block without IdentitiesOnly is replaced with the managed one, and a
+// missing managed block is written
+func fixAgentKeys(config Config, alias string) error {
+	account, _ := config.account(alias)
+	host := "github.com-" + account.Username
+	offers, err := offersAgentKeys(account)
+	if err != nil {
+		return err
+	}
+	if !offers {
+		return fmt.Errorf("ssh already offers only the key of account '%s'", alias)
+	}
+	if account.SSHKeyPath == "" && account.hardwareKey() {
+		return fmt.Errorf("account '%s' has no key file, so ssh offers every key of its agent; give it the public key with ghs edit %s --key <file.pub>", alias, alias)
+	}
+	if keyMissing(account) {
+		return fmt.Errorf("SSH key not found for account '%s' at %s", alias, account.SSHKeyPath)
+	}
+
+	scanned, err := scanSSHConfig()
+	if err != nil {
+		return fmt.Errorf("failed to read SSH config file: %v", err)
+	}
+	adopt := map[string]bool{}
+	if block, exists := scanned.hosts[host]; exists {
+		if len(block.Patterns) > 1 {
+			return fmt.Errorf("the block at %s:%d is shared by Host %s; add IdentitiesOnly yes to it by hand",
+				sshConfigPath, block.Line, strings.Join(block.Patterns, " "))
+		}
+		fmt.Printf("Replacing the hand-written Host %s block at %s:%d, which offers every agent key\n", host, sshConfigPath, block.Line)
+		adopt[host] = true
+	}
+	if err := writeSSHConfig(config, adopt, sshEditsAsk); err != nil {
+		return err
+	}
+	if offers, err := offersAgentKeys(account); err == nil && offers {
+		// The managed block is there, but an earlier block wins
+		return fmt.Errorf("an earlier block of %s overrides IdentitiesOnly for Host %s; run ghs sshconfig lint to find it", sshConfigPath, host)
+	}
+	fmt.Printf("Host %s now offers only %s (IdentitiesOnly yes)\n", host, account.SSHKeyPath)
+	return nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// hasAlias reports whether the account can also be called name
+func (a GitHubAccount) hasAlias(name string) bool {
+	for _, other := range a.Aliases {
+		if other == name {
+			return true
+		}
+	}
+	return false
+}
+
+// namedAlias returns the alias of the account called exactly name, by its
+// alias or one of its extra aliases. Names kept in files, such as the
+// accounts of rules, are resolved with it.
+func (c Config) namedAlias(name string) (string, bool) {
+	if _, exists := c.Accounts[name]; exists {
+		return name, true
+	}
+	for _, alias := range sortedAliases(c.Accounts) {
+		if c.Accounts[alias].hasAlias(name) {
+			return alias, true
+		}
+	}
+	return "", false
+}
+
+// lookupAlias returns the alias an account is stored under for a name typed
+// on the command line: one of its names, the same name in another case, or
+// the start of a single account's names, so "Work" and "wo" find "work"
+func (c Config) lookupAlias(name string) (string, error) {
+	if alias, ok := c.namedAlias(name); ok {
+		return alias, nil
+	}
+	lower := strings.ToLower(name)
+	for _, match := range []func(string) bool{
+		func(other string) bool { return strings.ToLower(other) == lower },
+		func(other string) bool { return strings.HasPrefix(strings.ToLower(other), lower) },
+	} {
+		var candidates []string
+		for _, alias := range sortedAliases(c.Accounts) {
+			for _, other := range append([]string{alias}, c.Accounts[alias].Aliases...) {
+				if match(other) {
+					candidates = append(candidates, alias)
+					break
+				}
+			}
+		}
+		switch {
+		case len(candidates) == 1:
+			return candidates[0], nil
+		case len(candidates) > 1:
+			return "", fmt.Errorf("'%s' matches several accounts: %s", name, strings.Join(candidates, ", "))
+		}
+	}
+	return "", fmt.Errorf("account '%s' not found%s", name, didYouMean(name, c.accountNames()))
+}
+
+// exactAlias is lookupAlias without case folding or prefixes, for commands
+// that destroy what they name
+func (c Config) exactAlias(name string) (string, error) {
+	if alias, ok := c.namedAlias(name); ok {
+		return alias, nil
+	}
+	return "", fmt.Errorf("account '%s' not found%s", name, didYouMean(name, c.accountNames()))
+}
+
+// lookupAliases resolves several names with lookupAlias
+func (c Config) lookupAliases(names []string) ([]string, error) {
+	aliases := make([]string, len(names))
+	for i, name := range names {
+		alias, err := c.lookupAlias(name)
+		if err != nil {
+			return nil, err
+		}
+		aliases[i] = alias
+	}
+	return aliases, nil
+}
+
+// lookupAccount returns an account with defaults applied by any of its names,
+// and the alias it is stored under
+func (c Config) lookupAccount(name string) (string, GitHubAccount, error) {
+	alias, err := c.lookupAlias(name)
+	if err != nil {
+		return "", GitHubAccount{}, err
+	}
+	account, _ := c.account(alias)
+	return alias, account, nil
+}
+
+// aliasProblems checks the extra aliases of a set of accounts: each is a
+// valid alias that names no other account
+func aliasProblems(accounts map[string]GitHubAccount) []fieldProblem {
+	var problems []fieldProblem
+	owners := map[string]string{}
+	for _, alias := range sortedAliases(accounts) {
+		owners[alias] = alias
+	}
+	for _, alias := range sortedAliases(accounts) {
+		for i, name := range accounts[alias].Aliases {
+			field := joinField(alias, fmt.Sprintf("aliases[%d]", i))
+			if err := validateAlias(name); err != nil {
+				problems = append(problems, fieldProblem{field, err.Error()})
+			} else if owner, exists := owners[name]; exists && owner != alias {
+				problems = append(problems, fieldProblem{field, fmt.Sprintf("%q already names account '%s'", name, owner)})
+			} else {
+				owners[name] = alias
+			}
+		}
+	}
+	return problems
+}
+
+// runAliasCommand handles "alias add|remove <alias> <name>..."
+func runAliasCommand(config Config, args []string) error {
+	if len(args) < 3 || (args[0] != "add" && args[0] != "remove") {
+		return fmt.Errorf("usage: ghs alias <add|remove> <alias> <name>...")
+	}
+	alias, err := config.lookupAlias(args[1])
+	if err != nil {
+		return err
+	}
+	account := config.Accounts[alias]
+
+	if args[0] == "add" {
+		for _, name := range args[2:] {
+			if err := validateAlias(name); err != nil {
+				return err
+			}
+			if owner, ok := config.namedAlias(name); ok && owner != alias {
+				return fmt.Errorf("%q already names account '%s'", name, owner)
+			} else if ok && name == alias {
+				return fmt.Errorf("%q is the account's alias", name)
+			}
+			if !account.hasAlias(name) {
+				account.Aliases = append(account.Aliases, name)
+			}
+		}
+		sort.Strings(account.Aliases)
+	} else {
+		var kept []string
+		removed := GitHubAccount{Aliases: args[2:]}
+		for _, name := range account.Aliases {
+			if !removed.hasAlias(name) {
+				kept = append(kept, name)
+			}
+		}
+		account.Aliases = kept
+	}
+	config.Accounts[alias] = account
+	if err := saveConfig(config); err != nil {
+		return err
+	}
+
+	fmt.Printf("Aliases of '%s': %s\n", alias, formatTags(account.Aliases))
+	return nil
+}
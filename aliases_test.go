@@ -0,0 +1,107 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLookupAlias(t *testing.T) {
+	config := Config{
+		Accounts: map[string]GitHubAccount{
+			"work":     {Username: "acme-me", Aliases: []string{"acme"}},
+			"Workshop": {Username: "shop-me"},
+			"personal": {Username: "me", Aliases: []string{"home", "p"}},
+			"client":   {Username: "client-me"},
+		},
+	}
+	tests := []struct {
+		name string
+		want string
+		err  string
+	}{
+		{name: "work", want: "work"},
+		{name: "Workshop", want: "Workshop"},
+		{name: "acme", want: "work"},
+		{name: "p", want: "personal"},
+		{name: "WORK", want: "work"},
+		{name: "workshop", want: "Workshop"},
+		{name: "ACME", want: "work"},
+		{name: "pers", want: "personal"},
+		{name: "ho", want: "personal"},
+		{name: "cl", want: "client"},
+		{name: "works", want: "Workshop"},
+		{name: "wo", err: "'wo' matches several accounts: Workshop, work"},
+		{name: "a", want: "work"},
+		{name: "wrok", err: "account 'wrok' not found, did you mean work?"},
+		{name: "zzz", err: "account 'zzz' not found"},
+	}
+	for _, tt := range tests {
+		got, err := config.lookupAlias(tt.name)
+		if tt.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+				t.Errorf("lookupAlias(%q) = %q, %v, want error %q", tt.name, got, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("lookupAlias(%q) = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestLookupAliases(t *testing.T) {
+	config := Config{
+		Accounts: map[string]GitHubAccount{
+			"work":     {Aliases: []string{"w"}},
+			"personal": {},
+		},
+	}
+	got, err := config.lookupAliases([]string{"W", "per"})
+	if err != nil || strings.Join(got, ",") != "work,personal" {
+		t.Errorf("lookupAliases = %v, %v, want [work personal]", got, err)
+	}
+	if _, err := config.lookupAliases([]string{"work", "nope"}); err == nil {
+		t.Error("lookupAliases with an unknown name succeeded")
+	}
+}
+
+func TestExactAlias(t *testing.T) {
+	config := Config{
+		Accounts: map[string]GitHubAccount{
+			"work": {Aliases: []string{"acme"}},
+		},
+	}
+	if got, err := config.exactAlias("acme"); err != nil || got != "work" {
+		t.Errorf("exactAlias(acme) = %q, %v, want work", got, err)
+	}
+	for _, name := range []string{"w", "Work"} {
+		if got, err := config.exactAlias(name); err == nil {
+			t.Errorf("exactAlias(%q) = %q, want an error", name, got)
+		}
+	}
+}
+
+func TestEnvAccountAlias(t *testing.T) {
+	config := Config{
+		Accounts: map[string]GitHubAccount{
+			"work":       {},
+			"github-bot": {},
+		},
+	}
+	t.Setenv(envAccount, "work")
+	tests := []struct {
+		args  []string
+		alias string
+		rest  []string
+	}{
+		{[]string{"git", "push"}, "work", []string{"git", "push"}},
+		{[]string{"github-bot", "git", "push"}, "github-bot", []string{"git", "push"}},
+		{[]string{"--", "github-bot"}, "work", []string{"--", "github-bot"}},
+	}
+	for _, tt := range tests {
+		alias, rest, err := envAccountAlias(config, tt.args)
+		if err != nil || alias != tt.alias || strings.Join(rest, " ") != strings.Join(tt.rest, " ") {
+			t.Errorf("envAccountAlias(%q) = %q, %q, %v, want %q, %q", tt.args, alias, rest, err, tt.alias, tt.rest)
+		}
+	}
+}
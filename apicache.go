@@ -0,0 +1,102 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// defaultAPICacheTTL is how long GitHub API responses are reused without
+// asking GitHub again
+const defaultAPICacheTTL = 5 * time.Minute
+
+var (
+	// apiCacheTTL is set from the config's api_cache_ttl
+	apiCacheTTL = defaultAPICacheTTL
+	// apiCacheDisabled is set by --no-cache
+	apiCacheDisabled bool
+)
+
+// cachedResponse is a GitHub API response stored on disk
+type cachedResponse struct {
+	Time time.Time       `json:"time"`
+	ETag string          `json:"etag,omitempty"`
+	Body json.RawMessage `json:"body"`
+}
+
+func apiCacheDir() string {
+	return filepath.Join(stateDir, "cache", "api")
+}
+
+// apiCachePath returns the cache file of a request. The token is part of the
+// key since different accounts see different data.
+func apiCachePath(url, token string) string {
+	sum := sha256.Sum256([]byte(url + "\x00" + token))
+	return filepath.Join(apiCacheDir(), hex.EncodeToString(sum[:])+".json")
+}
+
+func readAPICache(url, token string) (cachedResponse, bool) {
+	var cached cachedResponse
+	if apiCacheDisabled {
+		return cached, false
+	}
+	data, err := os.ReadFile(apiCachePath(url, token))
+	if err != nil || json.Unmarshal(data, &cached) != nil {
+		return cached, false
+	}
+	return cached, true
+}
+
+// writeAPICache stores a response. Failures are ignored since the cache only
+// saves requests.
+func writeAPICache(url, token string, cached cachedResponse) {
+	if apiCacheDisabled {
+		return
+	}
+	data, err := json.Marshal(cached)
+	if err != nil {
+		return
+	}
+	if err := mkdirPrivate(apiCacheDir()); err != nil {
+		return
+	}
+	writePrivateFile(apiCachePath(url, token), data)
+}
+
+// parseAPICacheTTL parses the config's api_cache_ttl
+func parseAPICacheTTL(value string) (time.Duration, error) {
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl < 0 {
+		return 0, fmt.Errorf("invalid duration %q, expected a value such as 10m", value)
+	}
+	return ttl, nil
+}
+
+// setAPICacheTTL applies the config's api_cache_ttl
+func setAPICacheTTL(config Config) error {
+	if config.APICacheTTL == "" {
+		return nil
+	}
+	ttl, err := parseAPICacheTTL(config.APICacheTTL)
+	if err != nil {
+		return fmt.Errorf("api_cache_ttl: %v", err)
+	}
+	apiCacheTTL = ttl
+	return nil
+}
+
+// runCacheCommand handles "cache clear"
+func runCacheCommand(args []string) error {
+	if len(args) != 1 || args[0] != "clear" {
+		return fmt.Errorf("usage: ghs cache clear")
+	}
+	if err := os.RemoveAll(apiCacheDir()); err != nil {
+		return fmt.Errorf("failed to clear cache: %v", err)
+	}
+	fmt.Println("API cache cleared.")
+	return nil
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// batchCommands are the commands a batch may run: they change nothing but
+// the files batchSnapshot restores. token is left out because it writes to
+// the keyring, and add may not generate keys.
+var batchCommands = map[string]bool{
+	"add": true, "edit": true, "copy": true, "map": true, "unmap": true,
+	"tag": true, "rule": true, "app": true, "sshconfig": true,
+	"profile": true, "import": true, "merge": true,
+}
+
+// batchOp is one operation of a batch file
+type batchOp struct {
+	Line int
+	Args []string
+}
+
+// splitWords splits a line into words like a shell: single quotes keep
+// everything, double quotes and backslashes work as in sh
+func splitWords(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord, quote, escaped := false, rune(0), false
+	for _, r := range line {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\\':
+			escaped, inWord = true, true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// parseBatch reads a batch: a JSON array of argument arrays, or one ghs
+// command line per line with # comments. A leading "ghs" is dropped, so
+// commands can be copied from docs.
+func parseBatch(data []byte) ([]batchOp, error) {
+	var ops []batchOp
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		var list [][]string
+		if err := json.Unmarshal(trimmed, &list); err != nil {
+			return nil, fmt.Errorf("invalid JSON batch: %v", err)
+		}
+		for i, args := range list {
+			ops = append(ops, batchOp{Line: i + 1, Args: args})
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for line := 1; scanner.Scan(); line++ {
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" || strings.HasPrefix(text, "#") {
+				continue
+			}
+			args, err := splitWords(text)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", line, err)
+			}
+			ops = append(ops, batchOp{Line: line, Args: args})
+		}
+	}
+
+	for i, op := range ops {
+		if len(op.Args) > 0 && op.Args[0] == "ghs" {
+			op.Args = op.Args[1:]
+			ops[i] = op
+		}
+		if len(op.Args) == 0 {
+			return nil, fmt.Errorf("line %d: empty command", op.Line)
+		}
+		if !batchCommands[op.Args[0]] {
+			return nil, fmt.Errorf("line %d: %s can't run in a batch", op.Line, op.Args[0])
+		}
+		if op.Args[0] == "add" && hasFlag(op.Args[1:], "generate-key") {
+			return nil, fmt.Errorf("line %d: add --generate-key can't run in a batch, a rollback would leave the key behind; generate keys first", op.Line)
+		}
+	}
+	return ops, nil
+}
+
+// snapshotFile is a file as it was before a batch
+type snapshotFile struct {
+	Data []byte
+	Mode fs.FileMode
+}
+
+// batchSnapshot keeps the files a batch may change so a failed batch can be
+// rolled back: the config, the SSH config, the global git config and the
+// fragments and templates ghs writes. Missing files are restored by
+// removing them again.
+type batchSnapshot struct {
+	files map[string]*snapshotFile
+	dirs  []string
+	// subdirs are the directories below dirs that existed
+	subdirs map[string]bool
+}
+
+// globalGitConfigPaths returns the files git reads as the global config
+func globalGitConfigPaths() []string {
+	if path := os.Getenv("GIT_CONFIG_GLOBAL"); path != "" {
+		return []string{path}
+	}
+	home, _ := os.UserHomeDir()
+	xdg := os.Getenv("XDG_CONFIG_HOME")
+	if xdg == "" {
+		xdg = filepath.Join(home, ".config")
+	}
+	return []string{filepath.Join(home, ".gitconfig"), filepath.Join(xdg, "git", "config")}
+}
+
+func takeBatchSnapshot() (*batchSnapshot, error) {
+	s := &batchSnapshot{
+		files:   map[string]*snapshotFile{},
+		dirs:    []string{fragmentsDir(), filepath.Join(stateDir, "templates")},
+		subdirs: map[string]bool{},
+	}
+	paths := append([]string{storedConfigPath(), sshConfigPath}, globalGitConfigPaths()...)
+	for _, dir := range s.dirs {
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			switch {
+			case err != nil:
+			case d.IsDir():
+				s.subdirs[path] = true
+			case d.Type().IsRegular():
+				paths = append(paths, path)
+			}
+			return nil
+		})
+	}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			s.files[path] = nil
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		s.files[path] = &snapshotFile{Data: data, Mode: info.Mode().Perm()}
+	}
+	return s, nil
+}
+
+// restore puts every file back and removes the files and directories the
+// batch created
+func (s *batchSnapshot) restore() error {
+	for _, dir := range s.dirs {
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if _, known := s.files[path]; err != nil || known || s.subdirs[path] {
+				return nil
+			}
+			os.RemoveAll(path)
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		})
+	}
+	var failed []string
+	for path, file := range s.files {
+		var err error
+		if file == nil {
+			if err = os.Remove(path); os.IsNotExist(err) {
+				err = nil
+			}
+		} else if err = mkdirPrivate(filepath.Dir(path)); err == nil {
+			if err = os.WriteFile(path, file.Data, file.Mode); err == nil {
+				err = os.Chmod(path, file.Mode)
+			}
+		}
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", path, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to restore %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// runBatch handles "batch <file>": it runs every operation of the file as a
+// non-interactive ghs command and, when one fails, rolls all of them back
+func runBatch(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: ghs batch <file|->")
+	}
+	var data []byte
+	var err error
+	if args[0] == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(expandPath(args[0]))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read batch: %v", err)
+	}
+	ops, err := parseBatch(data)
+	if err != nil {
+		return err
+	}
+	if len(ops) == 0 {
+		return fmt.Errorf("the batch has no operations")
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	snapshot, err := takeBatchSnapshot()
+	if err != nil {
+		return fmt.Errorf("failed to back up files before the batch: %v", err)
+	}
+	for i, op := range ops {
+		fmt.Printf("==> [%d/%d] ghs %s\n", i+1, len(ops), strings.Join(op.Args, " "))
+		cmd := execForeground(self, append([]string{"--non-interactive"}, op.Args...)...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			logger.Warn("batch rolled back", "line", op.Line, "error", err.Error())
+			if restoreErr := snapshot.restore(); restoreErr != nil {
+				return fmt.Errorf("line %d failed (%v) and rolling back failed: %v", op.Line, err, restoreErr)
+			}
+			return fmt.Errorf("line %d failed (%v); all changes of the batch were rolled back", op.Line, err)
+		}
+	}
+	fmt.Printf("Batch complete: %d operation(s)\n", len(ops))
+	return nil
+}
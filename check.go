@@ -0,0 +1,271 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// checkSkip marks a "ghs check" step that doesn't apply to an account
+const checkSkip = "skip"
+
+// signingExpiryWarning is how long before its expiry a signing key is
+// reported
+const signingExpiryWarning = 14 * 24 * time.Hour
+
+// checkStep is the outcome of one step of "ghs check" for an account
+type checkStep struct {
+	Name    string
+	Status  string // doctorOK, doctorWarn, doctorFail or checkSkip
+	Message string
+	// Expiring names the credential that expires at Expires, if any
+	Expiring string
+	Expires  time.Time
+}
+
+// accountCheck holds the steps checked for one account
+type accountCheck struct {
+	Alias string
+	Steps []checkStep
+}
+
+// broken reports whether a step of the account failed
+func (c accountCheck) broken() bool {
+	for _, step := range c.Steps {
+		if step.Status == doctorFail {
+			return true
+		}
+	}
+	return false
+}
+
+// checkKeyLoads checks that the account's key exists, is a key ssh can
+// load and matches its public half
+func checkKeyLoads(account GitHubAccount) checkStep {
+	step := checkStep{Name: "key"}
+	switch {
+	case httpsOnly:
+		step.Status, step.Message = checkSkip, "the transport is https"
+		return step
+	case account.SSHKeyPath == "" && account.hardwareKey():
+		step.Status, step.Message = checkSkip, "on a hardware token"
+		return step
+	case account.SSHKeyPath == "":
+		step.Status, step.Message = doctorFail, "no ssh key configured"
+		return step
+	}
+	if _, err := os.Stat(account.SSHKeyPath); err != nil {
+		step.Status, step.Message = doctorFail, account.SSHKeyPath+" not found"
+		return step
+	}
+	keyType, fingerprint, err := keyFingerprint(account.SSHKeyPath)
+	if err != nil {
+		step.Status, step.Message = doctorFail, err.Error()
+		return step
+	}
+	step.Status, step.Message = doctorOK, keyType+" "+fingerprint
+	// Certificates renewed by a command expire by design
+	if account.SSHCertificate != "" && account.SSHCertificateCommand == "" {
+		if _, to, err := certValidity(account.SSHCertificate); err == nil && !to.IsZero() {
+			step.Message += ", certificate valid until " + to.Format("2006-01-02")
+			step.Expiring, step.Expires = "SSH certificate", to
+		}
+	}
+	if account.hardwareKey() {
+		return step
+	}
+
+	// An empty passphrase derives the public key of unprotected keys;
+	// protected ones fail asking for the passphrase, which still means the
+	// key loads
+	out, err := execCommand("ssh-keygen", "-y", "-P", "", "-f", account.SSHKeyPath).CombinedOutput()
+	output := strings.TrimSpace(string(out))
+	switch {
+	case err != nil && strings.Contains(output, "passphrase"):
+		step.Message += ", passphrase protected"
+	case err != nil:
+		step.Status, step.Message = doctorFail, fmt.Sprintf("%s doesn't load: %s", account.SSHKeyPath, output)
+	default:
+		if public, err := publicKeyOf(account); err == nil && !strings.HasPrefix(output, public) {
+			step.Status, step.Message = doctorFail, account.SSHKeyPath+".pub doesn't match the private key"
+		}
+	}
+	return step
+}
+
+// checkSSHAuth checks that GitHub greets the account's username over ssh
+func checkSSHAuth(alias string, account GitHubAccount, key checkStep) checkStep {
+	step := checkStep{Name: "ssh"}
+	switch {
+	case httpsOnly:
+		step.Status, step.Message = checkSkip, "the transport is https"
+	case key.Status == doctorFail:
+		step.Status, step.Message = checkSkip, "the key doesn't load"
+	default:
+		result := testSSH(alias, account)
+		step.Status, step.Message = doctorOK, result.Msg
+		if !result.OK {
+			step.Status = doctorFail
+		}
+	}
+	return step
+}
+
+// checkSigningKey checks that the account's signing key resolves and
+// hasn't expired
+func checkSigningKey(account GitHubAccount) checkStep {
+	step := checkStep{Name: "signing"}
+	_, key, err := signingEdits(account)
+	switch {
+	case err != nil:
+		step.Status, step.Message = doctorFail, err.Error()
+		return step
+	case key == "":
+		step.Status, step.Message = checkSkip, "signing is off"
+		return step
+	}
+	switch account.Signing {
+	case signingX509:
+		step.Status, step.Message = doctorOK, "x509 certificate "+key
+		return step
+	case signingNone:
+		step.Status, step.Message = doctorOK, "gpg key "+key+" for tags"
+	default:
+		step.Status, step.Message = doctorOK, "gpg key "+key
+	}
+	// findGPGKey skips expired keys, so only the coming expiry is left
+	if gpg, err := findGPGKey(account.Email); err == nil && !gpg.Expires.IsZero() {
+		step.Message += ", expires " + gpg.Expires.Format("2006-01-02")
+		step.Expiring, step.Expires = "signing key", gpg.Expires
+		if time.Until(gpg.Expires) < signingExpiryWarning {
+			step.Status = doctorWarn
+		}
+	}
+	return step
+}
+
+// checkAccountToken checks that the account's token, if it has one, is
+// valid, belongs to the account and has the scopes ghs needs
+func checkAccountToken(account GitHubAccount) checkStep {
+	step := checkStep{Name: "token"}
+	token, source, err := tokenFor(account, "", "")
+	if err != nil {
+		step.Status, step.Message = doctorFail, err.Error()
+		if len(account.Tokens) == 0 && account.App == nil {
+			step.Status, step.Message = checkSkip, "no token"
+		}
+		return step
+	}
+	info, err := inspectToken(token)
+	switch {
+	case errors.Is(err, errOffline):
+		step.Status, step.Message = doctorWarn, fmt.Sprintf("token from %s not checked: %v", source, err)
+		return step
+	case err != nil:
+		step.Status, step.Message = doctorFail, fmt.Sprintf("token from %s: %v", source, err)
+		return step
+	case !strings.EqualFold(info.Login, account.Username):
+		step.Status, step.Message = doctorFail, fmt.Sprintf("token from %s belongs to %s", source, info.Login)
+		return step
+	case !info.Classic:
+		step.Status, step.Message = doctorOK, fmt.Sprintf("fine-grained token from %s, its permissions aren't reported", source)
+		return withTokenExpiry(step, info)
+	}
+	var missing []string
+	for _, feature := range tokenFeatures {
+		granted := false
+		for _, scope := range feature.Scopes {
+			granted = granted || hasScope(info.Scopes, scope)
+		}
+		if !granted && !containsFold(missing, feature.Scopes[0]) {
+			missing = append(missing, feature.Scopes[0])
+		}
+	}
+	step.Status, step.Message = doctorOK, "token from "+source
+	if len(missing) > 0 {
+		step.Status, step.Message = doctorFail, fmt.Sprintf("token from %s lacks %s (see ghs token check)", source, strings.Join(missing, ", "))
+	}
+	return withTokenExpiry(step, info)
+}
+
+// withTokenExpiry adds the expiry of a valid token to its step
+func withTokenExpiry(step checkStep, info tokenInfo) checkStep {
+	if !info.Expires.IsZero() {
+		step.Message += ", expires " + info.Expires.Format("2006-01-02")
+		step.Expiring, step.Expires = "token", info.Expires
+	}
+	return step
+}
+
+// checkAccount runs every step of "ghs check" for one account
+func checkAccount(alias string, account GitHubAccount) accountCheck {
+	key := checkKeyLoads(account)
+	return accountCheck{Alias: alias, Steps: []checkStep{
+		key,
+		checkSSHAuth(alias, account, key),
+		checkSigningKey(account),
+		checkAccountToken(account),
+	}}
+}
+
+// runCheck handles "check [alias...] [--jobs n]": it validates every
+// account end to end and fails when one of them is broken, for dotfile CI
+func runCheck(config Config, args []string) error {
+	flags := flag.NewFlagSet("check", flag.ContinueOnError)
+	jobs := flags.Int("jobs", defaultJobs(), "number of accounts checked in parallel")
+	var tags stringList
+	flags.Var(&tags, "tag", "check the accounts with this tag (repeatable)")
+	aliases, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	accounts := config.resolvedAccounts()
+	switch {
+	case len(tags) > 0 && len(aliases) > 0:
+		return fmt.Errorf("usage: ghs check [alias...] | --tag <tag>... [--jobs n]")
+	case len(tags) > 0:
+		if aliases = accountsWithTags(config, tags); len(aliases) == 0 {
+			return fmt.Errorf("no accounts tagged %s", strings.Join(tags, ", "))
+		}
+	case len(aliases) == 0:
+		aliases = sortedAliases(accounts)
+	}
+	if aliases, err = config.lookupAliases(aliases); err != nil {
+		return err
+	}
+	if len(aliases) == 0 {
+		fmt.Println("No accounts configured yet.")
+		return nil
+	}
+
+	results := make([]accountCheck, len(aliases))
+	bar := newProgress("Checking accounts", len(aliases))
+	forEachParallel(len(aliases), *jobs, func(i int) {
+		results[i] = checkAccount(aliases[i], accounts[aliases[i]])
+		bar.step()
+	})
+	bar.finish()
+
+	if err := recordHealth(results); err != nil {
+		warnf("failed to record the results: %v", err)
+	}
+
+	broken := 0
+	for _, result := range results {
+		fmt.Printf("Account '%s'\n", result.Alias)
+		for _, step := range result.Steps {
+			fmt.Printf("  %-5s %-8s %s\n", step.Status, step.Name, step.Message)
+		}
+		if result.broken() {
+			broken++
+		}
+	}
+	if broken > 0 {
+		return fmt.Errorf("%d of %d account(s) broken", broken, len(results))
+	}
+	fmt.Printf("All %d account(s) work\n", len(results))
+	return nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Environment variables read by ci-setup, usually filled from CI secrets
+const (
+	envCIName     = "GHS_CI_NAME"
+	envCIEmail    = "GHS_CI_EMAIL"
+	envCIUsername = "GHS_CI_USERNAME"
+	envCISSHKey   = "GHS_CI_SSH_KEY"
+	envCIToken    = "GHS_CI_TOKEN"
+)
+
+// ciDirName is the directory below the workspace holding the job's key and
+// SSH config
+const ciDirName = ".ghs-ci"
+
+// ciWorkspace returns the directory of the CI job: the runner's temporary
+// directory or the project checkout, otherwise the current directory
+func ciWorkspace() string {
+	for _, name := range []string{"RUNNER_TEMP", "CI_PROJECT_DIR", "WORKSPACE", "GITHUB_WORKSPACE"} {
+		if dir := os.Getenv(name); dir != "" {
+			return dir
+		}
+	}
+	dir, _ := os.Getwd()
+	return dir
+}
+
+// decodeCIKey accepts a private key as is or base64 encoded, since most CI
+// systems can't store multi-line secrets
+func decodeCIKey(value string) ([]byte, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "-----BEGIN") {
+		return []byte(value + "\n"), nil
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(value), ""))
+	if err != nil {
+		return nil, fmt.Errorf("%s is neither a private key nor base64: %v", envCISSHKey, err)
+	}
+	if !strings.HasPrefix(string(key), "-----BEGIN") {
+		return nil, fmt.Errorf("%s doesn't decode to a private key", envCISSHKey)
+	}
+	if !strings.HasSuffix(string(key), "\n") {
+		key = append(key, '\n')
+	}
+	return key, nil
+}
+
+// ciSetup handles "ci-setup": it configures git inside a CI job from
+// environment variables. The key and SSH config are written below the
+// workspace; the token is never written, git reads it from the environment.
+func ciSetup(args []string) error {
+	flags := flag.NewFlagSet("ci-setup", flag.ContinueOnError)
+	dir := flags.String("dir", "", "workspace directory (default $RUNNER_TEMP, $CI_PROJECT_DIR, $WORKSPACE or the current directory)")
+	local := flags.Bool("local", false, "configure the current repository instead of the global git config")
+	cleanup := flags.Bool("cleanup", false, "remove the key and SSH config written by an earlier run")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return fmt.Errorf("usage: ghs ci-setup [--dir <workspace>] [--local] [--cleanup]")
+	}
+	if *dir == "" {
+		*dir = ciWorkspace()
+	}
+	ciDir := filepath.Join(expandPath(*dir), ciDirName)
+	scope := "--global"
+	if *local {
+		scope = "--local"
+	}
+	set := func(key, value string) error {
+		if err := execCommand("git", "config", scope, key, value).Run(); err != nil {
+			return fmt.Errorf("failed to set git %s: %v", key, err)
+		}
+		return nil
+	}
+
+	if *cleanup {
+		for _, key := range []string{"core.sshCommand", "credential.https://github.com.helper"} {
+			execCommand("git", "config", scope, "--unset-all", key).Run()
+		}
+		if err := os.RemoveAll(ciDir); err != nil {
+			return err
+		}
+		fmt.Printf("Removed %s\n", ciDir)
+		return nil
+	}
+
+	name, email := os.Getenv(envCIName), os.Getenv(envCIEmail)
+	keyValue, token := os.Getenv(envCISSHKey), os.Getenv(envCIToken)
+	if keyValue == "" && token == "" {
+		return fmt.Errorf("set %s or %s", envCISSHKey, envCIToken)
+	}
+	if name != "" {
+		if err := set("user.name", name); err != nil {
+			return err
+		}
+	}
+	if email != "" {
+		if err := set("user.email", email); err != nil {
+			return err
+		}
+	}
+
+	if keyValue != "" {
+		key, err := decodeCIKey(keyValue)
+		if err != nil {
+			return err
+		}
+		if err := mkdirPrivate(ciDir); err != nil {
+			return err
+		}
+		keyPath := filepath.Join(ciDir, "id_key")
+		if err := writePrivateFile(keyPath, key); err != nil {
+			return err
+		}
+		sshConfig := fmt.Sprintf("Host github.com\n    HostName github.com\n    User git\n    IdentityFile %s\n    IdentitiesOnly yes\n    StrictHostKeyChecking accept-new\n    UserKnownHostsFile %s\n",
+			keyPath, filepath.Join(ciDir, "known_hosts"))
+		configPath := filepath.Join(ciDir, "ssh_config")
+		if err := writePrivateFile(configPath, []byte(sshConfig)); err != nil {
+			return err
+		}
+		if err := set("core.sshCommand", "ssh -F "+shellQuote(configPath)); err != nil {
+			return err
+		}
+		fmt.Printf("SSH key written to %s\n", keyPath)
+	}
+
+	if token != "" {
+		username := os.Getenv(envCIUsername)
+		if username == "" {
+			username = appTokenUser
+		}
+		// The helper reads the token when git asks, so it never lands in a file
+		helper := fmt.Sprintf("!f() { test \"$1\" = get && echo username=%s && echo \"password=$%s\"; }; f", username, envCIToken)
+		execCommand("git", "config", scope, "--unset-all", "credential.https://github.com.helper").Run()
+		if err := set("credential.https://github.com.helper", ""); err != nil {
+			return err
+		}
+		if err := execCommand("git", "config", scope, "--add", "credential.https://github.com.helper", helper).Run(); err != nil {
+			return fmt.Errorf("failed to set git credential helper: %v", err)
+		}
+		fmt.Printf("HTTPS access to github.com uses $%s\n", envCIToken)
+	}
+
+	fmt.Printf("Git configured for CI (%s)\n", strings.TrimPrefix(scope, "--"))
+	return nil
+}
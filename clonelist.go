@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// cloneJob is one repository of a clone list
+type cloneJob struct {
+	URL     string
+	Owner   string
+	Repo    string
+	Alias   string
+	Dir     string
+	Skipped bool
+	Err     error
+}
+
+// readCloneList reads a clone list: one "<url> [directory]" per line, where
+// owner/repo is short for the github.com URL. Blank lines and # comments are
+// ignored. Lines that don't parse become failed jobs.
+func readCloneList(path string) ([]cloneJob, error) {
+	f, err := os.Open(expandPath(path))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var jobs []cloneJob
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		job := cloneJob{URL: fields[0]}
+		if !strings.Contains(job.URL, ":") && strings.Count(job.URL, "/") == 1 {
+			job.URL = "https://github.com/" + job.URL + ".git"
+		}
+		switch {
+		case len(fields) > 2:
+			job.Err = fmt.Errorf("line %d: expected <url> [directory]", line)
+		case len(fields) == 2:
+			job.Dir = fields[1]
+		}
+		if job.Err == nil {
+			if job.Owner, job.Repo, err = extractRepoInfo(job.URL); err != nil {
+				job.Err = fmt.Errorf("line %d: %v", line, err)
+			}
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, scanner.Err()
+}
+
+// cloneConfigArgs returns the git clone -c options that give a new clone the
+// account's identity, signing and git settings, like switch would
+func cloneConfigArgs(account GitHubAccount) ([]string, error) {
+	edits := []configEdit{
+		{key: "user.name", value: account.Name},
+		{key: "user.email", value: account.Email},
+	}
+	signing, _, err := signingEdits(account)
+	edits = append(edits, signing...)
+	settings := account.gitSettings()
+	for _, key := range sortedKeys(settings) {
+		edits = append(edits, configEdit{key: key, value: settings[key]})
+	}
+	var args []string
+	for _, e := range edits {
+		// A new clone has nothing to unset
+		if !e.unset {
+			args = append(args, "-c", e.key+"="+e.value)
+		}
+	}
+	return args, err
+}
+
+// cloneInBackground runs one clone of a clone list with its output
+// collected. Nobody can answer a prompt, so git and ssh fail instead of
+// asking for a password or passphrase.
+func cloneInBackground(config Config, job cloneJob, options []string, mode string) error {
+	args := append([]string{"clone"}, options...)
+	if mode != "" {
+		args = append(args, "--"+mode)
+	}
+	url := job.URL
+	account, _ := config.account(job.Alias)
+	if job.Alias != "" {
+		url = remoteURL(account, job.Owner, job.Repo)
+		if mode == cloneBare {
+			args = append(args, "-c", "remote.origin.fetch=+refs/heads/*:refs/heads/*")
+		}
+	}
+	args = append(args, url, job.Dir)
+
+	for attempt := 1; ; attempt++ {
+		cmd := execBackground("git", args...)
+		cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+		if os.Getenv("GIT_SSH_COMMAND") == "" {
+			cmd.Env = append(cmd.Env, "GIT_SSH_COMMAND=ssh -o BatchMode=yes")
+		}
+		out, err := cmd.CombinedOutput()
+		if err == nil {
+			break
+		}
+		if !transientGitError.Match(out) || !waitForRetry("git clone "+job.Owner+"/"+job.Repo, attempt, err) {
+			return fmt.Errorf("%s", errorLine(string(out), err))
+		}
+	}
+
+	if account.LFS != nil {
+		if err := execCommand("git", "-C", job.Dir, "lfs", "install", "--local").Run(); err != nil {
+			return fmt.Errorf("cloned, but failed to install Git LFS hooks: %v", err)
+		}
+	}
+	return nil
+}
+
+// errorLine returns the first line of git's output that isn't progress,
+// usually the one naming the problem, or the error when there is none
+func errorLine(output string, err error) string {
+	for _, line := range strings.Split(output, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "Cloning into") {
+			return line
+		}
+	}
+	return err.Error()
+}
+
+// cloneFromFile handles "clone --from-file": it clones every repository of
+// the list into dest, jobs at a time, each with the account its owner
+// resolves to, and reports the result of every repository
+func cloneFromFile(config Config, path, dest string, jobs int, alias, mode string) error {
+	list, err := readCloneList(path)
+	if err != nil {
+		return fmt.Errorf("failed to read clone list: %v", err)
+	}
+	if len(list) == 0 {
+		return fmt.Errorf("no repositories in %s", path)
+	}
+	if dest == "" {
+		dest = "."
+	}
+	dest = expandPath(dest)
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %v", dest, err)
+	}
+
+	// Resolve accounts up front; the clone options are built once per
+	// account so a signing key is looked up only once
+	options := make(map[string][]string)
+	for i := range list {
+		job := &list[i]
+		if job.Err != nil {
+			continue
+		}
+		if job.Dir == "" {
+			job.Dir = job.Repo
+			if mode != "" {
+				job.Dir += ".git"
+			}
+		}
+		job.Dir = filepath.Join(dest, job.Dir)
+		if _, err := os.Stat(job.Dir); err == nil {
+			job.Skipped = true
+			continue
+		}
+		job.Alias = alias
+		if job.Alias == "" {
+			job.Alias = resolveOwner(config, job.Owner)
+		}
+		if job.Alias == "" {
+			continue
+		}
+		account, _ := config.account(job.Alias)
+		if keyMissing(account) {
+			job.Err = fmt.Errorf("SSH key not found for account '%s' at %s", job.Alias, account.SSHKeyPath)
+			continue
+		}
+		if _, done := options[job.Alias]; !done {
+			args, err := cloneConfigArgs(account)
+			if err != nil {
+				warnf("Failed to find signing key for account '%s': %v", job.Alias, err)
+			}
+			options[job.Alias] = args
+		}
+	}
+
+	bar := newProgress("Cloning repositories", len(list))
+	forEachParallel(len(list), jobs, func(i int) {
+		if job := &list[i]; job.Err == nil && !job.Skipped {
+			job.Err = cloneInBackground(config, *job, options[job.Alias], mode)
+		}
+		bar.step()
+	})
+	bar.finish()
+
+	cloned, skipped, failed := 0, 0, 0
+	for _, job := range list {
+		name := job.URL
+		if job.Repo != "" {
+			name = job.Owner + "/" + job.Repo
+		}
+		switch {
+		case job.Err != nil:
+			fmt.Printf("  failed   %s: %v\n", name, job.Err)
+			failed++
+		case job.Skipped:
+			fmt.Printf("  skipped  %s: %s already exists\n", name, job.Dir)
+			skipped++
+		case job.Alias != "":
+			fmt.Printf("  cloned   %s -> %s (%s)\n", name, job.Dir, job.Alias)
+			cloned++
+		default:
+			fmt.Printf("  cloned   %s -> %s (no matching account)\n", name, job.Dir)
+			cloned++
+		}
+	}
+	fmt.Printf("\nCloned %d of %d repositories into %s", cloned, len(list), dest)
+	if skipped > 0 {
+		fmt.Printf(", %d already present", skipped)
+	}
+	fmt.Println()
+	if failed > 0 {
+		fmt.Println("Run 'ghs clone <url>' for a failed repository to see git's full output and a suggested fix.")
+		return fmt.Errorf("%d repositories failed to clone", failed)
+	}
+	return nil
+}
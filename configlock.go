@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// configIdentityName is the keyring entry holding the age identity a locked
+// config is encrypted to
+const configIdentityName = "config-identity"
+
+// decryptedConfig keeps the plaintext of a locked config once decrypted, so
+// a passphrase is asked at most once per run
+var decryptedConfig []byte
+
+// unlockedIdentity keeps the age identity of a locked config once read from
+// the keyring or its passphrase-protected file, for the rest of the run
+var unlockedIdentity string
+
+// configFreeCommands never look at the config, so a locked one isn't
+// decrypted for them
+var configFreeCommands = map[string]bool{
+	"help": true, "lock": true, "unlock": true, "cache": true,
+	"install-git-alias": true, "ci-setup": true,
+}
+
+// needsConfig reports whether a command line has to read the config
+func needsConfig(args []string) bool {
+	if len(args) == 0 || configFreeCommands[args[0]] {
+		return false
+	}
+	// Unknown commands only get suggestions
+	for _, name := range commandNames {
+		if name == args[0] {
+			return true
+		}
+	}
+	return false
+}
+
+// lockedConfigPath returns where the encrypted config is kept
+func lockedConfigPath() string {
+	return configPath + ".age"
+}
+
+// lockedIdentityPath returns where a passphrase lock keeps the age identity
+// the config is encrypted to, itself encrypted with the passphrase
+func lockedIdentityPath() string {
+	return configPath + ".key.age"
+}
+
+// configLocked reports whether the config is stored encrypted
+func configLocked() bool {
+	if _, err := os.Stat(configPath); err == nil {
+		return false
+	}
+	_, err := os.Stat(lockedConfigPath())
+	return err == nil
+}
+
+// storedConfigPath returns the file holding the config, encrypted or not
+func storedConfigPath() string {
+	if configLocked() {
+		return lockedConfigPath()
+	}
+	return configPath
+}
+
+// passphraseLocked reports whether the locked config's identity is protected
+// by a passphrase rather than kept in the keyring
+func passphraseLocked() bool {
+	_, err := os.Stat(lockedIdentityPath())
+	return err == nil
+}
+
+// requireAge checks that the age tools are installed
+func requireAge() error {
+	for _, tool := range []string{"age", "age-keygen"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			return fmt.Errorf("%s not found; install age (https://age-encryption.org) to lock the config", tool)
+		}
+	}
+	return nil
+}
+
+// configIdentity returns the age identity of a locked config: from the
+// keyring, or decrypted from its file with the passphrase. It is asked for
+// once per run.
+func configIdentity() (string, error) {
+	if unlockedIdentity != "" {
+		return unlockedIdentity, nil
+	}
+	if passphraseLocked() {
+		// age asks for the passphrase on the terminal itself
+		cmd := execForeground("age", "--decrypt", lockedIdentityPath())
+		cmd.Stderr = os.Stderr
+		cmd.secretOutput = true
+		identity, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("failed to decrypt %s: %v", lockedIdentityPath(), err)
+		}
+		unlockedIdentity = string(identity)
+		return unlockedIdentity, nil
+	}
+	store, err := openSecretStore()
+	if err != nil {
+		return "", err
+	}
+	identity, err := store.Get(configIdentityName)
+	if err != nil {
+		return "", fmt.Errorf("the key of the locked config isn't in the %s: %v", store.Name(), err)
+	}
+	unlockedIdentity = identity
+	return identity, nil
+}
+
+// ageRecipient returns the public key of an age identity
+func ageRecipient(identity string) (string, error) {
+	cmd := execCommand("age-keygen", "-y")
+	cmd.Stdin = strings.NewReader(identity)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to read the config key: %v", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// readConfigFile returns the contents of the config file, decrypting a
+// locked one with its identity
+func readConfigFile() ([]byte, error) {
+	if !configLocked() {
+		return os.ReadFile(configPath)
+	}
+	if decryptedConfig != nil {
+		return decryptedConfig, nil
+	}
+	path := lockedConfigPath()
+	identity, err := configIdentity()
+	if err != nil {
+		return nil, err
+	}
+	cmd := execCommand("age", "--decrypt", "--identity", "-", path)
+	cmd.Stdin = strings.NewReader(identity)
+	cmd.secretOutput = true
+	data, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s: %v", path, err)
+	}
+	decryptedConfig = data
+	return data, nil
+}
+
+// encryptConfig writes data to the locked config, encrypted to the
+// recipient of its identity, so saving never asks for a passphrase
+func encryptConfig(data []byte) error {
+	path := lockedConfigPath()
+	tmp := path + ".tmp"
+	identity, err := configIdentity()
+	if err != nil {
+		return err
+	}
+	recipient, err := ageRecipient(identity)
+	if err != nil {
+		return err
+	}
+	cmd := execCommand("age", "--encrypt", "--recipient", recipient, "--output", tmp)
+	cmd.Stdin = bytes.NewReader(data)
+	if err := cmd.Run(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to encrypt the config: %v", err)
+	}
+	if err := os.Chmod(tmp, 0600); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	decryptedConfig = data
+	return nil
+}
+
+// writeConfigFile stores the config file, encrypted again when it is locked
+func writeConfigFile(data []byte) error {
+	if configLocked() {
+		return encryptConfig(data)
+	}
+	return writePrivateFile(configPath, data)
+}
+
+// lockIdentity encrypts a new identity with a passphrase asked on the
+// terminal
+func lockIdentity(identity []byte) error {
+	path := lockedIdentityPath()
+	cmd := execForeground("age", "--encrypt", "--passphrase", "--output", path)
+	cmd.Stdin = bytes.NewReader(identity)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(path)
+		return fmt.Errorf("failed to encrypt the config key: %v", err)
+	}
+	return os.Chmod(path, 0600)
+}
+
+// lockConfig handles "lock [--passphrase]": it encrypts the config file with
+// age to a new key, kept in the OS keyring so commands unlock it
+// transparently, or encrypted with a passphrase asked once per command that
+// reads the config
+func lockConfig(args []string) error {
+	flags := flag.NewFlagSet("lock", flag.ContinueOnError)
+	passphrase := flags.Bool("passphrase", false, "protect the key with a passphrase instead of the keyring")
+	if _, err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if configLocked() {
+		return fmt.Errorf("the config is already locked in %s", lockedConfigPath())
+	}
+	if err := requireAge(); err != nil {
+		return err
+	}
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	cmd := execCommand("age-keygen")
+	cmd.secretOutput = true
+	identity, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("failed to create a key: %v", err)
+	}
+	if *passphrase {
+		if err := lockIdentity(identity); err != nil {
+			return err
+		}
+	} else {
+		store, err := openSecretStore()
+		if err != nil {
+			return fmt.Errorf("%v; use --passphrase without a keyring", err)
+		}
+		if err := store.Set(configIdentityName, string(identity)); err != nil {
+			return fmt.Errorf("failed to store the key in the %s: %v", store.Name(), err)
+		}
+	}
+	unlockedIdentity = string(identity)
+	if err := encryptConfig(data); err != nil {
+		if *passphrase {
+			os.Remove(lockedIdentityPath())
+		}
+		return err
+	}
+	if err := os.Remove(configPath); err != nil {
+		return fmt.Errorf("encrypted the config but failed to remove %s: %v", configPath, err)
+	}
+	if *passphrase {
+		fmt.Printf("Locked the config in %s; commands that read it ask for the passphrase once\n", lockedConfigPath())
+	} else {
+		fmt.Printf("Locked the config in %s, its key is in the keyring\n", lockedConfigPath())
+	}
+	return nil
+}
+
+// unlockConfig handles "unlock": it decrypts the config file back to plain
+// JSON and removes the key from the keyring
+func unlockConfig(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("usage: ghs unlock")
+	}
+	if !configLocked() {
+		return fmt.Errorf("the config isn't locked")
+	}
+	passphrase := passphraseLocked()
+	data, err := readConfigFile()
+	if err != nil {
+		return err
+	}
+	if err := writePrivateFile(configPath, data); err != nil {
+		return fmt.Errorf("failed to write %s: %v", configPath, err)
+	}
+	if err := os.Remove(lockedConfigPath()); err != nil {
+		return fmt.Errorf("failed to remove %s: %v", lockedConfigPath(), err)
+	}
+	if passphrase {
+		if err := os.Remove(lockedIdentityPath()); err != nil {
+			warnf("failed to remove %s: %v", lockedIdentityPath(), err)
+		}
+	} else {
+		if store, err := openSecretStore(); err == nil {
+			if err := store.Delete(configIdentityName); err != nil {
+				warnf("failed to remove the config key from the %s: %v", store.Name(), err)
+			}
+		}
+	}
+	fmt.Printf("Unlocked the config to %s\n", configPath)
+	return nil
+}
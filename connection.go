@@ -0,0 +1,153 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// defaultControlPersist is how long an idle master connection stays open
+const defaultControlPersist = "10m"
+
+// connectionOptions are the ssh options the connection settings render,
+// which ssh_options can't set as well
+var connectionOptions = []string{"ControlMaster", "ControlPath", "ControlPersist", "AddKeysToAgent"}
+
+// ConnectionSettings configures connection reuse and the agent for an
+// account's Host block
+type ConnectionSettings struct {
+	// Multiplex reuses one master connection for consecutive git commands
+	Multiplex bool `json:"multiplex,omitempty"`
+	// ControlPersist keeps an idle master open: a duration such as 10m, or yes
+	ControlPersist string `json:"control_persist,omitempty"`
+	// AddKeysToAgent is yes, ask, confirm or a lifetime such as 1h
+	AddKeysToAgent string `json:"add_keys_to_agent,omitempty"`
+}
+
+// controlDir holds the master connection sockets. ssh expands %C to a hash
+// of the connection, which keeps the path below the socket length limit.
+func controlDir() string {
+	return filepath.Join(stateDir, "ssh")
+}
+
+// Multiplexed reports whether the Host block reuses connections. OpenSSH for
+// Windows can't, so the options are left out there.
+func (c *ConnectionSettings) Multiplexed() bool {
+	return c.Multiplex && runtime.GOOS != "windows"
+}
+
+// ControlPath is the socket of the master connection, for the template
+func (c *ConnectionSettings) ControlPath() string {
+	return filepath.Join(controlDir(), "%C")
+}
+
+// Persist is the ControlPersist value, for the template
+func (c *ConnectionSettings) Persist() string {
+	if c.ControlPersist == "" {
+		return defaultControlPersist
+	}
+	return c.ControlPersist
+}
+
+// validPersist reports whether value is a ssh time value or yes/no
+func validPersist(value string) bool {
+	if value == "yes" || value == "no" {
+		return true
+	}
+	// Seconds, or units such as 10m, 1h30m or 2d
+	return value != "" && value[0] >= '0' && value[0] <= '9' && strings.Trim(value, "0123456789smhdwSMHDW") == ""
+}
+
+// connectionProblems checks connection settings for malformed values
+func connectionProblems(c *ConnectionSettings, sshOptions map[string]string) []fieldProblem {
+	if c == nil {
+		return nil
+	}
+	var problems []fieldProblem
+	if c.ControlPersist != "" {
+		if !c.Multiplex {
+			problems = append(problems, fieldProblem{"connection.control_persist", "requires connection.multiplex"})
+		} else if !validPersist(c.ControlPersist) {
+			problems = append(problems, fieldProblem{"connection.control_persist", fmt.Sprintf("invalid time %q, expected e.g. 10m, 1h or yes", c.ControlPersist)})
+		}
+	}
+	switch c.AddKeysToAgent {
+	case "", "yes", "ask", "confirm", "no":
+	default:
+		if !validPersist(c.AddKeysToAgent) {
+			problems = append(problems, fieldProblem{"connection.add_keys_to_agent", fmt.Sprintf("invalid value %q, expected yes, ask, confirm or a lifetime such as 1h", c.AddKeysToAgent)})
+		}
+	}
+	for key := range sshOptions {
+		for _, option := range connectionOptions {
+			if strings.EqualFold(key, option) {
+				problems = append(problems, fieldProblem{joinField("ssh_options", key), "set through connection instead, both would end up in the Host block"})
+			}
+		}
+	}
+	return problems
+}
+
+// prepareControlDir creates the socket directory when an account multiplexes;
+// ssh doesn't create it and refuses to start without it
+func prepareControlDir(accounts map[string]GitHubAccount) error {
+	for _, account := range accounts {
+		if account.Connection != nil && account.Connection.Multiplexed() {
+			if err := mkdirPrivate(controlDir()); err != nil {
+				return fmt.Errorf("failed to create %s: %v", controlDir(), err)
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// closeMaster stops the master connection of an account, so the next
+// command connects again with the current key instead of reusing the old one
+func closeMaster(account GitHubAccount) {
+	if account.Connection == nil || !account.Connection.Multiplexed() {
+		return
+	}
+	// Fails when no master is running, which is fine
+	execCommand("ssh", "-O", "exit", "github.com-"+account.Username).Run()
+}
+
+// applyConnectionFlags updates the connection settings of an account from
+// edit flags
+func applyConnectionFlags(account GitHubAccount, flags *flag.FlagSet, multiplex bool, persist, addKeys string) (GitHubAccount, error) {
+	connection := ConnectionSettings{}
+	if account.Connection != nil {
+		connection = *account.Connection
+	}
+	changed := false
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "multiplex":
+			connection.Multiplex, changed = multiplex, true
+			if !multiplex {
+				connection.ControlPersist = ""
+			}
+		case "control-persist":
+			connection.ControlPersist, changed = persist, true
+		case "add-keys-to-agent":
+			connection.AddKeysToAgent, changed = addKeys, true
+		}
+	})
+	if !changed {
+		return account, nil
+	}
+	if problems := connectionProblems(&connection, nil); len(problems) > 0 {
+		return account, fmt.Errorf("%s: %s", problems[0].Field, problems[0].Msg)
+	}
+	if connection.Multiplex && runtime.GOOS == "windows" {
+		warnf("OpenSSH for Windows doesn't support connection multiplexing; the Host block leaves it out")
+	}
+	if connection == (ConnectionSettings{}) {
+		account.Connection = nil
+	} else {
+		account.Connection = &connection
+	}
+	return account, nil
+}
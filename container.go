@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+var (
+	// containerMode adapts ghs to minimal containers: no prompts, plain
+	// output, a writable state directory and no SSH config when ~/.ssh
+	// can't be used
+	containerMode bool
+	// plainOutput disables terminal control sequences such as the
+	// progress bar
+	plainOutput bool
+)
+
+// envEnabled reports whether a boolean environment variable is set
+func envEnabled(name string) bool {
+	value := os.Getenv(name)
+	return value != "" && value != "0" && value != "false"
+}
+
+// writableDir reports whether files can be created in dir, creating it if
+// needed
+func writableDir(dir string) bool {
+	if err := mkdirPrivate(dir); err != nil {
+		return false
+	}
+	f, err := os.CreateTemp(dir, ".ghs-write-test")
+	if err != nil {
+		return false
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return true
+}
+
+// enableContainerMode switches to container mode. The state directory
+// moves to a temporary directory when HOME is read-only, unless
+// GHS_STATE_DIR chose one.
+func enableContainerMode() {
+	containerMode = true
+	nonInteractive = true
+	plainOutput = true
+	if os.Getenv(envStateDir) == "" && !writableDir(stateDir) {
+		stateDir = filepath.Join(os.TempDir(), fmt.Sprintf("ghs-%d", os.Getuid()))
+	}
+}
+
+// sshConfigUsable reports whether the SSH config can be written. Outside
+// container mode a missing ~/.ssh is created as usual.
+func sshConfigUsable() bool {
+	if !containerMode {
+		return true
+	}
+	dir := filepath.Dir(sshConfigPath)
+	if _, err := os.Stat(dir); err != nil {
+		return false
+	}
+	return writableDir(dir)
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// daemonRequest is one line sent to the daemon socket
+type daemonRequest struct {
+	Op    string `json:"op"`
+	Dir   string `json:"dir,omitempty"`
+	Alias string `json:"alias,omitempty"`
+}
+
+// daemonAccount describes an account in daemon responses
+type daemonAccount struct {
+	Alias    string `json:"alias"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+// daemonResponse is the line the daemon answers with
+type daemonResponse struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+	// which: the identity git uses in the directory, where it comes from
+	// (repo, mapped or global) and the account the remote's owner resolves
+	// to, which differs from Alias when the repository uses the wrong one
+	Alias    string          `json:"alias,omitempty"`
+	Email    string          `json:"email,omitempty"`
+	Source   string          `json:"source,omitempty"`
+	Repo     string          `json:"repo,omitempty"`
+	Expected string          `json:"expected,omitempty"`
+	Accounts []daemonAccount `json:"accounts,omitempty"`
+	Output   string          `json:"output,omitempty"`
+}
+
+func defaultDaemonSocket() string {
+	return filepath.Join(stateDir, "ghs.sock")
+}
+
+// daemonState is the config the daemon answers from. It is reloaded when
+// the config file changes.
+type daemonState struct {
+	mu       sync.Mutex
+	config   Config
+	modified time.Time
+}
+
+func (s *daemonState) current() Config {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if info, err := os.Stat(storedConfigPath()); err == nil && !info.ModTime().Equal(s.modified) {
+		s.config, s.modified = loadConfig(), info.ModTime()
+		logger.Info("daemon reloaded config")
+	}
+	return s.config
+}
+
+// findGitDirs returns the worktree, git directory and shared git directory
+// of the repository containing dir by looking for .git, without running git
+func findGitDirs(dir string) (root, gitDir, commonDir string, found bool) {
+	for root = dir; ; root = filepath.Dir(root) {
+		dotGit := filepath.Join(root, ".git")
+		if info, err := os.Stat(dotGit); err == nil {
+			gitDir = dotGit
+			if !info.IsDir() {
+				// Worktrees and submodules point elsewhere with "gitdir: <path>"
+				data, err := os.ReadFile(dotGit)
+				if err != nil {
+					return "", "", "", false
+				}
+				gitDir = strings.TrimSpace(strings.TrimPrefix(string(data), "gitdir:"))
+				if !filepath.IsAbs(gitDir) {
+					gitDir = filepath.Join(root, gitDir)
+				}
+			}
+			commonDir = gitDir
+			if data, err := os.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+				if commonDir = strings.TrimSpace(string(data)); !filepath.IsAbs(commonDir) {
+					commonDir = filepath.Join(gitDir, commonDir)
+				}
+			}
+			return root, gitDir, filepath.Clean(commonDir), true
+		}
+		if filepath.Dir(root) == root {
+			return "", "", "", false
+		}
+	}
+}
+
+// gitConfigFileValue reads key from a git config file, empty when unset
+func gitConfigFileValue(path, key string) string {
+	f, err := readGitConfigFile(path)
+	if err != nil {
+		return ""
+	}
+	value, _, _ := f.get(key)
+	return value
+}
+
+// aliasForEmail finds the account committing with an email
+func aliasForEmail(config Config, email string) string {
+	for _, alias := range sortedAliases(config.Accounts) {
+		if email != "" && strings.EqualFold(config.Accounts[alias].Email, email) {
+			return alias
+		}
+	}
+	return ""
+}
+
+// whichAccount answers which identity applies in dir from the config files
+// alone, so it takes microseconds instead of a git process per call
+func whichAccount(config Config, dir string) daemonResponse {
+	resp := daemonResponse{OK: true}
+	root, gitDir, commonDir, inRepo := findGitDirs(dir)
+	if inRepo {
+		resp.Repo = root
+		for _, path := range []string{filepath.Join(gitDir, "config.worktree"), filepath.Join(commonDir, "config")} {
+			if email := gitConfigFileValue(path, "user.email"); email != "" {
+				resp.Email, resp.Source = email, "repo"
+				break
+			}
+		}
+		if owner, _, err := extractRepoInfo(gitConfigFileValue(filepath.Join(commonDir, "config"), "remote.origin.url")); err == nil {
+			resp.Expected = resolveOwner(config, owner)
+		}
+	}
+	if resp.Email == "" {
+		best := ""
+		for _, alias := range sortedAliases(config.Accounts) {
+			for _, mapped := range config.Accounts[alias].Directories {
+				if (dir == mapped || strings.HasPrefix(dir, mapped+"/")) && len(mapped) > len(best) {
+					best, resp.Email, resp.Source = mapped, config.Accounts[alias].Email, "mapped"
+				}
+			}
+		}
+	}
+	if resp.Email == "" {
+		for _, path := range globalGitConfigPaths() {
+			if email := gitConfigFileValue(path, "user.email"); email != "" {
+				resp.Email, resp.Source = email, "global"
+				break
+			}
+		}
+	}
+	resp.Alias = aliasForEmail(config, resp.Email)
+	return resp
+}
+
+// handleDaemonRequest answers one request
+func handleDaemonRequest(state *daemonState, req daemonRequest) daemonResponse {
+	config := state.current()
+	switch req.Op {
+	case "ping":
+		return daemonResponse{OK: true}
+	case "list":
+		resp := daemonResponse{OK: true}
+		for _, alias := range sortedAliases(config.Accounts) {
+			account := config.Accounts[alias]
+			resp.Accounts = append(resp.Accounts, daemonAccount{alias, account.Username, account.Email})
+		}
+		return resp
+	case "which":
+		if !filepath.IsAbs(req.Dir) {
+			return daemonResponse{Error: "which needs an absolute dir"}
+		}
+		return whichAccount(config, filepath.Clean(req.Dir))
+	case "switch":
+		if !filepath.IsAbs(req.Dir) || req.Alias == "" {
+			return daemonResponse{Error: "switch needs an absolute dir and an alias"}
+		}
+		// Switching is rare; it runs the command itself
+		self, err := os.Executable()
+		if err != nil {
+			return daemonResponse{Error: err.Error()}
+		}
+		out, err := execCommand(self, "--non-interactive", "-C", req.Dir, "switch", req.Alias).CombinedOutput()
+		if err != nil {
+			return daemonResponse{Error: strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(string(out)), "Error: ")), Output: string(out)}
+		}
+		return daemonResponse{OK: true, Output: string(out)}
+	default:
+		return daemonResponse{Error: fmt.Sprintf("unknown op %q, expected ping, list, which or switch", req.Op)}
+	}
+}
+
+// serveDaemonConn answers the requests of one connection, one JSON object
+// per line in each direction
+func serveDaemonConn(state *daemonState, conn net.Conn) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	encoder := json.NewEncoder(conn)
+	for scanner.Scan() {
+		var req daemonRequest
+		resp := daemonResponse{Error: "invalid request"}
+		if err := json.Unmarshal(scanner.Bytes(), &req); err == nil {
+			resp = handleDaemonRequest(state, req)
+		}
+		logger.Debug("daemon request", "op", req.Op, "dir", req.Dir, "ok", resp.OK)
+		if err := encoder.Encode(resp); err != nil {
+			return
+		}
+	}
+}
+
+// runDaemon handles "daemon": it answers account queries of editors and
+// shell prompts on a unix socket only the user can open
+func runDaemon(config Config, args []string) error {
+	flags := flag.NewFlagSet("daemon", flag.ContinueOnError)
+	socket := flags.String("socket", defaultDaemonSocket(), "path of the unix socket")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return fmt.Errorf("usage: ghs daemon [--socket <path>]")
+	}
+	path := expandPath(*socket)
+	if err := mkdirPrivate(filepath.Dir(path)); err != nil {
+		return err
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return fmt.Errorf("a daemon is already listening on %s", path)
+	}
+	// A socket left behind by a daemon that was killed; anything else at the
+	// path is not ours to remove
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return fmt.Errorf("%s exists and is not a socket; choose another --socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	listener, err := listenPrivate(path)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", path, err)
+	}
+	defer listener.Close()
+
+	state := &daemonState{config: config}
+	if info, err := os.Stat(storedConfigPath()); err == nil {
+		state.modified = info.ModTime()
+	}
+	fmt.Printf("Listening on %s\n", path)
+	logger.Info("daemon started", "socket", path)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go serveDaemonConn(state, conn)
+	}
+}
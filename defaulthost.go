@@ -0,0 +1,171 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// defaultHost is the host of plain git@github.com URLs
+const defaultHost = "github.com"
+
+// defaultHostNone makes plain github.com URLs offer no key at all
+const defaultHostNone = "none"
+
+// sshDefaultHostNone is the block written for "default_host": "none"
+const sshDefaultHostNone = sshAccountMarker + ` none for plain github.com URLs
+Host github.com
+    HostName github.com
+    User git
+    IdentitiesOnly yes
+    PubkeyAuthentication no
+
+`
+
+// defaultHostProblem checks the config's default_host
+func defaultHostProblem(config Config) string {
+	if config.DefaultHost == "" || config.DefaultHost == defaultHostNone {
+		return ""
+	}
+	if _, ok := config.namedAlias(config.DefaultHost); !ok {
+		return fmt.Sprintf("account '%s' not found (use an alias or none)", config.DefaultHost)
+	}
+	return ""
+}
+
+// defaultHostBlock renders the managed Host github.com block: the chosen
+// account's key only, or no key when the choice is none
+func defaultHostBlock(config Config, accounts map[string]GitHubAccount, tmpl *template.Template) (string, error) {
+	if config.DefaultHost == defaultHostNone {
+		return sshDefaultHostNone, nil
+	}
+	name, ok := config.namedAlias(config.DefaultHost)
+	if !ok {
+		return "", fmt.Errorf("account '%s' not found", config.DefaultHost)
+	}
+	account := accounts[name]
+	if keyMissing(account) {
+		return "", fmt.Errorf("SSH key not found for account '%s' at %s", config.DefaultHost, account.SSHKeyPath)
+	}
+	block, err := executeSSHTemplate(tmpl, account)
+	if err != nil {
+		return "", err
+	}
+	alias := "github.com-" + account.Username
+	block = strings.Replace(block, sshAccountMarker+" "+account.Username+"\nHost "+alias+"\n",
+		fmt.Sprintf("%s %s for plain github.com URLs\nHost %s\n", sshAccountMarker, account.Username, defaultHost), 1)
+	return block, nil
+}
+
+// agentKeyCount returns how many keys the ssh-agent holds, -1 without an agent
+func agentKeyCount() int {
+	if os.Getenv("SSH_AUTH_SOCK") == "" {
+		return -1
+	}
+	out, err := execCommand("ssh-add", "-l").Output()
+	if err != nil {
+		// Exit status 1 with an agent means it has no keys
+		if strings.Contains(string(out), "no identities") {
+			return 0
+		}
+		return -1
+	}
+	return len(strings.Split(strings.TrimSpace(string(out)), "\n"))
+}
+
+// checkDefaultHost explains which key plain github.com URLs authenticate with.
+// Without IdentitiesOnly, ssh offers every agent key in turn and the first
+// one GitHub knows decides the account, whatever the repository.
+func checkDefaultHost(config Config) *doctorResult {
+	if httpsOnly || !sshConfigUsable() {
+		return nil
+	}
+	switch config.DefaultHost {
+	case defaultHostNone:
+		return &doctorResult{Status: doctorOK, Finding: "none", Message: "plain github.com URLs offer no key; use the account hosts (ghs remote convert)",
+			Data: map[string]string{"default_host": defaultHostNone}}
+	case "":
+	default:
+		return &doctorResult{Status: doctorOK, Finding: "account", Message: fmt.Sprintf("plain github.com URLs authenticate as account '%s' only", config.DefaultHost),
+			Hint: "repositories of other accounts need their account host, or they act as this account", Data: map[string]string{"default_host": config.DefaultHost}}
+	}
+
+	scanned, err := scanSSHConfig()
+	if err != nil {
+		return nil
+	}
+	if block, exists := scanned.hosts[defaultHost]; exists {
+		return &doctorResult{Status: doctorOK, Finding: "hand_written", Message: fmt.Sprintf("Host github.com is configured by hand at %s:%d", sshConfigPath, block.Line),
+			Hint: "make sure it sets IdentitiesOnly yes, or let ghs manage it with ghs sshconfig default-host", Data: map[string]string{"line": fmt.Sprint(block.Line)}}
+	}
+	keys := agentKeyCount()
+	if keys < 2 {
+		return nil
+	}
+	return &doctorResult{Status: doctorWarn, Finding: "agent_keys", Message: fmt.Sprintf("plain github.com URLs offer all %d agent keys; the first one GitHub knows picks the account", keys),
+		Hint: "ghs sshconfig default-host <alias> to use one account's key, or none to refuse plain URLs", Data: map[string]string{"agent_keys": fmt.Sprint(keys)}}
+}
+
+// setDefaultHost handles "sshconfig default-host <alias|none|off>": it
+// chooses the key plain github.com URLs use and rewrites the SSH config,
+// replacing a hand-written Host github.com block after confirmation
+func setDefaultHost(config Config, args []string) error {
+	flags := flag.NewFlagSet("sshconfig default-host", flag.ContinueOnError)
+	yes := flags.Bool("yes", false, "replace a hand-written Host github.com block without asking")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: ghs sshconfig default-host <alias|none|off> [--yes]")
+	}
+	choice := positional[0]
+	if choice == "off" {
+		choice = ""
+	}
+	if choice != "" && choice != defaultHostNone {
+		if choice, err = config.lookupAlias(choice); err != nil {
+			return fmt.Errorf("%v (use an alias or none)", err)
+		}
+	}
+	config.DefaultHost = choice
+
+	var adopt map[string]bool
+	scanned, err := scanSSHConfig()
+	if err != nil {
+		return fmt.Errorf("failed to read SSH config file: %v", err)
+	}
+	if block, exists := scanned.hosts[defaultHost]; exists && choice != "" {
+		if len(block.Patterns) > 1 {
+			return fmt.Errorf("the block at %s:%d is shared by Host %s; split it by hand first",
+				sshConfigPath, block.Line, strings.Join(block.Patterns, " "))
+		}
+		if !*yes {
+			ok, err := confirm(fmt.Sprintf("Replace your Host github.com block at %s:%d with the one ghs manages?", sshConfigPath, block.Line), false)
+			if err != nil {
+				return fmt.Errorf("%v (pass --yes)", err)
+			}
+			if !ok {
+				return fmt.Errorf("aborted")
+			}
+		}
+		adopt = map[string]bool{defaultHost: true}
+	}
+	if err := writeSSHConfig(config, adopt, sshEditsAsk); err != nil {
+		return err
+	}
+	if err := saveConfig(config); err != nil {
+		return err
+	}
+	switch choice {
+	case "":
+		fmt.Println("Host github.com is no longer managed by ghs")
+	case defaultHostNone:
+		fmt.Println("Plain github.com URLs now offer no key")
+	default:
+		fmt.Printf("Plain github.com URLs now use the key of account '%s' only\n", choice)
+	}
+	return nil
+}
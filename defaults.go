@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Signing modes
+const (
+	signingGPG  = "gpg"
+	signingNone = "none"
+	// signingX509 signs with an S/MIME certificate through gpgsm
+	signingX509 = "x509"
+)
+
+// Values of push_signing, see push.gpgSign
+var pushSigningModes = map[string]bool{"true": true, "if-asked": true}
+
+// Key types accepted for generated SSH keys
+var keyTypes = map[string]bool{"rsa": true, "ed25519": true, "ecdsa": true}
+
+// AccountDefaults holds values inherited by every account that doesn't set
+// them itself
+type AccountDefaults struct {
+	Name       string            `json:"name,omitempty"`
+	KeyType    string            `json:"key_type,omitempty"`
+	Signing    string            `json:"signing,omitempty"`
+	SSHOptions map[string]string `json:"ssh_options,omitempty"`
+	GitConfig  map[string]string `json:"git_config,omitempty"`
+	// KeyRotation is the rotation interval of every account's key
+	KeyRotation string `json:"key_rotation,omitempty"`
+}
+
+// mergeSettings overlays override onto base, returning a new map
+func mergeSettings(base, override map[string]string) map[string]string {
+	if len(base) == 0 {
+		return override
+	}
+	merged := make(map[string]string, len(base)+len(override))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range override {
+		merged[k] = v
+	}
+	return merged
+}
+
+// apply fills the unset fields of an account from the defaults. SSH options
+// and git config are merged, with the account's own values taking precedence.
+func (d *AccountDefaults) apply(account GitHubAccount) GitHubAccount {
+	if d == nil {
+		return account
+	}
+	if account.Name == "" {
+		account.Name = d.Name
+	}
+	if account.KeyType == "" {
+		account.KeyType = d.KeyType
+	}
+	if account.Signing == "" {
+		account.Signing = d.Signing
+	}
+	if account.KeyRotation == "" {
+		account.KeyRotation = d.KeyRotation
+	}
+	account.SSHOptions = mergeSettings(d.SSHOptions, account.SSHOptions)
+	account.GitConfig = mergeSettings(d.GitConfig, account.GitConfig)
+	return account
+}
+
+// inherit returns "" when name equals the default name, so the account keeps
+// following the defaults instead of storing a copy
+func (d *AccountDefaults) inherit(name string) string {
+	if d != nil && name == d.Name {
+		return ""
+	}
+	return name
+}
+
+// account returns the named account with defaults applied
+func (c Config) account(alias string) (GitHubAccount, bool) {
+	account, exists := c.Accounts[alias]
+	if !exists {
+		return account, false
+	}
+	return c.Defaults.apply(account), true
+}
+
+// resolvedAccounts returns every account with defaults applied
+func (c Config) resolvedAccounts() map[string]GitHubAccount {
+	accounts := make(map[string]GitHubAccount, len(c.Accounts))
+	for alias, account := range c.Accounts {
+		accounts[alias] = c.Defaults.apply(account)
+	}
+	return accounts
+}
+
+// sortedAliases returns the aliases of accounts in sorted order
+func sortedAliases(accounts map[string]GitHubAccount) []string {
+	aliases := make([]string, 0, len(accounts))
+	for alias := range accounts {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	return aliases
+}
+
+// managedGitConfig lists git config keys ghs sets itself on switch, which
+// can't be overridden through git_config
+var managedGitConfig = map[string]bool{
+	"user.name":        true,
+	"user.email":       true,
+	"user.signingkey":  true,
+	"commit.gpgsign":   true,
+	"gpg.format":       true,
+	"gpg.x509.program": true,
+	"tag.gpgsign":      true,
+	"push.gpgsign":     true,
+}
+
+var gitConfigKeyPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9-]*(\.[^\s=]+)?\.[A-Za-z][A-Za-z0-9-]*$`)
+
+// gitSettings returns every extra git config key applied on switch: the
+// account's git_config plus settings derived from its other options
+func (a GitHubAccount) gitSettings() map[string]string {
+	settings := map[string]string{}
+	for k, v := range a.GitConfig {
+		settings[k] = v
+	}
+	for k, v := range a.LFS.gitSettings() {
+		settings[k] = v
+	}
+	for k, v := range a.Init.gitSettings() {
+		settings[k] = v
+	}
+	if a.SignTags {
+		settings["tag.gpgSign"] = "true"
+	}
+	if a.PushSigning != "" {
+		settings["push.gpgSign"] = a.PushSigning
+	}
+	return settings
+}
+
+// sortedKeys returns the keys of a settings map in sorted order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// settingProblems checks the inheritable settings shared by accounts and defaults
+func settingProblems(keyType, signing string, sshOptions, gitConfig map[string]string) []fieldProblem {
+	var problems []fieldProblem
+	if keyType != "" && !keyTypes[keyType] {
+		problems = append(problems, fieldProblem{"key_type", fmt.Sprintf("unsupported key type %q (use rsa, ed25519 or ecdsa)", keyType)})
+	}
+	if signing != "" && signing != signingGPG && signing != signingX509 && signing != signingNone {
+		problems = append(problems, fieldProblem{"signing", fmt.Sprintf("unknown signing mode %q (use gpg, x509 or none)", signing)})
+	}
+	for _, key := range sortedKeys(sshOptions) {
+		if value := sshOptions[key]; key == "" || strings.ContainsAny(key, " \t\r\n=") || strings.ContainsAny(value, "\r\n") {
+			problems = append(problems, fieldProblem{joinField("ssh_options", key), "SSH option names can't contain spaces or '=' and values must be a single line"})
+		}
+	}
+	for _, key := range sortedKeys(gitConfig) {
+		value, field := gitConfig[key], joinField("git_config", key)
+		switch {
+		case !gitConfigKeyPattern.MatchString(key):
+			problems = append(problems, fieldProblem{field, fmt.Sprintf("invalid git config key %q, expected section.name such as core.editor", key)})
+		case managedGitConfig[strings.ToLower(key)]:
+			problems = append(problems, fieldProblem{field, fmt.Sprintf("%s is managed by ghs and can't be set here", key)})
+		case strings.ContainsAny(value, "\r\n"):
+			problems = append(problems, fieldProblem{field, "git config values must be a single line"})
+		}
+	}
+	return problems
+}
+
+// keygenArgs returns the ssh-keygen arguments selecting the key type
+func keygenArgs(keyType string) []string {
+	switch keyType {
+	case "ed25519":
+		return []string{"-t", "ed25519"}
+	case "ecdsa":
+		return []string{"-t", "ecdsa", "-b", "521"}
+	default:
+		return []string{"-t", "rsa", "-b", "4096"}
+	}
+}
+
+// foreignGitConfig returns the settings another account put into the
+// repository config that the given account doesn't set itself, so they can
+// be removed. Values that don't match what the other account would set are
+// left alone, since the user changed them by hand.
+func foreignGitConfig(config Config, alias string, account GitHubAccount, repo repoInfo) []string {
+	own := account.gitSettings()
+	seen := map[string]bool{}
+	var keys []string
+	for _, other := range sortedAliases(config.Accounts) {
+		if other == alias {
+			continue
+		}
+		otherAccount, _ := config.account(other)
+		settings := otherAccount.gitSettings()
+		for _, key := range sortedKeys(settings) {
+			if _, exists := own[key]; exists || seen[key] {
+				continue
+			}
+			if current, found := repoConfigValue(repo, key); found && current == settings[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// commandNames are the commands main dispatches, for suggestions
+var commandNames = []string{
+	"actions", "add", "alias", "app", "batch", "cache", "cert", "check", "ci-setup",
+	"clone", "config", "copy", "credential", "current", "daemon", "doctor", "edit",
+	"env", "exec", "export", "gpg", "help", "import", "init", "install-git-alias",
+	"list", "lock", "map", "merge", "migrate", "path-rule", "profile", "purge",
+	"remind", "remote", "resolve", "rotate-key", "rule", "scan", "serve", "sshconfig",
+	"stats", "status", "switch", "sync", "tag", "test", "token", "uninstall",
+	"unlock", "unmap", "verify", "watch", "which",
+}
+
+// maxSuggestions is how many close names are offered at most
+const maxSuggestions = 3
+
+// editDistance returns how many insertions, deletions, substitutions and
+// swaps of adjacent letters turn a into b, ignoring case
+func editDistance(a, b string) int {
+	s, t := []rune(strings.ToLower(a)), []rune(strings.ToLower(b))
+	// d[i][j] is the distance between the first i runes of s and j of t
+	d := make([][]int, len(s)+1)
+	for i := range d {
+		d[i] = make([]int, len(t)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(s)][len(t)]
+}
+
+// closestNames returns the names closest to a mistyped one that are close
+// enough to suggest: a few edits away, or starting with it
+func closestNames(typed string, names []string) []string {
+	// Short names allow fewer edits, or everything would be close
+	limit := 1
+	if len([]rune(typed)) > 4 {
+		limit = 2
+	}
+	var found []string
+	distances := map[string]int{}
+	for _, name := range names {
+		d := editDistance(typed, name)
+		if d > limit && len(typed) > 1 && strings.HasPrefix(strings.ToLower(name), strings.ToLower(typed)) {
+			d = limit
+		}
+		if _, seen := distances[name]; d <= limit && !seen {
+			distances[name] = d
+			found = append(found, name)
+		}
+	}
+	sort.Strings(found)
+	sort.SliceStable(found, func(i, j int) bool {
+		return distances[found[i]] < distances[found[j]]
+	})
+	// Only the closest are worth offering
+	for i := range found {
+		if distances[found[i]] > distances[found[0]] {
+			found = found[:i]
+			break
+		}
+	}
+	if len(found) > maxSuggestions {
+		found = found[:maxSuggestions]
+	}
+	return found
+}
+
+// didYouMean phrases suggestions for a mistyped name, "" without any
+func didYouMean(typed string, names []string) string {
+	found := closestNames(typed, names)
+	switch len(found) {
+	case 0:
+		return ""
+	case 1:
+		return fmt.Sprintf(", did you mean %s?", found[0])
+	}
+	return fmt.Sprintf(", did you mean %s or %s?", strings.Join(found[:len(found)-1], ", "), found[len(found)-1])
+}
+
+// unknownCommand explains an unknown command with the closest commands
+func unknownCommand(command string) error {
+	if suggestion := didYouMean(command, commandNames); suggestion != "" {
+		return fmt.Errorf("unknown command '%s'%s", command, suggestion)
+	}
+	return fmt.Errorf("unknown command '%s' (ghs help lists every command)", command)
+}
+
+// accountNames returns every name the accounts answer to
+func (c Config) accountNames() []string {
+	var names []string
+	for _, alias := range sortedAliases(c.Accounts) {
+		names = append(names, alias)
+		names = append(names, c.Accounts[alias].Aliases...)
+	}
+	return names
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Doctor check statuses
+const (
+	doctorOK   = "ok"
+	doctorWarn = "warn"
+	doctorFail = "fail"
+)
+
+// doctorResult is the outcome of one doctor check
+type doctorResult struct {
+	// Code identifies the finding as "<check id>.<finding>" and never
+	// changes, so tooling can aggregate results
+	Code    string `json:"code"`
+	Check   string `json:"check"`
+	Account string `json:"account,omitempty"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	// Hint tells how to fix a problem
+	Hint string `json:"hint,omitempty"`
+	// Data holds the facts behind the message, such as paths and dates
+	Data map[string]string `json:"data,omitempty"`
+
+	// Finding is set by the check; runDoctor turns it into Code
+	Finding string `json:"-"`
+}
+
+// doctorCheck is a check run once. It returns nil when it doesn't apply.
+type doctorCheck struct {
+	ID   string
+	Name string
+	Run  func(config Config) *doctorResult
+}
+
+// doctorAccountCheck is a check run for every account
+type doctorAccountCheck struct {
+	ID   string
+	Name string
+	Run  func(alias string, account GitHubAccount) *doctorResult
+}
+
+// Check IDs are part of the finding codes; don't rename them
+var doctorChecks = []doctorCheck{
+	{"git", "git", checkGit},
+	{"credential_manager", "credentials", checkCredentialManager},
+	{"secret_store", "keyring", checkSecretStore},
+	{"transport", "transport", checkTransport},
+	{"default_host", "github.com host", checkDefaultHost},
+	{"gpg_agent", "gpg agent", checkGPGAgent},
+}
+
+// sshAccountChecks are skipped in HTTPS mode
+var sshAccountChecks = map[string]bool{"ssh_key": true, "hardware_key": true, "ssh_certificate": true, "agent_keys": true, "key_rotation": true}
+
+var doctorAccountChecks = []doctorAccountCheck{
+	{"ssh_key", "ssh key", checkSSHKey},
+	{"hardware_key", "hardware key", checkHardwareKey},
+	{"ssh_certificate", "ssh certificate", checkSSHCertificate},
+	{"gpg_card", "gpg card", checkGPGCard},
+	{"gpg_cache", "gpg passphrase", checkGPGCache},
+	{"agent_keys", "agent keys", checkAgentKeys},
+	{"key_rotation", "key rotation", checkKeyRotation},
+}
+
+// errDoctorFailed reports failed checks after the JSON report, which
+// already explains them
+var errDoctorFailed = errors.New("checks failed")
+
+// doctorSeverity maps a status to the severity reported in JSON
+var doctorSeverity = map[string]string{doctorOK: "info", doctorWarn: "warning", doctorFail: "error"}
+
+// checkGit checks that git can be run
+func checkGit(config Config) *doctorResult {
+	out, err := execCommand("git", "--version").Output()
+	if err != nil {
+		return &doctorResult{Status: doctorFail, Finding: "not_found", Message: "git not found", Hint: "install git"}
+	}
+	version := strings.TrimSpace(string(out))
+	return &doctorResult{Status: doctorOK, Finding: "ok", Message: version, Data: map[string]string{"version": strings.TrimPrefix(version, "git version ")}}
+}
+
+// checkSSHKey checks that the key file of an account exists and is private.
+// Hardware token accounts only need the public key, if any.
+func checkSSHKey(alias string, account GitHubAccount) *doctorResult {
+	if account.hardwareKey() && account.SSHKeyPath == "" {
+		return nil
+	}
+	info, err := os.Stat(account.SSHKeyPath)
+	if err != nil {
+		return &doctorResult{Status: doctorFail, Finding: "not_found", Message: fmt.Sprintf("key %s not found", account.SSHKeyPath), Hint: "ghs edit " + alias + " --key <path>", Data: map[string]string{"path": account.SSHKeyPath}}
+	}
+	if info.Mode().Perm()&0077 != 0 && !account.hardwareKey() {
+		return &doctorResult{Status: doctorWarn, Finding: "permissions", Message: fmt.Sprintf("key %s is readable by others, ssh refuses it", account.SSHKeyPath), Hint: "chmod 600 " + account.SSHKeyPath,
+			Data: map[string]string{"path": account.SSHKeyPath, "mode": fmt.Sprintf("%04o", info.Mode().Perm())}}
+	}
+	return &doctorResult{Status: doctorOK, Finding: "ok", Message: account.SSHKeyPath, Data: map[string]string{"path": account.SSHKeyPath}}
+}
+
+// runDoctor runs every check, or only the account checks of one account
+func runDoctor(config Config, args []string) ([]doctorResult, error) {
+	if len(args) > 1 {
+		return nil, fmt.Errorf("usage: ghs doctor [alias] [--json]")
+	}
+	accounts := config.resolvedAccounts()
+	aliases := sortedAliases(accounts)
+	var results []doctorResult
+	if len(args) == 1 {
+		alias, err := config.lookupAlias(args[0])
+		if err != nil {
+			return nil, err
+		}
+		aliases = []string{alias}
+	} else {
+		for _, check := range doctorChecks {
+			if r := check.Run(config); r != nil {
+				r.Check, r.Code = check.Name, check.ID+"."+r.Finding
+				results = append(results, *r)
+			}
+		}
+	}
+	for _, alias := range aliases {
+		for _, check := range doctorAccountChecks {
+			if httpsOnly && sshAccountChecks[check.ID] {
+				continue
+			}
+			if r := check.Run(alias, accounts[alias]); r != nil {
+				r.Check, r.Account, r.Code = check.Name, alias, check.ID+"."+r.Finding
+				results = append(results, *r)
+			}
+		}
+	}
+	return results, nil
+}
+
+// doctorReport is the JSON output of "doctor --json"
+type doctorReport struct {
+	Version int                  `json:"version"`
+	Host    string               `json:"host"`
+	Time    time.Time            `json:"time"`
+	Results []doctorReportResult `json:"results"`
+	Summary map[string]int       `json:"summary"`
+}
+
+// doctorReportResult adds the severity to a result
+type doctorReportResult struct {
+	doctorResult
+	Severity string `json:"severity"`
+}
+
+// newDoctorReport collects the results with a summary
+func newDoctorReport(results []doctorResult) doctorReport {
+	host, _ := os.Hostname()
+	report := doctorReport{Version: 1, Host: host, Time: time.Now().UTC(), Results: []doctorReportResult{},
+		Summary: map[string]int{doctorOK: 0, doctorWarn: 0, doctorFail: 0}}
+	for _, r := range results {
+		report.Results = append(report.Results, doctorReportResult{r, doctorSeverity[r.Status]})
+		report.Summary[r.Status]++
+	}
+	return report
+}
+
+// printDoctorJSON writes the results as a doctorReport
+func printDoctorJSON(results []doctorResult) error {
+	data, err := json.MarshalIndent(newDoctorReport(results), "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// doctor handles "doctor [alias] [--json]": it prints the result of every
+// check and fails when one of them failed
+func doctor(config Config, args []string) error {
+	flags := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the results as JSON with stable finding codes")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	results, err := runDoctor(config, positional)
+	if err != nil {
+		return err
+	}
+	failed, warned := 0, 0
+	if *asJSON {
+		if err := printDoctorJSON(results); err != nil {
+			return err
+		}
+		for _, r := range results {
+			if r.Status == doctorFail {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return errDoctorFailed
+		}
+		return nil
+	}
+	group := "\x00"
+	for _, r := range results {
+		if r.Account != group {
+			group = r.Account
+			if group == "" {
+				fmt.Println("System")
+			} else {
+				fmt.Printf("Account '%s'\n", group)
+			}
+		}
+		fmt.Printf("  %-5s %-16s %s\n", r.Status, r.Check, r.Message)
+		if r.Hint != "" && r.Status != doctorOK {
+			fmt.Printf("  %-5s %-16s fix: %s\n", "", "", r.Hint)
+		}
+		switch r.Status {
+		case doctorFail:
+			failed++
+		case doctorWarn:
+			warned++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d check(s) failed, %d warning(s)", failed, warned)
+	}
+	if warned > 0 {
+		fmt.Printf("\nAll checks passed with %d warning(s).\n", warned)
+	} else {
+		fmt.Println("\nAll checks passed.")
+	}
+	return nil
+}
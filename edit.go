@@ -0,0 +1,327 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// accountAnswers converts an account into wizard answers
+func accountAnswers(alias string, account GitHubAccount) map[string]string {
+	return map[string]string{
+		"alias":    alias,
+		"username": account.Username,
+		"name":     account.Name,
+		"email":    account.Email,
+		"key":      account.SSHKeyPath,
+		"notes":    account.Notes,
+	}
+}
+
+// applyAnswers copies wizard answers onto an account
+func applyAnswers(account GitHubAccount, answers map[string]string, defaults *AccountDefaults) GitHubAccount {
+	account.Username = answers["username"]
+	account.Name = defaults.inherit(answers["name"])
+	account.Email = answers["email"]
+	account.SSHKeyPath = answers["key"]
+	account.Notes = answers["notes"]
+	if !filepath.IsAbs(account.SSHKeyPath) {
+		account.SSHKeyPath = expandKeyPath(account.SSHKeyPath)
+	}
+	return account
+}
+
+// applyGitConfigFlags applies key=value git config settings to an account;
+// an empty value removes the key
+func applyGitConfigFlags(account GitHubAccount, entries []string) (GitHubAccount, error) {
+	if len(entries) == 0 {
+		return account, nil
+	}
+	settings := make(map[string]string, len(account.GitConfig)+len(entries))
+	for k, v := range account.GitConfig {
+		settings[k] = v
+	}
+	for _, entry := range entries {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return account, fmt.Errorf("invalid --git-config %q, expected key=value", entry)
+		}
+		key := strings.TrimSpace(parts[0])
+		if parts[1] == "" {
+			delete(settings, key)
+			continue
+		}
+		if problems := settingProblems("", "", nil, map[string]string{key: parts[1]}); len(problems) > 0 {
+			return account, fmt.Errorf("%s", problems[0].Msg)
+		}
+		settings[key] = parts[1]
+	}
+	if len(settings) == 0 {
+		settings = nil
+	}
+	account.GitConfig = settings
+	return account, nil
+}
+
+// applyLFSFlags updates the LFS settings of an account from edit flags
+func applyLFSFlags(alias string, account GitHubAccount, flags *flag.FlagSet, lfsURL, helper string) (GitHubAccount, error) {
+	lfs := LFSSettings{}
+	if account.LFS != nil {
+		lfs = *account.LFS
+	}
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "lfs-url":
+			lfs.URL = lfsURL
+		case "lfs-credential-helper":
+			lfs.CredentialHelper = helper
+		}
+	})
+
+	if lfs.URL == "" && lfs.CredentialHelper == "" {
+		account.LFS = nil
+		return account, nil
+	}
+	if problems := lfsProblems(&lfs); len(problems) > 0 {
+		return account, fmt.Errorf("%s: %s", problems[0].Field, problems[0].Msg)
+	}
+	if err := requireGitLFS(alias); err != nil {
+		warnf("%v", err)
+	}
+	account.LFS = &lfs
+	return account, nil
+}
+
+// applyInitFlags updates the repository init defaults of an account
+func applyInitFlags(account GitHubAccount, flags *flag.FlagSet, branch, template string) (GitHubAccount, error) {
+	init := InitSettings{}
+	if account.Init != nil {
+		init = *account.Init
+	}
+	changed := false
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "default-branch":
+			init.DefaultBranch, changed = branch, true
+		case "commit-template":
+			init.CommitTemplate, changed = template, true
+		}
+	})
+	if !changed {
+		return account, nil
+	}
+
+	if init.CommitTemplate != "" && !filepath.IsAbs(init.CommitTemplate) {
+		init.CommitTemplate = expandPath(init.CommitTemplate)
+	}
+	if problems := initProblems(&init); len(problems) > 0 {
+		return account, fmt.Errorf("%s: %s", problems[0].Field, problems[0].Msg)
+	}
+	if init == (InitSettings{}) {
+		account.Init = nil
+	} else {
+		account.Init = &init
+	}
+	return account, nil
+}
+
+// editAnswers lets the user change answers: fields given as flags are applied
+// directly, otherwise every field is shown for review and editing
+func editAnswers(steps []wizardStep, answers map[string]string, fromFlags bool) error {
+	if fromFlags || nonInteractive {
+		return checkAnswers(steps, answers)
+	}
+	defer guardInterrupt()()
+	return reviewAnswers(steps, answers)
+}
+
+// editAccount updates an existing account
+func editAccount(config Config, args []string) (Config, error) {
+	flags := flag.NewFlagSet("edit", flag.ContinueOnError)
+	flags.String("username", "", "GitHub username")
+	flags.String("name", "", "your name")
+	flags.String("email", "", "your email")
+	flags.String("key", "", "SSH key path")
+	flags.String("notes", "", "free-form notes (empty to clear)")
+	var gitConfig stringList
+	flags.Var(&gitConfig, "git-config", "set a git config key for the account, e.g. core.editor=vim (empty value removes it, repeatable)")
+	lfsURL := flags.String("lfs-url", "", "Git LFS endpoint for the account (empty to disable LFS)")
+	lfsHelper := flags.String("lfs-credential-helper", "", "credential helper used for the LFS endpoint")
+	defaultBranch := flags.String("default-branch", "", "init.defaultBranch for repositories of the account (empty to unset)")
+	commitTemplate := flags.String("commit-template", "", "commit.template file for the account (empty to unset)")
+	cert := flags.String("ssh-certificate", "", "SSH certificate signed by your CA (empty to unset)")
+	certCommand := flags.String("ssh-certificate-command", "", "command printing or writing a fresh certificate (empty to unset)")
+	pkcs11 := flags.String("pkcs11-provider", "", "PKCS#11 library of a hardware token holding the key (empty to unset)")
+	agent := flags.String("identity-agent", "", "agent socket holding the key, or gpg-agent (empty to unset)")
+	signTags := flags.Bool("sign-tags", false, "sign annotated tags with the account's key (--sign-tags=false to stop)")
+	pushSigning := flags.String("push-signing", "", "push.gpgSign for the account: true or if-asked (empty to unset)")
+	multiplex := flags.Bool("multiplex", false, "reuse one SSH connection for consecutive git commands (--multiplex=false to stop)")
+	controlPersist := flags.String("control-persist", "", "how long an idle shared connection stays open, e.g. 10m (empty for the default)")
+	addKeys := flags.String("add-keys-to-agent", "", "AddKeysToAgent for the account: yes, ask, confirm or a lifetime (empty to unset)")
+	hostKeyChecking := flags.String("host-key-checking", "", "StrictHostKeyChecking for the account: yes, accept-new or ask (empty to unset)")
+	keyCreated := flags.String("key-created", "", "day the ssh key was generated, YYYY-MM-DD (empty to use the key file's date)")
+	keyRotation := flags.String("key-rotation", "", "how often the ssh key must be rotated, e.g. 180d (empty to inherit the default)")
+	knownHosts := flags.Bool("known-hosts", false, "give the account its own known_hosts file with GitHub's host keys (--known-hosts=false to stop)")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return config, err
+	}
+	if len(positional) != 1 {
+		return config, fmt.Errorf("usage: ghs edit <alias> [--username|--name|--email|--key|--notes <value>] [--git-config key=value]")
+	}
+
+	alias, err := config.lookupAlias(positional[0])
+	if err != nil {
+		return config, err
+	}
+	account := config.Accounts[alias]
+
+	if account, err = applyGitConfigFlags(account, gitConfig); err != nil {
+		return config, err
+	}
+
+	answers := accountAnswers(alias, account)
+	fromFlags := false
+	lfsChanged := false
+	flags.Visit(func(f *flag.Flag) {
+		fromFlags = true
+		if _, isAnswer := answers[f.Name]; isAnswer {
+			answers[f.Name] = f.Value.String()
+		}
+		lfsChanged = lfsChanged || strings.HasPrefix(f.Name, "lfs-")
+	})
+	if lfsChanged {
+		if account, err = applyLFSFlags(alias, account, flags, *lfsURL, *lfsHelper); err != nil {
+			return config, err
+		}
+	}
+	if account, err = applyInitFlags(account, flags, *defaultBranch, *commitTemplate); err != nil {
+		return config, err
+	}
+	if account, err = applyConnectionFlags(account, flags, *multiplex, *controlPersist, *addKeys); err != nil {
+		return config, err
+	}
+	account = applyCertFlags(account, flags, *cert, *certCommand)
+	account = applyHardwareFlags(account, flags, *pkcs11, *agent)
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "sign-tags":
+			account.SignTags = *signTags
+		case "push-signing":
+			account.PushSigning = *pushSigning
+		case "known-hosts":
+			account.KnownHosts = *knownHosts
+		case "host-key-checking":
+			account.HostKeyChecking = *hostKeyChecking
+		case "key-created":
+			account.KeyCreated = *keyCreated
+		case "key-rotation":
+			account.KeyRotation = *keyRotation
+		}
+	})
+	if problems := keyRotationProblems(account); len(problems) > 0 {
+		return config, fmt.Errorf("%s", problems[0].Msg)
+	}
+	if problem := hostKeyCheckingProblem(account.HostKeyChecking); problem != "" {
+		return config, fmt.Errorf("%s", problem)
+	}
+	if account.PushSigning != "" && !pushSigningModes[account.PushSigning] {
+		return config, fmt.Errorf("unknown push signing mode %q (use true or if-asked)", account.PushSigning)
+	}
+
+	// The alias itself is not editable
+	steps := accountSteps(config, answers, true)[1:]
+	if err := editAnswers(steps, answers, fromFlags); err != nil {
+		return config, err
+	}
+
+	previous := config.Accounts[alias]
+	account = applyAnswers(account, answers, config.Defaults)
+	if keyMissing(account) {
+		warnf("SSH key not found at %s", account.SSHKeyPath)
+	}
+	config.Accounts[alias] = account
+	if previous.KnownHosts && (!account.KnownHosts || account.Username != previous.Username) {
+		os.Remove(previous.KnownHostsFile())
+	}
+	if account.SSHKeyPath != previous.SSHKeyPath || account.IdentityAgent != previous.IdentityAgent || account.Username != previous.Username {
+		// A running master would keep authenticating with the old key
+		closeMaster(previous)
+	}
+
+	if err := updateManagedFiles(config); err != nil {
+		fmt.Printf("Error: %v\n", err)
+	}
+	fmt.Printf("Account '%s' updated.\n", alias)
+	return config, nil
+}
+
+// copyAccount duplicates an account under a new alias and asks for the
+// fields that have to differ, such as the username and key
+func copyAccount(config Config, args []string) (Config, error) {
+	flags := flag.NewFlagSet("copy", flag.ContinueOnError)
+	flags.String("username", "", "GitHub username")
+	flags.String("name", "", "your name")
+	flags.String("email", "", "your email")
+	flags.String("key", "", "SSH key path")
+	flags.String("notes", "", "free-form notes (empty to clear)")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return config, err
+	}
+	if len(positional) != 2 {
+		return config, fmt.Errorf("usage: ghs copy <alias> <new-alias> [--username|--name|--email|--key|--notes <value>]")
+	}
+
+	newAlias := positional[1]
+	source, err := config.lookupAlias(positional[0])
+	if err != nil {
+		return config, err
+	}
+	account := config.Accounts[source]
+
+	answers := accountAnswers(newAlias, account)
+	fromFlags := false
+	flags.Visit(func(f *flag.Flag) {
+		answers[f.Name] = f.Value.String()
+		fromFlags = true
+	})
+
+	// The alias step rejects existing aliases; the username step rejects
+	// the source's username, so it has to be changed
+	steps := accountSteps(config, answers, false)
+	if err := steps[0].check(newAlias); err != nil {
+		return config, err
+	}
+	if err := editAnswers(steps[1:], answers, fromFlags); err != nil {
+		return config, err
+	}
+
+	account = applyAnswers(account, answers, config.Defaults)
+	account.Tags = append([]string(nil), account.Tags...)
+	// Aliases name the source only
+	account.Aliases = nil
+	// A directory maps to a single account
+	account.Directories = nil
+	// Tokens belong to the source's user
+	account.Tokens = nil
+	if account.SSHOptions != nil {
+		options := make(map[string]string, len(account.SSHOptions))
+		for k, v := range account.SSHOptions {
+			options[k] = v
+		}
+		account.SSHOptions = options
+	}
+	if keyMissing(account) {
+		warnf("SSH key not found at %s", account.SSHKeyPath)
+	}
+	config.Accounts[newAlias] = account
+
+	if err := updateManagedFiles(config); err != nil {
+		fmt.Printf("Error: %v\n", err)
+	}
+	fmt.Printf("Account '%s' copied to '%s'.\n", source, newAlias)
+	return config, nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Environment variables that override ghs behaviour
+const (
+	envAccount = "GHS_ACCOUNT"
+	envConfig  = "GHS_CONFIG"
+	envProfile = "GHS_PROFILE"
+	envOffline = "GHS_OFFLINE"
+	// envStateDir moves the state directory, by default ~/.ghs
+	envStateDir  = "GHS_STATE_DIR"
+	envContainer = "GHS_CONTAINER"
+	// envSecretStore picks the keyring backend instead of detecting it
+	envSecretStore = "GHS_SECRET_STORE"
+	// envSystemConfig moves the system-wide config layer
+	envSystemConfig = "GHS_SYSTEM_CONFIG"
+)
+
+// shellQuote quotes s for safe use in a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// accountEnv returns the environment variables that make git commit and
+// authenticate as the given account without touching any git config.
+// GHS_ACCOUNT tells the identity guard hook which account was chosen.
+func accountEnv(alias string, account GitHubAccount) []string {
+	env := []string{
+		envAccount + "=" + alias,
+		"GIT_AUTHOR_NAME=" + account.Name,
+		"GIT_AUTHOR_EMAIL=" + account.Email,
+		"GIT_COMMITTER_NAME=" + account.Name,
+		"GIT_COMMITTER_EMAIL=" + account.Email,
+	}
+	if options := sshCommandOptions(account); len(options) > 0 && !httpsOnly {
+		env = append(env, "GIT_SSH_COMMAND=ssh "+strings.Join(options, " "))
+	}
+	return env
+}
+
+// envAccountAlias splits an optional leading alias off args. Without one, the
+// account named by GHS_ACCOUNT is used. The leading alias must be exact, or
+// the "git" of "ghs exec git push" could pick an account named github-bot.
+func envAccountAlias(config Config, args []string) (string, []string, error) {
+	if len(args) > 0 && args[0] != "--" {
+		if alias, ok := config.namedAlias(args[0]); ok {
+			return alias, args[1:], nil
+		}
+	}
+	if name := os.Getenv(envAccount); name != "" {
+		alias, err := config.lookupAlias(name)
+		if err != nil {
+			return "", nil, fmt.Errorf("account '%s' from %s not found", name, envAccount)
+		}
+		return alias, args, nil
+	}
+	return "", nil, fmt.Errorf("no account given and %s is not set", envAccount)
+}
+
+// printAccountEnv prints shell export statements for the selected account
+func printAccountEnv(config Config, args []string) error {
+	alias, _, err := envAccountAlias(config, args)
+	if err != nil {
+		return err
+	}
+	account, _ := config.account(alias)
+	for _, kv := range accountEnv(alias, account) {
+		parts := strings.SplitN(kv, "=", 2)
+		fmt.Printf("export %s=%s\n", parts[0], shellQuote(parts[1]))
+	}
+	if signsWithGPG(account) && !containerMode {
+		fmt.Println(gpgTTYScript)
+	}
+	return nil
+}
+
+// execAsAccount runs a command with the selected account's identity and SSH
+// key and returns the command's exit code
+func execAsAccount(config Config, args []string) (int, error) {
+	alias, rest, err := envAccountAlias(config, args)
+	if err != nil {
+		return 1, err
+	}
+	if len(rest) > 0 && rest[0] == "--" {
+		rest = rest[1:]
+	}
+	if len(rest) == 0 {
+		return 1, fmt.Errorf("usage: ghs exec [alias] -- <command> [args...]")
+	}
+
+	cmd := execForeground(rest[0], rest[1:]...)
+	account, _ := config.account(alias)
+	cmd.Env = append(os.Environ(), accountEnv(alias, account)...)
+	if signsWithGPG(account) && os.Getenv("GPG_TTY") == "" {
+		if tty := currentTTY(); tty != "" {
+			cmd.Env = append(cmd.Env, "GPG_TTY="+tty)
+		}
+	}
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode(), nil
+		}
+		return 1, fmt.Errorf("failed to run %s: %v", rest[0], err)
+	}
+	return 0, nil
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+func fragmentsDir() string {
+	return filepath.Join(stateDir, "gitconfig")
+}
+
+func fragmentPath(alias string) string {
+	return filepath.Join(fragmentsDir(), alias+".gitconfig")
+}
+
+// updateManagedFiles regenerates every file derived from the accounts: the
+// SSH config and the git config fragments for mapped directories
+func updateManagedFiles(config Config) error {
+	var errs []error
+	// Containers without ~/.ssh use GIT_SSH_COMMAND through env/exec, and
+	// HTTPS mode doesn't use SSH at all
+	if sshConfigUsable() && !httpsOnly {
+		if err := updateSSHConfig(config); err != nil {
+			errs = append(errs, fmt.Errorf("failed to update SSH config: %v", err))
+		}
+	}
+	if err := updateGitConfigFragments(config); err != nil {
+		errs = append(errs, fmt.Errorf("failed to update git config fragments: %v", err))
+	}
+	return errors.Join(errs...)
+}
+
+// quoteGitConfigValue quotes a value for a git config file when needed
+func quoteGitConfigValue(value string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\t", `\t`).Replace(value)
+	if escaped != value || strings.ContainsAny(value, "#;") || strings.TrimSpace(value) != value {
+		return `"` + escaped + `"`
+	}
+	return value
+}
+
+// splitGitConfigKey splits "section.sub.section.name" into its parts
+func splitGitConfigKey(key string) (section, subsection, name string) {
+	first := strings.Index(key, ".")
+	last := strings.LastIndex(key, ".")
+	section, name = key[:first], key[last+1:]
+	if first != last {
+		subsection = key[first+1 : last]
+	}
+	return section, subsection, name
+}
+
+// formatGitConfig renders settings in git config file syntax, grouping keys
+// by section
+func formatGitConfig(settings map[string]string) string {
+	type entry struct{ name, value string }
+	sections := map[string][]entry{}
+	var headers []string
+	for _, key := range sortedKeys(settings) {
+		section, subsection, name := splitGitConfigKey(key)
+		header := "[" + section + "]"
+		if subsection != "" {
+			header = fmt.Sprintf("[%s %q]", section, subsection)
+		}
+		if _, seen := sections[header]; !seen {
+			headers = append(headers, header)
+		}
+		sections[header] = append(sections[header], entry{name, settings[key]})
+	}
+	sort.Strings(headers)
+
+	var b strings.Builder
+	for _, header := range headers {
+		b.WriteString(header + "\n")
+		for _, e := range sections[header] {
+			fmt.Fprintf(&b, "\t%s = %s\n", e.name, quoteGitConfigValue(e.value))
+		}
+	}
+	return b.String()
+}
+
+// fragmentSettings returns the git config written to an account's fragment
+func fragmentSettings(alias string, account GitHubAccount) map[string]string {
+	settings := account.gitSettings()
+	settings["user.name"] = account.Name
+	settings["user.email"] = account.Email
+	settings["init.templateDir"] = templateDir(alias)
+	return settings
+}
+
+// mappedDirPattern turns a directory into an includeIf gitdir pattern
+func mappedDirPattern(dir string) string {
+	return "gitdir:" + strings.TrimSuffix(dir, "/") + "/"
+}
+
+// managedIncludes returns the includeIf keys in the global git config that
+// point at ghs fragments
+func managedIncludes() ([]string, error) {
+	out, err := execCommand("git", "config", "--global", "--get-regexp", `^includeif\..*\.path$`).Output()
+	if err != nil {
+		// Exit status 1 means there are no matching keys
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var keys []string
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		parts := strings.SplitN(line, " ", 2)
+		if len(parts) == 2 && strings.HasPrefix(parts[1], fragmentsDir()+string(filepath.Separator)) {
+			keys = append(keys, parts[0])
+		}
+	}
+	return keys, nil
+}
+
+// fragmentContent returns the git config fragment of a mapped account
+func fragmentContent(alias string, account GitHubAccount) string {
+	return fmt.Sprintf("# Managed by ghs for account '%s', changes are overwritten\n", alias) +
+		formatGitConfig(fragmentSettings(alias, account))
+}
+
+// updateGitConfigFragments writes one git config fragment per account with
+// mapped directories and points includeIf entries in the global git config
+// at them. Fragments and includes of unmapped accounts are removed.
+func updateGitConfigFragments(config Config) error {
+	accounts := config.resolvedAccounts()
+	existing, err := managedIncludes()
+	if err != nil {
+		return fmt.Errorf("failed to read global git config: %v", err)
+	}
+
+	mapped := map[string]bool{}
+	for alias, account := range accounts {
+		if len(account.Directories) > 0 {
+			mapped[alias] = true
+		}
+	}
+	if len(mapped) == 0 && len(existing) == 0 {
+		return nil
+	}
+
+	if err := mkdirPrivate(fragmentsDir()); err != nil {
+		return err
+	}
+	for _, alias := range sortedAliases(accounts) {
+		if !mapped[alias] {
+			continue
+		}
+		account := accounts[alias]
+		if err := ensureTemplate(alias, account); err != nil {
+			return err
+		}
+		if err := writePrivateFile(fragmentPath(alias), []byte(fragmentContent(alias, account))); err != nil {
+			return err
+		}
+		logger.Info("git config fragment written", "account", alias, "path", fragmentPath(alias))
+	}
+
+	// Drop fragments of accounts that are no longer mapped
+	entries, _ := os.ReadDir(fragmentsDir())
+	for _, entry := range entries {
+		alias := strings.TrimSuffix(entry.Name(), ".gitconfig")
+		if !mapped[alias] {
+			os.Remove(filepath.Join(fragmentsDir(), entry.Name()))
+			logger.Info("git config fragment removed", "account", alias)
+		}
+	}
+
+	// Replace all managed includes with the current mapping
+	for _, key := range existing {
+		if err := execCommand("git", "config", "--global", "--unset-all", key).Run(); err != nil {
+			return fmt.Errorf("failed to remove %s: %v", key, err)
+		}
+	}
+	for _, alias := range sortedAliases(accounts) {
+		for _, dir := range accounts[alias].Directories {
+			key := "includeIf." + mappedDirPattern(dir) + ".path"
+			if err := execCommand("git", "config", "--global", "--add", key, fragmentPath(alias)).Run(); err != nil {
+				return fmt.Errorf("failed to add %s: %v", key, err)
+			}
+			logger.Debug("git config include set", "key", key, "account", alias)
+		}
+	}
+	return nil
+}
+
+// mapDirectory adds or removes a directory whose repositories use an account
+func mapDirectory(config Config, args []string, add bool) (Config, error) {
+	command := "map"
+	if !add {
+		command = "unmap"
+	}
+	if len(args) != 2 {
+		return config, fmt.Errorf("usage: ghs %s <alias> <directory>", command)
+	}
+	alias, err := config.lookupAlias(args[0])
+	if err != nil {
+		return config, err
+	}
+	account := config.Accounts[alias]
+	dir := strings.TrimSuffix(expandPath(args[1]), "/")
+
+	var dirs []string
+	for _, d := range account.Directories {
+		if d != dir {
+			dirs = append(dirs, d)
+		}
+	}
+	if add {
+		for other, otherAccount := range config.Accounts {
+			for _, d := range otherAccount.Directories {
+				if d == dir && other != alias {
+					return config, fmt.Errorf("%s is already mapped to account '%s'", dir, other)
+				}
+			}
+		}
+		dirs = append(dirs, dir)
+		sort.Strings(dirs)
+	} else if len(dirs) == len(account.Directories) {
+		return config, fmt.Errorf("%s is not mapped to account '%s'", dir, alias)
+	}
+	account.Directories = dirs
+	config.Accounts[alias] = account
+
+	if err := updateGitConfigFragments(config); err != nil {
+		return config, fmt.Errorf("failed to update git config fragments: %v", err)
+	}
+	if add {
+		fmt.Printf("Repositories under %s now use account '%s'\n", dir, alias)
+		fmt.Printf("Template directory: %s\n", templateDir(alias))
+	} else {
+		fmt.Printf("Removed mapping of %s from account '%s'\n", dir, alias)
+	}
+	return config, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import "testing"
+
+func TestQuoteGitConfigValue(t *testing.T) {
+	tests := []struct {
+		value, want string
+	}{
+		{"vim", "vim"},
+		{"code --wait", "code --wait"},
+		{"", ""},
+		{" leading", `" leading"`},
+		{"trailing ", `"trailing "`},
+		{"a # comment", `"a # comment"`},
+		{"a;b", `"a;b"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{`C:\Tools\vim.exe`, `"C:\\Tools\\vim.exe"`},
+		{"tab\there", `"tab\there"`},
+	}
+	for _, tt := range tests {
+		if got := quoteGitConfigValue(tt.value); got != tt.want {
+			t.Errorf("quoteGitConfigValue(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestSplitGitConfigKey(t *testing.T) {
+	tests := []struct {
+		key                       string
+		section, subsection, name string
+	}{
+		{"core.editor", "core", "", "editor"},
+		{"user.name", "user", "", "name"},
+		{"url.git@github.com-me:.insteadOf", "url", "git@github.com-me:", "insteadOf"},
+		{"includeIf.gitdir:~/code/acme/.path", "includeIf", "gitdir:~/code/acme/", "path"},
+		{"branch.feature.x.remote", "branch", "feature.x", "remote"},
+	}
+	for _, tt := range tests {
+		section, subsection, name := splitGitConfigKey(tt.key)
+		if section != tt.section || subsection != tt.subsection || name != tt.name {
+			t.Errorf("splitGitConfigKey(%q) = %q, %q, %q, want %q, %q, %q",
+				tt.key, section, subsection, name, tt.section, tt.subsection, tt.name)
+		}
+	}
+}
+
+func TestFormatGitConfig(t *testing.T) {
+	settings := map[string]string{
+		"user.name":                        "Me Myself",
+		"user.email":                       "me@acme.com",
+		"core.editor":                      "code --wait",
+		"core.sshCommand":                  "ssh -i ~/.ssh/id_work # work",
+		"url.git@github.com-me:.insteadOf": "git@github.com:",
+	}
+	want := `[core]
+	editor = code --wait
+	sshCommand = "ssh -i ~/.ssh/id_work # work"
+[url "git@github.com-me:"]
+	insteadOf = git@github.com:
+[user]
+	email = me@acme.com
+	name = Me Myself
+`
+	if got := formatGitConfig(settings); got != want {
+		t.Errorf("formatGitConfig() =\n%s\nwant\n%s", got, want)
+	}
+}
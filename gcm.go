@@ -0,0 +1,229 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Credential modes of "credential setup": ghs answers for github.com itself,
+// or Git Credential Manager keeps answering with one login per account
+const (
+	credentialModeGHS = "ghs"
+	credentialModeGCM = "gcm"
+)
+
+// ghsCredentialHelper is the helper "credential setup" installs
+const ghsCredentialHelper = "!ghs credential"
+
+// githubCredentialKey is the git config prefix of github.com credential settings
+const githubCredentialKey = "credential.https://github.com"
+
+// isGCMHelper reports whether a credential helper is Git Credential Manager
+// (manager, manager-core or a path to git-credential-manager)
+func isGCMHelper(helper string) bool {
+	return strings.Contains(strings.ToLower(helper), "manager")
+}
+
+// gcmVersion returns the version of the installed Git Credential Manager
+func gcmVersion() (string, bool) {
+	out, err := execCommand("git", "credential-manager", "--version").Output()
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(string(out)), true
+}
+
+// githubCredentialHelpers returns the helpers git asks for github.com, in
+// order. An empty value clears the helpers configured before it, as in git.
+func githubCredentialHelpers() []string {
+	out, _ := execCommand("git", "config", "--get-regexp", `^credential\.(https://github\.com/?\.)?helper$`).Output()
+	var helpers []string
+	for _, line := range strings.Split(strings.TrimRight(string(out), "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		if _, value, _ := strings.Cut(line, " "); value == "" {
+			helpers = nil
+		} else {
+			helpers = append(helpers, value)
+		}
+	}
+	return helpers
+}
+
+// credentialNamespaces returns the GitHub owners whose HTTPS credentials
+// belong to each account's user: the username itself, exact owner rules and
+// owners with a token. Glob and regex rules can't be expressed as git URLs.
+func credentialNamespaces(config Config) map[string]string {
+	owners := map[string]string{}
+	accounts := config.resolvedAccounts()
+	for _, alias := range sortedAliases(accounts) {
+		account := accounts[alias]
+		owners[strings.ToLower(account.Username)] = account.Username
+		for scope := range account.Tokens {
+			if owner, _, _ := strings.Cut(scope, "/"); scope != defaultTokenScope {
+				owners[strings.ToLower(owner)] = account.Username
+			}
+		}
+	}
+	for _, rule := range config.OwnerRules {
+		alias, _ := config.namedAlias(rule.Account)
+		if account, exists := accounts[alias]; exists && patternKind(rule.Pattern) == patternExact {
+			owners[strings.ToLower(rule.Pattern)] = account.Username
+		}
+	}
+	return owners
+}
+
+// managedNamespaces returns the per-owner username settings of the global
+// git config that point at one of the accounts, keyed by config key
+func managedNamespaces(config Config) map[string]string {
+	usernames := map[string]bool{}
+	for _, account := range config.resolvedAccounts() {
+		usernames[strings.ToLower(account.Username)] = true
+	}
+	found := map[string]string{}
+	out, _ := execCommand("git", "config", "--global", "--get-regexp", `^credential\.https://github\.com/.+\.username$`).Output()
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if key, value, ok := strings.Cut(line, " "); ok && usernames[strings.ToLower(value)] {
+			found[key] = value
+		}
+	}
+	return found
+}
+
+// removeCredentialSetup undoes both modes in the global git config
+func removeCredentialSetup(config Config) error {
+	for key := range managedNamespaces(config) {
+		if err := execCommand("git", "config", "--global", "--unset-all", key).Run(); err != nil {
+			return fmt.Errorf("failed to unset %s: %v", key, err)
+		}
+	}
+	helpers, _ := execCommand("git", "config", "--global", "--get-all", githubCredentialKey+".helper").Output()
+	for _, helper := range strings.Split(strings.TrimSpace(string(helpers)), "\n") {
+		// Leave helpers the user configured for github.com alone
+		if helper != "" && helper != ghsCredentialHelper {
+			return nil
+		}
+	}
+	for _, key := range []string{githubCredentialKey + ".helper", githubCredentialKey + ".useHttpPath"} {
+		execCommand("git", "config", "--global", "--unset-all", key).Run()
+	}
+	return nil
+}
+
+// setupCredentials handles "credential setup": in ghs mode github.com asks
+// only ghs, so GCM's single login no longer answers for every account; in
+// gcm mode GCM stays and each account's owners get its username, which
+// makes GCM keep and pick one credential per account
+func setupCredentials(config Config, args []string) error {
+	flags := flag.NewFlagSet("credential setup", flag.ContinueOnError)
+	mode := flags.String("mode", credentialModeGHS, "ghs to answer with account tokens, gcm to keep Git Credential Manager")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 || (*mode != credentialModeGHS && *mode != credentialModeGCM) {
+		return fmt.Errorf("usage: ghs credential setup [--mode ghs|gcm]")
+	}
+	if *mode == credentialModeGCM {
+		if _, installed := gcmVersion(); !installed {
+			return fmt.Errorf("Git Credential Manager is not installed; use --mode ghs")
+		}
+	}
+	if err := removeCredentialSetup(config); err != nil {
+		return err
+	}
+	set := func(args ...string) error {
+		if err := execCommand("git", append([]string{"config", "--global"}, args...)...).Run(); err != nil {
+			return fmt.Errorf("failed to set %s: %v", args[len(args)-2], err)
+		}
+		return nil
+	}
+
+	if *mode == credentialModeGHS {
+		// The empty helper drops GCM and other helpers for github.com
+		if err := set("--add", githubCredentialKey+".helper", ""); err != nil {
+			return err
+		}
+		if err := set("--add", githubCredentialKey+".helper", ghsCredentialHelper); err != nil {
+			return err
+		}
+		if err := set(githubCredentialKey+".useHttpPath", "true"); err != nil {
+			return err
+		}
+		fmt.Println("HTTPS access to github.com now uses the token of each repository's account")
+		return nil
+	}
+
+	namespaces := credentialNamespaces(config)
+	owners := sortedKeys(namespaces)
+	for _, owner := range owners {
+		if err := set(githubCredentialKey+"/"+owner+".username", namespaces[owner]); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Git Credential Manager now keeps one login per account for %d owner(s)\n", len(owners))
+	for _, rule := range config.OwnerRules {
+		if patternKind(rule.Pattern) != patternExact {
+			warnf("owner rule %q isn't an exact owner; its repositories use GCM's default login", rule.Pattern)
+		}
+	}
+	return nil
+}
+
+// credentialStatus handles "credential status"
+func credentialStatus(config Config) error {
+	version, installed := gcmVersion()
+	if installed {
+		fmt.Printf("Git Credential Manager: %s\n", version)
+	} else {
+		fmt.Println("Git Credential Manager: not installed")
+	}
+	helpers := githubCredentialHelpers()
+	if len(helpers) == 0 {
+		fmt.Println("Helpers for github.com: none")
+	} else {
+		fmt.Printf("Helpers for github.com: %s\n", strings.Join(helpers, ", "))
+	}
+	namespaces := managedNamespaces(config)
+	switch {
+	case len(helpers) > 0 && helpers[0] == ghsCredentialHelper:
+		fmt.Println("Mode: ghs (tokens of each repository's account)")
+	case len(namespaces) > 0:
+		fmt.Printf("Mode: gcm (one login per account for %d owner(s))\n", len(namespaces))
+		keys := make([]string, 0, len(namespaces))
+		for key := range namespaces {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			owner := strings.TrimSuffix(strings.TrimPrefix(key, githubCredentialKey+"/"), ".username")
+			fmt.Printf("  %-30s %s\n", owner, namespaces[key])
+		}
+	default:
+		fmt.Println("Mode: not set up, see 'ghs credential setup'")
+	}
+	return nil
+}
+
+// checkCredentialManager warns when GCM answers for github.com with a single
+// login although there are several accounts
+func checkCredentialManager(config Config) *doctorResult {
+	helpers := githubCredentialHelpers()
+	gcm := false
+	for _, helper := range helpers {
+		gcm = gcm || isGCMHelper(helper)
+	}
+	if !gcm || len(helpers) > 0 && helpers[0] == ghsCredentialHelper {
+		return nil
+	}
+	data := map[string]string{"helpers": strings.Join(helpers, ",")}
+	if len(config.Accounts) > 1 && len(managedNamespaces(config)) == 0 {
+		return &doctorResult{Status: doctorWarn, Finding: "single_login", Message: "Git Credential Manager answers for github.com with one login for every account",
+			Hint: "ghs credential setup --mode gcm (or --mode ghs to use account tokens)", Data: data}
+	}
+	return &doctorResult{Status: doctorOK, Finding: "ok", Message: "Git Credential Manager keeps one login per account", Data: data}
+}
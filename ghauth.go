@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// ghActiveUser returns the GitHub user gh is currently logged in as
+func ghActiveUser() (string, error) {
+	out, err := execCommand("gh", "api", "user", "--jq", ".login").Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("gh: %s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("failed to run gh: %v", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// ghAuthSwitch makes the account's user the active gh account. gh has to be
+// logged in as that user already, see "gh auth login".
+func ghAuthSwitch(account GitHubAccount) error {
+	if active, err := ghActiveUser(); err == nil && strings.EqualFold(active, account.Username) {
+		return nil
+	}
+	cmd := execCommand("gh", "auth", "switch", "--hostname", "github.com", "--user", account.Username)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("gh auth switch: %s", msg)
+		}
+		return fmt.Errorf("failed to run gh: %v", err)
+	}
+	fmt.Printf("gh is now logged in as %s\n", account.Username)
+	return nil
+}
+
+// ghAccount returns the alias of the account gh is logged in as
+func ghAccount(config Config) (string, error) {
+	user, err := ghActiveUser()
+	if err != nil {
+		return "", err
+	}
+	for _, alias := range sortedAliases(config.Accounts) {
+		if strings.EqualFold(config.Accounts[alias].Username, user) {
+			return alias, nil
+		}
+	}
+	return "", fmt.Errorf("gh is logged in as %s, which no account has", user)
+}
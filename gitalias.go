@@ -0,0 +1,122 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// gitSubcommandName is the executable name git looks for on PATH to run
+// "git ghs"
+const gitSubcommandName = "git-ghs"
+
+// envGitAlias is set by the git alias ghs installs
+const envGitAlias = "GHS_GIT_ALIAS"
+
+// ghExtensionName is the executable name of ghs installed as a gh extension
+const ghExtensionName = "gh-ghs"
+
+// invokedByGH reports whether ghs runs as the gh extension "gh ghs"
+func invokedByGH() bool {
+	return strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe") == ghExtensionName
+}
+
+// invokedByGit reports whether ghs runs as "git ghs", either through the
+// git-ghs link or through the git alias
+func invokedByGit() bool {
+	name := strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe")
+	return name == gitSubcommandName || os.Getenv(envGitAlias) != ""
+}
+
+// subcommandArgs adapts arguments to the git and gh calling conventions,
+// where "git ghs -h" and "gh ghs --help" ask for help
+func subcommandArgs(args []string) []string {
+	if len(args) == 1 && (args[0] == "-h" || args[0] == "--help") {
+		return []string{"help"}
+	}
+	return args
+}
+
+// gitAliasCommand returns the value of the git alias running exe. Shell
+// aliases run in the top-level directory, so it returns to the directory
+// git was started in first; git appends the arguments.
+func gitAliasCommand(exe string) string {
+	return fmt.Sprintf(`!cd "${GIT_PREFIX:-.}" && %s=1 '%s'`, envGitAlias, exe)
+}
+
+// installedGitAlias returns the ghs git alias in the global git config if
+// ghs installed it
+func installedGitAlias() (string, bool) {
+	out, err := execCommand("git", "config", "--global", "alias.ghs").Output()
+	value := strings.TrimSpace(string(out))
+	return value, err == nil && strings.Contains(value, envGitAlias)
+}
+
+// gitSubcommandLink returns the git-ghs link next to the ghs executable
+func gitSubcommandLink() (link, exe string, err error) {
+	if exe, err = os.Executable(); err != nil {
+		return "", "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	return filepath.Join(filepath.Dir(exe), gitSubcommandName), exe, nil
+}
+
+// installGitAlias handles "install-git-alias": it makes "git ghs" run ghs,
+// through a global git alias or, with --link, a git-ghs link next to the
+// executable. --remove undoes either.
+func installGitAlias(args []string) error {
+	flags := flag.NewFlagSet("install-git-alias", flag.ContinueOnError)
+	link := flags.Bool("link", false, "create a git-ghs link next to the executable instead of a git alias")
+	remove := flags.Bool("remove", false, "remove the alias and link")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return fmt.Errorf("usage: ghs install-git-alias [--link] [--remove]")
+	}
+	linkPath, exe, err := gitSubcommandLink()
+	if err != nil {
+		return fmt.Errorf("failed to find the ghs executable: %v", err)
+	}
+
+	if *remove {
+		if _, ok := installedGitAlias(); ok {
+			if err := execCommand("git", "config", "--global", "--unset", "alias.ghs").Run(); err != nil {
+				return fmt.Errorf("failed to remove alias.ghs: %v", err)
+			}
+			fmt.Println("Removed alias.ghs from the global git config")
+		}
+		if target, err := os.Readlink(linkPath); err == nil && target == exe {
+			if err := os.Remove(linkPath); err != nil {
+				return err
+			}
+			fmt.Printf("Removed %s\n", linkPath)
+		}
+		return nil
+	}
+
+	if *link {
+		if _, err := os.Lstat(linkPath); err == nil {
+			return fmt.Errorf("%s already exists", linkPath)
+		}
+		if err := os.Symlink(exe, linkPath); err != nil {
+			return fmt.Errorf("failed to create %s: %v", linkPath, err)
+		}
+		fmt.Printf("Created %s; \"git ghs\" works while %s is on PATH\n", linkPath, filepath.Dir(linkPath))
+		return nil
+	}
+
+	if value, ok := installedGitAlias(); !ok && value != "" {
+		return fmt.Errorf("alias.ghs is already set to %q", value)
+	}
+	if err := execCommand("git", "config", "--global", "alias.ghs", gitAliasCommand(exe)).Run(); err != nil {
+		return fmt.Errorf("failed to set alias.ghs: %v", err)
+	}
+	fmt.Println("Added alias.ghs to the global git config; try \"git ghs current\"")
+	return nil
+}
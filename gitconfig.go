@@ -0,0 +1,331 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// errUnsupportedGitConfig is returned for config files using syntax the
+// native editor doesn't handle; callers fall back to running git config
+var errUnsupportedGitConfig = errors.New("unsupported git config syntax")
+
+var (
+	gitConfigHeader   = regexp.MustCompile(`^\s*\[\s*([A-Za-z0-9.-]+)(?:\s+"((?:[^"\\]|\\.)*)")?\s*\]\s*(?:[#;].*)?$`)
+	gitConfigVariable = regexp.MustCompile(`^\s*([A-Za-z][A-Za-z0-9-]*)\s*(?:=(.*))?$`)
+)
+
+// gitConfigFile is a git config file edited in place, keeping comments,
+// ordering and unrelated settings intact
+type gitConfigFile struct {
+	path  string
+	lines []string
+}
+
+// gitConfigSection is a section header and the last line belonging to it
+type gitConfigSection struct {
+	section, subsection string
+	header, end         int
+}
+
+// gitConfigEntry is a variable spanning lines start..end (continuations)
+type gitConfigEntry struct {
+	key        string
+	value      string
+	start, end int
+}
+
+func readGitConfigFile(path string) (*gitConfigFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	f := &gitConfigFile{path: path}
+	if text := strings.TrimRight(string(data), "\n"); text != "" {
+		f.lines = strings.Split(text, "\n")
+	}
+	return f, nil
+}
+
+// normalizeGitConfigKey lowercases the section and name of a key; the
+// subsection is case-sensitive
+func normalizeGitConfigKey(section, subsection, name string) string {
+	key := strings.ToLower(section)
+	if subsection != "" {
+		key += "." + subsection
+	}
+	return key + "." + strings.ToLower(name)
+}
+
+// decodeGitConfigValue removes quoting, escapes and trailing comments
+func decodeGitConfigValue(raw string) string {
+	var b strings.Builder
+	quoted := false
+	pending := "" // whitespace kept only if more value follows
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		switch {
+		case c == '\\' && i+1 < len(raw):
+			i++
+			b.WriteString(pending)
+			pending = ""
+			switch raw[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'b':
+				b.WriteByte('\b')
+			case '\n':
+			default:
+				b.WriteByte(raw[i])
+			}
+		case c == '"':
+			quoted = !quoted
+		case !quoted && (c == '#' || c == ';'):
+			return b.String()
+		case !quoted && (c == ' ' || c == '\t'):
+			if b.Len() > 0 {
+				pending += string(c)
+			}
+		default:
+			b.WriteString(pending)
+			pending = ""
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// parse returns the sections and variables of the file
+func (f *gitConfigFile) parse() ([]gitConfigSection, []gitConfigEntry, error) {
+	var sections []gitConfigSection
+	var entries []gitConfigEntry
+	for i := 0; i < len(f.lines); i++ {
+		line := f.lines[i]
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed[0] == '#' || trimmed[0] == ';' {
+			continue
+		}
+		if m := gitConfigHeader.FindStringSubmatch(line); m != nil {
+			section, subsection := m[1], strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(m[2])
+			if m[2] == "" && strings.Contains(section, ".") {
+				// Deprecated [section.subsection] form, case-insensitive
+				parts := strings.SplitN(section, ".", 2)
+				section, subsection = parts[0], strings.ToLower(parts[1])
+			}
+			sections = append(sections, gitConfigSection{strings.ToLower(section), subsection, i, i})
+			continue
+		}
+		m := gitConfigVariable.FindStringSubmatch(line)
+		if m == nil || len(sections) == 0 {
+			return nil, nil, fmt.Errorf("%w in %s line %d", errUnsupportedGitConfig, f.path, i+1)
+		}
+		start, raw := i, m[2]
+		for strings.HasSuffix(raw, `\`) && !strings.HasSuffix(raw, `\\`) && i+1 < len(f.lines) {
+			i++
+			raw += "\n" + f.lines[i]
+		}
+		value := "true"
+		if strings.Contains(line, "=") {
+			value = decodeGitConfigValue(raw)
+		}
+		current := &sections[len(sections)-1]
+		current.end = i
+		entries = append(entries, gitConfigEntry{normalizeGitConfigKey(current.section, current.subsection, m[1]), value, start, i})
+	}
+	return sections, entries, nil
+}
+
+// get returns the last value of key
+func (f *gitConfigFile) get(key string) (string, bool, error) {
+	_, entries, err := f.parse()
+	if err != nil {
+		return "", false, err
+	}
+	section, subsection, name := splitGitConfigKey(key)
+	want := normalizeGitConfigKey(section, subsection, name)
+	value, found := "", false
+	for _, e := range entries {
+		if e.key == want {
+			value, found = e.value, true
+		}
+	}
+	return value, found, nil
+}
+
+// removeLines deletes lines start..end
+func (f *gitConfigFile) removeLines(start, end int) {
+	f.lines = append(f.lines[:start], f.lines[end+1:]...)
+}
+
+// set replaces every value of key with value, keeping the position of the
+// first one, or adds it to the end of its section
+func (f *gitConfigFile) set(key, value string) error {
+	sections, entries, err := f.parse()
+	if err != nil {
+		return err
+	}
+	section, subsection, name := splitGitConfigKey(key)
+	want := normalizeGitConfigKey(section, subsection, name)
+	line := fmt.Sprintf("\t%s = %s", name, quoteGitConfigValue(value))
+
+	var matches []gitConfigEntry
+	for _, e := range entries {
+		if e.key == want {
+			matches = append(matches, e)
+		}
+	}
+	if len(matches) > 0 {
+		for i := len(matches) - 1; i > 0; i-- {
+			f.removeLines(matches[i].start, matches[i].end)
+		}
+		first := matches[0]
+		f.removeLines(first.start, first.end)
+		f.lines = append(f.lines[:first.start], append([]string{line}, f.lines[first.start:]...)...)
+		return nil
+	}
+
+	for i := len(sections) - 1; i >= 0; i-- {
+		s := sections[i]
+		if s.section == strings.ToLower(section) && s.subsection == subsection {
+			at := s.end + 1
+			f.lines = append(f.lines[:at], append([]string{line}, f.lines[at:]...)...)
+			return nil
+		}
+	}
+	header := "[" + section + "]"
+	if subsection != "" {
+		header = fmt.Sprintf("[%s \"%s\"]", section, strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(subsection))
+	}
+	f.lines = append(f.lines, header, line)
+	return nil
+}
+
+// unset removes every value of key
+func (f *gitConfigFile) unset(key string) error {
+	_, entries, err := f.parse()
+	if err != nil {
+		return err
+	}
+	section, subsection, name := splitGitConfigKey(key)
+	want := normalizeGitConfigKey(section, subsection, name)
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].key == want {
+			f.removeLines(entries[i].start, entries[i].end)
+		}
+	}
+	return nil
+}
+
+// save writes the file through a lock file the way git does, so concurrent
+// git commands never see a half-written config
+func (f *gitConfigFile) save() error {
+	lock := f.path + ".lock"
+	file, err := os.OpenFile(lock, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to lock %s: %v", f.path, err)
+	}
+	// A replaced file keeps its mode, a new one is private whatever the umask
+	mode := os.FileMode(0600)
+	if info, err := os.Stat(f.path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := file.Chmod(mode); err != nil {
+		file.Close()
+		os.Remove(lock)
+		return err
+	}
+	content := strings.Join(f.lines, "\n")
+	if content != "" {
+		content += "\n"
+	}
+	if _, err := file.WriteString(content); err != nil {
+		file.Close()
+		os.Remove(lock)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(lock)
+		return err
+	}
+	return os.Rename(lock, f.path)
+}
+
+// configEdit is a single change to the repository config; an empty value
+// with unset true removes the key
+type configEdit struct {
+	key   string
+	value string
+	unset bool
+}
+
+// repoConfigPath returns the config file written in the current scope
+func repoConfigPath(repo repoInfo) string {
+	if gitConfigScope == "--worktree" {
+		return filepath.Join(repo.GitDir, "config.worktree")
+	}
+	return filepath.Join(repo.CommonDir, "config")
+}
+
+// applyConfigEdits writes all edits to the repository config at once. Files
+// the native editor can't handle are edited with one git config call per key.
+func applyConfigEdits(repo repoInfo, edits []configEdit) error {
+	for _, e := range edits {
+		if e.unset {
+			logger.Info("git config unset", "file", repoConfigPath(repo), "key", e.key)
+		} else {
+			logger.Info("git config set", "file", repoConfigPath(repo), "key", e.key, "value", e.value)
+		}
+	}
+	f, err := readGitConfigFile(repoConfigPath(repo))
+	if err == nil {
+		for _, e := range edits {
+			if e.unset {
+				err = f.unset(e.key)
+			} else {
+				err = f.set(e.key, e.value)
+			}
+			if err != nil {
+				break
+			}
+		}
+	}
+	if err == nil {
+		return f.save()
+	}
+	if !errors.Is(err, errUnsupportedGitConfig) {
+		return err
+	}
+
+	for _, e := range edits {
+		cmd := gitConfig(e.key, e.value)
+		if e.unset {
+			cmd = gitConfig("--unset-all", e.key)
+		}
+		if err := cmd.Run(); err != nil && !e.unset {
+			return fmt.Errorf("failed to set git %s: %v", e.key, err)
+		}
+	}
+	return nil
+}
+
+// repoConfigValue reads a key from the repository config in the current
+// scope, ignoring global and system settings
+func repoConfigValue(repo repoInfo, key string) (string, bool) {
+	f, err := readGitConfigFile(repoConfigPath(repo))
+	if err == nil {
+		value, found, err := f.get(key)
+		if err == nil {
+			return value, found
+		}
+	}
+	out, err := gitConfig("--get", key).Output()
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(string(out)), true
+}
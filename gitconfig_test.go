@@ -0,0 +1,261 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testGitConfig returns an editor for the given file contents
+func testGitConfig(content string) *gitConfigFile {
+	f := &gitConfigFile{path: "config"}
+	if text := strings.TrimRight(content, "\n"); text != "" {
+		f.lines = strings.Split(text, "\n")
+	}
+	return f
+}
+
+func TestDecodeGitConfigValue(t *testing.T) {
+	tests := []struct {
+		raw, want string
+	}{
+		{" vim", "vim"},
+		{" code --wait  ", "code --wait"},
+		{` "  padded  "`, "  padded  "},
+		{` "a # not a comment" # comment`, "a # not a comment"},
+		{" value ; comment", "value"},
+		{` say \"hi\"`, `say "hi"`},
+		{` C:\\Tools`, `C:\Tools`},
+		{` line\nbreak\ttab`, "line\nbreak\ttab"},
+		{" con\\\ntinued", "continued"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := decodeGitConfigValue(tt.raw); got != tt.want {
+			t.Errorf("decodeGitConfigValue(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestGitConfigGet(t *testing.T) {
+	content := `# user settings
+[user]
+	name = Me
+	email = me@acme.com
+[Core]
+	Editor = vim
+	bare
+[url "git@github.com-me:"]
+	insteadOf = git@github.com:
+[branch.Main]
+	remote = origin
+[core]
+	editor = "code --wait" ; later wins
+	pager = less \
+-R
+`
+	tests := []struct {
+		key   string
+		want  string
+		found bool
+	}{
+		{"user.name", "Me", true},
+		{"USER.EMAIL", "me@acme.com", true},
+		{"core.editor", "code --wait", true},
+		{"core.bare", "true", true},
+		{"core.pager", "less -R", true},
+		{"url.git@github.com-me:.insteadof", "git@github.com:", true},
+		{"url.git@GitHub.com-me:.insteadOf", "", false},
+		{"branch.main.remote", "origin", true},
+		{"user.signingkey", "", false},
+	}
+	f := testGitConfig(content)
+	for _, tt := range tests {
+		value, found, err := f.get(tt.key)
+		if err != nil {
+			t.Fatalf("get(%q): %v", tt.key, err)
+		}
+		if value != tt.want || found != tt.found {
+			t.Errorf("get(%q) = %q, %v, want %q, %v", tt.key, value, found, tt.want, tt.found)
+		}
+	}
+}
+
+func TestGitConfigEdit(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		edits   []configEdit
+		want    string
+	}{
+		{
+			name:    "set in an empty file",
+			content: "",
+			edits:   []configEdit{{key: "user.name", value: "Me"}},
+			want: `[user]
+	name = Me
+`,
+		},
+		{
+			name: "replace in place keeping comments",
+			content: `[user]
+	# who commits
+	name = Old ; old name
+	email = me@acme.com
+`,
+			edits: []configEdit{{key: "user.name", value: "New Name"}},
+			want: `[user]
+	# who commits
+	name = New Name
+	email = me@acme.com
+`,
+		},
+		{
+			name: "duplicates collapse to the first",
+			content: `[core]
+	editor = vim
+[user]
+	name = Me
+[core]
+	editor = nano
+	pager = less
+`,
+			edits: []configEdit{{key: "core.editor", value: "code --wait"}},
+			want: `[core]
+	editor = code --wait
+[user]
+	name = Me
+[core]
+	pager = less
+`,
+		},
+		{
+			name: "append to the last matching section",
+			content: `[user]
+	name = Me
+[core]
+	pager = less
+[user]
+	email = me@acme.com
+[alias]
+	st = status
+`,
+			edits: []configEdit{{key: "user.signingKey", value: "ABC123"}},
+			want: `[user]
+	name = Me
+[core]
+	pager = less
+[user]
+	email = me@acme.com
+	signingKey = ABC123
+[alias]
+	st = status
+`,
+		},
+		{
+			name:    "new subsection is quoted",
+			content: "[user]\n\tname = Me\n",
+			edits:   []configEdit{{key: `url.git@github.com-me:.insteadOf`, value: "git@github.com:"}},
+			want: `[user]
+	name = Me
+[url "git@github.com-me:"]
+	insteadOf = git@github.com:
+`,
+		},
+		{
+			name: "values are quoted when needed",
+			content: `[core]
+`,
+			edits: []configEdit{{key: "core.sshCommand", value: "ssh -i ~/.ssh/id # work"}},
+			want: `[core]
+	sshCommand = "ssh -i ~/.ssh/id # work"
+`,
+		},
+		{
+			name: "unset removes every value and continuations",
+			content: `[user]
+	name = Me
+	signingKey = ABC \
+DEF
+[user]
+	signingkey = GHI
+	email = me@acme.com
+`,
+			edits: []configEdit{{key: "user.signingkey", unset: true}},
+			want: `[user]
+	name = Me
+[user]
+	email = me@acme.com
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := testGitConfig(tt.content)
+			for _, e := range tt.edits {
+				var err error
+				if e.unset {
+					err = f.unset(e.key)
+				} else {
+					err = f.set(e.key, e.value)
+				}
+				if err != nil {
+					t.Fatalf("edit %s: %v", e.key, err)
+				}
+			}
+			if got := strings.Join(f.lines, "\n") + "\n"; got != tt.want {
+				t.Errorf("file =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGitConfigUnsupported(t *testing.T) {
+	for _, content := range []string{
+		"name = before any section\n",
+		"[user]\n\t!bad = x\n",
+	} {
+		f := testGitConfig(content)
+		if _, _, err := f.parse(); !errors.Is(err, errUnsupportedGitConfig) {
+			t.Errorf("parse(%q) = %v, want errUnsupportedGitConfig", content, err)
+		}
+		if err := f.set("user.name", "Me"); !errors.Is(err, errUnsupportedGitConfig) {
+			t.Errorf("set on %q = %v, want errUnsupportedGitConfig", content, err)
+		}
+	}
+}
+
+func TestGitConfigSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte("[user]\n\tname = Me\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := readGitConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.set("user.email", "me@acme.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.save(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[user]\n\tname = Me\n\temail = me@acme.com\n"; string(data) != want {
+		t.Errorf("saved %q, want %q", data, want)
+	}
+	if info, err := os.Stat(path); err != nil {
+		t.Error(err)
+	} else if info.Mode().Perm() != 0644 {
+		t.Errorf("mode = %v, want 0644 kept", info.Mode().Perm())
+	}
+	if _, err := os.Stat(path + ".lock"); !os.IsNotExist(err) {
+		t.Errorf("lock file left behind: %v", err)
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// githubAPIURL is the base URL of the GitHub REST API
+var githubAPIURL = "https://api.github.com"
+
+// offline disables GitHub API calls. It is set by --offline or GHS_OFFLINE.
+var offline bool
+
+// errOffline is returned when the GitHub API is needed but can't be reached
+// or offline mode is on, so callers can degrade to local behavior
+var errOffline = errors.New("GitHub API unavailable")
+
+// maxRateLimitWait is the longest ghs waits for a rate limit to reset before
+// giving up on a request
+const maxRateLimitWait = 30 * time.Second
+
+// lowRateLimit is the number of remaining requests below which ghs warns
+const lowRateLimit = 10
+
+// githubToken returns the token used for GitHub API calls, falling back to
+// the token gh is logged in with
+func githubToken() (string, error) {
+	return accountToken("")
+}
+
+// accountToken returns the token for a GitHub user: GH_TOKEN or
+// GITHUB_TOKEN when set, otherwise the token gh stores for the user, or for
+// the active gh account when username is empty
+func accountToken(username string) (string, error) {
+	token, _, err := findAccountToken(username)
+	return token, err
+}
+
+// findAccountToken is accountToken that also describes where the token
+// came from
+func findAccountToken(username string) (token, source string, err error) {
+	for _, name := range []string{"GH_TOKEN", "GITHUB_TOKEN"} {
+		if token := os.Getenv(name); token != "" {
+			return token, name, nil
+		}
+	}
+	args := []string{"auth", "token", "--hostname", "github.com"}
+	if username != "" {
+		args = append(args, "--user", username)
+	}
+	if out, err := execCommand("gh", args...).Output(); err == nil {
+		if token := strings.TrimSpace(string(out)); token != "" {
+			return token, "gh auth token", nil
+		}
+	}
+	return "", "", fmt.Errorf("no GitHub token found, set GH_TOKEN or GITHUB_TOKEN or log in with gh")
+}
+
+// rateLimitReset returns how long until the rate limit of a response resets,
+// from Retry-After or X-RateLimit-Reset
+func rateLimitReset(resp *http.Response) time.Duration {
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if epoch, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		if wait := time.Until(time.Unix(epoch, 0)); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
+
+// isRateLimited reports whether a response was refused by a rate limit
+func isRateLimited(resp *http.Response) bool {
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	return resp.StatusCode == http.StatusForbidden &&
+		(resp.Header.Get("X-RateLimit-Remaining") == "0" || resp.Header.Get("Retry-After") != "")
+}
+
+// warnLowRateLimit warns once the remaining request budget gets low
+func warnLowRateLimit(resp *http.Response) {
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if err != nil || remaining >= lowRateLimit {
+		return
+	}
+	reset := time.Now().Add(rateLimitReset(resp))
+	warnf("only %d GitHub API requests left until %s", remaining, reset.Format("15:04"))
+}
+
+// staleCache returns a cached response that is past its TTL, telling the user
+// why it is used
+func staleCache(cached cachedResponse, out interface{}, reason string) error {
+	warnf("%s, using cached data from %s ago", reason, time.Since(cached.Time).Round(time.Second))
+	return decodeAPIResponse(cached.Body, out)
+}
+
+// githubRequest calls the GitHub API, encoding body as JSON when it is not
+// nil and decoding the response into out when it is not nil. GET responses
+// are cached: within the TTL they are reused as is, after it GitHub is asked
+// with the cached ETag and a 304 reply reuses them as well. When GitHub can't
+// be reached, is rate limiting, or offline mode is on, older cached data is
+// used if there is any; otherwise the error wraps errOffline.
+func githubRequest(method, path, token string, body, out interface{}) error {
+	url := githubAPIURL + path
+	var cached cachedResponse
+	hasCache := false
+	// Installation lookups are signed with a new app JWT every time, so
+	// caching them by token would only litter the cache
+	cacheable := method == "GET" && !strings.HasSuffix(path, "/installation")
+	if cacheable {
+		cached, hasCache = readAPICache(url, token)
+		if hasCache && time.Since(cached.Time) < apiCacheTTL {
+			return decodeAPIResponse(cached.Body, out)
+		}
+	}
+	if offline {
+		if hasCache {
+			return staleCache(cached, out, "offline mode")
+		}
+		return fmt.Errorf("%w: offline mode is on", errOffline)
+	}
+
+	var payload []byte
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = data
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(method, url, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept", "application/vnd.github+json")
+		req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if hasCache && cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			if hasCache {
+				return staleCache(cached, out, "GitHub is unreachable")
+			}
+			if waitForRetry("GitHub API "+method+" "+path, attempt+1, err) {
+				continue
+			}
+			return fmt.Errorf("%w: %v", errOffline, err)
+		}
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		warnLowRateLimit(resp)
+
+		if isRateLimited(resp) {
+			wait := rateLimitReset(resp)
+			if hasCache {
+				return staleCache(cached, out, "GitHub API rate limit reached")
+			}
+			if attempt == 0 && wait <= maxRateLimitWait {
+				fmt.Printf("GitHub API rate limit reached, retrying in %s...\n", wait.Round(time.Second))
+				time.Sleep(wait)
+				continue
+			}
+			return fmt.Errorf("%w: rate limit reached, resets at %s", errOffline, time.Now().Add(wait).Format("15:04"))
+		}
+
+		// GitHub's load balancers answer 502-504 on transient failures
+		if resp.StatusCode >= 502 && resp.StatusCode <= 504 && !hasCache &&
+			waitForRetry("GitHub API "+method+" "+path, attempt+1, fmt.Errorf("%s", resp.Status)) {
+			continue
+		}
+		if resp.StatusCode == http.StatusNotModified && hasCache {
+			cached.Time = time.Now()
+			writeAPICache(url, token, cached)
+			return decodeAPIResponse(cached.Body, out)
+		}
+		if resp.StatusCode >= 300 {
+			var apiErr struct {
+				Message string `json:"message"`
+			}
+			if json.Unmarshal(data, &apiErr) == nil && apiErr.Message != "" {
+				return fmt.Errorf("GitHub API %s %s: %s (%s)", method, path, apiErr.Message, resp.Status)
+			}
+			return fmt.Errorf("GitHub API %s %s: %s", method, path, resp.Status)
+		}
+		if cacheable && json.Valid(data) {
+			writeAPICache(url, token, cachedResponse{Time: time.Now(), ETag: resp.Header.Get("ETag"), Body: data})
+		}
+		return decodeAPIResponse(data, out)
+	}
+}
+
+func decodeAPIResponse(data []byte, out interface{}) error {
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// createGitHubRepo creates a repository owned by the account's user or, when
+// owner is another login, by that organization
+func createGitHubRepo(account GitHubAccount, owner, name string, private bool) error {
+	token, _, err := tokenFor(account, owner, "")
+	if err != nil {
+		return err
+	}
+	path := "/user/repos"
+	if owner != account.Username {
+		path = "/orgs/" + owner + "/repos"
+	}
+	body := map[string]interface{}{"name": name, "private": private}
+	return githubRequest("POST", path, token, body, nil)
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GitHubApp holds the credentials of a GitHub App used instead of personal
+// access tokens
+type GitHubApp struct {
+	AppID          int64  `json:"app_id"`
+	PrivateKeyPath string `json:"private_key_path"`
+	// InstallationID is looked up from the owner when zero
+	InstallationID int64 `json:"installation_id,omitempty"`
+}
+
+// tokenRefApp selects the account's GitHub App in Tokens
+const tokenRefApp = "app"
+
+// appTokenUser is the user name git uses with an installation token
+const appTokenUser = "x-access-token"
+
+// appTokenMargin is how long before expiry a cached installation token is
+// replaced
+const appTokenMargin = 5 * time.Minute
+
+// appProblems checks the GitHub App settings of an account
+func appProblems(app *GitHubApp) []fieldProblem {
+	var problems []fieldProblem
+	if app.AppID <= 0 {
+		problems = append(problems, fieldProblem{"app.app_id", "required field is missing or not positive"})
+	}
+	if app.PrivateKeyPath == "" {
+		problems = append(problems, fieldProblem{"app.private_key_path", "required field is missing or empty"})
+	} else if !filepath.IsAbs(app.PrivateKeyPath) {
+		problems = append(problems, fieldProblem{"app.private_key_path", fmt.Sprintf("key path %q must be absolute", app.PrivateKeyPath)})
+	}
+	if app.InstallationID < 0 {
+		problems = append(problems, fieldProblem{"app.installation_id", "must be positive"})
+	}
+	return problems
+}
+
+// appJWT signs the short-lived JWT a GitHub App authenticates with
+func appJWT(app *GitHubApp) (string, error) {
+	data, err := os.ReadFile(app.PrivateKeyPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read app private key: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return "", fmt.Errorf("%s is not a PEM private key", app.PrivateKeyPath)
+	}
+	var key *rsa.PrivateKey
+	if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+		parsed, err8 := x509.ParsePKCS8PrivateKey(block.Bytes)
+		rsaKey, ok := parsed.(*rsa.PrivateKey)
+		if err8 != nil || !ok {
+			return "", fmt.Errorf("%s is not an RSA private key", app.PrivateKeyPath)
+		}
+		key = rsaKey
+	}
+
+	// Back-date the token a little against clock drift; GitHub allows ten
+	// minutes of validity at most
+	now := time.Now().Unix()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iat": now - 60,
+		"exp": now + 9*60,
+		"iss": strconv.FormatInt(app.AppID, 10),
+	})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign app token: %v", err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// appInstallation returns the installation of the app for owner/repo
+func appInstallation(app *GitHubApp, jwt, owner, repo string) (int64, error) {
+	if app.InstallationID > 0 {
+		return app.InstallationID, nil
+	}
+	var path string
+	switch {
+	case owner != "" && repo != "":
+		path = "/repos/" + owner + "/" + repo + "/installation"
+	case owner != "":
+		path = "/users/" + owner + "/installation"
+	default:
+		return 0, fmt.Errorf("set app.installation_id or give an owner to find the installation")
+	}
+	var installation struct {
+		ID int64 `json:"id"`
+	}
+	if err := githubRequest("GET", path, jwt, nil, &installation); err != nil {
+		return 0, fmt.Errorf("app %d is not installed for %s: %v", app.AppID, owner, err)
+	}
+	return installation.ID, nil
+}
+
+// appToken is a minted installation token as cached on disk
+type appToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func appTokenCachePath(app *GitHubApp, installation int64) string {
+	return filepath.Join(stateDir, "cache", "app", fmt.Sprintf("%d-%d.json", app.AppID, installation))
+}
+
+// appTokenKeyringPrefix starts the keyring names of cached installation tokens
+const appTokenKeyringPrefix = "app:"
+
+// readAppTokenCache returns the cached installation token. On Windows it is
+// kept in the Credential Manager instead of a file in the profile.
+func readAppTokenCache(app *GitHubApp, installation int64) (appToken, bool) {
+	var data []byte
+	if runtime.GOOS == "windows" {
+		store, err := openSecretStore()
+		if err != nil {
+			return appToken{}, false
+		}
+		secret, err := store.Get(fmt.Sprintf("%s%d-%d", appTokenKeyringPrefix, app.AppID, installation))
+		if err != nil {
+			return appToken{}, false
+		}
+		data = []byte(secret)
+	} else if data, _ = os.ReadFile(appTokenCachePath(app, installation)); data == nil {
+		return appToken{}, false
+	}
+	var cached appToken
+	return cached, json.Unmarshal(data, &cached) == nil
+}
+
+// writeAppTokenCache keeps a minted installation token for reuse
+func writeAppTokenCache(app *GitHubApp, installation int64, minted appToken) {
+	data, err := json.Marshal(minted)
+	if err != nil {
+		return
+	}
+	if runtime.GOOS == "windows" {
+		if store, err := openSecretStore(); err == nil {
+			store.Set(fmt.Sprintf("%s%d-%d", appTokenKeyringPrefix, app.AppID, installation), string(data))
+		}
+		return
+	}
+	cachePath := appTokenCachePath(app, installation)
+	if mkdirPrivate(filepath.Dir(cachePath)) == nil {
+		writePrivateFile(cachePath, data)
+	}
+}
+
+// mintAppToken returns an installation token of the account's app for
+// owner/repo, reusing a cached one until shortly before it expires
+func mintAppToken(account GitHubAccount, owner, repo string) (string, error) {
+	app := account.App
+	if app == nil {
+		return "", fmt.Errorf("account has no GitHub App configured")
+	}
+	jwt, err := appJWT(app)
+	if err != nil {
+		return "", err
+	}
+	installation, err := appInstallation(app, jwt, owner, repo)
+	if err != nil {
+		return "", err
+	}
+
+	if cached, ok := readAppTokenCache(app, installation); ok && time.Until(cached.ExpiresAt) > appTokenMargin {
+		return cached.Token, nil
+	}
+
+	var minted appToken
+	path := fmt.Sprintf("/app/installations/%d/access_tokens", installation)
+	if err := githubRequest("POST", path, jwt, nil, &minted); err != nil {
+		return "", fmt.Errorf("failed to create installation token: %v", err)
+	}
+	writeAppTokenCache(app, installation, minted)
+	return minted.Token, nil
+}
+
+// runAppCommand handles "app set|unset|token"
+func runAppCommand(config Config, args []string) (Config, error) {
+	if len(args) < 2 {
+		return config, fmt.Errorf("usage: ghs app <set|unset|token> <alias> ...")
+	}
+	alias, err := config.lookupAlias(args[1])
+	if err != nil {
+		return config, err
+	}
+	account := config.Accounts[alias]
+
+	switch args[0] {
+	case "set":
+		flags := flag.NewFlagSet("app set", flag.ContinueOnError)
+		appID := flags.Int64("app-id", 0, "GitHub App ID")
+		key := flags.String("key", "", "path of the app's private key (PEM)")
+		installation := flags.Int64("installation", 0, "installation ID (looked up from the owner when omitted)")
+		if positional, err := parseFlags(flags, args[2:]); err != nil {
+			return config, err
+		} else if len(positional) > 0 {
+			return config, fmt.Errorf("usage: ghs app set <alias> --app-id <id> --key <pem> [--installation <id>]")
+		}
+		app := &GitHubApp{AppID: *appID, PrivateKeyPath: expandPath(*key), InstallationID: *installation}
+		if problems := appProblems(app); len(problems) > 0 {
+			return config, fmt.Errorf("%s: %s", problems[0].Field, problems[0].Msg)
+		}
+		if _, err := appJWT(app); err != nil {
+			return config, err
+		}
+		account.App = app
+		fmt.Printf("Account '%s' uses GitHub App %d\n", alias, app.AppID)
+	case "unset":
+		account.App = nil
+		fmt.Printf("Account '%s' no longer uses a GitHub App\n", alias)
+	case "token":
+		if len(args) > 3 {
+			return config, fmt.Errorf("usage: ghs app token <alias> [owner[/repo]]")
+		}
+		owner, repo := "", ""
+		if len(args) == 3 {
+			owner, repo, _ = strings.Cut(args[2], "/")
+		}
+		token, err := mintAppToken(config.Defaults.apply(account), owner, repo)
+		if err != nil {
+			return config, err
+		}
+		fmt.Println(token)
+		return config, nil
+	default:
+		return config, fmt.Errorf("unknown app subcommand: %s", args[0])
+	}
+	config.Accounts[alias] = account
+	return config, nil
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// defaultAgentCacheTTL is gpg-agent's default-cache-ttl in seconds
+const defaultAgentCacheTTL = "600"
+
+// Cache times "gpg setup" writes when gpg-agent.conf sets none
+const (
+	setupCacheTTL    = "3600"
+	setupMaxCacheTTL = "28800"
+)
+
+// pinentryCandidates are the pinentry programs "gpg setup" looks for when
+// none is configured or found on PATH, GUI ones first
+var pinentryCandidates = []string{
+	"/opt/homebrew/bin/pinentry-mac",
+	"/usr/local/bin/pinentry-mac",
+	"/usr/bin/pinentry-gnome3",
+	"/usr/bin/pinentry-qt",
+	"/usr/bin/pinentry-curses",
+	"/usr/bin/pinentry-tty",
+}
+
+// signsWithGPG reports whether an account signs through gpg-agent, with
+// gpg or gpgsm
+func signsWithGPG(account GitHubAccount) bool {
+	return account.Signing != signingNone || account.SignTags
+}
+
+// gpgTTYScript is added to the output of "ghs env" for accounts that sign:
+// it tells gpg-agent which terminal a terminal pinentry should ask in
+const gpgTTYScript = `if [ -t 0 ]; then
+  export GPG_TTY=$(tty)
+  gpg-connect-agent updatestartuptty /bye >/dev/null 2>&1
+fi`
+
+// currentTTY returns the terminal on stdin, for GPG_TTY
+func currentTTY() string {
+	if runtime.GOOS == "windows" || !isTerminal(os.Stdin) {
+		return ""
+	}
+	cmd := execCommand("tty")
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// refreshGPGAgent points gpg-agent at the current terminal after switching
+// to an account that signs, so the pinentry doesn't open in the terminal
+// the agent was started from
+func refreshGPGAgent(account GitHubAccount) {
+	if !signsWithGPG(account) || currentTTY() == "" {
+		return
+	}
+	if err := execCommand("gpg-connect-agent", "updatestartuptty", "/bye").Run(); err != nil {
+		return
+	}
+	if os.Getenv("GPG_TTY") == "" {
+		_, options := gpgAgentConf()
+		if pinentry, err := findPinentry(options); err == nil && terminalPinentry(pinentry) {
+			warnf("GPG_TTY isn't set, so signing can't ask for the passphrase in this terminal; run ghs gpg setup")
+		}
+	}
+}
+
+// gpgSigners returns the aliases of accounts that sign with gpg or gpgsm,
+// which both ask gpg-agent for the passphrase
+func gpgSigners(config Config) []string {
+	var aliases []string
+	accounts := config.resolvedAccounts()
+	for _, alias := range sortedAliases(accounts) {
+		if signsWithGPG(accounts[alias]) {
+			aliases = append(aliases, alias)
+		}
+	}
+	return aliases
+}
+
+// gpgAgentConf returns the path of gpg-agent.conf and its options
+func gpgAgentConf() (string, map[string]string) {
+	homeDir, _ := os.UserHomeDir()
+	home := filepath.Join(homeDir, ".gnupg")
+	if out, err := execCommand("gpgconf", "--list-dirs", "homedir").Output(); err == nil {
+		home = strings.TrimSpace(string(out))
+	}
+	path := filepath.Join(home, "gpg-agent.conf")
+	options := map[string]string{}
+	f, err := os.Open(path)
+	if err != nil {
+		return path, options
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, _ := strings.Cut(line, " ")
+		options[key] = strings.TrimSpace(value)
+	}
+	return path, options
+}
+
+// findPinentry returns the pinentry gpg-agent uses: the configured
+// pinentry-program, or pinentry on PATH
+func findPinentry(options map[string]string) (string, error) {
+	if program := options["pinentry-program"]; program != "" {
+		if _, err := os.Stat(program); err != nil {
+			return "", fmt.Errorf("pinentry-program %s not found", program)
+		}
+		return program, nil
+	}
+	path, err := exec.LookPath("pinentry")
+	if err != nil {
+		return "", fmt.Errorf("no pinentry program found, gpg can't ask for passphrases")
+	}
+	return path, nil
+}
+
+// terminalPinentry reports whether a pinentry asks in the terminal, which
+// needs GPG_TTY to find it
+func terminalPinentry(path string) bool {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	name := filepath.Base(path)
+	return strings.Contains(name, "curses") || strings.Contains(name, "tty")
+}
+
+// checkGPGAgent explains "gpg failed to sign the data": gpg-agent has to
+// run, find a pinentry, and a terminal pinentry needs GPG_TTY
+func checkGPGAgent(config Config) *doctorResult {
+	if len(gpgSigners(config)) == 0 {
+		return nil
+	}
+	if err := execCommand("gpg", "--version").Run(); err != nil {
+		return &doctorResult{Status: doctorFail, Finding: "no_gpg", Message: "accounts sign commits, but gpg is not installed", Hint: "install GnuPG, or set \"signing\": \"none\" on the accounts"}
+	}
+	if out, err := execCommand("gpg-connect-agent", "/bye").CombinedOutput(); err != nil {
+		return &doctorResult{Status: doctorFail, Finding: "agent_down", Message: "gpg-agent doesn't start: " + errorLine(string(out), err),
+			Hint: "gpgconf --kill gpg-agent && gpgconf --launch gpg-agent"}
+	}
+	_, options := gpgAgentConf()
+	pinentry, err := findPinentry(options)
+	if err != nil {
+		return &doctorResult{Status: doctorFail, Finding: "no_pinentry", Message: err.Error(), Hint: "ghs gpg setup"}
+	}
+	data := map[string]string{"pinentry": pinentry}
+	if os.Getenv("GPG_TTY") == "" && runtime.GOOS != "windows" && terminalPinentry(pinentry) && isTerminal(os.Stdin) {
+		return &doctorResult{Status: doctorWarn, Finding: "no_gpg_tty", Message: fmt.Sprintf("GPG_TTY isn't set, so %s can't ask for the passphrase in this terminal", filepath.Base(pinentry)),
+			Hint: "ghs gpg setup, or export GPG_TTY=$(tty)", Data: data}
+	}
+	return &doctorResult{Status: doctorOK, Finding: "ok", Message: "gpg-agent running, pinentry " + pinentry, Data: data}
+}
+
+// checkGPGCache warns when the passphrase of an account's signing key isn't
+// cached: signing from an editor or another program without a terminal then
+// fails with a terminal pinentry
+func checkGPGCache(alias string, account GitHubAccount) *doctorResult {
+	if !signsWithGPG(account) || account.Signing == signingX509 {
+		return nil
+	}
+	key, err := findGPGKey(account.Email)
+	if err != nil || key.CardSerial != "" {
+		return nil
+	}
+	out, err := execCommand("gpg", "--list-secret-keys", "--with-keygrip", "--with-colons", strings.TrimSuffix(key.ID, "!")).Output()
+	if err != nil {
+		return nil
+	}
+	var grips []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if fields := strings.Split(line, ":"); len(fields) > 9 && fields[0] == "grp" {
+			grips = append(grips, fields[9])
+		}
+	}
+	_, options := gpgAgentConf()
+	ttl := options["default-cache-ttl"]
+	if ttl == "" {
+		ttl = defaultAgentCacheTTL
+	}
+	data := map[string]string{"key": key.ID, "cache_ttl": ttl}
+	for _, grip := range grips {
+		// S KEYINFO <grip> <type> <serial> <idstr> <cached> <protection> ...
+		out, err := execCommand("gpg-connect-agent", "KEYINFO "+grip, "/bye").Output()
+		fields := strings.Fields(string(out))
+		if err != nil || len(fields) < 8 || fields[1] != "KEYINFO" {
+			continue
+		}
+		if fields[6] == "1" || fields[7] != "P" {
+			return &doctorResult{Status: doctorOK, Finding: "ok", Message: fmt.Sprintf("passphrase of %s available (cache %ss)", key.ID, ttl), Data: data}
+		}
+	}
+	if len(grips) == 0 {
+		return nil
+	}
+	return &doctorResult{Status: doctorWarn, Finding: "not_cached", Message: fmt.Sprintf("passphrase of %s isn't cached (cache %ss); signing without a terminal fails until you sign once", key.ID, ttl),
+		Hint: "ghs gpg setup for a longer cache, or sign once in a terminal", Data: data}
+}
+
+// shellRC returns the startup file of the user's shell and the line that
+// exports GPG_TTY in it
+func shellRC() (string, string) {
+	home, _ := os.UserHomeDir()
+	switch filepath.Base(os.Getenv("SHELL")) {
+	case "zsh":
+		return filepath.Join(home, ".zshrc"), "export GPG_TTY=$(tty)"
+	case "fish":
+		return filepath.Join(home, ".config", "fish", "config.fish"), "set -gx GPG_TTY (tty)"
+	default:
+		return filepath.Join(home, ".bashrc"), "export GPG_TTY=$(tty)"
+	}
+}
+
+// runGPGCommand handles "gpg setup"
+func runGPGCommand(config Config, args []string) error {
+	if len(args) < 1 || args[0] != "setup" {
+		return fmt.Errorf("usage: ghs gpg setup [--yes]")
+	}
+	return setupGPG(config, args[1:])
+}
+
+// setupGPG writes what signing needs and is missing: a pinentry and longer
+// cache times in gpg-agent.conf, and GPG_TTY in the shell's startup file
+func setupGPG(config Config, args []string) error {
+	flags := flag.NewFlagSet("gpg setup", flag.ContinueOnError)
+	yes := flags.Bool("yes", false, "write the changes without asking")
+	if _, err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if err := execCommand("gpg", "--version").Run(); err != nil {
+		return fmt.Errorf("gpg is not installed")
+	}
+
+	confPath, options := gpgAgentConf()
+	var confLines []string
+	if _, err := findPinentry(options); err != nil {
+		for _, candidate := range pinentryCandidates {
+			if _, err := os.Stat(candidate); err == nil {
+				confLines = append(confLines, "pinentry-program "+candidate)
+				break
+			}
+		}
+		if len(confLines) == 0 {
+			warnf("%v; install pinentry (e.g. pinentry-mac, pinentry-gnome3 or pinentry-curses)", err)
+		}
+	}
+	if options["default-cache-ttl"] == "" {
+		confLines = append(confLines, "default-cache-ttl "+setupCacheTTL)
+	}
+	if options["max-cache-ttl"] == "" {
+		confLines = append(confLines, "max-cache-ttl "+setupMaxCacheTTL)
+	}
+
+	rcPath, rcLine := shellRC()
+	if data, err := os.ReadFile(rcPath); err == nil && strings.Contains(string(data), "GPG_TTY") || runtime.GOOS == "windows" {
+		rcLine = ""
+	}
+
+	if len(confLines) == 0 && rcLine == "" {
+		fmt.Println("Nothing to do: gpg-agent.conf and your shell are set up for signing")
+		return nil
+	}
+	if len(confLines) > 0 {
+		fmt.Printf("Add to %s:\n", confPath)
+		for _, line := range confLines {
+			fmt.Printf("  %s\n", line)
+		}
+	}
+	if rcLine != "" {
+		fmt.Printf("Add to %s:\n  %s\n", rcPath, rcLine)
+	}
+	if !*yes {
+		ok, err := confirm("Write these changes?", true)
+		if err != nil {
+			return fmt.Errorf("%v (pass --yes)", err)
+		}
+		if !ok {
+			return fmt.Errorf("aborted")
+		}
+	}
+
+	appendLines := func(path string, lines []string) error {
+		if err := mkdirPrivate(filepath.Dir(path)); err != nil {
+			return fmt.Errorf("failed to create %s: %v", filepath.Dir(path), err)
+		}
+		f, err := openPrivateAppend(path)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %v", path, err)
+		}
+		defer f.Close()
+		_, err = fmt.Fprintf(f, "\n# Added by ghs gpg setup\n%s\n", strings.Join(lines, "\n"))
+		return err
+	}
+	if len(confLines) > 0 {
+		if err := appendLines(confPath, confLines); err != nil {
+			return err
+		}
+		if err := execCommand("gpgconf", "--reload", "gpg-agent").Run(); err != nil {
+			warnf("failed to reload gpg-agent: %v", err)
+		}
+		fmt.Printf("Updated %s and reloaded gpg-agent\n", confPath)
+	}
+	if rcLine != "" {
+		if err := appendLines(rcPath, []string{rcLine}); err != nil {
+			return err
+		}
+		fmt.Printf("Updated %s; open a new shell or run: %s\n", rcPath, rcLine)
+	}
+	if len(gpgSigners(config)) == 0 {
+		fmt.Println("Note: no account signs with GPG yet")
+	}
+	return nil
+}
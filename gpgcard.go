@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gpgKey is a secret key usable for signing
+type gpgKey struct {
+	// ID is what user.signingkey is set to. Subkeys carry a "!" so gpg
+	// signs with exactly that subkey.
+	ID string
+	// CardSerial is the serial number of the smartcard holding the secret
+	// part, empty for keys on disk
+	CardSerial string
+	// Expires is zero for keys that don't expire
+	Expires time.Time
+}
+
+// findGPGKey finds the signing key for the given email in
+// "gpg --list-secret-keys --with-colons". A primary key whose secret part is
+// offline ("sec#") or on a card ("sec>") hands signing to a subkey, which
+// may itself live on a card ("ssb>").
+func findGPGKey(email string) (gpgKey, error) {
+	out, err := execCommand("gpg", "--list-secret-keys", "--with-colons", email).Output()
+	if err != nil {
+		return gpgKey{}, fmt.Errorf("failed to list GPG keys: %v", err)
+	}
+
+	for _, line := range strings.Split(string(out), "\n") {
+		// Fields: 1 type, 2 validity, 5 key ID, 7 expiry, 12 capabilities, 15 serial
+		// number of the token, "#" when the secret part is missing
+		fields := strings.Split(line, ":")
+		if len(fields) < 15 || (fields[0] != "sec" && fields[0] != "ssb") {
+			continue
+		}
+		switch fields[1] {
+		case "r", "e", "d", "i":
+			// revoked, expired, disabled or invalid
+			continue
+		}
+		if !strings.Contains(fields[11], "s") || fields[14] == "#" {
+			continue
+		}
+		key := gpgKey{ID: fields[4]}
+		if fields[0] == "ssb" {
+			key.ID += "!"
+		}
+		if fields[14] != "" && fields[14] != "+" {
+			key.CardSerial = fields[14]
+		}
+		if epoch, err := strconv.ParseInt(fields[6], 10, 64); err == nil {
+			key.Expires = time.Unix(epoch, 0)
+		}
+		return key, nil
+	}
+	return gpgKey{}, fmt.Errorf("no GPG key found for email: %s", email)
+}
+
+// gpgCardSerial returns the serial number of the inserted smartcard
+func gpgCardSerial() (string, error) {
+	out, err := execCommand("gpg", "--card-status", "--with-colons").Output()
+	if err != nil {
+		return "", fmt.Errorf("no smartcard found")
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if fields := strings.Split(line, ":"); len(fields) >= 2 && fields[0] == "serial" {
+			return fields[1], nil
+		}
+	}
+	return "", fmt.Errorf("smartcard has no serial number")
+}
+
+// sameCard reports whether two card serial numbers name the same card. gpg
+// shows the full application ID in some places and only the serial number
+// part in others.
+func sameCard(a, b string) bool {
+	a, b = strings.ToUpper(a), strings.ToUpper(b)
+	return strings.Contains(a, b) || strings.Contains(b, a)
+}
+
+// checkGPGCard is the doctor check of accounts signing with a smartcard key:
+// the card has to be inserted
+func checkGPGCard(alias string, account GitHubAccount) *doctorResult {
+	if account.Signing == signingNone {
+		return nil
+	}
+	key, err := findGPGKey(account.Email)
+	if err != nil || key.CardSerial == "" {
+		return nil
+	}
+	serial, err := gpgCardSerial()
+	if err != nil {
+		return &doctorResult{Status: doctorFail, Finding: "missing", Message: fmt.Sprintf("signing key %s is on card %s: %v", key.ID, key.CardSerial, err), Hint: "insert the card",
+			Data: map[string]string{"key": key.ID, "serial": key.CardSerial}}
+	}
+	if !sameCard(serial, key.CardSerial) {
+		return &doctorResult{Status: doctorFail, Finding: "wrong_card", Message: fmt.Sprintf("signing key %s is on card %s, but card %s is inserted", key.ID, key.CardSerial, serial), Hint: "insert the right card",
+			Data: map[string]string{"key": key.ID, "serial": key.CardSerial, "inserted": serial}}
+	}
+	return &doctorResult{Status: doctorOK, Finding: "ok", Message: fmt.Sprintf("signing key %s on card %s", key.ID, key.CardSerial), Data: map[string]string{"key": key.ID, "serial": key.CardSerial}}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// identityAgentGPG selects gpg-agent's SSH socket as the identity agent
+const identityAgentGPG = "gpg-agent"
+
+// hardwareKey reports whether the account's key lives on a hardware token,
+// reached through a PKCS#11 provider or an agent. ssh_key_path is then
+// optional and, when set, may name the public key only.
+func (a GitHubAccount) hardwareKey() bool {
+	return a.PKCS11Provider != "" || a.IdentityAgent != ""
+}
+
+// keyMissing reports whether the key file an account needs doesn't exist
+func keyMissing(account GitHubAccount) bool {
+	if httpsOnly {
+		return false
+	}
+	if account.SSHKeyPath == "" {
+		return !account.hardwareKey()
+	}
+	_, err := os.Stat(account.SSHKeyPath)
+	return os.IsNotExist(err)
+}
+
+// resolveIdentityAgent turns "gpg-agent" into the path of gpg-agent's SSH
+// socket
+func resolveIdentityAgent(agent string) (string, error) {
+	if agent != identityAgentGPG {
+		return agent, nil
+	}
+	out, err := execCommand("gpgconf", "--list-dirs", "agent-ssh-socket").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to find gpg-agent's SSH socket: %v", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// sshCommandOptions returns the ssh options that make ssh use the account's
+// key, for GIT_SSH_COMMAND
+func sshCommandOptions(account GitHubAccount) []string {
+	var options []string
+	if account.SSHKeyPath != "" {
+		options = append(options, "-i", shellQuote(account.SSHKeyPath), "-o", "IdentitiesOnly=yes")
+	}
+	if account.PKCS11Provider != "" {
+		options = append(options, "-o", shellQuote("PKCS11Provider="+account.PKCS11Provider))
+	}
+	if account.IdentityAgent != "" {
+		if agent, err := resolveIdentityAgent(account.IdentityAgent); err == nil {
+			options = append(options, "-o", shellQuote("IdentityAgent="+agent))
+		}
+	}
+	if account.KnownHosts {
+		options = append(options, "-o", shellQuote("UserKnownHostsFile="+account.KnownHostsFile()))
+	}
+	if account.HostKeyChecking != "" {
+		options = append(options, "-o", "StrictHostKeyChecking="+account.HostKeyChecking)
+	}
+	return options
+}
+
+// applyHardwareFlags updates the hardware token settings of an account from
+// edit flags
+func applyHardwareFlags(account GitHubAccount, flags *flag.FlagSet, provider, agent string) GitHubAccount {
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "pkcs11-provider":
+			account.PKCS11Provider = provider
+		case "identity-agent":
+			account.IdentityAgent = agent
+			if agent != "" && agent != identityAgentGPG {
+				account.IdentityAgent = expandPath(agent)
+			}
+		}
+	})
+	return account
+}
+
+// tokenKeys lists the public keys a hardware token offers
+func tokenKeys(account GitHubAccount) ([]string, error) {
+	var cmd *tracedCmd
+	if account.PKCS11Provider != "" {
+		cmd = execCommand("ssh-keygen", "-D", account.PKCS11Provider)
+	} else {
+		agent, err := resolveIdentityAgent(account.IdentityAgent)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(agent); err != nil {
+			return nil, fmt.Errorf("agent socket %s not found", agent)
+		}
+		cmd = execCommand("ssh-add", "-L")
+		cmd.Env = append(os.Environ(), "SSH_AUTH_SOCK="+agent)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("no keys available (%v)", err)
+	}
+	var keys []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if fields := strings.Fields(line); len(fields) >= 2 && strings.Contains(fields[0], "-") {
+			keys = append(keys, fields[0]+" "+fields[1])
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no keys available")
+	}
+	return keys, nil
+}
+
+// checkHardwareKey is the doctor check of a hardware token: it has to be
+// present and offer the account's public key when one is configured
+func checkHardwareKey(alias string, account GitHubAccount) *doctorResult {
+	if !account.hardwareKey() {
+		return nil
+	}
+	if account.PKCS11Provider != "" {
+		if _, err := os.Stat(account.PKCS11Provider); err != nil {
+			return &doctorResult{Status: doctorFail, Finding: "provider_not_found", Message: fmt.Sprintf("PKCS#11 provider %s not found", account.PKCS11Provider), Hint: "install the token's PKCS#11 library, e.g. ykcs11 or opensc",
+				Data: map[string]string{"provider": account.PKCS11Provider}}
+		}
+	}
+	keys, err := tokenKeys(account)
+	if err != nil {
+		return &doctorResult{Status: doctorFail, Finding: "no_keys", Message: err.Error(), Hint: "insert and unlock the token"}
+	}
+	if account.SSHKeyPath == "" {
+		return &doctorResult{Status: doctorOK, Finding: "ok", Message: fmt.Sprintf("token offers %d key(s)", len(keys)), Data: map[string]string{"keys": fmt.Sprint(len(keys))}}
+	}
+	data, err := os.ReadFile(account.SSHKeyPath)
+	fields := strings.Fields(string(data))
+	if err != nil || len(fields) < 2 {
+		return &doctorResult{Status: doctorWarn, Finding: "public_key_unreadable", Message: fmt.Sprintf("can't read the public key %s to compare", account.SSHKeyPath), Data: map[string]string{"path": account.SSHKeyPath}}
+	}
+	for _, key := range keys {
+		if key == fields[0]+" "+fields[1] {
+			return &doctorResult{Status: doctorOK, Finding: "ok", Message: "token offers the account's key", Data: map[string]string{"path": account.SSHKeyPath}}
+		}
+	}
+	return &doctorResult{Status: doctorFail, Finding: "wrong_key", Message: fmt.Sprintf("token doesn't offer the key in %s", account.SSHKeyPath), Hint: "insert the right token or fix --key", Data: map[string]string{"path": account.SSHKeyPath}}
+}
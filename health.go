@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// healthRecord is what the last "ghs check" found about an account
+type healthRecord struct {
+	Checked time.Time `json:"checked"`
+	// Failures are the failed steps by name, since when they fail
+	Failures map[string]healthFailure `json:"failures,omitempty"`
+	// Expires holds the expiry of the account's credentials by name
+	Expires map[string]time.Time `json:"expires,omitempty"`
+}
+
+// healthFailure is a failing "ghs check" step
+type healthFailure struct {
+	Since   time.Time `json:"since"`
+	Message string    `json:"message"`
+}
+
+// healthPath returns the file the results of "ghs check" are kept in
+func healthPath() string {
+	return filepath.Join(stateDir, "health.json")
+}
+
+// readHealth reads the recorded health of every account; a missing or
+// broken file is no data
+func readHealth() map[string]healthRecord {
+	health := map[string]healthRecord{}
+	data, err := os.ReadFile(healthPath())
+	if err == nil {
+		json.Unmarshal(data, &health)
+	}
+	return health
+}
+
+// recordHealth stores the results of "ghs check", keeping when the steps
+// that still fail started failing
+func recordHealth(results []accountCheck) error {
+	health := readHealth()
+	now := time.Now()
+	for _, result := range results {
+		previous := health[result.Alias]
+		record := healthRecord{Checked: now, Failures: map[string]healthFailure{}, Expires: map[string]time.Time{}}
+		for _, step := range result.Steps {
+			if !step.Expires.IsZero() {
+				record.Expires[step.Expiring] = step.Expires
+			}
+			if step.Status != doctorFail {
+				continue
+			}
+			since := now
+			if failure, ok := previous.Failures[step.Name]; ok {
+				since = failure.Since
+			}
+			record.Failures[step.Name] = healthFailure{Since: since, Message: step.Message}
+		}
+		health[result.Alias] = record
+	}
+	data, err := json.MarshalIndent(health, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := mkdirPrivate(stateDir); err != nil {
+		return fmt.Errorf("failed to create %s: %v", stateDir, err)
+	}
+	return writePrivateFile(healthPath(), data)
+}
+
+// daysText describes a number of days from now
+func daysText(days int) string {
+	switch {
+	case days <= 0:
+		return "today"
+	case days == 1:
+		return "in 1 day"
+	}
+	return fmt.Sprintf("in %d days", days)
+}
+
+// sinceText describes a past time in words
+func sinceText(t time.Time) string {
+	days := int(time.Since(t).Hours() / 24)
+	switch {
+	case days == 0:
+		return "today"
+	case days == 1:
+		return "yesterday"
+	case days < 7:
+		return fmt.Sprintf("%d days ago", days)
+	case days < 14:
+		return "last week"
+	}
+	return t.Format("2006-01-02")
+}
+
+// healthWarnings turns the recorded health of the configured accounts into
+// one line per failed check. Expiries are left to the daily reminders.
+func healthWarnings(config Config) []string {
+	health := readHealth()
+	var warnings []string
+	for _, alias := range sortedAliases(config.Accounts) {
+		record, ok := health[alias]
+		if !ok {
+			continue
+		}
+		var steps []string
+		for step := range record.Failures {
+			steps = append(steps, step)
+		}
+		sort.Strings(steps)
+		for _, step := range steps {
+			failure := record.Failures[step]
+			warnings = append(warnings, fmt.Sprintf("%s: %s failing since %s (%s)", alias, step, sinceText(failure.Since), failure.Message))
+		}
+	}
+	return warnings
+}
+
+// quietHealthCommands print output meant for other programs, which health
+// warnings would spoil
+var quietHealthCommands = map[string]bool{
+	"env": true, "exec": true, "credential": true, "resolve": true, "serve": true,
+	"daemon": true, "help": true, "check": true, "export": true,
+}
+
+// printHealthWarnings prints the health warnings and the day's reminder on
+// stderr before a command runs, unless the config silences them or stderr
+// isn't a terminal
+func printHealthWarnings(config Config, command string) {
+	if config.SilenceHealthWarnings || quietHealthCommands[command] || !isTerminal(os.Stderr) {
+		return
+	}
+	for _, warning := range healthWarnings(config) {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+	if command != "remind" {
+		printDailyReminder(config)
+	}
+}
@@ -0,0 +1,838 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// helpEntry is one line of a command's help: a flag, an example or a common
+// error, with what it means
+type helpEntry struct {
+	Text string
+	Note string
+}
+
+// commandDoc describes a command for "help <command>"
+type commandDoc struct {
+	Summary  string
+	Usage    []string
+	Flags    []helpEntry
+	Examples []helpEntry
+	Errors   []helpEntry
+	Related  []string
+}
+
+// commandDocs holds the help of every command in commandNames
+var commandDocs = map[string]commandDoc{
+	"actions": {
+		Summary: "Configure git in a GitHub Actions job from GITHUB_TOKEN or OIDC",
+		Usage:   []string{"ghs actions setup [--account <alias>] [--oidc-audience <aud> --exchange <command>]"},
+		Flags: []helpEntry{
+			{"--account <alias>", "account whose name, email and tokens the job uses (default github-actions[bot])"},
+			{"--oidc-audience <aud>", "request an OIDC token for this audience"},
+			{"--exchange <command>", "command turning $GHS_OIDC_TOKEN into a GitHub token"},
+		},
+		Examples: []helpEntry{
+			{"ghs actions setup", "commit as github-actions[bot] with GITHUB_TOKEN"},
+			{"ghs actions setup --account release-bot", "commit and push as a configured account"},
+		},
+		Errors: []helpEntry{
+			{"not running in GitHub Actions", "GITHUB_ACTIONS isn't true; use ghs ci-setup in other CI systems"},
+			{"--oidc-audience needs --exchange", "name the command that trades the OIDC token for a GitHub token"},
+		},
+		Related: []string{"ci-setup", "token"},
+	},
+	"add": {
+		Summary: "Add a GitHub account and configure its SSH host",
+		Usage: []string{
+			"ghs add [--alias <alias>] [--username <user>] [--name <name>] [--email <email>] [--key <path>] [flags]",
+			"ghs add --from-json <file|->",
+		},
+		Flags: []helpEntry{
+			{"--alias, --username, --name, --email, --key", "the account's fields; missing ones are asked"},
+			{"--generate-key", "generate the SSH key without asking if it doesn't exist"},
+			{"--key-type rsa|ed25519|ecdsa", "type of a generated key"},
+			{"--signing gpg|x509|none", "how commits are signed"},
+			{"--tag <tag>", "tag the account (repeatable)"},
+			{"--git-config key=value", "set a git config key for the account (repeatable)"},
+			{"--host-key-checking yes|accept-new|ask", "StrictHostKeyChecking for the account"},
+			{"--force", "replace an existing account with the same alias"},
+		},
+		Examples: []helpEntry{
+			{"ghs add", "answer the questions one by one"},
+			{"ghs add --alias work --username acme-me --email me@acme.com --key ~/.ssh/id_work --generate-key", "add an account without questions"},
+			{"ghs add --from-json accounts.json", "add every account of a JSON array"},
+		},
+		Errors: []helpEntry{
+			{"account 'x' already exists", "pick another alias, or pass --force to replace it"},
+			{"username is already used by account 'x'", "each GitHub user has one account; edit that one instead"},
+		},
+		Related: []string{"edit", "copy", "import", "alias"},
+	},
+	"alias": {
+		Summary: "Add or remove other names an account answers to",
+		Usage:   []string{"ghs alias <add|remove> <alias> <name>..."},
+		Examples: []helpEntry{
+			{"ghs alias add work w corp", "\"w\" and \"corp\" now name the work account"},
+			{"ghs alias remove work corp", "forget one of them"},
+		},
+		Errors: []helpEntry{
+			{"\"w\" already names account 'x'", "names are unique across accounts; remove it there first"},
+		},
+		Related: []string{"list", "tag", "edit"},
+	},
+	"app": {
+		Summary: "Use GitHub App installation tokens for an account",
+		Usage: []string{
+			"ghs app set <alias> --app-id <id> --key <pem> [--installation <id>]",
+			"ghs app unset <alias>",
+			"ghs app token <alias>",
+		},
+		Flags: []helpEntry{
+			{"--key <pem>", "path of the app's private key (set)"},
+		},
+		Examples: []helpEntry{
+			{"ghs app set release-bot --app-id 12345 --key ~/.keys/app.pem", "mint tokens from the app"},
+			{"ghs app token release-bot", "print a fresh installation token"},
+		},
+		Related: []string{"token", "credential"},
+	},
+	"batch": {
+		Summary: "Run a file of ghs commands, rolling all back if one fails",
+		Usage:   []string{"ghs batch <file|->"},
+		Examples: []helpEntry{
+			{"ghs batch onboarding.ghs", "one command per line, without the ghs prefix"},
+			{"cat steps.json | ghs batch -", "a JSON array of argument arrays from stdin"},
+		},
+		Errors: []helpEntry{
+			{"line n: <command> can't run in a batch", "only commands that change nothing but the config, SSH config or git config can"},
+			{"line n: add --generate-key can't run in a batch", "generate the key first, or add the account outside the batch"},
+		},
+		Related: []string{"import", "merge"},
+	},
+	"cache": {
+		Summary:  "Remove cached GitHub API responses",
+		Usage:    []string{"ghs cache clear"},
+		Examples: []helpEntry{{"ghs cache clear", "ask GitHub again next time"}},
+		Related:  []string{"token"},
+	},
+	"cert": {
+		Summary: "Fetch new SSH certificates with the accounts' certificate commands",
+		Usage:   []string{"ghs cert refresh <alias|--all>"},
+		Examples: []helpEntry{
+			{"ghs cert refresh work", "renew one account's certificate"},
+			{"ghs cert refresh --all", "renew every account that has a certificate command"},
+		},
+		Errors: []helpEntry{
+			{"no ssh_certificate_command configured", "set one with ghs edit <alias> --ssh-certificate-command"},
+		},
+		Related: []string{"edit", "doctor"},
+	},
+	"check": {
+		Summary: "Check accounts end to end and fail when one is broken",
+		Usage:   []string{"ghs check [alias...] | --tag <tag>... [--jobs n]"},
+		Flags: []helpEntry{
+			{"--tag <tag>", "check the accounts with this tag (repeatable)"},
+			{"--jobs n", "number of accounts checked in parallel"},
+		},
+		Examples: []helpEntry{
+			{"ghs check", "check every account: key, SSH login, signing key and token"},
+			{"ghs check work personal", "check only these accounts"},
+			{"ghs check --tag client-x", "check the accounts tagged client-x"},
+		},
+		Related: []string{"doctor", "test", "remind"},
+	},
+	"ci-setup": {
+		Summary: "Configure git in a CI job from GHS_CI_* variables",
+		Usage:   []string{"ghs ci-setup [--local] [--dir <dir>] [--cleanup]"},
+		Flags: []helpEntry{
+			{"--dir <dir>", "workspace directory (default $RUNNER_TEMP, $CI_PROJECT_DIR, $WORKSPACE or the current directory)"},
+			{"--local", "configure the current repository instead of the global git config"},
+			{"--cleanup", "remove the key and SSH config written by an earlier run"},
+		},
+		Examples: []helpEntry{
+			{"ghs ci-setup", "identity from GHS_CI_NAME and GHS_CI_EMAIL, key from GHS_CI_SSH_KEY"},
+			{"ghs ci-setup --cleanup", "at the end of the job"},
+		},
+		Related: []string{"actions", "env"},
+	},
+	"clone": {
+		Summary: "Clone a repository with the account of its owner",
+		Usage: []string{
+			"ghs clone <url> [dir] [--account <alias>] [--mirror|--bare]",
+			"ghs clone --from-file <file> [--dest <dir>] [--jobs n] [--account <alias>] [--mirror|--bare]",
+		},
+		Flags: []helpEntry{
+			{"--account <alias>", "account to clone with instead of the one matched by owner"},
+			{"--mirror", "create a mirror of every ref (implies a bare repository)"},
+			{"--bare", "create a bare repository"},
+			{"--from-file <file>", "clone every repository listed in the file, one URL or owner/repo per line"},
+			{"--dest <dir>", "directory the repositories of --from-file are cloned into"},
+			{"--jobs n", "number of repositories cloned in parallel with --from-file"},
+		},
+		Examples: []helpEntry{
+			{"ghs clone git@github.com:acme/api.git", "clone through the host of the account serving acme"},
+			{"ghs clone https://github.com/acme/api --account personal", "choose the account yourself"},
+			{"ghs clone --from-file repos.txt --dest ~/code", "clone a list in parallel"},
+		},
+		Errors: []helpEntry{
+			{"Permission denied (publickey)", "the account's key isn't on GitHub; ghs test <alias> checks it"},
+		},
+		Related: []string{"resolve", "rule", "which"},
+	},
+	"config": {
+		Summary:  "Check the config file for schema errors",
+		Usage:    []string{"ghs config validate"},
+		Examples: []helpEntry{{"ghs config validate", "report problems with their line and field"}},
+		Related:  []string{"doctor", "lock"},
+	},
+	"copy": {
+		Summary: "Duplicate an account and edit the fields that must change",
+		Usage:   []string{"ghs copy <alias> <new-alias> [--username|--name|--email|--key|--notes <value>]"},
+		Flags: []helpEntry{
+			{"--username, --name, --email, --key, --notes", "fields of the new account; the username must differ"},
+		},
+		Examples: []helpEntry{
+			{"ghs copy client-a client-b", "asked for the fields that must differ"},
+			{"ghs copy client-a client-b --username alice-clientb --email alice@client-b.example", "without questions"},
+		},
+		Related: []string{"add", "edit"},
+	},
+	"credential": {
+		Summary: "Keep HTTPS logins per account",
+		Usage: []string{
+			"ghs credential setup [--mode ghs|gcm]",
+			"ghs credential status|remove",
+			"ghs credential get",
+		},
+		Flags: []helpEntry{
+			{"--mode ghs|gcm", "answer with account tokens, or keep Git Credential Manager (setup)"},
+		},
+		Examples: []helpEntry{
+			{"ghs credential setup", "make ghs git's credential helper for github.com"},
+			{"ghs credential status", "show what is set up"},
+		},
+		Related: []string{"token", "app"},
+	},
+	"current": {
+		Summary:  "Show the repository's identity, account, signing and remotes",
+		Usage:    []string{"ghs current"},
+		Examples: []helpEntry{{"ghs current", "inside a repository"}},
+		Related:  []string{"status", "switch"},
+	},
+	"daemon": {
+		Summary: "Answer account queries of editors and prompts on a unix socket",
+		Usage:   []string{"ghs daemon [--socket <path>]"},
+		Flags: []helpEntry{
+			{"--socket <path>", "path of the unix socket"},
+		},
+		Examples: []helpEntry{
+			{"ghs daemon &", "listen on ~/.ghs/ghs.sock"},
+		},
+		Related: []string{"serve", "status"},
+	},
+	"doctor": {
+		Summary: "Check keys, certificates and tools, with hints to fix problems",
+		Usage:   []string{"ghs doctor [alias] [--json]"},
+		Flags: []helpEntry{
+			{"--json", "print the results as JSON with stable finding codes"},
+		},
+		Examples: []helpEntry{
+			{"ghs doctor", "check the setup and every account"},
+			{"ghs doctor work --json", "one account, for tools"},
+		},
+		Related: []string{"check", "test", "config"},
+	},
+	"edit": {
+		Summary: "Edit an account",
+		Usage:   []string{"ghs edit <alias> [flags]"},
+		Flags: []helpEntry{
+			{"--username, --name, --email, --key, --notes", "the account's fields"},
+			{"--git-config key=value", "set a git config key for the account, empty value removes it (repeatable)"},
+			{"--lfs-url, --lfs-credential-helper", "Git LFS endpoint and its credential helper"},
+			{"--default-branch, --commit-template", "init.defaultBranch and commit.template of the account"},
+			{"--ssh-certificate, --ssh-certificate-command", "CA-signed certificate and the command refreshing it"},
+			{"--pkcs11-provider, --identity-agent", "keys on hardware tokens"},
+			{"--sign-tags, --push-signing true|if-asked", "tag and push signing"},
+			{"--multiplex, --control-persist, --add-keys-to-agent", "connection reuse and the agent"},
+			{"--known-hosts, --host-key-checking", "host key handling"},
+			{"--key-created, --key-rotation", "key dates and rotation interval"},
+		},
+		Examples: []helpEntry{
+			{"ghs edit work --email me@acme.com", "change one field"},
+			{"ghs edit work --git-config core.editor=vim", "a git setting for the account's repositories"},
+			{"ghs edit work", "asked for every field, current values as defaults"},
+		},
+		Related: []string{"copy", "tag", "alias", "list"},
+	},
+	"env": {
+		Summary: "Print shell exports that commit and push as an account",
+		Usage:   []string{"ghs env [alias]"},
+		Examples: []helpEntry{
+			{"eval \"$(ghs env work)\"", "this shell commits and pushes as work"},
+		},
+		Errors: []helpEntry{
+			{"no account given and GHS_ACCOUNT is not set", "name the account or set GHS_ACCOUNT"},
+		},
+		Related: []string{"exec", "switch"},
+	},
+	"exec": {
+		Summary: "Run a command as an account",
+		Usage:   []string{"ghs exec [alias] -- <command>"},
+		Examples: []helpEntry{
+			{"ghs exec work -- git push", "push with the work account's key"},
+			{"GHS_ACCOUNT=work ghs exec -- make release", "the account from the environment"},
+		},
+		Related: []string{"env", "switch"},
+	},
+	"export": {
+		Summary: "Print the managed SSH config section without writing it",
+		Usage:   []string{"ghs export ssh-config [--ignore-existing]"},
+		Flags: []helpEntry{
+			{"--ignore-existing", "include hosts that have a hand-written block in the local SSH config"},
+		},
+		Examples: []helpEntry{
+			{"ghs export ssh-config > ghs.conf", "for an Include on another machine"},
+		},
+		Related: []string{"sshconfig", "import"},
+	},
+	"gpg": {
+		Summary:  "Write the gpg-agent.conf and shell settings GPG signing needs",
+		Usage:    []string{"ghs gpg setup [--yes]"},
+		Flags:    []helpEntry{{"--yes", "write the changes without asking"}},
+		Examples: []helpEntry{{"ghs gpg setup", "preview and confirm the changes"}},
+		Related:  []string{"doctor", "verify"},
+	},
+	"help": {
+		Summary: "Show every command, or the help of one",
+		Usage:   []string{"ghs help [command]"},
+		Examples: []helpEntry{
+			{"ghs help", "list every command"},
+			{"ghs help switch", "usage, flags, examples and common errors of switch"},
+		},
+	},
+	"import": {
+		Summary: "Add accounts from a CSV file or the hand-written hosts of the SSH config",
+		Usage: []string{
+			"ghs import csv <file> [--dry-run] [--on-duplicate skip|update|fail] [--map field=column]",
+			"ghs import ssh-config [--dry-run] [--on-duplicate skip|update|fail] [--name <name>] [--email username=email] [--keep-blocks]",
+		},
+		Flags: []helpEntry{
+			{"--dry-run", "show what would be imported without changing anything"},
+			{"--on-duplicate skip|update|fail", "what to do with existing aliases"},
+			{"--map field=column", "read an account field from another column (csv, repeatable)"},
+			{"--keep-blocks", "leave the Host blocks hand-written (ssh-config)"},
+			{"--name, --email username=email", "fields the SSH config doesn't have (ssh-config)"},
+		},
+		Examples: []helpEntry{
+			{"ghs import csv accounts.csv --dry-run", "preview a CSV import"},
+			{"ghs import ssh-config", "one account per github.com-<username> host"},
+		},
+		Related: []string{"migrate", "add", "merge"},
+	},
+	"init": {
+		Summary: "Create a repository for an account with an origin remote",
+		Usage:   []string{"ghs init <alias> [dir] [--owner <owner>] [--name <name>] [--create [--private]] [--push]"},
+		Flags: []helpEntry{
+			{"--owner <owner>", "user or organization owning the repository (default: the account's username)"},
+			{"--name <name>", "repository name (default: the directory name)"},
+			{"--create", "create the repository on GitHub (needs GH_TOKEN or GITHUB_TOKEN)"},
+			{"--private", "make the created repository private"},
+			{"--push", "push the initial branch, creating an empty commit if needed"},
+		},
+		Examples: []helpEntry{
+			{"ghs init work api --owner acme", "a local repository with origin git@github.com-<user>:acme/api.git"},
+			{"ghs init personal --create --private --push", "also create it on GitHub"},
+		},
+		Related: []string{"clone", "switch"},
+	},
+	"install-git-alias": {
+		Summary: "Make \"git ghs <command>\" run ghs",
+		Usage:   []string{"ghs install-git-alias [--link] [--remove]"},
+		Flags: []helpEntry{
+			{"--link", "create a git-ghs link next to the executable instead of a git alias"},
+			{"--remove", "remove the alias and link"},
+		},
+		Examples: []helpEntry{{"ghs install-git-alias", "then: git ghs switch work"}},
+		Related:  []string{"uninstall"},
+	},
+	"list": {
+		Summary: "List the configured accounts",
+		Usage:   []string{"ghs list [--tag <tag>] [--verbose]"},
+		Flags: []helpEntry{
+			{"--tag <tag>", "only accounts with this tag (repeatable)"},
+			{"--verbose", "show every account detail"},
+		},
+		Examples: []helpEntry{
+			{"ghs list", "aliases, names and emails"},
+			{"ghs list --tag client-x --verbose", "details of the tagged accounts"},
+		},
+		Related: []string{"status", "current", "tag"},
+	},
+	"lock": {
+		Summary: "Encrypt the config file with age",
+		Usage:   []string{"ghs lock [--passphrase]"},
+		Flags: []helpEntry{
+			{"--passphrase", "protect the key with a passphrase instead of the keyring"},
+		},
+		Examples: []helpEntry{
+			{"ghs lock", "unlocked transparently through the OS keyring"},
+			{"ghs lock --passphrase", "asked for the passphrase once per command that reads the config"},
+		},
+		Errors: []helpEntry{
+			{"age not found", "install age from https://age-encryption.org"},
+		},
+		Related: []string{"unlock", "config"},
+	},
+	"map": {
+		Summary: "Use an account for every repository under a directory",
+		Usage:   []string{"ghs map <alias> <dir>", "ghs unmap <alias> <dir>"},
+		Examples: []helpEntry{
+			{"ghs map work ~/code/acme", "repositories under ~/code/acme commit as work"},
+			{"ghs unmap work ~/code/acme", "remove the mapping"},
+			{"git init --template ~/.ghs/templates/work ~/code/acme/app", "create a repository with the account's hooks"},
+		},
+		Related: []string{"switch", "rule", "migrate"},
+	},
+	"merge": {
+		Summary: "Merge another config file into this one",
+		Usage:   []string{"ghs merge [--strategy prefer-local|prefer-remote|interactive] <config-file>"},
+		Flags: []helpEntry{
+			{"--strategy", "conflict strategy: prefer-local, prefer-remote or interactive"},
+		},
+		Examples: []helpEntry{
+			{"ghs merge ~/old-laptop/.github-switcher.json", "asked on conflicts"},
+			{"ghs merge --strategy prefer-local other.json", "keep local accounts and settings on conflicts"},
+		},
+		Errors: []helpEntry{
+			{"file has n problem(s); fix them before merging", "the other file doesn't validate; fix the problems listed above it"},
+		},
+		Related: []string{"sync", "import"},
+	},
+	"migrate": {
+		Summary: "Turn a hand-rolled multi-account setup into accounts and mapped directories",
+		Usage:   []string{"ghs migrate [--scan <dir>] [--email username=email] [--name <name>] [--dry-run] [--yes]"},
+		Flags: []helpEntry{
+			{"--scan <dir>", "learn the emails of new accounts from the repositories under this directory (repeatable)"},
+			{"--email username=email", "email of a new account (repeatable)"},
+			{"--name <name>", "name of the new accounts"},
+			{"--dry-run", "only show what would change"},
+			{"--yes", "apply without asking"},
+		},
+		Examples: []helpEntry{
+			{"ghs migrate --dry-run", "see what would be adopted"},
+			{"ghs migrate --scan ~/code", "learn missing emails from your repositories"},
+		},
+		Related: []string{"import", "map", "sshconfig"},
+	},
+	"path-rule": {
+		Summary: "Require an account for commits touching a path of this repository",
+		Usage: []string{
+			"ghs path-rule <add|remove> <alias> <path>",
+			"ghs path-rule <list|check>",
+		},
+		Examples: []helpEntry{
+			{"ghs path-rule add work vendor/acme/", "commits touching vendor/acme/ must use work"},
+			{"ghs path-rule list", "show the rules of this repository"},
+		},
+		Errors: []helpEntry{
+			{"staged files need different identities", "commit the files of each account separately"},
+		},
+		Related: []string{"switch", "verify"},
+	},
+	"profile": {
+		Summary: "Manage named profiles, each with its own set of accounts",
+		Usage:   []string{"ghs profile <create|use|list> [name]"},
+		Examples: []helpEntry{
+			{"ghs profile create laptop", "an empty profile"},
+			{"ghs profile use laptop", "activate it and regenerate the SSH config"},
+		},
+		Related: []string{"list", "sync"},
+	},
+	"purge": {
+		Summary: "Remove an account with its key pair, GitHub key, fragments and journal",
+		Usage:   []string{"ghs purge <alias> [--scan <dir>] [--keep-key] [--skip-github] [--yes]"},
+		Flags: []helpEntry{
+			{"--scan <dir>", "list repositories under this directory that still use the account (repeatable)"},
+			{"--keep-key", "keep the key pair on disk"},
+			{"--skip-github", "don't remove the key from GitHub"},
+			{"--yes", "purge without asking"},
+		},
+		Examples: []helpEntry{
+			{"ghs purge old-job --scan ~/code", "see what still uses it first"},
+			{"ghs purge old-job --keep-key --skip-github", "only forget it locally"},
+		},
+		Related: []string{"uninstall", "edit"},
+	},
+	"remind": {
+		Summary: "List or snooze reminders of expiring credentials and due key rotations",
+		Usage: []string{
+			"ghs remind [list]",
+			"ghs remind snooze <alias[:kind]> <duration>",
+			"ghs remind unsnooze <alias[:kind]>",
+		},
+		Examples: []helpEntry{
+			{"ghs remind", "what expires in the next 30 days"},
+			{"ghs remind snooze work:token 7d", "quiet one reminder for a week"},
+		},
+		Errors: []helpEntry{
+			{"unknown reminder", "kinds are key-rotation, signing-key, ssh-certificate and token"},
+		},
+		Related: []string{"check", "rotate-key", "token"},
+	},
+	"remote": {
+		Summary: "Rewrite GitHub remotes to an account's SSH host or to HTTPS",
+		Usage: []string{
+			"ghs remote convert [remote] [--account <alias>] [--to ssh|https] [--dry-run]",
+			"ghs remote rewrite <dir> [--account-map owner=alias]... [--to ssh|https] [--dry-run] [--jobs n]",
+		},
+		Flags: []helpEntry{
+			{"--account <alias>", "account whose SSH host to use (convert)"},
+			{"--account-map owner=alias", "use an account for every repository of an owner (rewrite, repeatable)"},
+			{"--to ssh|https", "target form"},
+			{"--dry-run", "show the changes without making them"},
+		},
+		Examples: []helpEntry{
+			{"ghs remote convert", "point origin at the matching account's host"},
+			{"ghs remote rewrite ~/code --account-map acme=work --dry-run", "preview converting every repository"},
+		},
+		Errors: []helpEntry{
+			{"no account matches", "pass --account, or add an owner rule with ghs rule add"},
+		},
+		Related: []string{"clone", "rule", "scan"},
+	},
+	"resolve": {
+		Summary: "Print the URL clone would use, for scripts",
+		Usage:   []string{"ghs resolve <repo-url> [--account <alias>]"},
+		Flags:   []helpEntry{{"--account <alias>", "account to use instead of the one matched by owner"}},
+		Examples: []helpEntry{
+			{"git clone \"$(ghs resolve git@github.com:acme/api.git)\"", "clone with plain git"},
+		},
+		Related: []string{"clone", "which"},
+	},
+	"rotate-key": {
+		Summary: "Replace an account's key pair, on GitHub too with --upload",
+		Usage:   []string{"ghs rotate-key <alias> [--upload] [--yes]"},
+		Flags: []helpEntry{
+			{"--upload", "add the new key to GitHub and remove the old one, with the account's token"},
+			{"--yes", "rotate without asking"},
+		},
+		Examples: []helpEntry{
+			{"ghs rotate-key work", "new key locally, the old one kept as <key>.old"},
+			{"ghs rotate-key work --upload", "also swap the keys on GitHub"},
+		},
+		Errors: []helpEntry{
+			{"another account uses <key>, give '<alias>' its own key first", "ghs edit <alias> --key <new path>"},
+		},
+		Related: []string{"remind", "edit", "test"},
+	},
+	"rule": {
+		Summary: "Map GitHub owners to accounts by name, glob or regular expression",
+		Usage:   []string{"ghs rule <add <pattern> <alias>|remove <pattern>|list>"},
+		Examples: []helpEntry{
+			{"ghs rule add acme work", "repositories of acme use work"},
+			{"ghs rule add 'acme-*' work", "every owner starting with acme-"},
+			{"ghs rule add '/^(foo|bar)$/' personal", "a regular expression between slashes"},
+		},
+		Errors: []helpEntry{
+			{"rule already maps to account", "remove the rule first"},
+		},
+		Related: []string{"which", "clone", "map"},
+	},
+	"scan": {
+		Summary: "Check the identity of every repository below directories",
+		Usage:   []string{"ghs scan <dir>... [--problems] [--jobs n]"},
+		Flags: []helpEntry{
+			{"--problems", "only show repositories whose identity doesn't match"},
+			{"--jobs n", "number of repositories checked in parallel"},
+		},
+		Examples: []helpEntry{
+			{"ghs scan ~/code --problems", "repositories committing with the wrong identity"},
+		},
+		Related: []string{"remote", "stats", "map"},
+	},
+	"serve": {
+		Summary: "Serve list, status, switch and doctor as a token-protected local HTTP API",
+		Usage:   []string{"ghs serve [--addr 127.0.0.1:7717] [--token-file <path>]"},
+		Flags: []helpEntry{
+			{"--addr", "loopback address to listen on"},
+			{"--token-file <path>", "file holding the bearer token"},
+		},
+		Examples: []helpEntry{{"ghs serve &", "token created in ~/.ghs/serve.token"}},
+		Related:  []string{"daemon"},
+	},
+	"sshconfig": {
+		Summary: "Manage the ghs section of the SSH config",
+		Usage: []string{
+			"ghs sshconfig update [--merge|--overwrite]",
+			"ghs sshconfig lint [file]",
+			"ghs sshconfig adopt <alias> [--yes]",
+			"ghs sshconfig default-host <alias|none|off> [--yes]",
+			"ghs sshconfig known-hosts <alias>... | --all",
+		},
+		Flags: []helpEntry{
+			{"--merge, --overwrite", "keep or replace blocks edited by hand (update)"},
+			{"--yes", "replace a hand-written block without asking (adopt, default-host)"},
+			{"--all", "every account with its own known_hosts (known-hosts)"},
+		},
+		Examples: []helpEntry{
+			{"ghs sshconfig update", "regenerate the managed section"},
+			{"ghs sshconfig lint", "find problems that make git authenticate as the wrong user"},
+			{"ghs sshconfig default-host none", "plain github.com URLs offer no key"},
+		},
+		Related: []string{"export", "import", "doctor"},
+	},
+	"stats": {
+		Summary: "Show account usage, recently switched repositories and commits per identity",
+		Usage:   []string{"ghs stats [--since 30d] [--scan <dir>]"},
+		Flags: []helpEntry{
+			{"--since", "time window, e.g. 30d, 2w or 12h"},
+			{"--scan <dir>", "count commits in repositories below this directory (repeatable)"},
+		},
+		Examples: []helpEntry{{"ghs stats --since 2w --scan ~/code", "the last two weeks"}},
+		Related:  []string{"scan", "list"},
+	},
+	"status": {
+		Summary: "Show the account committing here",
+		Usage:   []string{"ghs status [--porcelain]"},
+		Flags:   []helpEntry{{"--porcelain", "print the stable machine-readable format (v1)"}},
+		Examples: []helpEntry{
+			{"ghs status", "inside a repository"},
+			{"ghs status --porcelain", "for prompts and scripts"},
+		},
+		Related: []string{"current", "switch"},
+	},
+	"switch": {
+		Summary: "Switch the current repository to an account",
+		Usage: []string{
+			"ghs switch <alias> [--worktree] [--gh] [--sign|--no-sign] [--dry-run]",
+			"ghs switch --auto|--from-gh [--worktree] [--gh] [--dry-run]",
+		},
+		Flags: []helpEntry{
+			{"--auto", "use the account the repository's remotes belong to"},
+			{"--from-gh", "use the account gh is logged in as"},
+			{"--worktree", "apply the account to the current linked worktree only"},
+			{"--gh", "also make the account the active gh account"},
+			{"--sign, --no-sign", "override the account's signing this time"},
+			{"--dry-run", "show the settings that would change without changing them"},
+		},
+		Examples: []helpEntry{
+			{"ghs switch work", "commit and push as work in this repository"},
+			{"ghs switch --auto", "the account of the origin's owner"},
+			{"ghs switch wo", "a unique prefix or another alias works too"},
+		},
+		Errors: []helpEntry{
+			{"current directory is not a git repository", "run it inside the repository, or use ghs map for a directory"},
+			{"account 'x' not found", "ghs list shows the accounts"},
+		},
+		Related: []string{"current", "status", "map", "env"},
+	},
+	"sync": {
+		Summary: "Share the config across machines through a git repository",
+		Usage:   []string{"ghs sync <init <url>|push|pull>"},
+		Examples: []helpEntry{
+			{"ghs sync init git@github.com:me/ghs-config.git", "clone the sync repository"},
+			{"ghs sync pull", "apply the shared config"},
+		},
+		Errors: []helpEntry{
+			{"the sync file has n problem(s)", "the pushed config doesn't validate; fix it on the machine that pushed it and push again"},
+		},
+		Related: []string{"merge", "profile"},
+	},
+	"tag": {
+		Summary: "Add or remove account tags",
+		Usage:   []string{"ghs tag <add|remove> <alias> <tag>..."},
+		Examples: []helpEntry{
+			{"ghs tag add acme client-x oss", "tag an account"},
+			{"ghs list --tag client-x", "only the tagged accounts"},
+		},
+		Related: []string{"list", "alias"},
+	},
+	"test": {
+		Summary: "Check that accounts' SSH keys authenticate as their usernames",
+		Usage:   []string{"ghs test <alias>... | --all | --tag <tag>... [--jobs n] [--fix]"},
+		Flags: []helpEntry{
+			{"--all", "test every account"},
+			{"--tag <tag>", "test the accounts with this tag (repeatable)"},
+			{"--jobs n", "number of accounts tested in parallel"},
+			{"--fix", "make ssh offer only the account's key when the agent has too many"},
+		},
+		Examples: []helpEntry{
+			{"ghs test work", "one account"},
+			{"ghs test --all --fix", "every account, fixing too many agent keys"},
+		},
+		Errors: []helpEntry{
+			{"Too many authentication failures", "the agent offers other keys first; --fix limits it to the account's"},
+		},
+		Related: []string{"check", "doctor"},
+	},
+	"token": {
+		Summary: "Manage the GitHub tokens of accounts",
+		Usage: []string{
+			"ghs token check [alias]",
+			"ghs token set <alias> <owner|owner/repo|*> <env:VAR|cmd:<command>|keyring:<name>|gh|app>",
+			"ghs token unset <alias> <scope>",
+			"ghs token store <alias> <owner|owner/repo|*>",
+			"ghs token forget <name>",
+			"ghs token list",
+		},
+		Examples: []helpEntry{
+			{"ghs token check", "compare token scopes with what ghs features need"},
+			{"ghs token set work acme env:ACME_TOKEN", "a token for one organization"},
+			{"echo \"$TOKEN\" | ghs token store work '*'", "keep a token in the OS keyring"},
+		},
+		Related: []string{"app", "credential", "cache"},
+	},
+	"uninstall": {
+		Summary: "Remove everything ghs manages",
+		Usage:   []string{"ghs uninstall [dir...] [--config] [--dry-run] [--yes]"},
+		Flags: []helpEntry{
+			{"--config", "also delete the config file"},
+			{"--dry-run", "only show what would be removed"},
+			{"--yes", "remove without asking"},
+		},
+		Examples: []helpEntry{{"ghs uninstall --dry-run", "see what would be removed"}},
+		Related:  []string{"purge", "install-git-alias"},
+	},
+	"unlock": {
+		Summary:  "Decrypt the config file back to plain JSON",
+		Usage:    []string{"ghs unlock"},
+		Examples: []helpEntry{{"ghs unlock", "and remove the key from the keyring"}},
+		Related:  []string{"lock"},
+	},
+	"verify": {
+		Summary: "Check that commits are signed by the repository's account",
+		Usage:   []string{"ghs verify [rev-range] [--account <alias>]"},
+		Flags: []helpEntry{
+			{"--account <alias>", "account expected to sign instead of the one matched by the remotes"},
+		},
+		Examples: []helpEntry{
+			{"ghs verify", "the commits not pushed yet"},
+			{"ghs verify main..HEAD --account work", "a range, signed by work"},
+		},
+		Related: []string{"gpg", "path-rule"},
+	},
+	"watch": {
+		Summary: "Report or repair changes other tools make to the managed configs",
+		Usage:   []string{"ghs watch [--policy alert|repair] [--interval <duration>] [--once]"},
+		Flags: []helpEntry{
+			{"--policy alert|repair", "report drift, or also fix it"},
+			{"--interval", "how often the files are looked at"},
+			{"--once", "check once and exit, with status 1 when there is drift"},
+		},
+		Examples: []helpEntry{
+			{"ghs watch --policy repair", "put changes back as they happen"},
+			{"ghs watch --once", "for cron or CI"},
+		},
+		Related: []string{"doctor", "sshconfig"},
+	},
+	"which": {
+		Summary: "Show which account serves a repository and which rule fired",
+		Usage:   []string{"ghs which <owner|owner/repo|url>"},
+		Examples: []helpEntry{
+			{"ghs which acme", "every rule evaluated for acme"},
+			{"ghs which git@github.com:acme/api.git", "for a URL"},
+		},
+		Related: []string{"rule", "clone", "resolve"},
+	},
+}
+
+// commandDocAliases are commands documented under another name
+var commandDocAliases = map[string]string{"unmap": "map", "remotes": "remote"}
+
+// lookupCommandDoc returns the help of a command
+func lookupCommandDoc(name string) (string, commandDoc, bool) {
+	if other, ok := commandDocAliases[name]; ok {
+		name = other
+	}
+	doc, ok := commandDocs[name]
+	return name, doc, ok
+}
+
+// printHelpEntries prints flags, examples or errors with their notes aligned
+// below them
+func printHelpEntries(title string, entries []helpEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	fmt.Printf("\n%s:\n", title)
+	for _, e := range entries {
+		fmt.Printf("  %s\n", e.Text)
+		if e.Note != "" {
+			fmt.Printf("      %s\n", e.Note)
+		}
+	}
+}
+
+// showCommandHelp handles "help <command>": usage, flags, examples, common
+// errors and related commands
+func showCommandHelp(name string) error {
+	name, doc, ok := lookupCommandDoc(name)
+	if !ok {
+		return unknownCommand(name)
+	}
+	fmt.Printf("ghs %s - %s\n\nUsage:\n", name, doc.Summary)
+	for _, usage := range doc.Usage {
+		fmt.Printf("  %s\n", usage)
+	}
+	printHelpEntries("Flags", doc.Flags)
+	printHelpEntries("Examples", doc.Examples)
+	printHelpEntries("Common errors", doc.Errors)
+	if len(doc.Related) > 0 {
+		fmt.Printf("\nRelated: %s\n", strings.Join(doc.Related, ", "))
+	}
+	return nil
+}
+
+// flagError is a command line flag parseFlags rejected, with the command it
+// was given to
+type flagError struct {
+	Command string
+	Err     error
+}
+
+func (e *flagError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *flagError) Unwrap() error {
+	return e.Err
+}
+
+// usageCommand returns the command whose arguments an error rejects: a
+// "usage: ghs <command> ..." error or a bad flag; "" for other errors
+func usageCommand(err error) string {
+	var fe *flagError
+	if errors.As(err, &fe) {
+		return strings.Fields(fe.Command)[0]
+	}
+	if rest, ok := strings.CutPrefix(err.Error(), "usage: ghs "); ok {
+		if fields := strings.Fields(rest); len(fields) > 0 {
+			return fields[0]
+		}
+	}
+	return ""
+}
+
+// printUsageHelp follows an error caused by bad arguments with the part of
+// the command's help that fixes it: the flags after a bad flag, examples
+// after a usage error
+func printUsageHelp(err error) {
+	name, doc, ok := lookupCommandDoc(usageCommand(err))
+	if !ok {
+		return
+	}
+	var fe *flagError
+	switch {
+	case errors.Is(err, flag.ErrHelp):
+		showCommandHelp(name)
+		return
+	case errors.As(err, &fe) && len(doc.Flags) > 0:
+		printHelpEntries("Flags", doc.Flags)
+	default:
+		printHelpEntries("Examples", doc.Examples)
+	}
+	fmt.Printf("\nRun 'ghs help %s' for its usage, flags, examples and common errors.\n", name)
+}
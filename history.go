@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// historyEntry is a single line of the usage journal
+type historyEntry struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	Alias  string    `json:"alias"`
+	Repo   string    `json:"repo,omitempty"`
+}
+
+func historyPath() string {
+	return filepath.Join(stateDir, "history.jsonl")
+}
+
+// repoRoot returns the top-level directory of the repository containing the
+// current directory, or the git directory of a bare repository, falling back
+// to the current directory itself
+func repoRoot() string {
+	if repo, err := currentRepo(); err == nil {
+		if repo.Bare {
+			return repo.GitDir
+		}
+		return repo.Root
+	}
+	dir, _ := os.Getwd()
+	return dir
+}
+
+// recordHistory appends an entry to the journal. Failures only print a
+// warning since the journal is informational.
+func recordHistory(action, alias, repo string) {
+	entry := historyEntry{Time: time.Now().UTC(), Action: action, Alias: alias, Repo: repo}
+	data, err := json.Marshal(entry)
+	if err == nil {
+		err = appendHistoryLine(data)
+	}
+	if err != nil {
+		warnf("failed to record history: %v", err)
+	}
+}
+
+func appendHistoryLine(line []byte) error {
+	if err := mkdirPrivate(stateDir); err != nil {
+		return err
+	}
+	f, err := openPrivateAppend(historyPath())
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readHistory returns every journal entry recorded since the given time
+func readHistory(since time.Time) ([]historyEntry, error) {
+	f, err := os.Open(historyPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []historyEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry historyEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// Skip damaged lines rather than losing the whole journal
+			continue
+		}
+		if !entry.Time.Before(since) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// forgetHistory removes the journal entries of an account and returns how
+// many were dropped
+func forgetHistory(alias string) (int, error) {
+	data, err := os.ReadFile(historyPath())
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	var kept []byte
+	removed := 0
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var entry historyEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil && entry.Alias == alias {
+			removed++
+			continue
+		}
+		kept = append(append(kept, scanner.Bytes()...), '\n')
+	}
+	if err := scanner.Err(); err != nil || removed == 0 {
+		return 0, err
+	}
+	return removed, writePrivateFile(historyPath(), kept)
+}
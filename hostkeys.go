@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// githubFingerprintsURL documents GitHub's host key fingerprints, for
+// comparing by hand when the API can't be reached
+const githubFingerprintsURL = "https://docs.github.com/en/authentication/keeping-your-account-and-data-secure/githubs-ssh-key-fingerprints"
+
+// hostKeyCheckingModes are the StrictHostKeyChecking values an account may
+// choose: yes refuses unknown host keys, accept-new records them on first use
+var hostKeyCheckingModes = map[string]bool{"yes": true, "accept-new": true, "ask": true}
+
+// hostKeyCheckingProblem checks an account's host_key_checking
+func hostKeyCheckingProblem(mode string) string {
+	if mode != "" && !hostKeyCheckingModes[mode] {
+		return fmt.Sprintf("unknown host key checking %q (use yes, accept-new or ask)", mode)
+	}
+	return ""
+}
+
+// accountKnownHosts returns the known_hosts file ssh checks for an account
+func accountKnownHosts(account GitHubAccount) string {
+	if account.KnownHosts {
+		return account.KnownHostsFile()
+	}
+	return filepath.Join(filepath.Dir(sshConfigPath), "known_hosts")
+}
+
+// hostKnown reports whether a known_hosts file has a key for github.com,
+// hashed entries included
+func hostKnown(file string) bool {
+	return execCommand("ssh-keygen", "-F", defaultHost, "-f", file).Run() == nil
+}
+
+// scanHostKeys returns the host keys github.com offers, as "type key"
+func scanHostKeys() ([]string, error) {
+	out, err := execCommand("ssh-keyscan", "-T", "10", defaultHost).Output()
+	var keys []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if fields := strings.Fields(line); len(fields) == 3 && !strings.HasPrefix(line, "#") {
+			keys = append(keys, fields[1]+" "+fields[2])
+		}
+	}
+	if len(keys) == 0 {
+		if err == nil {
+			err = fmt.Errorf("no keys offered")
+		}
+		return nil, fmt.Errorf("failed to fetch the host keys of %s: %v", defaultHost, err)
+	}
+	return keys, nil
+}
+
+// hostKeyFingerprint returns the SHA256 fingerprint of a "type key" host key
+func hostKeyFingerprint(key string) string {
+	cmd := execCommand("ssh-keygen", "-l", "-f", "-")
+	cmd.Stdin = strings.NewReader(defaultHost + " " + key + "\n")
+	out, err := cmd.Output()
+	if fields := strings.Fields(string(out)); err == nil && len(fields) >= 2 {
+		return fields[1]
+	}
+	return "(unknown fingerprint)"
+}
+
+// verifyHostKey makes the first connection of an account safe: when its
+// known_hosts has no key for github.com yet, the keys github.com offers are
+// shown with their fingerprints and compared with the ones GitHub publishes.
+// Only matching keys are recorded; without the published keys the user has
+// to compare the fingerprints.
+func verifyHostKey(alias string, account GitHubAccount) error {
+	file := accountKnownHosts(account)
+	if hostKnown(file) {
+		return nil
+	}
+	offered, err := scanHostKeys()
+	if err != nil {
+		return err
+	}
+	published, publishErr := githubHostKeys()
+	isPublished := map[string]bool{}
+	for _, key := range published {
+		isPublished[key] = true
+	}
+
+	fmt.Printf("First connection to %s for account '%s', its host keys are:\n", defaultHost, alias)
+	unpublished := 0
+	for _, key := range offered {
+		status := ""
+		if publishErr == nil {
+			status = "matches GitHub's published key"
+			if !isPublished[key] {
+				status = "NOT PUBLISHED BY GITHUB"
+				unpublished++
+			}
+		}
+		keyType, _, _ := strings.Cut(key, " ")
+		fmt.Printf("  %-20s %s  %s\n", keyType, hostKeyFingerprint(key), status)
+	}
+	if publishErr == nil && unpublished > 0 {
+		return fmt.Errorf("%s offered %d host key(s) GitHub doesn't publish; not trusting them, someone may be intercepting the connection", defaultHost, unpublished)
+	}
+	if publishErr != nil {
+		warnf("can't compare with GitHub's published keys: %v", publishErr)
+		fmt.Printf("Compare the fingerprints with %s\n", githubFingerprintsURL)
+		ok, err := confirm("Do they match?", false)
+		if errors.Is(err, errNonInteractive) {
+			return fmt.Errorf("host keys of %s not verified, run ghs test %s in a terminal", defaultHost, alias)
+		} else if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("host keys of %s not trusted", defaultHost)
+		}
+	}
+
+	if err := mkdirPrivate(filepath.Dir(file)); err != nil {
+		return fmt.Errorf("failed to create %s: %v", filepath.Dir(file), err)
+	}
+	f, err := openPrivateAppend(file)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", file, err)
+	}
+	defer f.Close()
+	for _, key := range offered {
+		if _, err := fmt.Fprintf(f, "%s %s\n", defaultHost, key); err != nil {
+			return fmt.Errorf("failed to write %s: %v", file, err)
+		}
+	}
+	fmt.Printf("Recorded %d host key(s) of %s in %s\n", len(offered), defaultHost, file)
+	return nil
+}
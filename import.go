@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// accountRecord is an account entry as supplied by import sources
+type accountRecord struct {
+	Alias string `json:"alias"`
+	GitHubAccount
+}
+
+// importResult records the outcome for a single imported record
+type importResult struct {
+	Record string
+	Alias  string
+	Status string
+	Err    error
+}
+
+// expandPath resolves "~/" against the home directory and makes relative
+// paths absolute against the current directory
+func expandPath(path string) string {
+	homeDir, _ := os.UserHomeDir()
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		return filepath.Join(homeDir, strings.TrimPrefix(path, "~"))
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	return abs
+}
+
+// expandKeyPath makes a key path absolute, resolving "~/" against the home
+// directory and bare relative paths against ~/.ssh
+func expandKeyPath(path string) string {
+	homeDir, _ := os.UserHomeDir()
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		return filepath.Join(homeDir, strings.TrimPrefix(path, "~"))
+	}
+	if !filepath.IsAbs(path) {
+		return filepath.Join(homeDir, ".ssh", path)
+	}
+	return path
+}
+
+// checkRecord validates a record before it is applied to the config
+func checkRecord(record accountRecord, defaults *AccountDefaults) error {
+	if strings.TrimSpace(record.Alias) == "" {
+		return fmt.Errorf("alias: required field is missing or empty")
+	}
+	if err := validateAlias(record.Alias); err != nil {
+		return fmt.Errorf("alias: %v", err)
+	}
+	if problems := accountProblems(defaults.apply(record.GitHubAccount)); len(problems) > 0 {
+		messages := make([]string, len(problems))
+		for i, p := range problems {
+			messages[i] = p.Field + ": " + p.Msg
+		}
+		return fmt.Errorf("%s", strings.Join(messages, "; "))
+	}
+	if _, err := os.Stat(record.SSHKeyPath); err != nil {
+		return fmt.Errorf("ssh_key_path: SSH key not found at %s", record.SSHKeyPath)
+	}
+	return nil
+}
+
+// usernameOwner returns the account other than alias that already uses
+// username. Usernames name the SSH Host of an account, so they are unique.
+func usernameOwner(accounts map[string]GitHubAccount, username, alias string) (string, bool) {
+	for _, other := range sortedAliases(accounts) {
+		if other != alias && strings.EqualFold(accounts[other].Username, username) {
+			return other, true
+		}
+	}
+	return "", false
+}
+
+// How to handle records whose alias already exists
+const (
+	onDuplicateUpdate = "update"
+	onDuplicateSkip   = "skip"
+	onDuplicateFail   = "fail"
+)
+
+// importRecords validates each record and adds the valid ones to the config.
+// parseErrs holds errors found while reading the records, if any.
+func importRecords(config Config, records []accountRecord, labels []string, parseErrs []error, onDuplicate string) []importResult {
+	results := make([]importResult, 0, len(records))
+	for i, record := range records {
+		record.Alias = strings.TrimSpace(record.Alias)
+		if record.SSHKeyPath != "" {
+			record.SSHKeyPath = expandKeyPath(record.SSHKeyPath)
+		}
+
+		result := importResult{Record: labels[i], Alias: record.Alias}
+		if parseErrs != nil && parseErrs[i] != nil {
+			result.Status = "failed"
+			result.Err = parseErrs[i]
+		} else if err := checkRecord(record, config.Defaults); err != nil {
+			result.Status = "failed"
+			result.Err = err
+		} else if alias, exists := config.namedAlias(record.Alias); !exists {
+			if other, used := usernameOwner(config.Accounts, record.Username, record.Alias); used {
+				result.Status = "failed"
+				result.Err = fmt.Errorf("username: %s is already used by account '%s'", record.Username, other)
+			} else {
+				result.Status = "added"
+				config.Accounts[record.Alias] = record.GitHubAccount
+			}
+		} else {
+			result.Alias = alias
+			switch other, used := usernameOwner(config.Accounts, record.Username, alias); {
+			case onDuplicate == onDuplicateSkip:
+				result.Status = "skipped"
+			case onDuplicate == onDuplicateFail:
+				result.Status = "failed"
+				result.Err = fmt.Errorf("account '%s' already exists", alias)
+			case used:
+				result.Status = "failed"
+				result.Err = fmt.Errorf("username: %s is already used by account '%s'", record.Username, other)
+			default:
+				result.Status = "updated"
+				// The names the account answers to stay unless the record sets them
+				if record.Aliases == nil {
+					record.Aliases = config.Accounts[alias].Aliases
+				}
+				config.Accounts[alias] = record.GitHubAccount
+			}
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// printImportSummary prints one line per record followed by the totals and
+// returns an error when any record failed
+func printImportSummary(results []importResult) error {
+	counts := map[string]int{}
+	for _, r := range results {
+		counts[r.Status]++
+		if r.Err != nil {
+			fmt.Printf("  %-10s %-15s %s: %v\n", r.Status, r.Alias, r.Record, r.Err)
+		} else {
+			fmt.Printf("  %-10s %-15s %s\n", r.Status, r.Alias, r.Record)
+		}
+	}
+	fmt.Printf("\n%d record(s): %d added, %d updated, %d skipped, %d failed\n",
+		len(results), counts["added"], counts["updated"], counts["skipped"], counts["failed"])
+
+	if counts["failed"] > 0 {
+		return fmt.Errorf("%d record(s) failed to import", counts["failed"])
+	}
+	return nil
+}
+
+// readJSONRecords decodes an array of account objects, rejecting unknown fields
+func readJSONRecords(r io.Reader) ([]accountRecord, []string, []error, error) {
+	var raw []json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to parse JSON input: expected an array of accounts: %v", err)
+	}
+
+	records := make([]accountRecord, len(raw))
+	labels := make([]string, len(raw))
+	errs := make([]error, len(raw))
+	for i, item := range raw {
+		labels[i] = fmt.Sprintf("record %d", i+1)
+		dec := json.NewDecoder(strings.NewReader(string(item)))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&records[i]); err != nil {
+			errs[i] = err
+		}
+	}
+	return records, labels, errs, nil
+}
+
+// importJSON adds every account from a JSON array read from path ("-" for stdin)
+func importJSON(config Config, path string) (Config, error) {
+	var input io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return config, fmt.Errorf("failed to open %s: %v", path, err)
+		}
+		defer f.Close()
+		input = f
+	}
+
+	records, labels, decodeErrs, err := readJSONRecords(input)
+	if err != nil {
+		return config, err
+	}
+
+	return finishImport(config, importRecords(config, records, labels, decodeErrs, onDuplicateUpdate))
+}
+
+// finishImport regenerates the SSH config and reports the results. Valid
+// records are kept even when others failed, so the config is saved here in
+// that case; on full success the caller saves it as usual.
+func finishImport(config Config, results []importResult) (Config, error) {
+	applied := 0
+	for _, r := range results {
+		if r.Err == nil {
+			applied++
+		}
+	}
+	if applied > 0 {
+		if err := updateManagedFiles(config); err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+	}
+
+	err := printImportSummary(results)
+	if err != nil && applied > 0 {
+		if saveErr := saveConfig(config); saveErr != nil {
+			return config, fmt.Errorf("failed to save config: %v", saveErr)
+		}
+	}
+	return config, err
+}
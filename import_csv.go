@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// csvColumnNames lists the header names recognized for each account field
+var csvColumnNames = map[string][]string{
+	"alias":        {"alias", "account", "account alias"},
+	"username":     {"username", "github", "github username", "login"},
+	"name":         {"name", "full name", "display name"},
+	"email":        {"email", "e-mail", "email address"},
+	"ssh_key_path": {"ssh_key_path", "ssh key", "ssh key path", "key", "key path"},
+}
+
+// stringList is a flag.Value collecting every occurrence of a repeated flag
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// normalizeHeader lowercases a header and folds "_" and "-" to spaces
+func normalizeHeader(h string) string {
+	h = strings.ToLower(strings.TrimSpace(h))
+	h = strings.NewReplacer("_", " ", "-", " ").Replace(h)
+	return strings.Join(strings.Fields(h), " ")
+}
+
+// csvColumns maps account fields to column indexes using the header row and
+// explicit field=Column overrides
+func csvColumns(header []string, overrides []string) (map[string]int, error) {
+	index := map[string]int{}
+	for i, h := range header {
+		index[normalizeHeader(h)] = i
+	}
+
+	columns := map[string]int{}
+	for field, names := range csvColumnNames {
+		for _, name := range names {
+			if i, ok := index[normalizeHeader(name)]; ok {
+				columns[field] = i
+				break
+			}
+		}
+	}
+
+	for _, o := range overrides {
+		parts := strings.SplitN(o, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid --map %q, expected field=Column", o)
+		}
+		field := strings.TrimSpace(parts[0])
+		if _, known := csvColumnNames[field]; !known {
+			return nil, fmt.Errorf("invalid --map %q: unknown field %q", o, field)
+		}
+		i, ok := index[normalizeHeader(parts[1])]
+		if !ok {
+			return nil, fmt.Errorf("invalid --map %q: no column named %q", o, parts[1])
+		}
+		columns[field] = i
+	}
+
+	for _, field := range []string{"alias", "username", "name", "email", "ssh_key_path"} {
+		if _, ok := columns[field]; !ok {
+			return nil, fmt.Errorf("no column found for %s (use --map %s=<column>)", field, field)
+		}
+	}
+	return columns, nil
+}
+
+// readCSVRecords reads accounts from CSV data with a header row
+func readCSVRecords(r io.Reader, overrides []string) ([]accountRecord, []string, []error, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to read CSV header: %v", err)
+	}
+	columns, err := csvColumns(header, overrides)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var records []accountRecord
+	var labels []string
+	var errs []error
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line, _ := reader.FieldPos(0)
+		labels = append(labels, fmt.Sprintf("line %d", line))
+		if err != nil {
+			records = append(records, accountRecord{})
+			errs = append(errs, err)
+			continue
+		}
+
+		get := func(field string) string {
+			if i := columns[field]; i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+		records = append(records, accountRecord{
+			Alias: get("alias"),
+			GitHubAccount: GitHubAccount{
+				Name:       get("name"),
+				Email:      get("email"),
+				Username:   get("username"),
+				SSHKeyPath: get("ssh_key_path"),
+			},
+		})
+		errs = append(errs, nil)
+	}
+	return records, labels, errs, nil
+}
+
+// importCSV adds every account from a CSV file and saves the config; a dry
+// run only reports
+func importCSV(config Config, args []string) error {
+	flags := flag.NewFlagSet("import csv", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "show what would be imported without changing anything")
+	onDuplicate := flags.String("on-duplicate", onDuplicateSkip, "what to do with existing aliases: skip, update or fail")
+	var overrides stringList
+	flags.Var(&overrides, "map", "map an account field to a column, e.g. --map email=\"Work Email\" (repeatable)")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: ghs import csv [--dry-run] [--on-duplicate skip|update|fail] [--map field=Column] <file>")
+	}
+	switch *onDuplicate {
+	case onDuplicateSkip, onDuplicateUpdate, onDuplicateFail:
+	default:
+		return fmt.Errorf("invalid --on-duplicate %q, expected skip, update or fail", *onDuplicate)
+	}
+
+	f, err := os.Open(positional[0])
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", positional[0], err)
+	}
+	defer f.Close()
+
+	records, labels, parseErrs, err := readCSVRecords(f, overrides)
+	if err != nil {
+		return err
+	}
+
+	if *dryRun {
+		// Work on a copy so nothing leaks into the real config
+		preview := config
+		preview.Accounts = copyAccounts(config.Accounts)
+		fmt.Println("Dry run, no changes will be written:")
+		return printImportSummary(importRecords(preview, records, labels, parseErrs, *onDuplicate))
+	}
+
+	if config, err = finishImport(config, importRecords(config, records, labels, parseErrs, *onDuplicate)); err != nil {
+		return err
+	}
+	return saveConfig(config)
+}
+
+// runImportCommand handles the "import" subcommands, which save the config
+// themselves unless they only preview
+func runImportCommand(config Config, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: ghs import <csv <file>|ssh-config>")
+	}
+	switch args[0] {
+	case "csv":
+		return importCSV(config, args[1:])
+	case "ssh-config":
+		return importSSHConfig(config, args[1:])
+	default:
+		return fmt.Errorf("unknown import source: %s", args[0])
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCSVColumns(t *testing.T) {
+	tests := []struct {
+		name      string
+		header    []string
+		overrides []string
+		want      map[string]int
+		err       string
+	}{
+		{
+			name:   "field names",
+			header: []string{"alias", "username", "name", "email", "ssh_key_path"},
+			want:   map[string]int{"alias": 0, "username": 1, "name": 2, "email": 3, "ssh_key_path": 4},
+		},
+		{
+			name:   "other names in any case and spacing",
+			header: []string{" E-Mail ", "Full Name", "GitHub_Username", "Account", "SSH  Key"},
+			want:   map[string]int{"alias": 3, "username": 2, "name": 1, "email": 0, "ssh_key_path": 4},
+		},
+		{
+			name:   "first known name wins",
+			header: []string{"key", "alias", "login", "username", "name", "email"},
+			want:   map[string]int{"alias": 1, "username": 3, "name": 4, "email": 5, "ssh_key_path": 0},
+		},
+		{
+			name:      "overrides",
+			header:    []string{"Handle", "Who", "Mail", "Id", "Key File"},
+			overrides: []string{"username=Handle", "name=who", "email=MAIL", "alias=id", "ssh_key_path=key_file"},
+			want:      map[string]int{"alias": 3, "username": 0, "name": 1, "email": 2, "ssh_key_path": 4},
+		},
+		{
+			name:      "override replaces a recognized column",
+			header:    []string{"alias", "username", "login", "name", "email", "key"},
+			overrides: []string{"username=login"},
+			want:      map[string]int{"alias": 0, "username": 2, "name": 3, "email": 4, "ssh_key_path": 5},
+		},
+		{
+			name:   "missing column",
+			header: []string{"alias", "username", "name", "email"},
+			err:    "no column found for ssh_key_path (use --map ssh_key_path=<column>)",
+		},
+		{
+			name:      "override without column",
+			header:    []string{"alias", "username", "name", "email", "key"},
+			overrides: []string{"username"},
+			err:       `invalid --map "username", expected field=Column`,
+		},
+		{
+			name:      "override of an unknown field",
+			header:    []string{"alias", "username", "name", "email", "key"},
+			overrides: []string{"team=alias"},
+			err:       `unknown field "team"`,
+		},
+		{
+			name:      "override naming no column",
+			header:    []string{"alias", "username", "name", "email", "key"},
+			overrides: []string{"username=handle"},
+			err:       `no column named "handle"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := csvColumns(tt.header, tt.overrides)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("columns = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadCSVRecords(t *testing.T) {
+	input := `Account,Login,Full Name,Email,Key
+work, acme-me ,Me,me@acme.com,/home/me/.ssh/id_work
+"home","me","Me, Myself","me@home.org","/home/me/.ssh/id_home"
+short,only
+`
+	records, labels, errs, err := readCSVRecords(strings.NewReader(input), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []accountRecord{
+		{Alias: "work", GitHubAccount: GitHubAccount{Name: "Me", Email: "me@acme.com", Username: "acme-me", SSHKeyPath: "/home/me/.ssh/id_work"}},
+		{Alias: "home", GitHubAccount: GitHubAccount{Name: "Me, Myself", Email: "me@home.org", Username: "me", SSHKeyPath: "/home/me/.ssh/id_home"}},
+		{Alias: "short", GitHubAccount: GitHubAccount{Username: "only"}},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("records = %+v, want %+v", records, want)
+	}
+	if wantLabels := []string{"line 2", "line 3", "line 4"}; !reflect.DeepEqual(labels, wantLabels) {
+		t.Errorf("labels = %v, want %v", labels, wantLabels)
+	}
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("record %d: unexpected error %v", i+1, err)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// InitSettings holds defaults for repositories created with an account
+type InitSettings struct {
+	DefaultBranch  string `json:"default_branch,omitempty"`
+	CommitTemplate string `json:"commit_template,omitempty"`
+}
+
+// gitSettings returns the git config derived from the init settings
+func (i *InitSettings) gitSettings() map[string]string {
+	if i == nil {
+		return nil
+	}
+	settings := map[string]string{}
+	if i.DefaultBranch != "" {
+		settings["init.defaultBranch"] = i.DefaultBranch
+	}
+	if i.CommitTemplate != "" {
+		settings["commit.template"] = i.CommitTemplate
+	}
+	return settings
+}
+
+// initProblems checks init settings for malformed values
+func initProblems(i *InitSettings) []fieldProblem {
+	if i == nil {
+		return nil
+	}
+	var problems []fieldProblem
+	if i.DefaultBranch != "" && !validBranchName(i.DefaultBranch) {
+		problems = append(problems, fieldProblem{"init.default_branch", fmt.Sprintf("invalid branch name %q", i.DefaultBranch)})
+	}
+	if i.CommitTemplate != "" && !filepath.IsAbs(i.CommitTemplate) && !strings.HasPrefix(i.CommitTemplate, "~/") {
+		problems = append(problems, fieldProblem{"init.commit_template", fmt.Sprintf("template path %q must be absolute or start with ~/", i.CommitTemplate)})
+	}
+	return problems
+}
+
+// validBranchName reports whether name is acceptable as a branch name
+func validBranchName(name string) bool {
+	if name == "" || strings.HasPrefix(name, "-") {
+		return false
+	}
+	// Prefer git's own rules when git is available
+	if err := execCommand("git", "check-ref-format", "--branch", name).Run(); err == nil {
+		return true
+	} else if _, ok := err.(*exec.ExitError); ok {
+		return false
+	}
+	return !strings.ContainsAny(name, " ~^:?*[\\\x7f") && !strings.Contains(name, "..")
+}
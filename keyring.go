@@ -0,0 +1,261 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// tokenRefKeyring points at a token in the OS keyring: "keyring:<name>"
+const tokenRefKeyring = "keyring:"
+
+// keyringService is the service secrets are stored under
+const keyringService = "ghs"
+
+// secretStore keeps secrets in the OS's secret storage, by name
+type secretStore interface {
+	Name() string
+	Get(name string) (string, error)
+	Set(name, secret string) error
+	Delete(name string) error
+	// List returns the names of the stored secrets
+	List() ([]string, error)
+}
+
+// Secret store backends, also the values of GHS_SECRET_STORE
+const (
+	storeKeychain      = "keychain"
+	storeSecretService = "secret-service"
+	storeWincred       = "wincred"
+)
+
+// openSecretStore returns the backend of this system: the macOS keychain,
+// the Windows Credential Manager or a freedesktop secret service such as
+// GNOME Keyring or KWallet. GHS_SECRET_STORE picks one explicitly.
+func openSecretStore() (secretStore, error) {
+	backend := os.Getenv(envSecretStore)
+	if backend == "" {
+		switch runtime.GOOS {
+		case "darwin":
+			backend = storeKeychain
+		case "windows":
+			backend = storeWincred
+		default:
+			backend = storeSecretService
+		}
+	}
+	switch backend {
+	case storeWincred:
+		return openWincred()
+	case storeKeychain:
+		if _, err := exec.LookPath("security"); err != nil {
+			return nil, fmt.Errorf("the macOS keychain needs the security command")
+		}
+		return keychainStore{}, nil
+	case storeSecretService:
+		return openSecretService()
+	default:
+		return nil, fmt.Errorf("unknown %s %q, expected %s, %s or %s", envSecretStore, backend, storeKeychain, storeSecretService, storeWincred)
+	}
+}
+
+// keyringName is the name of the token of an account's user for a scope
+func keyringName(username, scope string) string {
+	return username + ":" + scope
+}
+
+// readKeyringRef returns the secret of a keyring reference
+func readKeyringRef(ref string) (string, error) {
+	store, err := openSecretStore()
+	if err != nil {
+		return "", err
+	}
+	return store.Get(strings.TrimPrefix(ref, tokenRefKeyring))
+}
+
+// readSecret reads a secret from stdin without echoing it on a terminal
+func readSecret(label string) (string, error) {
+	if !isTerminal(os.Stdin) {
+		return readLine()
+	}
+	fmt.Printf("Paste %s (input is hidden): ", label)
+	if runtime.GOOS != "windows" {
+		stty := func(arg string) {
+			cmd := exec.Command("stty", arg)
+			cmd.Stdin = os.Stdin
+			cmd.Run()
+		}
+		stty("-echo")
+		defer stty("echo")
+	}
+	secret, err := readLine()
+	fmt.Println()
+	return secret, err
+}
+
+// storeAccountToken handles "token store <alias> <scope>": it reads a token,
+// keeps it in the OS keyring and points the scope at it
+func storeAccountToken(config Config, args []string) (Config, error) {
+	if len(args) != 2 {
+		return config, fmt.Errorf("usage: ghs token store <alias> <owner|owner/repo|*>  (the token is read from stdin)")
+	}
+	scope := args[1]
+	alias, err := config.lookupAlias(args[0])
+	if err != nil {
+		return config, err
+	}
+	account := config.Accounts[alias]
+	if problem := tokenScopeProblem(scope); problem != "" {
+		return config, fmt.Errorf("%s", problem)
+	}
+	store, err := openSecretStore()
+	if err != nil {
+		return config, err
+	}
+	token, err := readSecret("the token")
+	if err != nil {
+		return config, fmt.Errorf("failed to read the token: %v", err)
+	}
+	if token == "" {
+		return config, fmt.Errorf("no token given")
+	}
+	name := keyringName(account.Username, scope)
+	if err := store.Set(name, token); err != nil {
+		return config, fmt.Errorf("failed to store the token in the %s: %v", store.Name(), err)
+	}
+	logger.Info("token stored", "account", alias, "scope", scope, "store", store.Name())
+	fmt.Printf("Stored the token in the %s as %s\n", store.Name(), name)
+	return setAccountToken(config, []string{alias, scope, tokenRefKeyring + name}, true)
+}
+
+// deleteKeyringToken removes the secret of a keyring reference, if it is one
+func deleteKeyringToken(ref string) {
+	if !strings.HasPrefix(ref, tokenRefKeyring) {
+		return
+	}
+	store, err := openSecretStore()
+	if err == nil {
+		err = store.Delete(strings.TrimPrefix(ref, tokenRefKeyring))
+	}
+	if err != nil {
+		warnf("Failed to remove %s from the keyring: %v", ref, err)
+	}
+}
+
+// checkSecretStore checks that tokens referenced from the keyring are there,
+// and reports tokens in the keyring nothing refers to
+func checkSecretStore(config Config) *doctorResult {
+	referenced := map[string]string{}
+	for alias, account := range config.resolvedAccounts() {
+		for _, ref := range account.Tokens {
+			if strings.HasPrefix(ref, tokenRefKeyring) {
+				referenced[strings.TrimPrefix(ref, tokenRefKeyring)] = alias
+			}
+		}
+	}
+	store, err := openSecretStore()
+	if err != nil {
+		if len(referenced) == 0 {
+			return nil
+		}
+		return &doctorResult{Status: doctorFail, Finding: "unavailable", Message: err.Error(), Hint: "start the keyring, or point the tokens elsewhere with ghs token set"}
+	}
+	names, err := store.List()
+	if err != nil {
+		return &doctorResult{Status: doctorFail, Finding: "unavailable", Message: fmt.Sprintf("%s: %v", store.Name(), err), Hint: "unlock or start the keyring"}
+	}
+	stored := map[string]bool{}
+	var unused []string
+	for _, name := range names {
+		stored[name] = true
+		if _, used := referenced[name]; !used && !strings.HasPrefix(name, appTokenKeyringPrefix) && name != configIdentityName {
+			unused = append(unused, name)
+		}
+	}
+	for _, name := range sortedKeys(referenced) {
+		if !stored[name] {
+			_, scope, _ := strings.Cut(name, ":")
+			return &doctorResult{Status: doctorFail, Finding: "missing", Message: fmt.Sprintf("token %s of account '%s' is not in the %s", name, referenced[name], store.Name()),
+				Hint: fmt.Sprintf("ghs token store %s %s", referenced[name], shellQuote(scope)), Data: map[string]string{"store": store.Name(), "name": name}}
+		}
+	}
+	data := map[string]string{"store": store.Name(), "stored": fmt.Sprint(len(names))}
+	if len(unused) > 0 {
+		return &doctorResult{Status: doctorWarn, Finding: "unused", Message: fmt.Sprintf("%s holds tokens no account uses: %s", store.Name(), strings.Join(unused, ", ")),
+			Hint: "ghs token forget <name>", Data: data}
+	}
+	return &doctorResult{Status: doctorOK, Finding: "ok", Message: fmt.Sprintf("%s, %d token(s)", store.Name(), len(names)), Data: data}
+}
+
+// forgetKeyringToken handles "token forget <name>": it removes a token
+// from the keyring that no account refers to anymore
+func forgetKeyringToken(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: ghs token forget <name>")
+	}
+	store, err := openSecretStore()
+	if err != nil {
+		return err
+	}
+	if err := store.Delete(args[0]); err != nil {
+		return fmt.Errorf("failed to remove %s from the %s: %v", args[0], store.Name(), err)
+	}
+	fmt.Printf("Removed %s from the %s\n", args[0], store.Name())
+	return nil
+}
+
+// keychainStore keeps secrets as generic passwords in the macOS keychain
+type keychainStore struct{}
+
+func (keychainStore) Name() string { return "macOS keychain" }
+
+func (keychainStore) Get(name string) (string, error) {
+	cmd := execCommand("security", "find-generic-password", "-s", keyringService, "-a", name, "-w")
+	cmd.secretOutput = true
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s not found in the keychain", name)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (keychainStore) Set(name, secret string) error {
+	// Through stdin, so the secret doesn't show up in the process list
+	quote := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	cmd := execCommand("security", "-i")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %s -a \"%s\" -w \"%s\"\n", keyringService, quote.Replace(name), quote.Replace(secret)))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("security: %s", errorLine(string(out), err))
+	}
+	return nil
+}
+
+func (keychainStore) Delete(name string) error {
+	if out, err := execCommand("security", "delete-generic-password", "-s", keyringService, "-a", name).CombinedOutput(); err != nil {
+		return fmt.Errorf("security: %s", errorLine(string(out), err))
+	}
+	return nil
+}
+
+func (keychainStore) List() ([]string, error) {
+	out, err := execCommand("security", "dump-keychain").Output()
+	if err != nil {
+		return nil, err
+	}
+	// Items list their attributes one per line; the service follows the account
+	var names []string
+	account := ""
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if value, ok := strings.CutPrefix(line, `"acct"<blob>=`); ok {
+			account = strings.Trim(value, `"`)
+		} else if line == `"svce"<blob>="`+keyringService+`"` && account != "" {
+			names = append(names, account)
+		} else if strings.HasPrefix(line, "keychain:") {
+			account = ""
+		}
+	}
+	return names, nil
+}
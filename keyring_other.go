@@ -0,0 +1,10 @@
+//go:build !windows
+
+package main
+
+import "fmt"
+
+// openWincred fails outside Windows
+func openWincred() (secretStore, error) {
+	return nil, fmt.Errorf("the Windows Credential Manager is only available on Windows")
+}
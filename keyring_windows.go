@@ -0,0 +1,133 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	advapi32           = syscall.NewLazyDLL("advapi32.dll")
+	procCredReadW      = advapi32.NewProc("CredReadW")
+	procCredWriteW     = advapi32.NewProc("CredWriteW")
+	procCredDeleteW    = advapi32.NewProc("CredDeleteW")
+	procCredEnumerateW = advapi32.NewProc("CredEnumerateW")
+	procCredFree       = advapi32.NewProc("CredFree")
+)
+
+const (
+	credTypeGeneric         = 1
+	credPersistLocalMachine = 2
+	errorNotFound           = syscall.Errno(1168)
+)
+
+// winCredential is the CREDENTIALW structure
+type winCredential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        syscall.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// wincredStore keeps secrets as generic credentials named "ghs:<name>" in
+// the Windows Credential Manager, which only the user's logon can read
+type wincredStore struct{}
+
+func openWincred() (secretStore, error) {
+	if err := procCredReadW.Find(); err != nil {
+		return nil, fmt.Errorf("the Windows Credential Manager is not available: %v", err)
+	}
+	return wincredStore{}, nil
+}
+
+func (wincredStore) Name() string { return "Windows Credential Manager" }
+
+func wincredTarget(name string) string {
+	return keyringService + ":" + name
+}
+
+func (wincredStore) Get(name string) (string, error) {
+	target, err := syscall.UTF16PtrFromString(wincredTarget(name))
+	if err != nil {
+		return "", err
+	}
+	var cred *winCredential
+	if ret, _, err := procCredReadW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred))); ret == 0 {
+		if err == errorNotFound {
+			return "", fmt.Errorf("%s not found in the Credential Manager", name)
+		}
+		return "", err
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(cred)))
+	return string(unsafe.Slice(cred.CredentialBlob, cred.CredentialBlobSize)), nil
+}
+
+func (wincredStore) Set(name, secret string) error {
+	target, err := syscall.UTF16PtrFromString(wincredTarget(name))
+	if err != nil {
+		return err
+	}
+	user, _ := syscall.UTF16PtrFromString(name)
+	blob := []byte(secret)
+	cred := winCredential{Type: credTypeGeneric, TargetName: target, UserName: user, Persist: credPersistLocalMachine, CredentialBlobSize: uint32(len(blob))}
+	if len(blob) > 0 {
+		cred.CredentialBlob = &blob[0]
+	}
+	if ret, _, err := procCredWriteW.Call(uintptr(unsafe.Pointer(&cred)), 0); ret == 0 {
+		return err
+	}
+	return nil
+}
+
+func (wincredStore) Delete(name string) error {
+	target, err := syscall.UTF16PtrFromString(wincredTarget(name))
+	if err != nil {
+		return err
+	}
+	if ret, _, err := procCredDeleteW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0); ret == 0 && err != errorNotFound {
+		return err
+	}
+	return nil
+}
+
+func (wincredStore) List() ([]string, error) {
+	filter, err := syscall.UTF16PtrFromString(wincredTarget("*"))
+	if err != nil {
+		return nil, err
+	}
+	var count uint32
+	var creds **winCredential
+	if ret, _, err := procCredEnumerateW.Call(uintptr(unsafe.Pointer(filter)), 0, uintptr(unsafe.Pointer(&count)), uintptr(unsafe.Pointer(&creds))); ret == 0 {
+		if err == errorNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(creds)))
+	var names []string
+	for _, cred := range unsafe.Slice(creds, count) {
+		target := syscall.UTF16ToString(unsafe.Slice(cred.TargetName, utf16Len(cred.TargetName)))
+		names = append(names, strings.TrimPrefix(target, keyringService+":"))
+	}
+	return names, nil
+}
+
+// utf16Len is the length of a NUL-terminated UTF-16 string
+func utf16Len(p *uint16) int {
+	n := 0
+	for ptr := unsafe.Pointer(p); *(*uint16)(ptr) != 0; n++ {
+		ptr = unsafe.Add(ptr, 2)
+	}
+	return n
+}
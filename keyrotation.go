@@ -0,0 +1,259 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// keyRotationWarning is how long before its rotation is due a key is
+// reported
+const keyRotationWarning = 14 * 24 * time.Hour
+
+// keyDateFormat is the format of key_created
+const keyDateFormat = "2006-01-02"
+
+// keyRotationProblems checks an account's key_created and key_rotation
+func keyRotationProblems(account GitHubAccount) []fieldProblem {
+	var problems []fieldProblem
+	if account.KeyCreated != "" {
+		if _, err := time.Parse(keyDateFormat, account.KeyCreated); err != nil {
+			problems = append(problems, fieldProblem{"key_created", fmt.Sprintf("invalid date %q, use YYYY-MM-DD", account.KeyCreated)})
+		}
+	}
+	if problem := keyRotationProblem(account.KeyRotation); problem != "" {
+		problems = append(problems, fieldProblem{"key_rotation", problem})
+	}
+	return problems
+}
+
+// keyRotationProblem checks a rotation interval such as 180d
+func keyRotationProblem(rotation string) string {
+	if rotation == "" {
+		return ""
+	}
+	if d, err := parseSince(rotation); err != nil || d <= 0 {
+		return fmt.Sprintf("invalid rotation interval %q, use e.g. 180d or 26w", rotation)
+	}
+	return ""
+}
+
+// keyCreated returns when the account's key was generated: key_created, or
+// the key file's modification time for keys that predate it
+func keyCreated(account GitHubAccount) (created time.Time, recorded bool, err error) {
+	if account.KeyCreated != "" {
+		created, err = time.ParseInLocation(keyDateFormat, account.KeyCreated, time.Local)
+		return created, true, err
+	}
+	info, err := os.Stat(account.SSHKeyPath)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return info.ModTime(), false, nil
+}
+
+// keyRotationDue returns when the account's key has to be rotated; ok is
+// false when the account has no rotation interval or its key's age is
+// unknown
+func keyRotationDue(account GitHubAccount) (due time.Time, ok bool) {
+	interval, err := parseSince(account.KeyRotation)
+	if account.KeyRotation == "" || err != nil || account.SSHKeyPath == "" || account.hardwareKey() {
+		return time.Time{}, false
+	}
+	created, _, err := keyCreated(account)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return created.Add(interval), true
+}
+
+// rotationText describes when a key is due for rotation
+func rotationText(due time.Time) string {
+	left := time.Until(due)
+	if left < 0 {
+		return "overdue since " + due.Format(keyDateFormat)
+	}
+	return fmt.Sprintf("due %s (%s)", due.Format(keyDateFormat), daysText(int(left.Hours()/24)))
+}
+
+// checkKeyRotation checks that the account's key is rotated on schedule
+func checkKeyRotation(alias string, account GitHubAccount) *doctorResult {
+	due, ok := keyRotationDue(account)
+	if !ok {
+		return nil
+	}
+	data := map[string]string{"path": account.SSHKeyPath, "rotation": account.KeyRotation, "due": due.Format(keyDateFormat)}
+	hint := "ghs rotate-key " + alias
+	switch left := time.Until(due); {
+	case left < 0:
+		return &doctorResult{Status: doctorFail, Finding: "overdue", Message: "key rotation " + rotationText(due), Hint: hint, Data: data}
+	case left < keyRotationWarning:
+		return &doctorResult{Status: doctorWarn, Finding: "due", Message: "key rotation " + rotationText(due), Hint: hint, Data: data}
+	}
+	return &doctorResult{Status: doctorOK, Finding: "ok", Message: "key rotation " + rotationText(due), Data: data}
+}
+
+// rotationNote is appended to an account in the plain list when its key is
+// due for rotation soon
+func rotationNote(account GitHubAccount) string {
+	due, ok := keyRotationDue(account)
+	if !ok || time.Until(due) >= keyRotationWarning {
+		return ""
+	}
+	return " - key rotation " + rotationText(due)
+}
+
+// describeRotation describes an account's rotation schedule for
+// "list --verbose"
+func describeRotation(account GitHubAccount) string {
+	if account.KeyRotation == "" {
+		return "none"
+	}
+	due, ok := keyRotationDue(account)
+	if !ok {
+		return "every " + account.KeyRotation + ", key age unknown"
+	}
+	text := "every " + account.KeyRotation + ", " + rotationText(due)
+	if _, recorded, _ := keyCreated(account); !recorded {
+		text += ", from the key file's date"
+	}
+	return text
+}
+
+// uploadGitHubKey registers the account's public key on its GitHub user
+func uploadGitHubKey(account GitHubAccount, title string) error {
+	public, err := publicKeyOf(account)
+	if err != nil {
+		return fmt.Errorf("failed to read public key: %v", err)
+	}
+	token, err := ownerToken(account)
+	if err != nil {
+		return err
+	}
+	body := map[string]string{"title": title, "key": public}
+	return githubRequest("POST", "/user/keys", token, body, nil)
+}
+
+// rotateKey handles "rotate-key <alias> [--upload] [--yes]": it replaces the
+// account's key pair with a new one of the same type, keeping the old pair
+// as <key>.old, and records the new key's date. With --upload the new key
+// is added to GitHub and the old one removed from it.
+func rotateKey(config Config, args []string) (Config, error) {
+	flags := flag.NewFlagSet("rotate-key", flag.ContinueOnError)
+	upload := flags.Bool("upload", false, "add the new key to GitHub and remove the old one, with the account's token")
+	yes := flags.Bool("yes", false, "rotate without asking")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return config, err
+	}
+	if len(positional) != 1 {
+		return config, fmt.Errorf("usage: ghs rotate-key <alias> [--upload] [--yes]")
+	}
+	alias, err := config.exactAlias(positional[0])
+	if err != nil {
+		return config, err
+	}
+	stored := config.Accounts[alias]
+	account := config.Defaults.apply(stored)
+	switch {
+	case httpsOnly:
+		return config, fmt.Errorf("the transport is https, accounts have no ssh key")
+	case account.hardwareKey():
+		return config, fmt.Errorf("the key of account '%s' is on a hardware token, replace it with the token's tools", alias)
+	case account.SSHKeyPath == "":
+		return config, fmt.Errorf("account '%s' has no ssh key", alias)
+	case keyShared(config, alias, account.SSHKeyPath):
+		return config, fmt.Errorf("another account uses %s, give '%s' its own key first", account.SSHKeyPath, alias)
+	}
+	if _, err := os.Stat(account.SSHKeyPath); err != nil {
+		return config, fmt.Errorf("key %s not found", account.SSHKeyPath)
+	}
+	// Keep the key's type unless the account asks for another one
+	keyType := account.KeyType
+	if keyType == "" {
+		if current, _, err := keyFingerprint(account.SSHKeyPath); err == nil && keyTypes[strings.ToLower(current)] {
+			keyType = strings.ToLower(current)
+		}
+	}
+	// Check the token before touching the key, not halfway through
+	if *upload {
+		if _, err := ownerToken(account); err != nil {
+			return config, fmt.Errorf("can't manage the GitHub keys of %s: %v", account.Username, err)
+		}
+	}
+
+	old := account
+	old.SSHKeyPath = account.SSHKeyPath + ".old"
+	fmt.Printf("Rotating the key of account '%s' (%s):\n", alias, account.Username)
+	fmt.Printf("  %s moves to %s\n", account.SSHKeyPath, old.SSHKeyPath)
+	kind := "key"
+	if keyType != "" {
+		kind = keyType + " key"
+	}
+	fmt.Printf("  a new %s is generated at %s\n", kind, account.SSHKeyPath)
+	if *upload {
+		fmt.Println("  the new key is added to GitHub and the old one removed")
+	}
+	if !*yes {
+		ok, err := confirm(fmt.Sprintf("Rotate the key of '%s'?", alias), false)
+		if err != nil {
+			return config, fmt.Errorf("%v (pass --yes)", err)
+		}
+		if !ok {
+			return config, fmt.Errorf("aborted")
+		}
+	}
+
+	for _, suffix := range []string{"", ".pub"} {
+		if err := os.Rename(account.SSHKeyPath+suffix, old.SSHKeyPath+suffix); err != nil && !os.IsNotExist(err) {
+			return config, fmt.Errorf("failed to keep the old key: %v", err)
+		}
+	}
+	keygen := append(keygenArgs(keyType), "-C", account.Email, "-f", account.SSHKeyPath, "-N", "")
+	cmd := execCommand("ssh-keygen", keygen...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		// Put the old key back so the account keeps working
+		for _, suffix := range []string{"", ".pub"} {
+			os.Rename(old.SSHKeyPath+suffix, account.SSHKeyPath+suffix)
+		}
+		return config, fmt.Errorf("failed to generate SSH key: %v", err)
+	}
+	if err := os.Chmod(account.SSHKeyPath, 0600); err != nil {
+		return config, fmt.Errorf("failed to protect SSH key: %v", err)
+	}
+
+	stored.KeyCreated = time.Now().Format(keyDateFormat)
+	config.Accounts[alias] = stored
+	// A shared connection would keep authenticating with the old key
+	closeMaster(account)
+	if account.SSHCertificate != "" || account.SSHCertificateCommand != "" {
+		warnf("the SSH certificate was issued for the old key; have the new one signed (ghs cert refresh %s)", alias)
+	}
+
+	if !*upload {
+		fmt.Printf("\nNew key generated. Add it to GitHub, then remove the old key there and delete %s:\n", old.SSHKeyPath)
+		fmt.Printf("cat %s.pub\n", account.SSHKeyPath)
+		return config, nil
+	}
+	title := fmt.Sprintf("ghs %s %s", alias, stored.KeyCreated)
+	if err := uploadGitHubKey(account, title); err != nil {
+		warnf("the new key wasn't added to GitHub, add %s.pub yourself: %v", account.SSHKeyPath, err)
+		return config, nil
+	}
+	fmt.Println("Added the new key to GitHub")
+	if err := deleteGitHubKey(old); err != nil {
+		warnf("the old key wasn't removed from GitHub: %v", err)
+		return config, nil
+	}
+	fmt.Println("Removed the old key from GitHub")
+	for _, suffix := range []string{"", ".pub"} {
+		if err := os.Remove(old.SSHKeyPath + suffix); err != nil && !os.IsNotExist(err) {
+			warnf("%v", err)
+		}
+	}
+	return config, nil
+}
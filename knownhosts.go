@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// knownHostsDir holds the known_hosts files of accounts with their own
+func knownHostsDir() string {
+	return filepath.Join(stateDir, "known_hosts")
+}
+
+// KnownHostsFile is the account's own known_hosts file, for the template
+func (a GitHubAccount) KnownHostsFile() string {
+	return filepath.Join(knownHostsDir(), a.Username)
+}
+
+// githubHostKeys returns GitHub's published SSH host keys as "type key"
+func githubHostKeys() ([]string, error) {
+	var meta struct {
+		SSHKeys []string `json:"ssh_keys"`
+	}
+	if err := githubRequest("GET", "/meta", "", nil, &meta); err != nil {
+		return nil, fmt.Errorf("failed to fetch GitHub's host keys: %v", err)
+	}
+	if len(meta.SSHKeys) == 0 {
+		return nil, fmt.Errorf("GitHub published no host keys")
+	}
+	return meta.SSHKeys, nil
+}
+
+// seedKnownHosts writes GitHub's published host keys into the account's
+// known_hosts file, replacing what it held
+func seedKnownHosts(account GitHubAccount) error {
+	keys, err := githubHostKeys()
+	if err != nil {
+		return err
+	}
+	if err := mkdirPrivate(knownHostsDir()); err != nil {
+		return fmt.Errorf("failed to create %s: %v", knownHostsDir(), err)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "# GitHub host keys for %s, written by ghs\n", account.Username)
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%s %s\n", defaultHost, key)
+	}
+	if err := writePrivateFile(account.KnownHostsFile(), []byte(b.String())); err != nil {
+		return fmt.Errorf("failed to write %s: %v", account.KnownHostsFile(), err)
+	}
+	return nil
+}
+
+// prepareKnownHosts seeds the missing known_hosts files of accounts that
+// have their own, before the Host blocks point ssh at them
+func prepareKnownHosts(accounts map[string]GitHubAccount) {
+	for _, alias := range sortedAliases(accounts) {
+		account := accounts[alias]
+		if !account.KnownHosts {
+			continue
+		}
+		if _, err := os.Stat(account.KnownHostsFile()); err == nil {
+			continue
+		}
+		if err := seedKnownHosts(account); err != nil {
+			warnf("known_hosts of account '%s' not seeded: %v", alias, err)
+		}
+	}
+}
+
+// refreshKnownHosts handles "sshconfig known-hosts": it rewrites the
+// known_hosts files of accounts with GitHub's current host keys, e.g. after
+// GitHub rotated one
+func refreshKnownHosts(config Config, args []string) error {
+	flags := flag.NewFlagSet("sshconfig known-hosts", flag.ContinueOnError)
+	all := flags.Bool("all", false, "every account with its own known_hosts")
+	aliases, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if *all == (len(aliases) > 0) {
+		return fmt.Errorf("usage: ghs sshconfig known-hosts <alias>... | --all")
+	}
+	if *all {
+		for _, alias := range sortedAliases(config.Accounts) {
+			if config.Accounts[alias].KnownHosts {
+				aliases = append(aliases, alias)
+			}
+		}
+		if len(aliases) == 0 {
+			return fmt.Errorf("no account has its own known_hosts (ghs edit <alias> --known-hosts)")
+		}
+	}
+	if aliases, err = config.lookupAliases(aliases); err != nil {
+		return err
+	}
+	for _, alias := range aliases {
+		account := config.Accounts[alias]
+		if !account.KnownHosts {
+			return fmt.Errorf("account '%s' uses the shared known_hosts (ghs edit %s --known-hosts)", alias, alias)
+		}
+		if err := seedKnownHosts(account); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote GitHub's host keys to %s\n", account.KnownHostsFile())
+	}
+	return nil
+}
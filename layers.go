@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+)
+
+// systemConfig is the parsed system-wide config, nil when there is none;
+// userLayer is the user's config file as loaded, to tell the values the user
+// set from the ones inherited
+var systemConfig, userLayer *jsonObject
+
+// jsonObject is a decoded JSON object that keeps the order of its keys, so
+// saving doesn't shuffle the user's file
+type jsonObject struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func newJSONObject() *jsonObject {
+	return &jsonObject{values: map[string]interface{}{}}
+}
+
+func (o *jsonObject) set(key string, value interface{}) {
+	if _, exists := o.values[key]; !exists {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+func (o *jsonObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(key)
+		value, err := json.Marshal(o.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// systemConfigPath returns where administrators provision settings shared
+// by every user of the machine
+func systemConfigPath() string {
+	if path := os.Getenv(envSystemConfig); path != "" {
+		return path
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("ProgramData"), "ghs", "config.json")
+	}
+	return "/etc/ghs/config.json"
+}
+
+// decodeJSONObject parses a config file generically, keeping numbers as
+// written and keys in order
+func decodeJSONObject(data []byte) (*jsonObject, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	value, err := decodeJSONValue(decoder)
+	if err != nil {
+		return nil, err
+	}
+	object, ok := value.(*jsonObject)
+	if !ok {
+		return nil, fmt.Errorf("the config is not a JSON object")
+	}
+	return object, nil
+}
+
+func decodeJSONValue(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch token {
+	case json.Delim('{'):
+		object := newJSONObject()
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeJSONValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			object.set(key.(string), value)
+		}
+		_, err := decoder.Token()
+		return object, err
+	case json.Delim('['):
+		list := []interface{}{}
+		for decoder.More() {
+			value, err := decodeJSONValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		_, err := decoder.Token()
+		return list, err
+	}
+	return token, nil
+}
+
+// readSystemConfig loads the system-wide config; a missing file is no layer
+func readSystemConfig() error {
+	data, err := os.ReadFile(systemConfigPath())
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	object, err := decodeJSONObject(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %v", systemConfigPath(), err)
+	}
+	systemConfig = object
+	return nil
+}
+
+// mergeLayers lays the user's config over the system one: objects such as
+// accounts, defaults and ssh_options merge key by key with the user's value
+// winning, owner rules are the user's followed by the system's, and any
+// other value set by the user replaces the system's
+func mergeLayers(system, user *jsonObject) *jsonObject {
+	merged := newJSONObject()
+	for _, key := range system.keys {
+		merged.set(key, system.values[key])
+	}
+	for _, key := range user.keys {
+		value := user.values[key]
+		base, exists := merged.values[key]
+		switch {
+		case !exists:
+			merged.set(key, value)
+		case key == "owner_rules":
+			userRules, _ := value.([]interface{})
+			systemRules, _ := base.([]interface{})
+			merged.set(key, append(append([]interface{}{}, userRules...), systemRules...))
+		default:
+			baseObject, baseOK := base.(*jsonObject)
+			object, ok := value.(*jsonObject)
+			if baseOK && ok {
+				merged.set(key, mergeLayers(baseObject, object))
+			} else {
+				merged.set(key, value)
+			}
+		}
+	}
+	return merged
+}
+
+// subtractLayer is the inverse of mergeLayers for saving: it drops from a
+// merged config whatever the system layer provides unchanged and the user
+// didn't set, leaving what belongs in the user's file. user is the part of
+// the user's file at the same place, nil when it has none, and t the type
+// the objects decode to.
+func subtractLayer(merged, system, user *jsonObject, t reflect.Type) *jsonObject {
+	if user == nil {
+		user = newJSONObject()
+	}
+	own := newJSONObject()
+	for _, key := range merged.keys {
+		value := merged.values[key]
+		base, exists := system.values[key]
+		_, userSet := user.values[key]
+		switch {
+		case !exists && isZeroJSON(value) && !userSet:
+			// Fields the structs always write, such as an empty
+			// ssh_key_path, add nothing to what the system provides
+		case !exists:
+			own.set(key, value)
+		case key == "owner_rules":
+			rules, _ := value.([]interface{})
+			systemRules, _ := base.([]interface{})
+			var ownRules []interface{}
+			for _, rule := range rules {
+				inherited := false
+				for _, systemRule := range systemRules {
+					inherited = inherited || sameJSON(rule, systemRule)
+				}
+				if !inherited {
+					ownRules = append(ownRules, rule)
+				}
+			}
+			if len(ownRules) > 0 {
+				own.set(key, ownRules)
+			}
+		default:
+			baseObject, baseOK := base.(*jsonObject)
+			object, ok := value.(*jsonObject)
+			userObject, _ := user.values[key].(*jsonObject)
+			switch {
+			case baseOK && ok:
+				if rest := subtractLayer(object, baseObject, userObject, layerType(t, key)); len(rest.keys) > 0 {
+					own.set(key, rest)
+				}
+			case userSet || !sameJSON(value, base):
+				own.set(key, value)
+			}
+		}
+	}
+	if !isStructType(t) {
+		return own
+	}
+	// Fields the user emptied are left out of merged; their zero value keeps
+	// the system's from coming back
+	for _, key := range system.keys {
+		if _, kept := merged.values[key]; kept || key == "owner_rules" || isZeroJSON(system.values[key]) {
+			continue
+		}
+		switch base := system.values[key].(type) {
+		case *jsonObject:
+			if rest := subtractLayer(newJSONObject(), base, nil, layerType(t, key)); len(rest.keys) > 0 {
+				own.set(key, rest)
+			}
+		case []interface{}:
+			own.set(key, []interface{}{})
+		case string:
+			own.set(key, "")
+		case bool:
+			own.set(key, false)
+		case json.Number:
+			own.set(key, json.Number("0"))
+		}
+	}
+	return own
+}
+
+// inheritedRemovals lists what merged no longer has of the system layer and
+// no value in the user's file can take away: accounts, owner rules and other
+// entries of maps. Emptied fields are overridden by subtractLayer instead.
+func inheritedRemovals(merged, system *jsonObject, path string, t reflect.Type) []string {
+	var removed []string
+	for _, key := range system.keys {
+		base := system.values[key]
+		value, kept := merged.values[key]
+		field := joinField(path, key)
+		baseObject, baseOK := base.(*jsonObject)
+		switch {
+		case key == "owner_rules" && path == "":
+			rules, _ := value.([]interface{})
+			systemRules, _ := base.([]interface{})
+			for _, systemRule := range systemRules {
+				found := false
+				for _, rule := range rules {
+					found = found || sameJSON(rule, systemRule)
+				}
+				if rule, ok := systemRule.(*jsonObject); ok && !found {
+					removed = append(removed, fmt.Sprintf("owner rule %v -> %v", rule.values["pattern"], rule.values["account"]))
+				}
+			}
+		case isZeroJSON(base):
+		case !kept && !isStructType(t):
+			removed = append(removed, field)
+		case baseOK:
+			object, ok := value.(*jsonObject)
+			if !ok {
+				object = newJSONObject()
+			}
+			removed = append(removed, inheritedRemovals(object, baseObject, field, layerType(t, key))...)
+		}
+	}
+	return removed
+}
+
+// layerType returns the type of the value under key in an object of type t,
+// nil when the schema doesn't know it
+func layerType(t reflect.Type, key string) reflect.Type {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == nil:
+		return nil
+	case t.Kind() == reflect.Map:
+		return t.Elem()
+	case t.Kind() == reflect.Struct:
+		field, _ := jsonFieldType(t, key)
+		return field
+	}
+	return nil
+}
+
+// isStructType reports whether objects of type t hold fields rather than
+// map entries
+func isStructType(t reflect.Type) bool {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t != nil && t.Kind() == reflect.Struct
+}
+
+// sameJSON reports whether two decoded JSON values are equal
+func sameJSON(a, b interface{}) bool {
+	dataA, errA := json.Marshal(a)
+	dataB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(dataA, dataB)
+}
+
+// isZeroJSON reports whether a decoded JSON value is empty
+func isZeroJSON(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case bool:
+		return !v
+	case *jsonObject:
+		return len(v.keys) == 0
+	case []interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+// layerConfig merges the system layer under the user's config file
+func layerConfig(data []byte) ([]byte, error) {
+	if systemConfig == nil {
+		return data, nil
+	}
+	user, err := decodeJSONObject(data)
+	if err != nil {
+		return nil, err
+	}
+	userLayer = user
+	return json.Marshal(mergeLayers(systemConfig, user))
+}
+
+// unlayerConfig removes what the system layer provides from the config
+// about to be saved. Saving is refused when it drops accounts, owner rules or
+// other entries the system provides: they would come back on the next run.
+func unlayerConfig(data []byte) ([]byte, error) {
+	if systemConfig == nil {
+		return data, nil
+	}
+	merged, err := decodeJSONObject(data)
+	if err != nil {
+		return nil, err
+	}
+	configType := reflect.TypeOf(Config{})
+	if removed := inheritedRemovals(merged, systemConfig, "", configType); len(removed) > 0 {
+		for _, what := range removed {
+			warnf("%s comes from %s and can't be removed", what, systemConfigPath())
+		}
+		return nil, fmt.Errorf("the change removes %d setting(s) provided by %s", len(removed), systemConfigPath())
+	}
+	return json.MarshalIndent(subtractLayer(merged, systemConfig, userLayer, configType), "", "  ")
+}
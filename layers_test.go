@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSubtractLayer(t *testing.T) {
+	system := `{
+  "accounts": {"sys": {"email": "sys@corp.com", "username": "sys", "tags": ["corp"], "notes": "from IT"}},
+  "owner_rules": [{"pattern": "corp-*", "account": "sys"}],
+  "gh_auth_switch": true
+}`
+	tests := []struct {
+		name    string
+		merged  string
+		want    string
+		removed []string
+	}{
+		{
+			name:   "inherited values stay out of the user's file",
+			merged: `{"accounts": {"sys": {"email": "sys@corp.com", "username": "sys", "tags": ["corp"], "notes": "from IT"}}, "owner_rules": [{"pattern": "corp-*", "account": "sys"}], "gh_auth_switch": true}`,
+			want:   `{}`,
+		},
+		{
+			name:   "changed values are the user's",
+			merged: `{"accounts": {"sys": {"email": "me@corp.com", "username": "sys", "tags": ["corp"], "notes": "from IT"}}, "owner_rules": [{"pattern": "me", "account": "sys"}, {"pattern": "corp-*", "account": "sys"}], "transport": "https", "gh_auth_switch": true}`,
+			want:   `{"accounts":{"sys":{"email":"me@corp.com"}},"owner_rules":[{"pattern":"me","account":"sys"}],"transport":"https"}`,
+		},
+		{
+			name:   "emptied fields are written as overrides",
+			merged: `{"accounts": {"sys": {"email": "sys@corp.com", "username": "sys"}}, "owner_rules": [{"pattern": "corp-*", "account": "sys"}]}`,
+			want:   `{"accounts":{"sys":{"tags":[],"notes":""}},"gh_auth_switch":false}`,
+		},
+		{
+			name:    "removed accounts and rules can't be overridden",
+			merged:  `{"gh_auth_switch": true}`,
+			removed: []string{"accounts.sys", "owner rule corp-* -> sys"},
+		},
+	}
+	systemObject, err := decodeJSONObject([]byte(system))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, err := decodeJSONObject([]byte(tt.merged))
+			if err != nil {
+				t.Fatal(err)
+			}
+			configType := reflect.TypeOf(Config{})
+			if removed := inheritedRemovals(merged, systemObject, "", configType); !reflect.DeepEqual(removed, tt.removed) {
+				t.Errorf("removed = %q, want %q", removed, tt.removed)
+			}
+			if tt.removed != nil {
+				return
+			}
+			data, err := json.Marshal(subtractLayer(merged, systemObject, nil, configType))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("user file = %s, want %s", data, tt.want)
+			}
+			// Laying the user's file over the system's gives the config back
+			user, _ := decodeJSONObject(data)
+			var got, want Config
+			relayered, _ := json.Marshal(mergeLayers(systemObject, user))
+			json.Unmarshal(relayered, &got)
+			json.Unmarshal([]byte(tt.merged), &want)
+			gotData, _ := json.Marshal(got)
+			wantData, _ := json.Marshal(want)
+			if string(gotData) != string(wantData) {
+				t.Errorf("relayered config = %s, want %s", gotData, wantData)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// LFSSettings configures Git LFS for repositories using an account
+type LFSSettings struct {
+	// URL overrides the LFS endpoint (lfs.url), e.g. an SSO-protected server
+	URL string `json:"url,omitempty"`
+	// CredentialHelper is used for requests to the LFS endpoint only
+	CredentialHelper string `json:"credential_helper,omitempty"`
+}
+
+// gitSettings returns the git config derived from the LFS settings
+func (l *LFSSettings) gitSettings() map[string]string {
+	if l == nil {
+		return nil
+	}
+	settings := map[string]string{}
+	if l.URL != "" {
+		settings["lfs.url"] = l.URL
+		if l.CredentialHelper != "" {
+			settings["credential."+lfsCredentialScope(l.URL)+".helper"] = l.CredentialHelper
+		}
+	}
+	return settings
+}
+
+// lfsCredentialScope returns the URL prefix credential helpers are scoped to
+func lfsCredentialScope(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// lfsProblems checks LFS settings for malformed values
+func lfsProblems(l *LFSSettings) []fieldProblem {
+	if l == nil {
+		return nil
+	}
+	var problems []fieldProblem
+	if l.URL != "" {
+		if u, err := url.Parse(l.URL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			problems = append(problems, fieldProblem{"lfs.url", fmt.Sprintf("invalid LFS URL %q, expected https://host/path", l.URL)})
+		}
+	}
+	if l.CredentialHelper != "" && l.URL == "" {
+		problems = append(problems, fieldProblem{"lfs.credential_helper", "requires lfs.url to scope the helper to"})
+	}
+	return problems
+}
+
+// requireGitLFS fails when git-lfs is not installed
+func requireGitLFS(alias string) error {
+	if err := execCommand("git", "lfs", "version").Run(); err != nil {
+		return fmt.Errorf("account '%s' requires Git LFS but git-lfs is not installed (see https://git-lfs.com)", alias)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// accountDetails are the facts "list --verbose" looks up for an account
+type accountDetails struct {
+	Key      string
+	GitHub   string
+	LastUsed string
+}
+
+// publicKeyOf returns the "type key" of an account's public key
+func publicKeyOf(account GitHubAccount) (string, error) {
+	path := account.SSHKeyPath
+	if !strings.HasSuffix(path, ".pub") {
+		path += ".pub"
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 2 {
+		return "", fmt.Errorf("%s is not a public key", path)
+	}
+	return fields[0] + " " + fields[1], nil
+}
+
+// describeKey returns the type, fingerprint and presence of an account's key
+func describeKey(account GitHubAccount) string {
+	if account.SSHKeyPath == "" {
+		if account.hardwareKey() {
+			return "on a hardware token"
+		}
+		return "none"
+	}
+	if _, err := os.Stat(account.SSHKeyPath); err != nil {
+		return account.SSHKeyPath + " (missing)"
+	}
+	keyType, fingerprint, err := keyFingerprint(account.SSHKeyPath)
+	if err != nil {
+		return account.SSHKeyPath + " (present, not a readable key)"
+	}
+	return fmt.Sprintf("%s (%s %s)", account.SSHKeyPath, keyType, fingerprint)
+}
+
+// keyFingerprint returns the type and SHA256 fingerprint of a key, read
+// from its public half when there is one
+func keyFingerprint(path string) (keyType, fingerprint string, err error) {
+	if _, err := os.Stat(path + ".pub"); err == nil {
+		path += ".pub"
+	}
+	out, err := execCommand("ssh-keygen", "-l", "-f", path).Output()
+	// 256 SHA256:... comment (ED25519)
+	fields := strings.Fields(string(out))
+	if err != nil || len(fields) < 3 {
+		return "", "", fmt.Errorf("ssh-keygen can't read %s", path)
+	}
+	return strings.Trim(fields[len(fields)-1], "()"), fields[1], nil
+}
+
+// githubKeyStatus reports whether the account's public key is registered on
+// its GitHub user, from the user's public key list
+func githubKeyStatus(account GitHubAccount) string {
+	public, err := publicKeyOf(account)
+	if err != nil {
+		return "unknown, no public key to compare"
+	}
+	var keys []githubKey
+	if err := githubRequest("GET", "/users/"+account.Username+"/keys", "", nil, &keys); err != nil {
+		if errors.Is(err, errOffline) {
+			return "unknown, GitHub unavailable"
+		}
+		return "unknown: " + err.Error()
+	}
+	for _, key := range keys {
+		if key.Key == public {
+			return "registered"
+		}
+	}
+	return "not registered"
+}
+
+// lastUsed returns the latest journal entry of every account
+func lastUsed() map[string]historyEntry {
+	entries, _ := readHistory(time.Time{})
+	last := map[string]historyEntry{}
+	for _, entry := range entries {
+		if entry.Time.After(last[entry.Alias].Time) {
+			last[entry.Alias] = entry
+		}
+	}
+	return last
+}
+
+// collectAccountDetails looks up the details of the given accounts in
+// parallel, since each may ask GitHub
+func collectAccountDetails(config Config, aliases []string) map[string]accountDetails {
+	last := lastUsed()
+	details := make([]accountDetails, len(aliases))
+	forEachParallel(len(aliases), defaultJobs(), func(i int) {
+		account, _ := config.account(aliases[i])
+		d := accountDetails{Key: describeKey(account), LastUsed: "never"}
+		if httpsOnly {
+			d.GitHub = "not used, the transport is https"
+		} else {
+			d.GitHub = githubKeyStatus(account)
+		}
+		if entry, ok := last[aliases[i]]; ok {
+			d.LastUsed = entry.Time.Local().Format("2006-01-02 15:04") + " (" + entry.Action
+			if entry.Repo != "" {
+				d.LastUsed += " in " + entry.Repo
+			}
+			d.LastUsed += ")"
+		}
+		details[i] = d
+	})
+	byAlias := make(map[string]accountDetails, len(aliases))
+	for i, alias := range aliases {
+		byAlias[alias] = details[i]
+	}
+	return byAlias
+}
+
+// signingMode describes how an account signs commits and tags
+func signingMode(account GitHubAccount) string {
+	mode := account.Signing
+	if mode == "" {
+		mode = signingGPG
+	}
+	if account.SignTags {
+		mode += ", tags signed"
+	}
+	return mode
+}
+
+// accountHost returns the host an account's remotes use
+func accountHost(account GitHubAccount) string {
+	if httpsOnly {
+		return "https://github.com"
+	}
+	return "github.com-" + account.Username
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Environment variables for the log file
+const (
+	envLog      = "GHS_LOG"
+	envLogLevel = "GHS_LOG_LEVEL"
+)
+
+// logger records what ghs did, for debugging reports. It discards
+// everything unless --log-file or GHS_LOG names a file.
+var logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// setupLogging appends JSON log records to path. GHS_LOG_LEVEL selects
+// debug, info (the default), warn or error.
+func setupLogging(path string) error {
+	level := slog.LevelInfo
+	if name := os.Getenv(envLogLevel); name != "" {
+		if err := level.UnmarshalText([]byte(strings.ToUpper(name))); err != nil {
+			return fmt.Errorf("invalid %s %q (use debug, info, warn or error)", envLogLevel, name)
+		}
+	}
+	f, err := openPrivateAppend(expandPath(path))
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %v", err)
+	}
+	logger = slog.New(slog.NewJSONHandler(f, &slog.HandlerOptions{Level: level})).With("pid", os.Getpid())
+	return nil
+}
+
+// warnf prints a warning and logs it
+func warnf(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	fmt.Println("Warning: " + msg)
+	logger.Warn(msg)
+}
+
+// printError prints the error a command failed with and logs it
+func printError(err error) {
+	if !errors.Is(err, flag.ErrHelp) {
+		fmt.Printf("Error: %v\n", err)
+		logger.Error("command failed", "error", err.Error())
+	}
+	printUsageHelp(err)
+}
+
+// logConfigChanges logs which accounts saving config adds, removes or
+// changes compared to the file on disk
+func logConfigChanges(config Config) {
+	var before Config
+	if data, err := readConfigFile(); err == nil {
+		json.Unmarshal(data, &before)
+	}
+	previous := before.Accounts
+	if config.profile != "" {
+		previous = before.Profiles[config.profile].Accounts
+	}
+
+	var added, removed, changed []string
+	for _, alias := range sortedAliases(config.Accounts) {
+		old, exists := previous[alias]
+		if !exists {
+			added = append(added, alias)
+			continue
+		}
+		oldData, _ := json.Marshal(old)
+		newData, _ := json.Marshal(config.Accounts[alias])
+		if !bytes.Equal(oldData, newData) {
+			changed = append(changed, alias)
+		}
+	}
+	for _, alias := range sortedAliases(previous) {
+		if _, exists := config.Accounts[alias]; !exists {
+			removed = append(removed, alias)
+		}
+	}
+	logger.Info("config saved", "path", configPath, "profile", config.currentProfile(),
+		"added", added, "removed", removed, "changed", changed)
+}
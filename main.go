@@ -1,42 +1,128 @@
 package main
 
 import (
-	"bufio"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
-	"text/template"
+	"time"
 )
 
 // GitHubAccount represents a GitHub account configuration
 type GitHubAccount struct {
-	Name       string `json:"name"`
-	Email      string `json:"email"`
-	Username   string `json:"username"`
-	SSHKeyPath string `json:"ssh_key_path"`
+	Name       string   `json:"name"`
+	Email      string   `json:"email"`
+	Username   string   `json:"username"`
+	SSHKeyPath string   `json:"ssh_key_path"`
+	Tags       []string `json:"tags,omitempty"`
+	Notes      string   `json:"notes,omitempty"`
+	// Aliases are other names the account answers to, e.g. "w" for "work"
+	Aliases []string `json:"aliases,omitempty"`
+
+	// SSHCertificate is a CA-signed certificate for the key, refreshed by
+	// SSHCertificateCommand
+	SSHCertificate        string `json:"ssh_certificate,omitempty"`
+	SSHCertificateCommand string `json:"ssh_certificate_command,omitempty"`
+
+	// Keys on hardware tokens, through a PKCS#11 library or an agent socket
+	// ("gpg-agent" for gpg-agent's)
+	PKCS11Provider string `json:"pkcs11_provider,omitempty"`
+	IdentityAgent  string `json:"identity_agent,omitempty"`
+
+	// KeyCreated is the day the SSH key was generated, YYYY-MM-DD
+	KeyCreated string `json:"key_created,omitempty"`
+
+	// Settings that fall back to the config's defaults when empty
+	KeyType    string            `json:"key_type,omitempty"`
+	Signing    string            `json:"signing,omitempty"`
+	SSHOptions map[string]string `json:"ssh_options,omitempty"`
+	GitConfig  map[string]string `json:"git_config,omitempty"`
+	// KeyRotation is how long a key may be used before rotate-key, e.g. 180d
+	KeyRotation string `json:"key_rotation,omitempty"`
+
+	// SignTags signs annotated tags, even when commits aren't signed
+	SignTags bool `json:"sign_tags,omitempty"`
+	// PushSigning is push.gpgSign: "true" or "if-asked"
+	PushSigning string `json:"push_signing,omitempty"`
+
+	// Connection configures connection reuse and the agent in the Host block
+	Connection *ConnectionSettings `json:"connection,omitempty"`
+	// KnownHosts gives the account its own known_hosts file, seeded with
+	// GitHub's published host keys
+	KnownHosts bool `json:"known_hosts,omitempty"`
+	// HostKeyChecking is StrictHostKeyChecking: yes, accept-new or ask
+	HostKeyChecking string `json:"host_key_checking,omitempty"`
+
+	LFS  *LFSSettings  `json:"lfs,omitempty"`
+	Init *InitSettings `json:"init,omitempty"`
+
+	// Directories whose repositories use this account through includeIf
+	Directories []string `json:"directories,omitempty"`
+
+	// Tokens maps an owner, owner/repo or "*" to a token reference
+	Tokens map[string]string `json:"tokens,omitempty"`
+	App    *GitHubApp        `json:"app,omitempty"`
 }
 
 // Config represents the application configuration
 type Config struct {
-	Accounts map[string]GitHubAccount `json:"accounts"`
+	Accounts       map[string]GitHubAccount `json:"accounts"`
+	ActiveProfile  string                   `json:"active_profile,omitempty"`
+	Profiles       map[string]Profile       `json:"profiles,omitempty"`
+	Sync           *SyncSettings            `json:"sync,omitempty"`
+	Defaults       *AccountDefaults         `json:"defaults,omitempty"`
+	OwnerRules     []OwnerRule              `json:"owner_rules,omitempty"`
+	APICacheTTL    string                   `json:"api_cache_ttl,omitempty"`
+	Retries        *RetrySettings           `json:"retries,omitempty"`
+	CommandTimeout string                   `json:"command_timeout,omitempty"`
+	Watch          *WatchSettings           `json:"watch,omitempty"`
+	// Transport is "ssh" (the default) or "https" for token-only setups
+	Transport string `json:"transport,omitempty"`
+	// DefaultHost is the account whose key plain github.com URLs use, or
+	// "none"; empty leaves Host github.com alone
+	DefaultHost string `json:"default_host,omitempty"`
+	// GHAuthSwitch makes every switch also switch the active gh account
+	GHAuthSwitch bool `json:"gh_auth_switch,omitempty"`
+	// SilenceHealthWarnings stops commands from repeating the problems the
+	// last "ghs check" found
+	SilenceHealthWarnings bool `json:"silence_health_warnings,omitempty"`
+
+	// profile is the name of the profile whose accounts are loaded into
+	// Accounts; defaultAccounts keeps the top-level accounts meanwhile
+	profile         string
+	defaultAccounts map[string]GitHubAccount
 }
 
-// SSHConfigTemplate represents the template for SSH config
+// SSHConfigTemplate represents the template for SSH config. Values go
+// through line, which refuses anything that would start a new line.
 const SSHConfigTemplate = `# GitHub account: {{.Username}}
 Host github.com-{{.Username}}
     HostName github.com
     User git
-    IdentityFile {{.SSHKeyPath}}
-    IdentitiesOnly yes
-
+{{if .SSHKeyPath}}    IdentityFile {{line .SSHKeyPath}}
+{{end}}{{if or .SSHKeyPath .PKCS11Provider}}    IdentitiesOnly yes
+{{end}}{{if .PKCS11Provider}}    PKCS11Provider {{line .PKCS11Provider}}
+{{end}}{{if .IdentityAgent}}    IdentityAgent {{line .IdentityAgent}}
+{{end}}{{if .SSHCertificate}}    CertificateFile {{line .SSHCertificate}}
+{{end}}{{with .Connection}}{{if .Multiplexed}}    ControlMaster auto
+    ControlPath {{line .ControlPath}}
+    ControlPersist {{line .Persist}}
+{{end}}{{if .AddKeysToAgent}}    AddKeysToAgent {{line .AddKeysToAgent}}
+{{end}}{{end}}{{if .KnownHosts}}    UserKnownHostsFile {{line .KnownHostsFile}}
+{{end}}{{if .HostKeyChecking}}    StrictHostKeyChecking {{line .HostKeyChecking}}
+{{end}}{{range $key, $value := .SSHOptions}}    {{line $key}} {{line $value}}
+{{end}}
 `
 
 var (
 	configPath    string
 	sshConfigPath string
+	// stateDir holds data ghs manages besides the config file
+	stateDir string
 )
 
 func init() {
@@ -46,149 +132,101 @@ func init() {
 		os.Exit(1)
 	}
 	configPath = filepath.Join(homeDir, ".github-switcher.json")
+	if path := os.Getenv(envConfig); path != "" {
+		configPath = path
+	}
 	sshConfigPath = filepath.Join(homeDir, ".ssh", "config")
+	stateDir = filepath.Join(homeDir, ".ghs")
+	if path := os.Getenv(envStateDir); path != "" {
+		stateDir = path
+	}
 }
 
 func loadConfig() Config {
-	config := Config{}
+	config := Config{Accounts: map[string]GitHubAccount{}}
 
-	data, err := os.ReadFile(configPath)
+	if err := readSystemConfig(); err != nil {
+		warnf("%v", err)
+	}
+	data, err := readConfigFile()
 	if err != nil {
+		if configLocked() {
+			// Going on would save an empty config over the locked one
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
 		if !os.IsNotExist(err) {
 			fmt.Println("Error reading config file:", err)
+			return config
+		}
+		if systemConfig == nil {
+			return config
 		}
-		return config
+		data = []byte("{}")
 	}
 
-	if err := json.Unmarshal(data, &config); err != nil {
+	if data, err = layerConfig(data); err != nil {
 		fmt.Println("Error parsing config file:", err)
-		return Config{}
+		return Config{Accounts: map[string]GitHubAccount{}}
 	}
-
-	return config
-}
-
-func saveConfig(config Config) error {
-	data, err := json.MarshalIndent(config, "", "  ")
-	if err != nil {
-		return err
-	}
-	return os.WriteFile(configPath, data, 0600)
-}
-
-func updateSSHConfig(accounts map[string]GitHubAccount) error {
-	// Read existing config
-	existingConfig, err := os.ReadFile(sshConfigPath)
-	if err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to read SSH config file: %v", err)
+	if err := json.Unmarshal(data, &config); err != nil {
+		fmt.Println("Error parsing config file:", err)
+		return Config{Accounts: map[string]GitHubAccount{}}
 	}
-
-	// Create a temporary file
-	tmpFile, err := os.CreateTemp(filepath.Dir(sshConfigPath), "ssh_config_tmp")
-	if err != nil {
-		return fmt.Errorf("failed to create temporary file: %v", err)
-	}
-	defer os.Remove(tmpFile.Name())
-
-	// Parse existing config to find our managed section
-	var otherConfig string
-	if len(existingConfig) > 0 {
-		lines := strings.Split(string(existingConfig), "\n")
-		inManagedSection := false
-		for _, line := range lines {
-			if strings.Contains(line, "# GitHub account:") {
-				inManagedSection = true
-				continue
-			}
-			// If we see a line that's not empty and doesn't start with whitespace,
-			// we're out of the previous section
-			if inManagedSection && line != "" && !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") {
-				inManagedSection = false
-			}
-			if !inManagedSection {
-				otherConfig += line + "\n"
-			}
-		}
+	if config.Accounts == nil {
+		config.Accounts = map[string]GitHubAccount{}
 	}
 
-	// Create template
-	tmpl, err := template.New("sshconfig").Parse(SSHConfigTemplate)
-	if err != nil {
-		return fmt.Errorf("failed to parse SSH config template: %v", err)
+	// GHS_PROFILE selects a profile for this invocation only
+	active := config.ActiveProfile
+	if name := os.Getenv(envProfile); name != "" {
+		active = name
 	}
-
-	// Write other configs first
-	if otherConfig != "" {
-		if !strings.HasSuffix(otherConfig, "\n\n") {
-			otherConfig += "\n"
-		}
-		if _, err := tmpFile.WriteString(otherConfig); err != nil {
-			return fmt.Errorf("failed to write existing config: %v", err)
+	if active != "" {
+		persisted := config.ActiveProfile
+		if err := config.useProfile(active); err != nil {
+			warnf("%v, using default profile", err)
 		}
+		config.ActiveProfile = persisted
 	}
 
-	// Write config for each account
-	for alias, account := range accounts {
-		// Validate SSH key path
-		if account.SSHKeyPath == "" {
-			fmt.Printf("Warning: Skipping SSH config for account '%s' due to empty key path\n", alias)
-			continue
-		}
-
-		// Check if SSH key exists
-		if _, err := os.Stat(account.SSHKeyPath); os.IsNotExist(err) {
-			fmt.Printf("Warning: SSH key not found for account '%s' at %s\n", alias, account.SSHKeyPath)
-			continue
-		}
+	return config
+}
 
-		if err := tmpl.Execute(tmpFile, account); err != nil {
-			return fmt.Errorf("failed to write SSH config: %v", err)
+// fileView returns the config as stored on disk, with the loaded profile's
+// accounts moved back into their own section
+func (c Config) fileView() Config {
+	if c.profile != "" {
+		if c.Profiles == nil {
+			c.Profiles = map[string]Profile{}
 		}
+		c.Profiles[c.profile] = Profile{Accounts: c.Accounts}
+		c.Accounts = c.defaultAccounts
+		c.profile = ""
+		c.defaultAccounts = nil
 	}
+	return c
+}
 
-	// Close the temporary file
-	if err := tmpFile.Close(); err != nil {
-		return fmt.Errorf("failed to close temporary file: %v", err)
-	}
-
-	// Create backup of existing config if it exists
-	if len(existingConfig) > 0 {
-		backupPath := sshConfigPath + ".bak"
-		if err := os.WriteFile(backupPath, existingConfig, 0600); err != nil {
-			return fmt.Errorf("failed to create backup: %v", err)
-		}
+func saveConfig(config Config) error {
+	data, err := json.MarshalIndent(config.fileView(), "", "  ")
+	if err != nil {
+		return err
 	}
-
-	// Move temporary file to SSH config
-	if err := os.Rename(tmpFile.Name(), sshConfigPath); err != nil {
-		return fmt.Errorf("failed to update SSH config: %v", err)
+	if data, err = unlayerConfig(data); err != nil {
+		return err
 	}
-
-	return nil
+	logConfigChanges(config)
+	return writeConfigFile(data)
 }
 
 // findGPGKeyID finds the GPG key ID for the given email
 func findGPGKeyID(email string) (string, error) {
-	cmd := exec.Command("gpg", "--list-secret-keys", "--keyid-format", "LONG", email)
-	output, err := cmd.Output()
+	key, err := findGPGKey(email)
 	if err != nil {
-		return "", fmt.Errorf("failed to list GPG keys: %v", err)
-	}
-
-	// Parse the output to find the key ID
-	lines := strings.Split(string(output), "\n")
-	for _, line := range lines {
-		if strings.Contains(line, "sec") {
-			// The key ID is in the format: sec   rsa4096/KEYID
-			parts := strings.Split(line, "/")
-			if len(parts) >= 2 {
-				keyID := strings.Split(parts[1], " ")[0]
-				return keyID, nil
-			}
-		}
+		return "", err
 	}
-
-	return "", fmt.Errorf("no GPG key found for email: %s", email)
+	return key.ID, nil
 }
 
 // configureGPGKey configures git to use the GPG key for the given email
@@ -199,12 +237,12 @@ func configureGPGKey(email string) error {
 	}
 
 	// Set signing key
-	if err := exec.Command("git", "config", "--global", "user.signingkey", keyID).Run(); err != nil {
+	if err := execCommand("git", "config", "--global", "user.signingkey", keyID).Run(); err != nil {
 		return fmt.Errorf("failed to set git user.signingkey: %v", err)
 	}
 
 	// Enable commit signing
-	if err := exec.Command("git", "config", "--global", "commit.gpgsign", "true").Run(); err != nil {
+	if err := execCommand("git", "config", "--global", "commit.gpgsign", "true").Run(); err != nil {
 		return fmt.Errorf("failed to enable commit signing: %v", err)
 	}
 
@@ -212,142 +250,413 @@ func configureGPGKey(email string) error {
 	return nil
 }
 
-func addAccount(config Config) Config {
-	reader := bufio.NewReader(os.Stdin)
-
-	fmt.Print("Enter account alias (e.g., work, personal): ")
-	alias, _ := reader.ReadString('\n')
-	alias = strings.TrimSpace(alias)
-
-	fmt.Print("Enter GitHub username: ")
-	username, _ := reader.ReadString('\n')
-	username = strings.TrimSpace(username)
+// accountSteps returns the wizard questions describing an account. The alias
+// step comes first; replace allows reusing an existing alias.
+func accountSteps(config Config, answers map[string]string, replace bool) []wizardStep {
+	homeDir, _ := os.UserHomeDir()
+	return []wizardStep{
+		{Key: "alias", Label: "account alias (e.g., work, personal)", Validate: func(v string) error {
+			if err := validateAlias(v); err != nil {
+				return err
+			}
+			if _, exists := config.Accounts[v]; exists && !replace {
+				return fmt.Errorf("account '%s' already exists (pass --force to replace it)", v)
+			}
+			if owner, ok := config.namedAlias(v); ok && owner != v {
+				return fmt.Errorf("'%s' is an alias of account '%s'", v, owner)
+			}
+			return nil
+		}},
+		{Key: "username", Label: "GitHub username", Validate: func(v string) error {
+			if err := validateUsername(v); err != nil {
+				return err
+			}
+			// The username is part of the SSH Host alias, which must be unique
+			for other, account := range config.Accounts {
+				if other != answers["alias"] && strings.EqualFold(account.Username, v) {
+					return fmt.Errorf("username %s is already used by account '%s'", v, other)
+				}
+			}
+			return nil
+		}},
+		{Key: "name", Label: "your name", Default: func(map[string]string) string {
+			if config.Defaults != nil {
+				return config.Defaults.Name
+			}
+			return ""
+		}},
+		{Key: "email", Label: "your email", Validate: func(v string) error {
+			if !validEmail(v) {
+				return fmt.Errorf("%q is not a valid email address", v)
+			}
+			return nil
+		}},
+		{Key: "key", Label: "SSH key path", Default: func(a map[string]string) string {
+			return filepath.Join(homeDir, ".ssh", fmt.Sprintf("id_rsa_%s", a["username"]))
+		}},
+		{Key: "notes", Label: "notes (optional)", Optional: true},
+	}
+}
 
-	fmt.Print("Enter your name: ")
-	name, _ := reader.ReadString('\n')
-	name = strings.TrimSpace(name)
+func addAccount(config Config, args []string) (Config, error) {
+	flags := flag.NewFlagSet("add", flag.ContinueOnError)
+	alias := flags.String("alias", "", "account alias (e.g., work, personal)")
+	username := flags.String("username", "", "GitHub username")
+	name := flags.String("name", "", "your name")
+	email := flags.String("email", "", "your email")
+	keyPath := flags.String("key", "", "SSH key path")
+	generateKey := flags.Bool("generate-key", false, "generate the SSH key without asking if it doesn't exist")
+	fromJSON := flags.String("from-json", "", "import an array of accounts from a JSON file (\"-\" for stdin)")
+	force := flags.Bool("force", false, "replace an existing account with the same alias")
+	var tags stringList
+	flags.Var(&tags, "tag", "tag the account, e.g. work or client-x (repeatable)")
+	notes := flags.String("notes", "", "free-form notes, e.g. \"expires 2025-06, VPN required\"")
+	keyType := flags.String("key-type", "", "type of a generated SSH key: rsa, ed25519 or ecdsa (default from config defaults, else rsa)")
+	signing := flags.String("signing", "", "commit signing: gpg, x509 or none (default from config defaults, else gpg)")
+	var gitConfig stringList
+	flags.Var(&gitConfig, "git-config", "set a git config key for the account, e.g. core.editor=vim (repeatable)")
+	hostKeyChecking := flags.String("host-key-checking", "", "StrictHostKeyChecking for the account: yes, accept-new or ask")
+	if err := flags.Parse(args); err != nil {
+		return config, err
+	}
 
-	fmt.Print("Enter your email: ")
-	email, _ := reader.ReadString('\n')
-	email = strings.TrimSpace(email)
+	if *fromJSON != "" {
+		return importJSON(config, *fromJSON)
+	}
+	for _, tag := range tags {
+		if err := validateAlias(tag); err != nil {
+			return config, fmt.Errorf("invalid tag %q: use letters, digits, '.', '_' or '-'", tag)
+		}
+	}
+	if problems := settingProblems(*keyType, *signing, nil, nil); len(problems) > 0 {
+		return config, fmt.Errorf("%s", problems[0].Msg)
+	}
+	if problem := hostKeyCheckingProblem(*hostKeyChecking); problem != "" {
+		return config, fmt.Errorf("%s", problem)
+	}
+	if _, err := applyGitConfigFlags(GitHubAccount{}, gitConfig); err != nil {
+		return config, err
+	}
 
 	homeDir, _ := os.UserHomeDir()
-	defaultKeyPath := filepath.Join(homeDir, ".ssh", fmt.Sprintf("id_rsa_%s", username))
+	answers := map[string]string{
+		"alias":    *alias,
+		"username": *username,
+		"name":     *name,
+		"email":    *email,
+		"key":      *keyPath,
+		"notes":    *notes,
+	}
+	steps := accountSteps(config, answers, *force)
+	if err := runWizard(steps, answers); err != nil {
+		return config, err
+	}
+	*alias, *username, *name, *email = answers["alias"], answers["username"], answers["name"], answers["email"]
+	*keyPath = answers["key"]
+	*notes = answers["notes"]
 
-	fmt.Printf("Enter SSH key path (default: %s): ", defaultKeyPath)
-	keyPath, _ := reader.ReadString('\n')
-	keyPath = strings.TrimSpace(keyPath)
-	if keyPath == "" {
-		keyPath = defaultKeyPath
+	for other, account := range config.Accounts {
+		if other != *alias && strings.EqualFold(account.Email, *email) {
+			warnf("email %s is already used by account '%s'", *email, other)
+		}
 	}
 
 	// Convert to absolute path if relative
-	if !filepath.IsAbs(keyPath) {
-		keyPath = filepath.Join(homeDir, ".ssh", keyPath)
+	if httpsOnly && *keyPath == "" {
+		// HTTPS mode needs no key; the account authenticates with its token
+	} else if !filepath.IsAbs(*keyPath) {
+		*keyPath = filepath.Join(homeDir, ".ssh", *keyPath)
 	}
 
 	// If key doesn't exist, generate it
-	if _, err := os.Stat(keyPath); os.IsNotExist(err) {
-		fmt.Printf("SSH key not found. Generate new key at %s? [Y/n]: ", keyPath)
-		genKey, _ := reader.ReadString('\n')
-		genKey = strings.ToLower(strings.TrimSpace(genKey))
-		if genKey == "" || genKey == "y" || genKey == "yes" {
+	created := ""
+	if _, err := os.Stat(*keyPath); os.IsNotExist(err) && !httpsOnly {
+		generate := *generateKey
+		if !generate {
+			generate, err = confirm(fmt.Sprintf("SSH key not found. Generate new key at %s?", *keyPath), true)
+			if errors.Is(err, errNonInteractive) {
+				return config, fmt.Errorf("SSH key not found at %s (pass --generate-key to create it)", *keyPath)
+			} else if err != nil {
+				return config, err
+			}
+		}
+		if generate {
 			// Ensure directory exists
-			keyDir := filepath.Dir(keyPath)
-			if err := os.MkdirAll(keyDir, 0700); err != nil {
-				fmt.Printf("Error creating directory: %v\n", err)
-				return config
+			keyDir := filepath.Dir(*keyPath)
+			if err := mkdirPrivate(keyDir); err != nil {
+				return config, fmt.Errorf("failed to create directory: %v", err)
 			}
 
-			cmd := exec.Command("ssh-keygen", "-t", "rsa", "-b", "4096", "-C", email, "-f", keyPath, "-N", "")
+			effectiveType := *keyType
+			if effectiveType == "" && config.Defaults != nil {
+				effectiveType = config.Defaults.KeyType
+			}
+			keygen := append(keygenArgs(effectiveType), "-C", *email, "-f", *keyPath, "-N", "")
+			cmd := execCommand("ssh-keygen", keygen...)
 			cmd.Stdout = os.Stdout
 			cmd.Stderr = os.Stderr
 			if err := cmd.Run(); err != nil {
-				fmt.Printf("Error generating SSH key: %v\n", err)
-				return config
+				return config, fmt.Errorf("failed to generate SSH key: %v", err)
+			}
+			if err := os.Chmod(*keyPath, 0600); err != nil {
+				return config, fmt.Errorf("failed to protect SSH key: %v", err)
 			}
+			created = time.Now().Format(keyDateFormat)
 			fmt.Printf("\nSSH key generated. Add this public key to GitHub:\n")
-			fmt.Printf("cat %s.pub\n", keyPath)
+			fmt.Printf("cat %s.pub\n", *keyPath)
 		}
 	}
 
 	// Verify SSH key exists after all operations
-	if _, err := os.Stat(keyPath); os.IsNotExist(err) {
-		fmt.Printf("Error: SSH key not found at %s\n", keyPath)
-		fmt.Println("Please ensure the SSH key exists before adding the account.")
-		return config
+	if _, err := os.Stat(*keyPath); os.IsNotExist(err) && !httpsOnly {
+		return config, fmt.Errorf("SSH key not found at %s, please ensure it exists before adding the account", *keyPath)
 	}
 
-	config.Accounts[alias] = GitHubAccount{
-		Name:       name,
-		Email:      email,
-		Username:   username,
-		SSHKeyPath: keyPath,
+	account, err := applyGitConfigFlags(GitHubAccount{
+		Name:       config.Defaults.inherit(*name),
+		Email:      *email,
+		Username:   *username,
+		SSHKeyPath: *keyPath,
+		Notes:      *notes,
+		KeyType:    *keyType,
+		KeyCreated: created,
+		Signing:    *signing,
+
+		HostKeyChecking: *hostKeyChecking,
+	}, gitConfig)
+	if err != nil {
+		return config, err
 	}
+	config.Accounts[*alias] = addTags(account, tags)
 
-	if err := updateSSHConfig(config.Accounts); err != nil {
-		fmt.Printf("Error updating SSH config: %v\n", err)
+	if err := updateManagedFiles(config); err != nil {
+		fmt.Printf("Error: %v\n", err)
 	}
 
-	fmt.Printf("\nAccount '%s' added successfully.\n", alias)
+	fmt.Printf("\nAccount '%s' added successfully.\n", *alias)
+	if httpsOnly {
+		fmt.Printf("\nHTTPS mode: give the account a token, e.g. ghs token store %s '*'\n", *alias)
+		return config, nil
+	}
+	// Verify github.com before the first clone records whatever it offers
+	if err := verifyHostKey(*alias, config.Accounts[*alias]); err != nil {
+		warnf("%v", err)
+	}
 	fmt.Println("\nTo clone repositories, use:")
-	fmt.Printf("git clone git@github.com-%s:owner/repo.git\n", username)
-	return config
+	fmt.Printf("git clone git@github.com-%s:owner/repo.git\n", *username)
+	return config, nil
 }
 
-func switchToAccount(config Config, alias string) error {
-	account, exists := config.Accounts[alias]
-	if !exists {
-		return fmt.Errorf("account '%s' not found", alias)
+// signingOverride replaces the account's signing for one switch: "on" signs
+// commits, signingNone signs nothing. Set by switch --sign and --no-sign.
+var signingOverride string
+
+// overrideSigning applies signingOverride to an account
+func overrideSigning(account GitHubAccount) GitHubAccount {
+	switch signingOverride {
+	case signingNone:
+		account.Signing = signingNone
+		account.SignTags = false
+		account.PushSigning = ""
+	case "on":
+		if account.Signing == signingNone {
+			account.Signing = signingGPG
+		}
 	}
+	return account
+}
 
-	// Check if current directory is a git repository
-	if _, err := os.Stat(".git"); os.IsNotExist(err) {
-		return fmt.Errorf("current directory is not a git repository")
+// switchEdits collects every repository setting of a switch, so they are
+// written in one go. It also returns the signing key, if any.
+func switchEdits(config Config, alias string, account GitHubAccount, repo repoInfo) ([]configEdit, string) {
+	edits := []configEdit{
+		{key: "user.name", value: account.Name},
+		{key: "user.email", value: account.Email},
 	}
 
-	// Configure git user.name and user.email for current repository
-	if err := exec.Command("git", "config", "user.name", account.Name).Run(); err != nil {
-		return fmt.Errorf("failed to set git user.name: %v", err)
+	// Configure the signing key for current repository
+	signing, signingKey, err := signingEdits(account)
+	if err != nil {
+		warnf("Failed to find signing key: %v", err)
+		fmt.Println("You may need to set up signing keys manually.")
 	}
+	edits = append(edits, signing...)
 
-	if err := exec.Command("git", "config", "user.email", account.Email).Run(); err != nil {
-		return fmt.Errorf("failed to set git user.email: %v", err)
+	// Apply the account's own settings such as core.editor or merge.tool
+	settings := account.gitSettings()
+	for _, key := range sortedKeys(settings) {
+		edits = append(edits, configEdit{key: key, value: settings[key]})
+	}
+	for _, key := range foreignGitConfig(config, alias, account, repo) {
+		edits = append(edits, configEdit{key: key, unset: true})
 	}
+	return edits, signingKey
+}
 
-	// Configure GPG key for current repository
-	keyID, err := findGPGKeyID(account.Email)
+func switchToAccount(config Config, alias string) error {
+	alias, account, err := config.lookupAccount(alias)
 	if err != nil {
-		fmt.Printf("Warning: Failed to find GPG key: %v\n", err)
-		fmt.Println("You may need to set up GPG keys manually.")
-	} else {
-		// Set signing key for current repository
-		if err := exec.Command("git", "config", "user.signingkey", keyID).Run(); err != nil {
-			fmt.Printf("Warning: Failed to set git user.signingkey: %v\n", err)
-		} else {
-			// Enable commit signing for current repository
-			if err := exec.Command("git", "config", "commit.gpgsign", "true").Run(); err != nil {
-				fmt.Printf("Warning: Failed to enable commit signing: %v\n", err)
-			} else {
-				fmt.Printf("Configured GPG key %s for email %s\n", keyID, account.Email)
-			}
+		return err
+	}
+	account = overrideSigning(account)
+
+	repo, err := currentRepo()
+	if err != nil {
+		return err
+	}
+
+	if account.LFS != nil {
+		if err := requireGitLFS(alias); err != nil {
+			return err
+		}
+	}
+
+	edits, signingKey := switchEdits(config, alias, account, repo)
+	if err := applyConfigEdits(repo, edits); err != nil {
+		return fmt.Errorf("failed to update git config: %v", err)
+	}
+	if signingKey != "" && account.Signing == signingX509 {
+		fmt.Printf("Configured certificate %s for email %s\n", signingKey, account.Email)
+	} else if signingKey != "" {
+		fmt.Printf("Configured GPG key %s for email %s\n", signingKey, account.Email)
+	}
+
+	if account.LFS != nil {
+		if err := execCommand("git", "lfs", "install", "--local").Run(); err != nil {
+			warnf("Failed to install Git LFS hooks: %v", err)
 		}
 	}
+	warnRemoteMismatch(config, alias)
+	if signingKey != "" {
+		refreshGPGAgent(account)
+	}
+
+	recordHistory("switch", alias, repoRoot())
 
 	fmt.Printf("Switched to GitHub account: %s (%s, %s) for current repository\n", alias, account.Name, account.Email)
+	if repo.Worktree && gitConfigScope != "--worktree" {
+		fmt.Println("The account applies to every worktree of this repository; use --worktree to limit it to this one.")
+	}
 	return nil
 }
 
-func listAccounts(config Config) {
+// runSwitch handles "switch", choosing the account from the arguments or the
+// repository's remotes
+func runSwitch(config Config, args []string) error {
+	flags := flag.NewFlagSet("switch", flag.ContinueOnError)
+	auto := flags.Bool("auto", false, "use the account the repository's remotes belong to")
+	worktree := flags.Bool("worktree", false, "apply the account to the current linked worktree only")
+	gh := flags.Bool("gh", config.GHAuthSwitch, "also make the account the active gh account")
+	fromGH := flags.Bool("from-gh", false, "use the account gh is logged in as")
+	sign := flags.Bool("sign", false, "sign commits this time, even if the account doesn't")
+	noSign := flags.Bool("no-sign", false, "sign nothing this time, e.g. on a machine without the signing key")
+	dryRun := flags.Bool("dry-run", false, "show the settings that would change without changing them")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 1 || (len(positional) == 1) == (*auto || *fromGH) || (*auto && *fromGH) || (*sign && *noSign) {
+		return fmt.Errorf("usage: ghs switch <alias|--auto|--from-gh> [--worktree] [--gh] [--sign|--no-sign] [--dry-run]")
+	}
+	switch {
+	case *sign:
+		signingOverride = "on"
+	case *noSign:
+		signingOverride = signingNone
+	}
+
+	if *worktree && !*dryRun {
+		repo, err := currentRepo()
+		if err != nil {
+			return err
+		}
+		if err := useWorktreeScope(repo); err != nil {
+			return err
+		}
+	}
+
+	var alias string
+	switch {
+	case *auto:
+		if alias, err = autoAccount(config); err != nil {
+			return err
+		}
+		fmt.Printf("Remotes belong to account '%s'\n", alias)
+	case *fromGH:
+		if alias, err = ghAccount(config); err != nil {
+			return err
+		}
+		fmt.Printf("gh is logged in as account '%s'\n", alias)
+	default:
+		alias = positional[0]
+	}
+	if *dryRun {
+		return previewSwitch(config, alias, *worktree, *gh && !*fromGH)
+	}
+	if err := switchToAccount(config, alias); err != nil {
+		return err
+	}
+	if *gh && !*fromGH {
+		account, _ := config.account(alias)
+		if err := ghAuthSwitch(account); err != nil {
+			warnf("%v", err)
+		}
+	}
+	return nil
+}
+
+func listAccounts(config Config, args []string) error {
+	flags := flag.NewFlagSet("list", flag.ContinueOnError)
+	var tags stringList
+	flags.Var(&tags, "tag", "only list accounts with this tag (repeatable)")
+	verbose := flags.Bool("verbose", false, "show every account detail")
+	flags.BoolVar(verbose, "v", false, "shorthand for --verbose")
+	if _, err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
 	fmt.Println("Available GitHub accounts:")
 	if len(config.Accounts) == 0 {
 		fmt.Println("  No accounts configured yet.")
-		return
+		return nil
 	}
 
-	for alias, account := range config.Accounts {
-		fmt.Printf(" %-15s (%s, %s)\n", alias, account.Name, account.Email)
+	aliases := accountsWithTags(config, tags)
+	if len(aliases) == 0 {
+		fmt.Printf("  No accounts tagged %s.\n", strings.Join(tags, ", "))
+		return nil
 	}
+	var details map[string]accountDetails
+	if *verbose {
+		details = collectAccountDetails(config, aliases)
+	}
+	for _, alias := range aliases {
+		account, _ := config.account(alias)
+		switch {
+		case *verbose:
+			d := details[alias]
+			fmt.Printf(" %-15s (%s, %s)\n", alias, account.Name, account.Email)
+			if len(account.Aliases) > 0 {
+				fmt.Printf("     aliases:   %s\n", strings.Join(account.Aliases, ", "))
+			}
+			fmt.Printf("     username:  %s\n", account.Username)
+			fmt.Printf("     ssh key:   %s\n", d.Key)
+			fmt.Printf("     rotation:  %s\n", describeRotation(account))
+			fmt.Printf("     on GitHub: %s\n", d.GitHub)
+			fmt.Printf("     signing:   %s\n", signingMode(account))
+			fmt.Printf("     host:      %s\n", accountHost(account))
+			fmt.Printf("     tags:      %s\n", formatTags(account.Tags))
+			fmt.Printf("     last used: %s\n", d.LastUsed)
+			if account.Notes != "" {
+				fmt.Printf("     notes:     %s\n", account.Notes)
+			}
+		case len(account.Tags) > 0:
+			fmt.Printf(" %-15s (%s, %s) [%s]%s\n", alias, account.Name, account.Email, strings.Join(account.Tags, ", "), rotationNote(account))
+		default:
+			fmt.Printf(" %-15s (%s, %s)%s\n", alias, account.Name, account.Email, rotationNote(account))
+		}
+	}
+	return nil
 }
 
 // extractRepoInfo extracts owner and repo name from GitHub URL
@@ -377,61 +686,148 @@ func extractRepoInfo(url string) (owner, repo string, err error) {
 	return "", "", fmt.Errorf("unsupported URL format")
 }
 
-// cloneRepo clones a repository with the appropriate configuration
-func cloneRepo(config Config, url string, dir string) error {
+// runClone handles "clone", choosing the account for the repository owner
+// unless --account names one
+func runClone(config Config, args []string) (Config, error) {
+	flags := flag.NewFlagSet("clone", flag.ContinueOnError)
+	alias := flags.String("account", "", "account to clone with instead of the one matched by owner")
+	mirror := flags.Bool("mirror", false, "create a mirror of every ref (implies a bare repository)")
+	bare := flags.Bool("bare", false, "create a bare repository")
+	fromFile := flags.String("from-file", "", "clone every repository listed in the file, one URL or owner/repo per line")
+	jobs := flags.Int("jobs", 4, "number of repositories cloned in parallel with --from-file")
+	dest := flags.String("dest", "", "directory the repositories of --from-file are cloned into (default: the current directory)")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return config, err
+	}
+	if *fromFile != "" && len(positional) > 0 {
+		return config, fmt.Errorf("--from-file takes no repository arguments")
+	}
+	if (*fromFile == "" && (len(positional) < 1 || len(positional) > 2)) || (*mirror && *bare) {
+		return config, fmt.Errorf("usage: ghs clone <repo-url> [directory] [--account <alias>] [--mirror|--bare]\n       ghs clone --from-file <file> [--dest <dir>] [--jobs n] [--account <alias>] [--mirror|--bare]")
+	}
+	mode := ""
+	if *mirror {
+		mode = cloneMirror
+	} else if *bare {
+		mode = cloneBare
+	}
+	if *alias != "" {
+		if *alias, err = config.lookupAlias(*alias); err != nil {
+			return config, err
+		}
+	}
+	if *fromFile != "" {
+		return config, cloneFromFile(config, *fromFile, *dest, *jobs, *alias, mode)
+	}
+	url, dir := positional[0], ""
+	if len(positional) == 2 {
+		dir = positional[1]
+	}
+
+	owner, _, err := extractRepoInfo(url)
+	if err != nil {
+		return config, fmt.Errorf("failed to parse repository URL: %v", err)
+	}
+	if *alias == "" {
+		if config, *alias, err = chooseOwnerAccount(config, owner); err != nil {
+			return config, err
+		}
+	}
+	return config, cloneRepo(config, url, dir, *alias, mode)
+}
+
+// resolveURL handles "resolve <url>": it prints the URL clone would use, so
+// scripts can run git clone themselves. Without a matching account the URL
+// is printed unchanged.
+func resolveURL(config Config, args []string) error {
+	flags := flag.NewFlagSet("resolve", flag.ContinueOnError)
+	alias := flags.String("account", "", "account to use instead of the one matched by owner")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: ghs resolve <repo-url> [--account <alias>]")
+	}
+	url := positional[0]
+	owner, repo, err := extractRepoInfo(url)
+	if err != nil {
+		return fmt.Errorf("failed to parse repository URL: %v", err)
+	}
+	if *alias == "" {
+		*alias = resolveOwner(config, owner)
+	}
+	if *alias == "" {
+		fmt.Println(url)
+		return nil
+	}
+	_, account, err := config.lookupAccount(*alias)
+	if err != nil {
+		return err
+	}
+	fmt.Println(remoteURL(account, owner, repo))
+	return nil
+}
+
+// Clone modes passed to git clone for backups
+const (
+	cloneMirror = "mirror"
+	cloneBare   = "bare"
+)
+
+// cloneRepo clones a repository with the appropriate configuration, using
+// the SSH host of the account alias when it is not empty. mode is empty for
+// a regular clone, or cloneMirror or cloneBare.
+func cloneRepo(config Config, url string, dir string, alias string, mode string) error {
 	owner, repo, err := extractRepoInfo(url)
 	if err != nil {
 		return fmt.Errorf("failed to parse repository URL: %v", err)
 	}
 
-	// Check if the owner matches any of our accounts
 	var matchedAccount string
 	var matchedAlias string
-	for alias, account := range config.Accounts {
-		if account.Username == owner {
-			// Verify SSH key exists
-			if _, err := os.Stat(account.SSHKeyPath); os.IsNotExist(err) {
-				return fmt.Errorf("SSH key not found for account '%s' at %s", alias, account.SSHKeyPath)
-			}
-			matchedAccount = account.Username
-			matchedAlias = alias
-			break
+	if alias != "" {
+		account := config.Accounts[alias]
+		// Verify SSH key exists
+		if keyMissing(account) {
+			return fmt.Errorf("SSH key not found for account '%s' at %s", alias, account.SSHKeyPath)
 		}
+		matchedAccount = account.Username
+		matchedAlias = alias
 	}
 
 	// Prepare clone command
-	var cloneCmd *exec.Cmd
-	if matchedAccount != "" {
+	cloneArgs := []string{"clone"}
+	if mode != "" {
+		cloneArgs = append(cloneArgs, "--"+mode)
+	}
+	if matchedAccount != "" && httpsOnly {
+		fmt.Printf("Using HTTPS with the token of account '%s'\n", matchedAlias)
+		cloneArgs = append(cloneArgs, remoteURL(config.Accounts[matchedAlias], owner, repo))
+	} else if matchedAccount != "" {
 		// If owner matches one of our accounts, use SSH config
 		sshURL := fmt.Sprintf("git@github.com-%s:%s/%s.git", matchedAccount, owner, repo)
 		fmt.Printf("Using SSH configuration for account '%s'\n", matchedAlias)
-		cloneCmd = exec.Command("git", "clone", sshURL)
+		cloneArgs = append(cloneArgs, sshURL)
 	} else {
 		// If owner doesn't match, use original URL
 		fmt.Println("No matching account found, using original URL")
-		cloneCmd = exec.Command("git", "clone", url)
+		cloneArgs = append(cloneArgs, url)
 	}
 
 	// Set target directory if specified
 	if dir != "" {
-		cloneCmd.Args = append(cloneCmd.Args, dir)
-	}
-
-	// Run clone command
-	cloneCmd.Stdout = os.Stdout
-	cloneCmd.Stderr = os.Stderr
-	if err := cloneCmd.Run(); err != nil {
-		if matchedAccount != "" {
-			fmt.Println("\nIf you're seeing SSH key errors, try:")
-			fmt.Println("1. Start ssh-agent:")
-			fmt.Println("   eval \"$(ssh-agent -s)\"")
-			fmt.Printf("2. Add your SSH key:\n")
-			fmt.Printf("   ssh-add %s\n", config.Accounts[matchedAlias].SSHKeyPath)
-			fmt.Println("\nOr verify your SSH configuration:")
-			fmt.Printf("1. Test SSH connection:\n")
-			fmt.Printf("   ssh -T git@github.com-%s\n", matchedAccount)
-			fmt.Printf("2. Check if the key exists:\n")
-			fmt.Printf("   ls -l %s\n", config.Accounts[matchedAlias].SSHKeyPath)
+		cloneArgs = append(cloneArgs, dir)
+	}
+
+	// Run clone command, retrying network failures
+	if stderr, err := runGitRetrying("git clone", cloneArgs...); err != nil {
+		account, _ := config.account(matchedAlias)
+		ctx := failureContext{Config: config, Alias: matchedAlias, Account: account, Owner: owner, Repo: repo}
+		if !suggestFix(stderr.String(), ctx) && matchedAccount != "" {
+			fmt.Println("\nCheck which user the account's key authenticates as:")
+			fmt.Printf("  ghs test %s\n", matchedAlias)
 		}
 		return fmt.Errorf("failed to clone repository: %v", err)
 	}
@@ -442,98 +838,422 @@ func cloneRepo(config Config, url string, dir string) error {
 		targetDir := dir
 		if targetDir == "" {
 			targetDir = repo
+			if mode != "" {
+				targetDir += ".git"
+			}
 		}
 		if err := os.Chdir(targetDir); err != nil {
 			return fmt.Errorf("failed to change to repository directory: %v", err)
 		}
 
+		// A bare clone has no fetch refspec; fetch branches in place so the
+		// copy can be updated like a mirror, without touching other refs
+		if mode == cloneBare {
+			if err := execCommand("git", "config", "remote.origin.fetch", "+refs/heads/*:refs/heads/*").Run(); err != nil {
+				warnf("Failed to configure fetch refspec: %v", err)
+			}
+		}
+
 		// Switch to the matched account in the repository
 		if err := switchToAccount(config, matchedAlias); err != nil {
-			fmt.Printf("Warning: Failed to configure repository: %v\n", err)
+			warnf("Failed to configure repository: %v", err)
 		}
 	}
 
 	return nil
 }
 
-func getCurrentAccount() error {
-	// Check if current directory is a git repository
-	if _, err := os.Stat(".git"); os.IsNotExist(err) {
-		return fmt.Errorf("current directory is not a git repository")
+func getCurrentAccount(config Config) error {
+	repo, err := currentRepo()
+	if err != nil {
+		return err
 	}
 
 	// Get current git user name
-	nameCmd := exec.Command("git", "config", "user.name")
+	nameCmd := execCommand("git", "config", "user.name")
 	name, err := nameCmd.Output()
 	if err != nil {
 		return fmt.Errorf("failed to get git user.name: %v", err)
 	}
 
 	// Get current git user email
-	emailCmd := exec.Command("git", "config", "user.email")
+	emailCmd := execCommand("git", "config", "user.email")
 	email, err := emailCmd.Output()
 	if err != nil {
 		return fmt.Errorf("failed to get git user.email: %v", err)
 	}
 
-	// Get current git signing key
-	keyCmd := exec.Command("git", "config", "user.signingkey")
-	key, _ := keyCmd.Output() // Ignore error as signing key is optional
-
 	fmt.Printf("Current repository configuration:\n")
-	fmt.Printf("Name:  %s", name)
-	fmt.Printf("Email: %s", email)
-	if len(key) > 0 {
-		fmt.Printf("GPG:   %s", key)
+	fmt.Printf("Name:    %s", name)
+	fmt.Printf("Email:   %s", email)
+	if alias := aliasForEmail(config, strings.TrimSpace(string(email))); alias != "" {
+		account, _ := config.account(alias)
+		fmt.Printf("Account: %s (%s)\n", alias, account.Username)
+	} else {
+		fmt.Println("Account: none, no configured account uses this email")
+	}
+	fmt.Printf("Signing: %s\n", describeSigning())
+	if repo.Worktree {
+		fmt.Printf("Worktree: %s (linked to %s)\n", repo.Root, repo.CommonDir)
+	}
+	if repo.Bare {
+		fmt.Printf("Bare repository: %s\n", repo.GitDir)
 	}
 
+	remotes, err := repoRemotes(config)
+	if err != nil {
+		return err
+	}
+	printRemotes(config, remotes, strings.TrimSpace(string(email)))
+
 	return nil
 }
 
+// parseGlobalFlags applies flags accepted by every command and returns the
+// remaining arguments
+func parseGlobalFlags(args []string) []string {
+	nonInteractive = detectNonInteractive()
+	if envEnabled(envOffline) {
+		offline = true
+	}
+	plainOutput = os.Getenv("NO_COLOR") != ""
+	container := envEnabled(envContainer)
+	logFile := os.Getenv(envLog)
+	traceFile := os.Getenv(envTrace)
+
+	rest := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		switch {
+		case arg == "--non-interactive":
+			nonInteractive = true
+		case arg == "--no-cache":
+			apiCacheDisabled = true
+		case arg == "--offline":
+			offline = true
+		case arg == "--allow-root":
+			allowRoot = true
+		case arg == "--container":
+			container = true
+		case arg == "--log-file" && i+1 < len(args):
+			i++
+			logFile = args[i]
+		case arg == "--trace" && i+1 < len(args):
+			i++
+			traceFile = args[i]
+		case arg == "-C" && len(rest) == 0 && i+1 < len(args):
+			// Like git -C: run as if started in the given directory, which
+			// also allows managing bare repositories from elsewhere
+			i++
+			if err := os.Chdir(args[i]); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	if container {
+		enableContainerMode()
+	}
+	if logFile != "" {
+		if err := setupLogging(logFile); err != nil {
+			warnf("%v", err)
+		}
+	}
+	if traceFile != "" {
+		if err := setupTrace(traceFile); err != nil {
+			warnf("%v", err)
+		}
+	}
+	return rest
+}
+
+// parseFlags parses flags that may appear before, between or after the
+// positional arguments and returns the positional arguments
+func parseFlags(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	// printError shows the command's help instead of the flag package's
+	flags.SetOutput(io.Discard)
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, &flagError{flags.Name(), err}
+		}
+		rest := flags.Args()
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		// Everything after "--" is positional
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// hasFlag reports whether args give the flag name, as -name, --name or
+// --name=value, before parsing them
+func hasFlag(args []string, name string) bool {
+	for _, arg := range args {
+		if arg == "--" {
+			return false
+		}
+		if flag, _, _ := strings.Cut(strings.TrimLeft(arg, "-"), "="); strings.HasPrefix(arg, "-") && flag == name {
+			return true
+		}
+	}
+	return false
+}
+
 func showHelp() {
 	fmt.Println("GitHub Account Switcher - Commands:")
-	fmt.Println("  add                    Add a new GitHub account and configure SSH")
-	fmt.Println("  list                   List all configured accounts")
+	fmt.Println("  add [flags]            Add a new GitHub account and configure SSH")
+	fmt.Println("                         (--alias, --username, --name, --email, --key, --generate-key,")
+	fmt.Println("                         --host-key-checking)")
+	fmt.Println("  add --from-json <file> Add every account from a JSON array (\"-\" reads stdin)")
+	fmt.Println("  list [--tag <tag>] [--verbose]")
+	fmt.Println("                         List all configured accounts, optionally only those with a tag")
+	fmt.Println("  edit <alias> [flags]   Edit an account (--username, --name, --email, --key, --notes,")
+	fmt.Println("                         --git-config, --lfs-url, --lfs-credential-helper,")
+	fmt.Println("                         --default-branch, --commit-template, --ssh-certificate,")
+	fmt.Println("                         --ssh-certificate-command, --pkcs11-provider, --identity-agent,")
+	fmt.Println("                         --multiplex, --control-persist, --add-keys-to-agent, --known-hosts,")
+	fmt.Println("                         --host-key-checking, --key-created, --key-rotation)")
+	fmt.Println("  copy <alias> <new-alias> [flags]")
+	fmt.Println("                         Duplicate an account and edit the fields that must change")
+	fmt.Println("  rotate-key <alias> [--upload]")
+	fmt.Println("                         Replace the account's key pair, on GitHub too with --upload")
+	fmt.Println("  purge <alias> [--scan <dir>]")
+	fmt.Println("                         Remove an account with its key pair, GitHub key, fragments and journal")
+	fmt.Println("  tag <add|remove> <alias> <tag>...")
+	fmt.Println("                         Add or remove account tags")
+	fmt.Println("  alias <add|remove> <alias> <name>...")
+	fmt.Println("                         Add or remove other names the account answers to")
+	fmt.Println("  map <alias> <dir>      Use the account, its git settings and identity guard hook for")
+	fmt.Println("                         every repository under dir (unmap removes the mapping)")
 	fmt.Println("  switch <alias>         Switch to the specified account in current repository")
-	fmt.Println("  current                Show current repository's git configuration")
+	fmt.Println("  switch --auto          Switch to the account the repository's remotes belong to")
+	fmt.Println("                         (--worktree limits the account to the current linked worktree)")
+	fmt.Println("  switch --from-gh       Switch to the account gh is logged in as (--gh also switches gh)")
+	fmt.Println("                         (--sign/--no-sign override the account's signing this time,")
+	fmt.Println("                         --dry-run shows the changes without making them)")
+	fmt.Println("  current                Show the repository's identity, account, signing and remotes")
+	fmt.Println("  status [--porcelain]   Show the account committing here (--porcelain: stable format for tools)")
+	fmt.Println("  init <alias> [dir]     Create a repository for the account with an origin remote")
+	fmt.Println("                         (--owner, --name, --create [--private], --push)")
+	fmt.Println("  rule <add <pattern> <alias>|remove <pattern>|list>")
+	fmt.Println("                         Map GitHub owners to accounts by name, glob (acme-*) or /regex/")
+	fmt.Println("  which <owner|owner/repo|url>")
+	fmt.Println("                         Show which account serves a repository and which rule fired")
+	fmt.Println("  verify [rev-range]     Check that commits are signed by the repository's account")
+	fmt.Println("                         (default: commits not pushed yet; --account)")
+	fmt.Println("  path-rule <add|remove> <alias> <path>")
+	fmt.Println("                         Require an account for commits touching a path of this repository")
+	fmt.Println("  path-rule <list|check> List the rules, or check the staged files (run by the pre-commit hook)")
+	fmt.Println("  remote convert [remote] [--account <alias>] [--to ssh|https] [--dry-run]")
+	fmt.Println("                         Rewrite a GitHub remote to the account's SSH host alias")
+	fmt.Println("  remote rewrite <dir> [--account-map owner=alias]... [--dry-run]")
+	fmt.Println("                         Convert the remotes of every repository below dir")
 	fmt.Println("  clone <url> [dir]      Clone a repository, automatically using SSH config if owner matches an account")
-	fmt.Println("  help                   Show this help information")
+	fmt.Println("                         (--account picks the account; asks when several rules match;")
+	fmt.Println("                         --mirror or --bare for backups)")
+	fmt.Println("  clone --from-file <file> [--dest <dir>] [--jobs n]")
+	fmt.Println("                         Clone every listed repository in parallel and report the results")
+	fmt.Println("  resolve <url>          Print the URL clone would use, for scripts (--account)")
+	fmt.Println("  scan <dir>... [--problems]")
+	fmt.Println("                         Check the identity of every repository below the directories")
+	fmt.Println("  test <alias>... | --all | --tag <tag>... [--fix]")
+	fmt.Println("                         Check that each account's SSH key authenticates as its username")
+	fmt.Println("  check [alias...] | --tag <tag>... [--jobs n]")
+	fmt.Println("                         Check every account end to end: key, SSH login, signing key and")
+	fmt.Println("                         token; exits non-zero when one is broken")
+	fmt.Println("  remind [list]          List credentials expiring within 30 days and key rotations due")
+	fmt.Println("  remind snooze <alias[:kind]> <duration>")
+	fmt.Println("                         Postpone a reminder, e.g. work:token 7d (unsnooze resumes it)")
+	fmt.Println("  stats [--since 30d] [--scan <dir>]")
+	fmt.Println("                         Show account usage, recently switched repositories and commits per identity")
+	fmt.Println("  import csv <file>      Add accounts from a CSV file (--dry-run, --on-duplicate, --map)")
+	fmt.Println("  migrate [--scan <dir>] [--dry-run]")
+	fmt.Println("                         Turn hand-written SSH hosts and includeIf identities into accounts")
+	fmt.Println("                         and mapped directories, previewed and applied all or nothing")
+	fmt.Println("  import ssh-config      Add an account for every hand-written github.com-<username> host and")
+	fmt.Println("                         manage its block (--dry-run, --email, --name, --keep-blocks)")
+	fmt.Println("  merge <config-file>    Merge another config file into this one")
+	fmt.Println("                         (--strategy prefer-local|prefer-remote|interactive)")
+	fmt.Println("  batch <file|->         Run a file of ghs commands, rolling all back if one fails")
+	fmt.Println("  watch [--policy alert|repair] [--once]")
+	fmt.Println("                         Report or repair changes other tools make to the managed configs")
+	fmt.Println("  daemon [--socket <path>]")
+	fmt.Println("                         Answer account queries of editors and prompts on a unix socket")
+	fmt.Println("  serve [--addr 127.0.0.1:7717] [--token-file <path>]")
+	fmt.Println("                         Serve list, status, switch and doctor as a token-protected local HTTP API")
+	fmt.Println("  sync <init|push|pull>  Share the config across machines through a git repository")
+	fmt.Println("  env [alias]            Print shell exports that commit and push as the account")
+	fmt.Println("  exec [alias] -- <cmd>  Run a command as the account")
+	fmt.Println("  doctor [alias] [--json]")
+	fmt.Println("                         Check keys, certificates and tools, with hints to fix problems")
+	fmt.Println("  gpg setup [--yes]      Write the gpg-agent.conf and shell settings GPG signing needs")
+	fmt.Println("  cert refresh <alias|--all>")
+	fmt.Println("                         Fetch a new SSH certificate with the account's certificate command")
+	fmt.Println("  config validate        Check the config file for schema errors")
+	fmt.Println("  lock [--passphrase]    Encrypt the config file with age, unlocked through the keyring")
+	fmt.Println("  unlock                 Decrypt the config file back to plain JSON")
+	fmt.Println("  cache clear            Remove cached GitHub API responses")
+	fmt.Println("  token check [alias]    Compare the scopes of the GitHub token with what ghs features need")
+	fmt.Println("  token set <alias> <owner|owner/repo|*> <env:VAR|cmd:<command>|keyring:<name>|gh>")
+	fmt.Println("                         Use a token for an organization (token unset|list)")
+	fmt.Println("  token store <alias> <owner|owner/repo|*>")
+	fmt.Println("                         Keep a token read from stdin in the OS keyring (token forget <name>)")
+	fmt.Println("  app set <alias> --app-id <id> --key <pem> [--installation <id>]")
+	fmt.Println("                         Use GitHub App installation tokens (app unset|token)")
+	fmt.Println("  credential get         Git credential helper answering with the account's token")
+	fmt.Println("  credential setup [--mode ghs|gcm]")
+	fmt.Println("                         Keep HTTPS logins per account, with ghs or Git Credential Manager")
+	fmt.Println("  credential status|remove")
+	fmt.Println("                         Show or undo the credential setup")
+	fmt.Println("  ci-setup [--local]     Configure git in a CI job from GHS_CI_* variables (--dir, --cleanup)")
+	fmt.Println("  actions setup [--account <alias>]")
+	fmt.Println("                         Configure git in a GitHub Actions job from GITHUB_TOKEN or OIDC")
+	fmt.Println("  install-git-alias [--link]")
+	fmt.Println("                         Make \"git ghs <command>\" run ghs (--remove undoes it)")
+	fmt.Println("  uninstall [dir...] [--config] [--dry-run]")
+	fmt.Println("                         Remove everything ghs manages (--config also deletes the config file)")
+	fmt.Println("  sshconfig update [--merge|--overwrite]")
+	fmt.Println("                         Regenerate the managed SSH config section")
+	fmt.Println("  export ssh-config [--ignore-existing]")
+	fmt.Println("                         Print the managed SSH config section without writing it")
+	fmt.Println("  sshconfig lint [file]  Find SSH config problems that make git authenticate as the wrong user")
+	fmt.Println("  sshconfig adopt <alias> [--yes]")
+	fmt.Println("                         Let ghs manage a hand-written Host block of an account")
+	fmt.Println("  sshconfig default-host <alias|none|off> [--yes]")
+	fmt.Println("                         Choose the only key plain github.com URLs may use")
+	fmt.Println("  sshconfig known-hosts <alias>... | --all")
+	fmt.Println("                         Rewrite accounts' own known_hosts with GitHub's current host keys")
+	fmt.Println("  profile <create|use|list> [name]")
+	fmt.Println("                         Manage named profiles, each with its own set of accounts")
+	fmt.Println("  help [command]         Show this help, or a command's usage, flags, examples and common errors")
+	fmt.Println("\nGlobal flags:")
+	fmt.Println("  --non-interactive      Never prompt; fail when input is missing (default when stdin is not a TTY or CI is set)")
+	fmt.Println("  --no-cache             Don't read or write cached GitHub API responses")
+	fmt.Println("  --offline              Never call the GitHub API; use cached data where possible")
+	fmt.Println("  --allow-root           Let commands change files when running as root for another user (sudo)")
+	fmt.Println("  --container            No prompts, plain output, state in a temp dir if HOME is read-only, no SSH config without ~/.ssh")
+	fmt.Println("  --log-file <file>      Append a JSON log of what ghs does and changes to file")
+	fmt.Println("  --trace <file>         Record every external command with its duration, exit code and output")
+	fmt.Println("                         (secrets redacted), e.g. for support tickets")
+	fmt.Println("  -C <dir>               Run as if started in dir (before the command, e.g. ghs -C /srv/repo.git switch work)")
+	fmt.Println("\nEnvironment:")
+	fmt.Println("  GHS_ACCOUNT            Account used by env/exec when no alias is given")
+	fmt.Println("  GHS_CONFIG             Path of the config file")
+	fmt.Println("  GHS_PROFILE            Profile used for this invocation")
+	fmt.Println("  GHS_OFFLINE            Same as --offline when set to 1")
+	fmt.Println("  GHS_CONTAINER          Same as --container when set to 1")
+	fmt.Println("  GHS_STATE_DIR          Directory for state and caches instead of ~/.ghs")
+	fmt.Println("  GHS_LOG                Same as --log-file; GHS_LOG_LEVEL=debug logs more")
+	fmt.Println("  GHS_TRACE              Same as --trace")
+	fmt.Println("  NO_COLOR               Plain output without terminal control sequences")
 	fmt.Println("\nExample SSH clone command:")
 	fmt.Println("  git clone git@github.com-username:owner/repo.git")
 }
 
 func main() {
-	config := loadConfig()
+	args := parseGlobalFlags(os.Args[1:])
+	if invokedByGit() || invokedByGH() {
+		args = subcommandArgs(args)
+	}
+	if len(args) > 0 {
+		if err := checkRoot(args); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+	}
+	// A locked config is only decrypted for commands that use it
+	config := Config{Accounts: map[string]GitHubAccount{}}
+	if needsConfig(args) {
+		config = loadConfig()
+	}
+	if err := setAPICacheTTL(config); err != nil {
+		warnf("%v", err)
+	}
+	if err := setRetryPolicy(config); err != nil {
+		warnf("%v", err)
+	}
+	if err := setCommandTimeout(config); err != nil {
+		warnf("%v", err)
+	}
+	if err := setTransport(config); err != nil {
+		warnf("%v", err)
+	}
+	handleInterrupts()
 
-	if len(os.Args) < 2 {
+	if len(args) < 1 {
 		showHelp()
 		return
 	}
 
-	command := os.Args[1]
+	command := args[0]
+	logger = logger.With("command", command)
+	logger.Debug("command started", "args", args[1:])
+	printHealthWarnings(config, command)
 	var err error
 
 	switch command {
 	case "list":
-		listAccounts(config)
+		err = listAccounts(config, args[1:])
+
+	case "edit":
+		if config, err = editAccount(config, args[1:]); err == nil {
+			err = saveConfig(config)
+		}
+
+	case "stats":
+		err = showStats(config, args[1:])
+
+	case "copy":
+		if config, err = copyAccount(config, args[1:]); err == nil {
+			err = saveConfig(config)
+		}
+
+	case "map", "unmap":
+		if config, err = mapDirectory(config, args[1:], command == "map"); err == nil {
+			err = saveConfig(config)
+		}
+
+	case "rotate-key":
+		if config, err = rotateKey(config, args[1:]); err == nil {
+			err = saveConfig(config)
+		}
+
+	case "purge":
+		if config, err = purgeAccount(config, args[1:]); err == nil {
+			err = saveConfig(config)
+		}
+
+	case "tag":
+		err = runTagCommand(config, args[1:])
+
+	case "alias":
+		err = runAliasCommand(config, args[1:])
 
 	case "add":
-		config = addAccount(config)
-		err = saveConfig(config)
+		if config, err = addAccount(config, args[1:]); err == nil {
+			err = saveConfig(config)
+		}
 
 	case "current":
-		if err := getCurrentAccount(); err != nil {
-			fmt.Printf("Error: %v\n", err)
+		if err := getCurrentAccount(config); err != nil {
+			printError(err)
 			os.Exit(1)
 		}
 
 	case "switch":
-		if len(os.Args) < 3 {
-			fmt.Println("Usage: github-switcher switch <alias>")
-			os.Exit(1)
-		}
-		if err := switchToAccount(config, os.Args[2]); err != nil {
-			fmt.Printf("Error: %v\n", err)
+		if err := runSwitch(config, args[1:]); err != nil {
+			printError(err)
 			os.Exit(1)
 		}
 		if err := saveConfig(config); err != nil {
@@ -541,31 +1261,167 @@ func main() {
 			os.Exit(1)
 		}
 
+	case "status":
+		err = runStatus(config, args[1:])
+
+	case "resolve":
+		err = resolveURL(config, args[1:])
+
+	case "init":
+		err = initRepo(config, args[1:])
+
+	case "rule":
+		if config, err = runRuleCommand(config, args[1:]); err == nil {
+			err = saveConfig(config)
+		}
+
+	case "which":
+		err = explainOwner(config, args[1:])
+
+	case "verify":
+		err = verifyCommits(config, args[1:])
+
+	case "scan":
+		err = scanRepos(config, args[1:])
+
+	case "test":
+		err = testAccounts(config, args[1:])
+
+	case "check":
+		err = runCheck(config, args[1:])
+
+	case "remind":
+		err = runRemindCommand(config, args[1:])
+
+	case "sshconfig":
+		err = runSSHConfigCommand(config, args[1:])
+
+	case "token":
+		if config, err = runTokenCommand(config, args[1:]); err == nil {
+			err = saveConfig(config)
+		}
+
+	case "app":
+		if config, err = runAppCommand(config, args[1:]); err == nil {
+			err = saveConfig(config)
+		}
+
+	case "cert":
+		err = runCertCommand(config, args[1:])
+
+	case "gpg":
+		err = runGPGCommand(config, args[1:])
+
+	case "doctor":
+		if err = doctor(config, args[1:]); errors.Is(err, errDoctorFailed) {
+			os.Exit(1)
+		}
+
+	case "credential":
+		err = credentialHelper(config, args[1:])
+
+	case "ci-setup":
+		err = ciSetup(args[1:])
+
+	case "actions":
+		err = runActionsCommand(config, args[1:])
+
+	case "cache":
+		err = runCacheCommand(args[1:])
+
+	case "install-git-alias":
+		err = installGitAlias(args[1:])
+
+	case "uninstall":
+		err = uninstall(config, args[1:])
+
+	case "path-rule":
+		err = runPathRuleCommand(config, args[1:])
+
+	case "remote", "remotes":
+		err = runRemoteCommand(config, args[1:])
+
 	case "clone":
-		if len(os.Args) < 3 {
-			fmt.Println("Usage: github-switcher clone <repo-url> [directory]")
+		if config, err = runClone(config, args[1:]); err == nil {
+			err = saveConfig(config)
+		}
+
+	case "migrate":
+		err = runMigrate(config, args[1:])
+
+	case "export":
+		err = runExportCommand(config, args[1:])
+
+	case "import":
+		err = runImportCommand(config, args[1:])
+
+	case "daemon":
+		err = runDaemon(config, args[1:])
+
+	case "serve":
+		err = runServe(config, args[1:])
+
+	case "watch":
+		err = watch(config, args[1:])
+
+	case "batch":
+		err = runBatch(args[1:])
+
+	case "merge":
+		if config, err = mergeConfig(config, args[1:]); err == nil {
+			err = saveConfig(config)
+		}
+
+	case "sync":
+		if err := runSyncCommand(config, args[1:]); err != nil {
+			printError(err)
 			os.Exit(1)
 		}
-		url := os.Args[2]
-		dir := ""
-		if len(os.Args) > 3 {
-			dir = os.Args[3]
+
+	case "env":
+		if err := printAccountEnv(config, args[1:]); err != nil {
+			printError(err)
+			os.Exit(1)
 		}
-		if err := cloneRepo(config, url, dir); err != nil {
-			fmt.Printf("Error: %v\n", err)
+
+	case "exec":
+		code, err := execAsAccount(config, args[1:])
+		if err != nil {
+			printError(err)
+		}
+		os.Exit(code)
+
+	case "lock":
+		err = lockConfig(args[1:])
+
+	case "unlock":
+		err = unlockConfig(args[1:])
+
+	case "config":
+		if err := runConfigCommand(args[1:]); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+
+	case "profile":
+		if err := runProfileCommand(config, args[1:]); err != nil {
+			printError(err)
 			os.Exit(1)
 		}
 
 	case "help":
-		showHelp()
+		if len(args) > 1 {
+			err = showCommandHelp(args[1])
+		} else {
+			showHelp()
+		}
 
 	default:
-		fmt.Printf("Unknown command: %s\n", command)
-		showHelp()
+		err = unknownCommand(command)
 	}
 
 	if err != nil {
-		fmt.Printf("Error: %v\n", err)
+		printError(err)
 		os.Exit(1)
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Conflict strategies for merging two config files
+const (
+	preferLocal  = "prefer-local"
+	preferRemote = "prefer-remote"
+	interactive  = "interactive"
+)
+
+// describeAccount renders an account on one line for conflict prompts
+func describeAccount(a GitHubAccount) string {
+	return fmt.Sprintf("%s <%s>, username %s, key %s", a.Name, a.Email, a.Username, a.SSHKeyPath)
+}
+
+// resolveConflict picks the version of an account to keep according to strategy
+func resolveConflict(name string, local, remote GitHubAccount, strategy string) (GitHubAccount, error) {
+	useRemote, err := chooseVersion("account '"+name+"'", describeAccount(local), describeAccount(remote), strategy)
+	if useRemote {
+		return remote, err
+	}
+	return local, err
+}
+
+// chooseVersion reports whether to keep the remote version of something
+// that differs between the two files, according to strategy
+func chooseVersion(what, local, remote, strategy string) (bool, error) {
+	switch strategy {
+	case preferLocal:
+		return false, nil
+	case preferRemote:
+		return true, nil
+	}
+
+	fmt.Printf("\nConflict for %s:\n", what)
+	fmt.Printf("  [l]ocal:  %s\n", local)
+	fmt.Printf("  [r]emote: %s\n", remote)
+	for {
+		answer, err := prompt("which version to keep [l/r]", "", "strategy")
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(answer) {
+		case "l", "local":
+			return false, nil
+		case "r", "remote":
+			return true, nil
+		}
+	}
+}
+
+// describeSetting renders a setting on one line for conflict prompts
+func describeSetting(value interface{}) string {
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// mergeOwnerRules merges the owner rules of src into dst, resolving rules
+// for the same pattern that name different accounts by strategy
+func mergeOwnerRules(dst, src []OwnerRule, strategy string) ([]OwnerRule, error) {
+	rules := append([]OwnerRule(nil), dst...)
+	for _, remote := range src {
+		i := 0
+		for i < len(rules) && rules[i].Pattern != remote.Pattern {
+			i++
+		}
+		switch {
+		case i == len(rules):
+			rules = append(rules, remote)
+			fmt.Printf("  added     owner rule %s\n", remote.Pattern)
+		case rules[i] == remote:
+			// Identical on both sides
+		default:
+			useRemote, err := chooseVersion("owner rule "+remote.Pattern, "account "+rules[i].Account, "account "+remote.Account, strategy)
+			if err != nil {
+				return nil, err
+			}
+			if useRemote {
+				rules[i] = remote
+				fmt.Printf("  replaced  owner rule %s (remote)\n", remote.Pattern)
+			} else {
+				fmt.Printf("  kept      owner rule %s (local)\n", remote.Pattern)
+			}
+		}
+	}
+	return rules, nil
+}
+
+// mergeSharedSettings merges the shared settings src sets into dst,
+// resolving settings both files set differently by strategy
+func mergeSharedSettings(dst *Config, src Config, strategy string) error {
+	local, remote := reflect.ValueOf(dst).Elem(), reflect.ValueOf(src)
+	for _, field := range sharedSettings {
+		mine, theirs := local.FieldByName(field), remote.FieldByName(field)
+		name := settingName(field)
+		switch {
+		case theirs.IsZero() || reflect.DeepEqual(mine.Interface(), theirs.Interface()):
+			// Unset in the other file or identical on both sides
+		case mine.IsZero():
+			mine.Set(theirs)
+			fmt.Printf("  added     %s\n", name)
+		default:
+			useRemote, err := chooseVersion(name, describeSetting(mine.Interface()), describeSetting(theirs.Interface()), strategy)
+			if err != nil {
+				return err
+			}
+			if useRemote {
+				mine.Set(theirs)
+				fmt.Printf("  replaced  %s (remote)\n", name)
+			} else {
+				fmt.Printf("  kept      %s (local)\n", name)
+			}
+		}
+	}
+	return nil
+}
+
+// mergeAccounts merges src into dst and prints what happened to each alias
+func mergeAccounts(section string, dst, src map[string]GitHubAccount, strategy string) error {
+	aliases := make([]string, 0, len(src))
+	for alias := range src {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+
+	for _, alias := range aliases {
+		remote := src[alias]
+		local, exists := dst[alias]
+		switch {
+		case !exists:
+			dst[alias] = remote
+			fmt.Printf("  added     %s%s\n", section, alias)
+		case reflect.DeepEqual(local, remote):
+			// Identical on both sides
+		default:
+			chosen, err := resolveConflict(section+alias, local, remote, strategy)
+			if err != nil {
+				return err
+			}
+			dst[alias] = chosen
+			if reflect.DeepEqual(chosen, local) {
+				fmt.Printf("  kept      %s%s (local)\n", section, alias)
+			} else {
+				fmt.Printf("  replaced  %s%s (remote)\n", section, alias)
+			}
+		}
+	}
+	return nil
+}
+
+// mergeConfig combines another config file into the current one
+func mergeConfig(config Config, args []string) (Config, error) {
+	flags := flag.NewFlagSet("merge", flag.ContinueOnError)
+	strategy := flags.String("strategy", interactive, "conflict strategy: prefer-local, prefer-remote or interactive")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return config, err
+	}
+	if len(positional) != 1 {
+		return config, fmt.Errorf("usage: ghs merge [--strategy prefer-local|prefer-remote|interactive] <config-file>")
+	}
+	switch *strategy {
+	case preferLocal, preferRemote, interactive:
+	default:
+		return config, fmt.Errorf("invalid --strategy %q", *strategy)
+	}
+
+	data, err := os.ReadFile(positional[0])
+	if err != nil {
+		return config, fmt.Errorf("failed to read %s: %v", positional[0], err)
+	}
+	if issues := validateConfigData(data); len(issues) > 0 {
+		printConfigIssues(positional[0], issues)
+		return config, fmt.Errorf("%s has %d problem(s); fix them before merging", positional[0], len(issues))
+	}
+	var other Config
+	if err := json.Unmarshal(data, &other); err != nil {
+		return config, fmt.Errorf("failed to parse %s: %v", positional[0], err)
+	}
+
+	// Merge on the on-disk layout so every profile is combined, then reload
+	// the active profile. Nothing is written until all conflicts are resolved.
+	active := config.ActiveProfile
+	merged := config.fileView()
+	merged.Accounts = copyAccounts(merged.Accounts)
+	if err := mergeAccounts("", merged.Accounts, other.Accounts, *strategy); err != nil {
+		return config, err
+	}
+
+	profiles := make(map[string]Profile, len(merged.Profiles))
+	for name, profile := range merged.Profiles {
+		profiles[name] = Profile{Accounts: copyAccounts(profile.Accounts)}
+	}
+	for name, profile := range other.Profiles {
+		accounts := profiles[name].Accounts
+		if accounts == nil {
+			accounts = map[string]GitHubAccount{}
+		}
+		if err := mergeAccounts(name+"/", accounts, profile.Accounts, *strategy); err != nil {
+			return config, err
+		}
+		profiles[name] = Profile{Accounts: accounts}
+	}
+	if len(profiles) > 0 {
+		merged.Profiles = profiles
+	}
+	if merged.OwnerRules, err = mergeOwnerRules(merged.OwnerRules, other.OwnerRules, *strategy); err != nil {
+		return config, err
+	}
+	if err := mergeSharedSettings(&merged, other, *strategy); err != nil {
+		return config, err
+	}
+
+	if err := merged.useProfile(active); err != nil {
+		warnf("%v, using default profile", err)
+	}
+	if err := updateManagedFiles(merged); err != nil {
+		fmt.Printf("Error: %v\n", err)
+	}
+	fmt.Println("Configs merged.")
+	return merged, nil
+}
+
+// copyAccounts returns a shallow copy of an account map
+func copyAccounts(accounts map[string]GitHubAccount) map[string]GitHubAccount {
+	copied := make(map[string]GitHubAccount, len(accounts))
+	for alias, account := range accounts {
+		copied[alias] = account
+	}
+	return copied
+}
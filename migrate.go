@@ -0,0 +1,291 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// handInclude is an includeIf gitdir entry of the global git config that
+// ghs didn't write, with the identity of the file it includes
+type handInclude struct {
+	Key   string
+	Dir   string
+	Path  string
+	Email string
+	Alias string // the account the email belongs to, if any
+}
+
+// migrationPlan is what "ghs migrate" found and proposes
+type migrationPlan struct {
+	sshHostImport
+	// Learned holds the emails of new accounts found in scanned repositories
+	Learned  map[string]string
+	Includes []handInclude
+	Repos    int
+}
+
+// handIncludes returns the includeIf gitdir entries of the global git config
+// that point at files other than ghs fragments
+func handIncludes() ([]handInclude, error) {
+	out, err := execCommand("git", "config", "--global", "--get-regexp", `^includeif\..*\.path$`).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var includes []handInclude
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		parts := strings.SplitN(line, " ", 2)
+		if len(parts) != 2 || strings.HasPrefix(parts[1], fragmentsDir()+string(filepath.Separator)) {
+			continue
+		}
+		condition := strings.TrimSuffix(strings.TrimPrefix(parts[0], "includeif."), ".path")
+		if !strings.HasPrefix(condition, "gitdir:") {
+			continue
+		}
+		dir := strings.TrimSuffix(strings.TrimSuffix(strings.TrimPrefix(condition, "gitdir:"), "**"), "/")
+		path := parts[1]
+		if strings.HasPrefix(path, "~/") {
+			path = expandPath(path)
+		} else if !filepath.IsAbs(path) {
+			// Relative to the file holding the include
+			home, _ := os.UserHomeDir()
+			path = filepath.Join(home, path)
+		}
+		email, _ := execCommand("git", "config", "--file", path, "user.email").Output()
+		includes = append(includes, handInclude{Key: parts[0], Dir: expandPath(dir), Path: path, Email: strings.TrimSpace(string(email))})
+	}
+	return includes, nil
+}
+
+// planMigration discovers the hand-rolled setup: account hosts in the SSH
+// config, identities included per directory by the global git config, and
+// in the scanned repositories the emails the new accounts commit with
+func planMigration(config Config, name string, emails map[string]string, scanDirs []string) (migrationPlan, error) {
+	plan := migrationPlan{Learned: map[string]string{}}
+	var err error
+	if sshConfigUsable() && !httpsOnly {
+		if plan.sshHostImport, err = sshHostRecords(config, name, emails); err != nil {
+			return plan, fmt.Errorf("failed to read SSH config file: %v", err)
+		}
+	}
+
+	// Learn missing emails from the repositories the new hosts are used in
+	preview := config
+	preview.Accounts = copyAccounts(config.Accounts)
+	for _, record := range plan.Records {
+		if _, exists := preview.Accounts[record.Alias]; !exists {
+			preview.Accounts[record.Alias] = record.GitHubAccount
+		}
+	}
+	var repos []string
+	for _, dir := range scanDirs {
+		found, err := findRepos(expandPath(dir))
+		if err != nil {
+			warnf("failed to scan %s: %v", dir, err)
+		}
+		repos = append(repos, found...)
+	}
+	plan.Repos = len(repos)
+	results := make([]repoScan, len(repos))
+	bar := newProgress("Scanning repositories", len(repos))
+	forEachParallel(len(repos), defaultJobs(), func(i int) {
+		results[i] = scanRepo(preview, repos[i])
+		bar.step()
+	})
+	bar.finish()
+	counts := map[string]map[string]int{}
+	for _, r := range results {
+		if r.Err != nil || len(r.Accounts) != 1 || r.Email == "" {
+			continue
+		}
+		if counts[r.Accounts[0]] == nil {
+			counts[r.Accounts[0]] = map[string]int{}
+		}
+		counts[r.Accounts[0]][r.Email]++
+	}
+	for _, record := range plan.Records {
+		if record.Email == "" && counts[record.Alias] != nil {
+			// The email most of the account's repositories commit with
+			plan.Learned[record.Username] = sortedCounts(counts[record.Alias])[0].Name
+		}
+	}
+	if len(plan.Learned) > 0 {
+		known := map[string]string{}
+		for username, email := range emails {
+			known[username] = email
+		}
+		for username, email := range plan.Learned {
+			known[username] = email
+			preview.Accounts[username] = GitHubAccount{Username: username, Email: email}
+		}
+		if plan.sshHostImport, err = sshHostRecords(config, name, known); err != nil {
+			return plan, fmt.Errorf("failed to read SSH config file: %v", err)
+		}
+	}
+
+	plan.Includes, err = handIncludes()
+	if err != nil {
+		return plan, fmt.Errorf("failed to read global git config: %v", err)
+	}
+	for i, include := range plan.Includes {
+		for _, alias := range sortedAliases(preview.Accounts) {
+			if include.Email != "" && strings.EqualFold(preview.Accounts[alias].Email, include.Email) {
+				plan.Includes[i].Alias = alias
+				break
+			}
+		}
+	}
+	return plan, nil
+}
+
+// printMigrationPlan shows what migrating would change
+func printMigrationPlan(plan migrationPlan, results []importResult) {
+	if len(results) > 0 {
+		fmt.Printf("Accounts from %s:\n", sshConfigPath)
+		for i, r := range results {
+			record := plan.Records[i]
+			switch {
+			case r.Err != nil:
+				fmt.Printf("  %-8s %-15s %s: %v\n", r.Status, r.Alias, r.Record, r.Err)
+			case r.Status == "skipped":
+				fmt.Printf("  %-8s %-15s %s, the account exists\n", r.Status, r.Alias, r.Record)
+			default:
+				fmt.Printf("  %-8s %-15s %s, %s, key %s; the block becomes managed\n", r.Status, r.Alias, record.Username, record.Email, record.SSHKeyPath)
+				if email, ok := plan.Learned[r.Alias]; ok {
+					fmt.Printf("  %-8s %-15s email %s, from the scanned repositories\n", "", "", email)
+				}
+			}
+		}
+	}
+	if len(plan.Includes) > 0 {
+		fmt.Println("Directories from the global git config:")
+		for _, include := range plan.Includes {
+			if include.Alias == "" {
+				fmt.Printf("  %-8s %-15s %s includes %s, whose email %q is no account's\n", "keep", "", include.Dir, include.Path, include.Email)
+				continue
+			}
+			fmt.Printf("  %-8s %-15s %s, replacing the include of %s\n", "map", include.Alias, include.Dir, include.Path)
+		}
+	}
+	if plan.Repos > 0 {
+		fmt.Printf("Scanned %d repositories\n", plan.Repos)
+	}
+}
+
+// runMigrate handles "migrate": it discovers a hand-rolled multi-account
+// setup, proposes the accounts and directory mappings that replace it,
+// previews them and applies them all or nothing
+func runMigrate(config Config, args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "only show what would change")
+	yes := flags.Bool("yes", false, "apply without asking")
+	name := flags.String("name", "", "name of the new accounts (defaults to the configured default or git's user.name)")
+	var emails, scanDirs stringList
+	flags.Var(&emails, "email", "email of a new account, username=email (repeatable)")
+	flags.Var(&scanDirs, "scan", "learn the emails of new accounts from the repositories under this directory (repeatable)")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return fmt.Errorf("usage: ghs migrate [--scan <dir>] [--email username=email] [--name <name>] [--dry-run] [--yes]")
+	}
+	byUsername, err := parseUsernameEmails(emails)
+	if err != nil {
+		return err
+	}
+	*name = importedName(config, *name)
+
+	plan, err := planMigration(config, *name, byUsername, scanDirs)
+	if err != nil {
+		return err
+	}
+	migrated := config
+	migrated.Accounts = copyAccounts(config.Accounts)
+	results := importRecords(migrated, plan.Records, plan.Labels, plan.Errs, onDuplicateSkip)
+	adopt := map[string]bool{}
+	for i, r := range results {
+		if r.Status == "added" {
+			adopt[plan.Hosts[i]] = true
+		}
+	}
+	var replaced []handInclude
+	for _, include := range plan.Includes {
+		account, exists := migrated.Accounts[include.Alias]
+		if include.Alias == "" || !exists {
+			continue
+		}
+		dirs := append([]string{include.Dir}, account.Directories...)
+		sort.Strings(dirs)
+		account.Directories = dirs
+		migrated.Accounts[include.Alias] = account
+		replaced = append(replaced, include)
+	}
+
+	printOwnedHosts(plan.Owned)
+	if len(results) == 0 && len(plan.Includes) == 0 {
+		fmt.Println("Found no hand-written github.com-<username> hosts or includeIf identities to migrate.")
+		return nil
+	}
+	printMigrationPlan(plan, results)
+	if len(adopt) == 0 && len(replaced) == 0 {
+		fmt.Println("\nNothing can be migrated; see the problems above.")
+		return nil
+	}
+	if *dryRun {
+		fmt.Println("\nDry run, nothing was changed.")
+		return nil
+	}
+	if !*yes {
+		ok, err := confirm(fmt.Sprintf("\nAdd %d account(s) and map %d directory(ies)?", len(adopt), len(replaced)), false)
+		if err != nil {
+			return fmt.Errorf("%v (pass --yes)", err)
+		}
+		if !ok {
+			return fmt.Errorf("aborted")
+		}
+	}
+
+	snapshot, err := takeBatchSnapshot()
+	if err != nil {
+		return fmt.Errorf("failed to back up the files migrate changes: %v", err)
+	}
+	if err := applyMigration(migrated, adopt, replaced); err != nil {
+		if restoreErr := snapshot.restore(); restoreErr != nil {
+			return fmt.Errorf("%v; rolling back failed too: %v", err, restoreErr)
+		}
+		return fmt.Errorf("%v; nothing was changed", err)
+	}
+	fmt.Printf("Migrated %d account(s) and %d directory(ies)\n", len(adopt), len(replaced))
+	if len(adopt) > 0 {
+		fmt.Printf("Previous SSH config saved to %s.bak\n", sshConfigPath)
+	}
+	return nil
+}
+
+// applyMigration writes a migration: the SSH config with the adopted hosts
+// managed, the git config with ghs fragments instead of the replaced
+// includes, and the config
+func applyMigration(config Config, adopt map[string]bool, replaced []handInclude) error {
+	if len(adopt) > 0 {
+		if err := writeSSHConfig(config, adopt, sshEditsAsk); err != nil {
+			return fmt.Errorf("failed to update SSH config: %v", err)
+		}
+	}
+	for _, include := range replaced {
+		if err := execCommand("git", "config", "--global", "--unset-all", include.Key).Run(); err != nil {
+			return fmt.Errorf("failed to remove %s: %v", include.Key, err)
+		}
+	}
+	if err := updateGitConfigFragments(config); err != nil {
+		return fmt.Errorf("failed to update git config fragments: %v", err)
+	}
+	return saveConfig(config)
+}
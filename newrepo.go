@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sshRemoteURL returns the remote URL that routes through an account's SSH
+// host alias
+func sshRemoteURL(account GitHubAccount, owner, repo string) string {
+	return fmt.Sprintf("git@github.com-%s:%s/%s.git", account.Username, owner, repo)
+}
+
+// initRepo creates a new repository configured for an account, adds an
+// origin remote through the account's SSH host and optionally creates the
+// repository on GitHub and pushes the initial branch
+func initRepo(config Config, args []string) error {
+	flags := flag.NewFlagSet("init", flag.ContinueOnError)
+	owner := flags.String("owner", "", "user or organization owning the repository (default: the account's username)")
+	name := flags.String("name", "", "repository name (default: the directory name)")
+	create := flags.Bool("create", false, "create the repository on GitHub (needs GH_TOKEN or GITHUB_TOKEN)")
+	private := flags.Bool("private", false, "make the created repository private")
+	push := flags.Bool("push", false, "push the initial branch, creating an empty commit if needed")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) < 1 || len(positional) > 2 {
+		return fmt.Errorf("usage: ghs init <alias> [dir] [--owner <owner>] [--name <repo>] [--create [--private]] [--push]")
+	}
+
+	alias := positional[0]
+	alias, account, err := config.lookupAccount(alias)
+	if err != nil {
+		return err
+	}
+	dir := "."
+	if len(positional) == 2 {
+		dir = positional[1]
+	}
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if *owner == "" {
+		*owner = account.Username
+	}
+	if *name == "" {
+		*name = filepath.Base(dir)
+	}
+
+	initCmd := execCommand("git", "init", dir)
+	if account.Init != nil && account.Init.DefaultBranch != "" {
+		initCmd.Args = append(initCmd.Args, "--initial-branch", account.Init.DefaultBranch)
+	}
+	initCmd.Stdout = os.Stdout
+	initCmd.Stderr = os.Stderr
+	if err := initCmd.Run(); err != nil {
+		return fmt.Errorf("git init failed: %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		return fmt.Errorf("failed to change to repository directory: %v", err)
+	}
+	if err := switchToAccount(config, alias); err != nil {
+		return err
+	}
+
+	remote := remoteURL(account, *owner, *name)
+	if out, err := execCommand("git", "remote", "get-url", "origin").Output(); err == nil {
+		fmt.Printf("Keeping existing origin remote %s\n", strings.TrimSpace(string(out)))
+	} else if err := execCommand("git", "remote", "add", "origin", remote).Run(); err != nil {
+		return fmt.Errorf("failed to add origin remote: %v", err)
+	} else {
+		fmt.Printf("Added origin remote %s\n", remote)
+	}
+
+	if *create {
+		err := createGitHubRepo(account, *owner, *name, *private)
+		if errors.Is(err, errOffline) {
+			// The local repository is ready; only the GitHub side is missing
+			warnf("%v", err)
+			fmt.Printf("Create %s/%s on GitHub later and push with: git push -u origin HEAD\n", *owner, *name)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to create %s/%s on GitHub: %v", *owner, *name, err)
+		}
+		fmt.Printf("Created https://github.com/%s/%s\n", *owner, *name)
+	}
+
+	if !*push {
+		return nil
+	}
+	if err := execCommand("git", "rev-parse", "--verify", "-q", "HEAD").Run(); err != nil {
+		if err := execCommand("git", "commit", "--allow-empty", "-m", "Initial commit").Run(); err != nil {
+			return fmt.Errorf("failed to create initial commit: %v", err)
+		}
+	}
+	if stderr, err := runGitRetrying("git push", "push", "-u", "origin", "HEAD"); err != nil {
+		suggestFix(stderr.String(), failureContext{Config: config, Alias: alias, Account: account, Owner: *owner, Repo: *name})
+		return fmt.Errorf("failed to push initial branch: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// defaultTokenScope is the Tokens key of the token used when no organization
+// or repository key matches
+const defaultTokenScope = "*"
+
+// Token references. Tokens themselves are never stored in the config, which
+// may be shared through sync.
+const (
+	tokenRefEnv = "env:"
+	tokenRefCmd = "cmd:"
+	tokenRefGH  = "gh"
+)
+
+// hasAppToken reports whether the account's token for owner/repo comes from
+// its GitHub App
+func hasAppToken(account GitHubAccount, owner, repo string) bool {
+	if scope, ok := tokenScopeFor(account, owner, repo); ok {
+		return account.Tokens[scope] == tokenRefApp
+	}
+	return account.App != nil
+}
+
+// tokenRefProblem checks a token reference
+func tokenRefProblem(ref string) string {
+	switch {
+	case ref == tokenRefGH, ref == tokenRefApp:
+	case strings.HasPrefix(ref, tokenRefEnv) && len(ref) > len(tokenRefEnv):
+	case strings.HasPrefix(ref, tokenRefCmd) && len(ref) > len(tokenRefCmd):
+	case strings.HasPrefix(ref, tokenRefKeyring) && len(ref) > len(tokenRefKeyring):
+	default:
+		return fmt.Sprintf("invalid token reference %q (use env:VAR, cmd:<command>, keyring:<name>, gh or app)", ref)
+	}
+	return ""
+}
+
+// tokenScopeProblem checks a Tokens key: an owner, owner/repo or "*"
+func tokenScopeProblem(scope string) string {
+	if scope == defaultTokenScope {
+		return ""
+	}
+	parts := strings.Split(scope, "/")
+	if len(parts) > 2 || parts[0] == "" || (len(parts) == 2 && parts[1] == "") {
+		return fmt.Sprintf("invalid token scope %q (use an owner, owner/repo or *)", scope)
+	}
+	return ""
+}
+
+// readTokenRef returns the token a reference points to
+func readTokenRef(username, ref string) (string, error) {
+	var token string
+	switch {
+	case strings.HasPrefix(ref, tokenRefEnv):
+		name := strings.TrimPrefix(ref, tokenRefEnv)
+		if token = os.Getenv(name); token == "" {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+	case strings.HasPrefix(ref, tokenRefCmd):
+		out, err := execCommand("sh", "-c", strings.TrimPrefix(ref, tokenRefCmd)).Output()
+		if err != nil {
+			return "", fmt.Errorf("token command failed: %v", err)
+		}
+		token = strings.TrimSpace(string(out))
+	case strings.HasPrefix(ref, tokenRefKeyring):
+		var err error
+		if token, err = readKeyringRef(ref); err != nil {
+			return "", err
+		}
+	case ref == tokenRefGH:
+		out, err := execCommand("gh", "auth", "token", "--hostname", "github.com", "--user", username).Output()
+		if err != nil {
+			return "", fmt.Errorf("gh auth token failed: %v", err)
+		}
+		token = strings.TrimSpace(string(out))
+	default:
+		return "", fmt.Errorf("%s", tokenRefProblem(ref))
+	}
+	if token == "" {
+		return "", fmt.Errorf("%s returned an empty token", ref)
+	}
+	return token, nil
+}
+
+// tokenScopeFor returns the most specific Tokens key of the account that
+// covers owner/repo: the repository, then the owner, then "*"
+func tokenScopeFor(account GitHubAccount, owner, repo string) (string, bool) {
+	candidates := []string{defaultTokenScope}
+	if owner != "" {
+		candidates = append([]string{owner}, candidates...)
+		if repo != "" {
+			candidates = append([]string{owner + "/" + repo}, candidates...)
+		}
+	}
+	for _, scope := range candidates {
+		for key := range account.Tokens {
+			if strings.EqualFold(key, scope) {
+				return key, true
+			}
+		}
+	}
+	return "", false
+}
+
+// tokenFor returns the token for API calls and HTTPS operations of the
+// account on owner/repo, either of which may be empty. Accounts without a
+// matching token use their GitHub App, or fall back to GH_TOKEN,
+// GITHUB_TOKEN and gh.
+func tokenFor(account GitHubAccount, owner, repo string) (token, source string, err error) {
+	if hasAppToken(account, owner, repo) {
+		token, err := mintAppToken(account, owner, repo)
+		if err != nil {
+			return "", "", err
+		}
+		return token, fmt.Sprintf("GitHub App %d", account.App.AppID), nil
+	}
+	if scope, ok := tokenScopeFor(account, owner, repo); ok {
+		ref := account.Tokens[scope]
+		token, err := readTokenRef(account.Username, ref)
+		if err != nil {
+			return "", "", fmt.Errorf("token for %s: %v", scope, err)
+		}
+		return token, fmt.Sprintf("%s (%s)", ref, scope), nil
+	}
+	return findAccountToken(account.Username)
+}
+
+// tokenAccount returns the account for HTTPS access to owner/repo: one with
+// a token for the repository or owner, otherwise the account owner resolves
+// to
+func tokenAccount(config Config, owner, repo string) string {
+	if owner == "" {
+		return ""
+	}
+	accounts := config.resolvedAccounts()
+	for _, alias := range sortedAliases(accounts) {
+		if scope, ok := tokenScopeFor(accounts[alias], owner, repo); ok && scope != defaultTokenScope {
+			return alias
+		}
+	}
+	return resolveOwner(config, owner)
+}
+
+// setAccountToken handles "token set <alias> <scope> <ref>" and "token unset
+// <alias> <scope>"
+func setAccountToken(config Config, args []string, set bool) (Config, error) {
+	if set && len(args) != 3 || !set && len(args) != 2 {
+		return config, fmt.Errorf("usage: ghs token set <alias> <owner|owner/repo|*> <env:VAR|cmd:<command>|keyring:<name>|gh|app>, ghs token unset <alias> <scope>")
+	}
+	scope := args[1]
+	alias, err := config.lookupAlias(args[0])
+	if err != nil {
+		return config, err
+	}
+	account := config.Accounts[alias]
+
+	tokens := make(map[string]string, len(account.Tokens)+1)
+	for k, v := range account.Tokens {
+		tokens[k] = v
+	}
+	if set {
+		if problem := tokenScopeProblem(scope); problem != "" {
+			return config, fmt.Errorf("%s", problem)
+		}
+		if problem := tokenRefProblem(args[2]); problem != "" {
+			return config, fmt.Errorf("%s", problem)
+		}
+		if old := tokens[scope]; old != args[2] {
+			deleteKeyringToken(old)
+		}
+		tokens[scope] = args[2]
+		fmt.Printf("Account '%s' uses %s for %s\n", alias, args[2], scope)
+	} else {
+		if _, exists := tokens[scope]; !exists {
+			return config, fmt.Errorf("account '%s' has no token for %s", alias, scope)
+		}
+		deleteKeyringToken(tokens[scope])
+		delete(tokens, scope)
+		fmt.Printf("Removed the token of account '%s' for %s\n", alias, scope)
+	}
+	if len(tokens) == 0 {
+		tokens = nil
+	}
+	account.Tokens = tokens
+	config.Accounts[alias] = account
+	return config, nil
+}
+
+// listAccountTokens prints the token references of every account
+func listAccountTokens(config Config) {
+	accounts := config.resolvedAccounts()
+	for _, alias := range sortedAliases(accounts) {
+		tokens := accounts[alias].Tokens
+		for _, scope := range sortedKeys(tokens) {
+			fmt.Printf("%-15s %-30s %s\n", alias, scope, tokens[scope])
+		}
+	}
+}
+
+// credentialHelper implements the git credential helper protocol for
+// "credential get": it answers with the account's token for the owner in the
+// requested path. Git needs credential.useHttpPath to send the path.
+func credentialHelper(config Config, args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "setup":
+			return setupCredentials(config, args[1:])
+		case "status":
+			return credentialStatus(config)
+		case "remove":
+			if err := removeCredentialSetup(config); err != nil {
+				return err
+			}
+			fmt.Println("Removed the credential setup of ghs from the global git config")
+			return nil
+		}
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("usage: ghs credential <get|store|erase|setup|status|remove>")
+	}
+	if args[0] != "get" {
+		// Tokens come from their references, nothing to store or erase
+		return nil
+	}
+
+	request := map[string]string{}
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+		if key, value, ok := strings.Cut(line, "="); ok {
+			request[key] = value
+		}
+	}
+	if request["protocol"] != "https" || request["host"] != "github.com" {
+		return nil
+	}
+	owner, repo, _ := strings.Cut(strings.Trim(request["path"], "/"), "/")
+	repo = strings.TrimSuffix(repo, ".git")
+
+	alias := tokenAccount(config, owner, repo)
+	if alias == "" {
+		return nil
+	}
+	account, _ := config.account(alias)
+	token, _, err := tokenFor(account, owner, repo)
+	if err != nil {
+		// Let git try its other helpers
+		fmt.Fprintf(os.Stderr, "ghs: %v\n", err)
+		return nil
+	}
+	username := account.Username
+	if hasAppToken(account, owner, repo) {
+		username = appTokenUser
+	}
+	fmt.Printf("username=%s\npassword=%s\n", username, token)
+	return nil
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// OwnerRule maps GitHub owners matching Pattern to an account. A pattern is
+// an exact owner, a glob such as "acme-*", or a regular expression written
+// between slashes such as "/^acme-(corp|labs)$/". Owners are compared
+// case-insensitively.
+type OwnerRule struct {
+	Pattern string `json:"pattern"`
+	Account string `json:"account"`
+}
+
+// ownerMatch is an account that can serve an owner and why
+type ownerMatch struct {
+	Alias  string
+	Kind   string // patternExact, "username" or the kind of the matching pattern
+	Reason string
+}
+
+// Kinds of owner patterns, in order of precedence
+const (
+	patternExact = "exact"
+	patternGlob  = "glob"
+	patternRegex = "regex"
+)
+
+func patternKind(pattern string) string {
+	if len(pattern) > 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		return patternRegex
+	}
+	if strings.ContainsAny(pattern, "*?[") {
+		return patternGlob
+	}
+	return patternExact
+}
+
+// compileOwnerPattern checks a pattern and returns a matcher for it
+func compileOwnerPattern(pattern string) (func(owner string) bool, error) {
+	switch patternKind(pattern) {
+	case patternRegex:
+		re, err := regexp.Compile("(?i)" + pattern[1:len(pattern)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %s: %v", pattern, err)
+		}
+		return re.MatchString, nil
+	case patternGlob:
+		lower := strings.ToLower(pattern)
+		if _, err := path.Match(lower, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob %q: %v", pattern, err)
+		}
+		return func(owner string) bool {
+			ok, _ := path.Match(lower, strings.ToLower(owner))
+			return ok
+		}, nil
+	}
+	return func(owner string) bool { return strings.EqualFold(pattern, owner) }, nil
+}
+
+// ownerCandidates returns every account that can serve owner, best first:
+// exact rules, then accounts whose username is the owner, then glob and
+// regex rules in the order they were added
+func ownerCandidates(config Config, owner string) []ownerMatch {
+	var matches []ownerMatch
+	seen := map[string]bool{}
+	add := func(name, kind, reason string) {
+		// Rules may name an account by any of its aliases
+		if alias, ok := config.namedAlias(name); ok && !seen[alias] {
+			seen[alias] = true
+			matches = append(matches, ownerMatch{alias, kind, reason})
+		}
+	}
+
+	for _, rule := range config.OwnerRules {
+		if patternKind(rule.Pattern) == patternExact && strings.EqualFold(rule.Pattern, owner) {
+			add(rule.Account, patternExact, fmt.Sprintf("rule %q", rule.Pattern))
+		}
+	}
+	for _, alias := range sortedAliases(config.Accounts) {
+		if strings.EqualFold(config.Accounts[alias].Username, owner) {
+			add(alias, "username", "username")
+		}
+	}
+	for _, rule := range config.OwnerRules {
+		kind := patternKind(rule.Pattern)
+		if kind == patternExact {
+			continue
+		}
+		if match, err := compileOwnerPattern(rule.Pattern); err == nil && match(owner) {
+			add(rule.Account, kind, fmt.Sprintf("%s rule %q", kind, rule.Pattern))
+		}
+	}
+	return matches
+}
+
+// resolveOwner returns the account that serves owner, or "" if none does
+func resolveOwner(config Config, owner string) string {
+	if matches := ownerCandidates(config, owner); len(matches) > 0 {
+		return matches[0].Alias
+	}
+	return ""
+}
+
+// chooseOwnerAccount picks the account for owner. When only glob or regex
+// rules match and they name several accounts, the user chooses and may keep
+// the choice as an exact rule; non-interactive runs take the first match.
+func chooseOwnerAccount(config Config, owner string) (Config, string, error) {
+	matches := ownerCandidates(config, owner)
+	if len(matches) == 0 {
+		return config, "", nil
+	}
+	if len(matches) == 1 || matches[0].Kind == patternExact || matches[0].Kind == "username" {
+		return config, matches[0].Alias, nil
+	}
+	if nonInteractive {
+		fmt.Printf("Several accounts match %s, using '%s' (%s)\n", owner, matches[0].Alias, matches[0].Reason)
+		return config, matches[0].Alias, nil
+	}
+
+	fmt.Printf("Several accounts can serve %s:\n", owner)
+	for i, m := range matches {
+		account := config.Accounts[m.Alias]
+		fmt.Printf("  %d) %-12s %s <%s> (%s)\n", i+1, m.Alias, account.Username, account.Email, m.Reason)
+	}
+	var alias string
+	for alias == "" {
+		answer, err := prompt("the account to use", "1", "account")
+		if err != nil {
+			return config, "", err
+		}
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(matches) {
+			alias = matches[n-1].Alias
+		} else if named, err := config.lookupAlias(answer); err == nil {
+			alias = named
+		} else {
+			fmt.Printf("Invalid choice %q\n", answer)
+		}
+	}
+
+	remember, err := confirm(fmt.Sprintf("Always use '%s' for %s?", alias, owner), false)
+	if err != nil {
+		return config, "", err
+	}
+	if remember {
+		config.OwnerRules = append(config.OwnerRules, OwnerRule{Pattern: owner, Account: alias})
+		fmt.Printf("Added rule %s -> %s\n", owner, alias)
+	}
+	return config, alias, nil
+}
+
+// ownerRuleProblems checks owner rules for bad patterns and unknown accounts
+func ownerRuleProblems(config Config) []fieldProblem {
+	var problems []fieldProblem
+	for i, rule := range config.OwnerRules {
+		field := fmt.Sprintf("owner_rules[%d]", i)
+		if _, err := compileOwnerPattern(rule.Pattern); err != nil {
+			problems = append(problems, fieldProblem{field + ".pattern", err.Error()})
+		}
+		if _, ok := config.namedAlias(rule.Account); !ok {
+			problems = append(problems, fieldProblem{field + ".account", fmt.Sprintf("account '%s' not found", rule.Account)})
+		}
+	}
+	return problems
+}
+
+// runRuleCommand handles "rule add|remove|list"
+func runRuleCommand(config Config, args []string) (Config, error) {
+	if len(args) < 1 {
+		return config, fmt.Errorf("usage: ghs rule <add <pattern> <alias>|remove <pattern>|list>")
+	}
+	switch args[0] {
+	case "add":
+		if len(args) != 3 {
+			return config, fmt.Errorf("usage: ghs rule add <pattern> <alias>")
+		}
+		pattern, alias := args[1], args[2]
+		if _, err := compileOwnerPattern(pattern); err != nil {
+			return config, err
+		}
+		alias, err := config.lookupAlias(alias)
+		if err != nil {
+			return config, err
+		}
+		for _, rule := range config.OwnerRules {
+			if rule.Pattern == pattern {
+				return config, fmt.Errorf("rule %q already maps to account '%s'", pattern, rule.Account)
+			}
+		}
+		config.OwnerRules = append(config.OwnerRules, OwnerRule{Pattern: pattern, Account: alias})
+		fmt.Printf("Owners matching %s (%s) now use account '%s'\n", pattern, patternKind(pattern), alias)
+	case "remove":
+		if len(args) != 2 {
+			return config, fmt.Errorf("usage: ghs rule remove <pattern>")
+		}
+		var rules []OwnerRule
+		for _, rule := range config.OwnerRules {
+			if rule.Pattern != args[1] {
+				rules = append(rules, rule)
+			}
+		}
+		if len(rules) == len(config.OwnerRules) {
+			return config, fmt.Errorf("no rule with pattern %q", args[1])
+		}
+		config.OwnerRules = rules
+		fmt.Printf("Removed rule %s\n", args[1])
+	case "list":
+		if len(config.OwnerRules) == 0 {
+			fmt.Println("No owner rules; owners map to the account with the same username.")
+		}
+		for _, rule := range config.OwnerRules {
+			fmt.Printf("%-30s %-6s %s\n", rule.Pattern, patternKind(rule.Pattern), rule.Account)
+		}
+	default:
+		return config, fmt.Errorf("unknown rule subcommand: %s", args[0])
+	}
+	return config, nil
+}
+
+// explainOwner handles "which <owner|owner/repo|url>", showing every rule
+// evaluated for the owner, the account chosen and the rule that fired
+func explainOwner(config Config, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: ghs which <owner|owner/repo|url>")
+	}
+	owner, repo := args[0], ""
+	if host, urlOwner, urlRepo, ok := parseRemoteURL(owner); ok {
+		owner, repo = urlOwner, urlRepo
+		if username := strings.TrimPrefix(host, "github.com-"); username != host {
+			// The SSH host alias names the account, no rule is consulted
+			alias := matchRemoteAccount(config, host, owner)
+			if alias == "" {
+				fmt.Printf("URL uses the SSH host of username %s, which no account has\n", username)
+				return nil
+			}
+			fmt.Printf("Account: %s (SSH host %s)\n", alias, host)
+			return nil
+		}
+	} else if parts := strings.Split(owner, "/"); len(parts) == 2 && parts[0] != "" && parts[1] != "" {
+		owner, repo = parts[0], strings.TrimSuffix(parts[1], ".git")
+	}
+
+	fmt.Printf("Owner: %s\n", owner)
+	for _, rule := range config.OwnerRules {
+		if patternKind(rule.Pattern) != patternExact {
+			continue
+		}
+		result := "no match"
+		if strings.EqualFold(rule.Pattern, owner) {
+			result = "match"
+		}
+		fmt.Printf("  %-8s %-30s -> %-12s %s\n", patternExact, rule.Pattern, rule.Account, result)
+	}
+	for _, alias := range sortedAliases(config.Accounts) {
+		username := config.Accounts[alias].Username
+		if strings.EqualFold(username, owner) {
+			fmt.Printf("  %-8s %-30s -> %-12s %s\n", "username", username, alias, "match")
+		}
+	}
+	for _, rule := range config.OwnerRules {
+		kind := patternKind(rule.Pattern)
+		if kind == patternExact {
+			continue
+		}
+		match, err := compileOwnerPattern(rule.Pattern)
+		result := "no match"
+		if err != nil {
+			result = "invalid: " + err.Error()
+		} else if match(owner) {
+			result = "match"
+		}
+		fmt.Printf("  %-8s %-30s -> %-12s %s\n", kind, rule.Pattern, rule.Account, result)
+	}
+
+	matches := ownerCandidates(config, owner)
+	if len(matches) == 0 {
+		fmt.Println("No account matches; the original URL is used.")
+		return nil
+	}
+	fmt.Printf("Account: %s (%s)\n", matches[0].Alias, matches[0].Reason)
+	if len(matches) > 1 && matches[0].Kind != patternExact && matches[0].Kind != "username" {
+		fmt.Println("Several patterns match; clone asks which account to use.")
+	}
+	for _, m := range matches[1:] {
+		fmt.Printf("Also possible: %s (%s)\n", m.Alias, m.Reason)
+	}
+	if repo != "" {
+		account, _ := config.account(matches[0].Alias)
+		fmt.Printf("Remote: %s\n", remoteURL(account, owner, repo))
+	}
+	return nil
+}
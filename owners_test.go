@@ -0,0 +1,114 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPatternKind(t *testing.T) {
+	tests := []struct {
+		pattern, want string
+	}{
+		{"acme", patternExact},
+		{"acme-*", patternGlob},
+		{"team?", patternGlob},
+		{"[ab]corp", patternGlob},
+		{"/^acme/", patternRegex},
+		{"//", patternExact},
+		{"/acme", patternExact},
+	}
+	for _, tt := range tests {
+		if got := patternKind(tt.pattern); got != tt.want {
+			t.Errorf("patternKind(%q) = %s, want %s", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestCompileOwnerPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		match   []string
+		noMatch []string
+		err     string
+	}{
+		{pattern: "acme", match: []string{"acme", "ACME"}, noMatch: []string{"acme-corp", "acm"}},
+		{pattern: "acme-*", match: []string{"acme-", "acme-corp", "Acme-Labs"}, noMatch: []string{"acme", "my-acme-corp"}},
+		{pattern: "team?", match: []string{"team1", "TEAMx"}, noMatch: []string{"team", "team12"}},
+		{pattern: "[ab]corp", match: []string{"acorp", "Bcorp"}, noMatch: []string{"ccorp"}},
+		{pattern: "/^acme-(corp|labs)$/", match: []string{"acme-corp", "ACME-labs"}, noMatch: []string{"acme-corp2", "acme"}},
+		{pattern: "/acme/", match: []string{"acme", "notacme", "acme-corp"}, noMatch: []string{"acm"}},
+		{pattern: "[acme", err: "invalid glob"},
+		{pattern: "/(acme/", err: "invalid regular expression"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			match, err := compileOwnerPattern(tt.pattern)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, owner := range tt.match {
+				if !match(owner) {
+					t.Errorf("%s doesn't match %q", tt.pattern, owner)
+				}
+			}
+			for _, owner := range tt.noMatch {
+				if match(owner) {
+					t.Errorf("%s matches %q", tt.pattern, owner)
+				}
+			}
+		})
+	}
+}
+
+func TestOwnerCandidates(t *testing.T) {
+	config := Config{
+		Accounts: map[string]GitHubAccount{
+			"work":    {Username: "acme-me", Aliases: []string{"w"}},
+			"client":  {Username: "client-me"},
+			"labs":    {Username: "labs-me"},
+			"private": {Username: "me"},
+		},
+		OwnerRules: []OwnerRule{
+			{Pattern: "/^acme/", Account: "labs"},
+			{Pattern: "acme-*", Account: "w"},
+			{Pattern: "acme-corp", Account: "client"},
+			{Pattern: "[", Account: "private"},
+			{Pattern: "beta-*", Account: "gone"},
+		},
+	}
+	tests := []struct {
+		owner string
+		want  []string
+	}{
+		// Exact rules come first, then usernames, then patterns in rule order
+		{"acme-corp", []string{"client", "labs", "work"}},
+		{"acme-me", []string{"work", "labs"}},
+		{"ACME", []string{"labs"}},
+		{"me", []string{"private"}},
+		{"beta-x", nil},
+		{"other", nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, m := range ownerCandidates(config, tt.owner) {
+			got = append(got, m.Alias)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ownerCandidates(%q) = %v, want %v", tt.owner, got, tt.want)
+		}
+		want := ""
+		if len(tt.want) > 0 {
+			want = tt.want[0]
+		}
+		if got := resolveOwner(config, tt.owner); got != want {
+			t.Errorf("resolveOwner(%q) = %q, want %q", tt.owner, got, want)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// pathRuleKey is the multi-valued repository git config key holding path
+// rules as "<alias>:<path>"
+const pathRuleKey = "ghs.pathRule"
+
+// pathRuleHookMarker identifies the pre-commit hook installed for path rules
+const pathRuleHookMarker = "# ghs path rules"
+
+// pathRule requires commits touching Path to use the account Alias
+type pathRule struct {
+	Alias string
+	Path  string
+}
+
+func readPathRules() []pathRule {
+	var rules []pathRule
+	for _, value := range gitConfigValues(".", pathRuleKey) {
+		if parts := strings.SplitN(value, ":", 2); len(parts) == 2 {
+			rules = append(rules, pathRule{Alias: parts[0], Path: parts[1]})
+		}
+	}
+	return rules
+}
+
+// normalizeRulePath turns a path given on the command line into a path
+// relative to the repository root with a trailing slash for directories
+func normalizeRulePath(repo repoInfo, path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(repo.Root, abs)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("%s is not inside the repository", path)
+	}
+	rel = filepath.ToSlash(rel)
+	if info, err := os.Stat(abs); err == nil && info.IsDir() || strings.HasSuffix(path, "/") {
+		rel += "/"
+	}
+	return rel, nil
+}
+
+// ruleFor returns the rule with the longest path matching file
+func ruleFor(rules []pathRule, file string) (pathRule, bool) {
+	var best pathRule
+	found := false
+	for _, rule := range rules {
+		matches := file == rule.Path || (strings.HasSuffix(rule.Path, "/") && strings.HasPrefix(file, rule.Path))
+		if matches && len(rule.Path) > len(best.Path) {
+			best, found = rule, true
+		}
+	}
+	return best, found
+}
+
+// installPathRuleHook installs the pre-commit hook that runs "path-rule
+// check". A pre-commit hook not written by ghs is left alone.
+func installPathRuleHook() error {
+	out, err := execCommand("git", "rev-parse", "--git-path", "hooks").Output()
+	if err != nil {
+		return fmt.Errorf("failed to find hooks directory: %v", err)
+	}
+	hooksDir, _ := filepath.Abs(strings.TrimSpace(string(out)))
+	hook := filepath.Join(hooksDir, "pre-commit")
+
+	self, err := os.Executable()
+	if err != nil {
+		self = "ghs"
+	}
+	command := shellQuote(self) + " path-rule check"
+	if data, err := os.ReadFile(hook); err == nil && !containsLine(string(data), pathRuleHookMarker) {
+		warnf("%s already exists; add this line to it to enforce path rules:\n  %s", hook, command)
+		return nil
+	}
+
+	if err := mkdirPrivate(hooksDir); err != nil {
+		return err
+	}
+	content := "#!/bin/sh\n" + pathRuleHookMarker + "\nexec " + command + "\n"
+	return writePrivateHook(hook, []byte(content))
+}
+
+// checkPathRules verifies that the author of the commit being made matches
+// the accounts required by the staged paths
+func checkPathRules(config Config) error {
+	rules := readPathRules()
+	if len(rules) == 0 {
+		return nil
+	}
+	out, err := execCommand("git", "diff", "--cached", "--name-only", "-z").Output()
+	if err != nil {
+		return fmt.Errorf("failed to list staged files: %v", err)
+	}
+
+	// Files without a rule use the repository's own identity, marked ""
+	required := map[string][]string{}
+	for _, file := range strings.Split(strings.TrimRight(string(out), "\x00"), "\x00") {
+		if file == "" {
+			continue
+		}
+		rule, _ := ruleFor(rules, file)
+		required[rule.Alias] = append(required[rule.Alias], file)
+	}
+	if len(required) > 1 {
+		aliases := make([]string, 0, len(required))
+		for alias := range required {
+			aliases = append(aliases, alias)
+		}
+		sort.Strings(aliases)
+		msg := "staged files need different identities, commit them separately:"
+		for _, alias := range aliases {
+			name := alias
+			if name == "" {
+				name = "(repository default)"
+			}
+			msg += fmt.Sprintf("\n  %s: %s", name, strings.Join(required[alias], ", "))
+		}
+		return fmt.Errorf("%s", msg)
+	}
+
+	for alias := range required {
+		if alias == "" {
+			return nil
+		}
+		named, ok := config.namedAlias(alias)
+		if !ok {
+			return fmt.Errorf("path rule uses unknown account '%s'", alias)
+		}
+		account, _ := config.account(named)
+		email := os.Getenv("GIT_AUTHOR_EMAIL")
+		if email == "" {
+			out, _ := execCommand("git", "config", "user.email").Output()
+			email = strings.TrimSpace(string(out))
+		}
+		if !strings.EqualFold(email, account.Email) {
+			return fmt.Errorf("staged files belong to account '%s' (%s) but the author is %s\nCommit with: ghs exec %s -- git commit", alias, account.Email, email, alias)
+		}
+	}
+	return nil
+}
+
+// runPathRuleCommand handles "path-rule add|remove|list|check"
+func runPathRuleCommand(config Config, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: ghs path-rule <add|remove> <alias> <path> | path-rule <list|check>")
+	}
+	repo, err := currentRepo()
+	if err != nil {
+		return err
+	}
+	if repo.Bare {
+		return fmt.Errorf("path rules need a repository with a worktree")
+	}
+
+	switch args[0] {
+	case "add", "remove":
+		if len(args) != 3 {
+			return fmt.Errorf("usage: ghs path-rule %s <alias> <path>", args[0])
+		}
+		alias, err := config.lookupAlias(args[1])
+		if err != nil {
+			return err
+		}
+		path, err := normalizeRulePath(repo, args[2])
+		if err != nil {
+			return err
+		}
+		value := alias + ":" + path
+		if args[0] == "remove" {
+			pattern := "^" + regexp.QuoteMeta(value) + "$"
+			if err := execCommand("git", "config", "--local", "--unset", pathRuleKey, pattern).Run(); err != nil {
+				return fmt.Errorf("no rule maps %s to account '%s'", path, alias)
+			}
+			fmt.Printf("Removed rule: %s -> %s\n", path, alias)
+			return nil
+		}
+		for _, rule := range readPathRules() {
+			if rule.Path == path {
+				return fmt.Errorf("%s already uses account '%s'", path, rule.Alias)
+			}
+		}
+		if err := execCommand("git", "config", "--local", "--add", pathRuleKey, value).Run(); err != nil {
+			return fmt.Errorf("failed to save rule: %v", err)
+		}
+		if err := installPathRuleHook(); err != nil {
+			return fmt.Errorf("failed to install pre-commit hook: %v", err)
+		}
+		fmt.Printf("Commits touching %s must use account '%s'\n", path, alias)
+		return nil
+	case "list":
+		rules := readPathRules()
+		if len(rules) == 0 {
+			fmt.Println("No path rules in this repository.")
+		}
+		for _, rule := range rules {
+			fmt.Printf("%-30s %s\n", rule.Path, rule.Alias)
+		}
+		return nil
+	case "check":
+		return checkPathRules(config)
+	default:
+		return fmt.Errorf("unknown path-rule subcommand: %s", args[0])
+	}
+}
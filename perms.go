@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// writePrivateFile writes a file only the user can read, whatever the umask
+// or the mode of the file it replaces
+func writePrivateFile(path string, data []byte) error {
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return err
+	}
+	return os.Chmod(path, 0600)
+}
+
+// writePrivateHook writes an executable script as 0700, whatever the umask
+// or the mode of the file it replaces
+func writePrivateHook(path string, data []byte) error {
+	if err := os.WriteFile(path, data, 0700); err != nil {
+		return err
+	}
+	return os.Chmod(path, 0700)
+}
+
+// mkdirPrivate creates dir and its missing parents as 0700, whatever the
+// umask. Directories that already exist, such as the user's home, keep
+// their mode.
+func mkdirPrivate(dir string) error {
+	var missing []string
+	for d := filepath.Clean(dir); ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil {
+			break
+		}
+		missing = append(missing, d)
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	for _, d := range missing {
+		if err := os.Chmod(d, 0700); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openPrivateAppend opens a file for appending. A file it creates is 0600
+// whatever the umask; an existing one keeps its mode.
+func openPrivateAppend(path string) (*os.File, error) {
+	_, statErr := os.Stat(path)
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if os.IsNotExist(statErr) {
+		if err := f.Chmod(0600); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return f, nil
+}
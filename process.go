@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// defaultCommandTimeout bounds external commands that should finish
+// quickly, such as gpg, ssh -T or git config
+const defaultCommandTimeout = 30 * time.Second
+
+var (
+	// commandTimeout is set from the config's command_timeout; 0 disables it
+	commandTimeout = defaultCommandTimeout
+	// interruptCtx is cancelled on Ctrl-C or SIGTERM, which kills the
+	// commands still running
+	interruptCtx, interrupt = context.WithCancel(context.Background())
+	// runningCommands and foregroundCommands count the external commands
+	// in flight
+	runningCommands, foregroundCommands atomic.Int32
+)
+
+// timeoutError reports the step that didn't finish in time
+type timeoutError struct {
+	Step    string
+	Timeout time.Duration
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("%s timed out after %s", e.Step, e.Timeout)
+}
+
+// tracedCmd is an exec.Cmd whose runs are traced and bounded by the
+// command timeout
+type tracedCmd struct {
+	*exec.Cmd
+	ctx     context.Context
+	cancel  context.CancelFunc
+	timeout time.Duration
+	// foreground commands share the terminal and handle Ctrl-C themselves
+	foreground bool
+	// secretOutput keeps the output of commands that print secrets, such as
+	// keyring lookups, out of the trace
+	secretOutput bool
+}
+
+// execCommand is exec.Command for commands that show up in the trace. The
+// command runs in its own process group, which is killed when the command
+// timeout passes or ghs is interrupted; a hung gpg takes its pinentry along.
+func execCommand(name string, args ...string) *tracedCmd {
+	return execWithTimeout(commandTimeout, name, args...)
+}
+
+// execBackground is execCommand without the timeout, for long transfers
+// whose output ghs collects, such as the clones of clone --from-file
+func execBackground(name string, args ...string) *tracedCmd {
+	return execWithTimeout(0, name, args...)
+}
+
+func execWithTimeout(timeout time.Duration, name string, args ...string) *tracedCmd {
+	ctx, cancel := interruptCtx, context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(interruptCtx, timeout)
+	}
+	cmd := exec.CommandContext(ctx, name, args...)
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error { return killProcessGroup(cmd) }
+	// Don't wait for children that keep the output open after a kill
+	cmd.WaitDelay = 2 * time.Second
+	return &tracedCmd{Cmd: cmd, ctx: ctx, cancel: cancel, timeout: timeout}
+}
+
+// execForeground is execCommand for commands the user watches or interacts
+// with, such as clones, pushes and ghs exec: they have no timeout and stay
+// in the terminal's process group, so they see Ctrl-C and can prompt
+func execForeground(name string, args ...string) *tracedCmd {
+	return &tracedCmd{Cmd: exec.CommandContext(interruptCtx, name, args...), ctx: interruptCtx, cancel: func() {}, foreground: true}
+}
+
+func (c *tracedCmd) Run() error {
+	start := time.Now()
+	err := c.run(c.Cmd.Run)
+	c.trace(start, err, nil)
+	return c.timedOut(err)
+}
+
+func (c *tracedCmd) Output() ([]byte, error) {
+	start := time.Now()
+	var out []byte
+	err := c.run(func() (err error) {
+		out, err = c.Cmd.Output()
+		return err
+	})
+	c.trace(start, err, out)
+	return out, c.timedOut(err)
+}
+
+func (c *tracedCmd) CombinedOutput() ([]byte, error) {
+	start := time.Now()
+	var out []byte
+	err := c.run(func() (err error) {
+		out, err = c.Cmd.CombinedOutput()
+		return err
+	})
+	c.trace(start, err, out)
+	return out, c.timedOut(err)
+}
+
+// run counts the command as running while it runs. Once ghs is
+// interrupted it doesn't return, the interrupt handler exits instead.
+func (c *tracedCmd) run(run func() error) error {
+	runningCommands.Add(1)
+	if c.foreground {
+		foregroundCommands.Add(1)
+	}
+	err := run()
+	if c.foreground {
+		foregroundCommands.Add(-1)
+	}
+	runningCommands.Add(-1)
+	c.cancel()
+	if interruptCtx.Err() != nil {
+		select {}
+	}
+	return err
+}
+
+// timedOut replaces the error of a command killed by the timeout with one
+// naming the step
+func (c *tracedCmd) timedOut(err error) error {
+	if err == nil || c.ctx.Err() != context.DeadlineExceeded {
+		return err
+	}
+	step := strings.Join(redactArgs(append([]string{filepath.Base(c.Path)}, c.Args[1:]...)), " ")
+	logger.Warn("command timed out", "cmd", step, "timeout", c.timeout.String())
+	return &timeoutError{Step: step, Timeout: c.timeout}
+}
+
+// handleInterrupts kills the running commands on Ctrl-C or SIGTERM and
+// exits. Ctrl-C while a foreground command runs is left to that command,
+// like a shell does.
+func handleInterrupts() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for sig := range signals {
+			if sig == os.Interrupt && foregroundCommands.Load() > 0 {
+				continue
+			}
+			logger.Info("interrupted", "signal", sig.String(), "running", runningCommands.Load())
+			interrupt()
+			for deadline := time.Now().Add(3 * time.Second); runningCommands.Load() > 0 && time.Now().Before(deadline); {
+				time.Sleep(10 * time.Millisecond)
+			}
+			os.Exit(130)
+		}
+	}()
+}
+
+// parseCommandTimeout parses the config's command_timeout
+func parseCommandTimeout(value string) (time.Duration, error) {
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout < 0 {
+		return 0, fmt.Errorf("invalid duration %q, expected a value such as 1m", value)
+	}
+	return timeout, nil
+}
+
+// setCommandTimeout applies the config's command_timeout
+func setCommandTimeout(config Config) error {
+	if config.CommandTimeout == "" {
+		return nil
+	}
+	timeout, err := parseCommandTimeout(config.CommandTimeout)
+	if err != nil {
+		return fmt.Errorf("command_timeout: %v", err)
+	}
+	commandTimeout = timeout
+	return nil
+}
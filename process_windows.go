@@ -0,0 +1,27 @@
+//go:build windows
+
+package main
+
+import (
+	"net"
+	"os/exec"
+)
+
+// setProcessGroup does nothing on Windows, where children aren't grouped
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills the command
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
+
+// fileOwner is unknown on Windows, which has no uids
+func fileOwner(path string) (int, bool) {
+	return 0, false
+}
+
+// listenPrivate listens on a unix socket, which Windows restricts by the
+// ACL of its directory
+func listenPrivate(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
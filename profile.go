@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// defaultProfile is the name of the profile stored in the top-level accounts
+const defaultProfile = "default"
+
+// Profile represents a named set of accounts, e.g. for a work laptop
+type Profile struct {
+	Accounts map[string]GitHubAccount `json:"accounts"`
+}
+
+// useProfile loads the accounts of the named profile into c.Accounts
+func (c *Config) useProfile(name string) error {
+	// Restore the top-level accounts before loading another profile
+	if c.profile != "" {
+		c.Profiles[c.profile] = Profile{Accounts: c.Accounts}
+		c.Accounts = c.defaultAccounts
+		c.profile = ""
+		c.defaultAccounts = nil
+	}
+
+	if name == "" || name == defaultProfile {
+		c.ActiveProfile = ""
+		return nil
+	}
+
+	profile, exists := c.Profiles[name]
+	if !exists {
+		return fmt.Errorf("profile '%s' not found", name)
+	}
+	if profile.Accounts == nil {
+		profile.Accounts = map[string]GitHubAccount{}
+	}
+
+	c.defaultAccounts = c.Accounts
+	c.Accounts = profile.Accounts
+	c.profile = name
+	c.ActiveProfile = name
+	return nil
+}
+
+// currentProfile returns the name of the active profile
+func (c *Config) currentProfile() string {
+	if c.profile == "" {
+		return defaultProfile
+	}
+	return c.profile
+}
+
+func listProfiles(config Config) {
+	names := []string{defaultProfile}
+	for name := range config.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names[1:])
+
+	fmt.Println("Available profiles:")
+	for _, name := range names {
+		marker := " "
+		if name == config.currentProfile() {
+			marker = "*"
+		}
+		count := len(config.Profiles[name].Accounts)
+		if name == config.currentProfile() {
+			count = len(config.Accounts)
+		} else if name == defaultProfile {
+			count = len(config.defaultAccounts)
+		}
+		fmt.Printf("%s %-15s (%d accounts)\n", marker, name, count)
+	}
+}
+
+func createProfile(config Config, name string) error {
+	if name == defaultProfile {
+		return fmt.Errorf("profile '%s' already exists", name)
+	}
+	if _, exists := config.Profiles[name]; exists {
+		return fmt.Errorf("profile '%s' already exists", name)
+	}
+	if config.Profiles == nil {
+		config.Profiles = map[string]Profile{}
+	}
+	config.Profiles[name] = Profile{Accounts: map[string]GitHubAccount{}}
+	if err := saveConfig(config); err != nil {
+		return err
+	}
+	fmt.Printf("Profile '%s' created. Activate it with: ghs profile use %s\n", name, name)
+	return nil
+}
+
+func switchProfile(config Config, name string) error {
+	if err := config.useProfile(name); err != nil {
+		return err
+	}
+	if err := saveConfig(config); err != nil {
+		return err
+	}
+
+	// The SSH config only holds the hosts of the active profile
+	if err := updateManagedFiles(config); err != nil {
+		fmt.Printf("Error: %v\n", err)
+	}
+
+	fmt.Printf("Switched to profile '%s' (%d accounts)\n", config.currentProfile(), len(config.Accounts))
+	return nil
+}
+
+// runProfileCommand handles the "profile" subcommands
+func runProfileCommand(config Config, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: ghs profile <create|use|list> [name]")
+	}
+
+	switch args[0] {
+	case "list":
+		listProfiles(config)
+		return nil
+	case "create", "use":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: ghs profile %s <name>", args[0])
+		}
+		if args[0] == "create" {
+			return createProfile(config, args[1])
+		}
+		return switchProfile(config, args[1])
+	default:
+		return fmt.Errorf("unknown profile subcommand: %s", args[0])
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// progressLogInterval is how often progress is logged when stderr is not a
+// terminal
+const progressLogInterval = 5 * time.Second
+
+// progress reports how far a bulk operation got. On a terminal it redraws a
+// bar with counts and an ETA on stderr; otherwise it logs a line every few
+// seconds so CI logs show the operation is alive. It is safe for concurrent
+// use by worker pools.
+type progress struct {
+	mu      sync.Mutex
+	label   string
+	total   int
+	done    int
+	start   time.Time
+	lastLog time.Time
+	tty     bool
+}
+
+func newProgress(label string, total int) *progress {
+	now := time.Now()
+	p := &progress{label: label, total: total, start: now, lastLog: now, tty: isTerminal(os.Stderr) && !plainOutput}
+	p.draw()
+	return p
+}
+
+// eta estimates the remaining time from the average time per item so far
+func (p *progress) eta() time.Duration {
+	if p.done == 0 {
+		return 0
+	}
+	perItem := time.Since(p.start) / time.Duration(p.done)
+	return (perItem * time.Duration(p.total-p.done)).Round(time.Second)
+}
+
+func (p *progress) draw() {
+	if !p.tty || p.total == 0 {
+		return
+	}
+	const width = 30
+	filled := width * p.done / p.total
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", width-filled)
+	eta := ""
+	if p.done > 0 && p.done < p.total {
+		eta = fmt.Sprintf(" ETA %s", p.eta())
+	}
+	fmt.Fprintf(os.Stderr, "\r\033[K%s [%s] %d/%d%s", p.label, bar, p.done, p.total, eta)
+}
+
+// step marks one item as done
+func (p *progress) step() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	if p.tty {
+		p.draw()
+		return
+	}
+	if time.Since(p.lastLog) >= progressLogInterval && p.done < p.total {
+		p.lastLog = time.Now()
+		fmt.Fprintf(os.Stderr, "%s: %d/%d done, about %s left\n", p.label, p.done, p.total, p.eta())
+	}
+}
+
+// finish removes the bar so the results can be printed
+func (p *progress) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.tty && p.total > 0 {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// nonInteractive disables every prompt. It is set by --non-interactive and
+// detected automatically when stdin is not a terminal or CI is set.
+var nonInteractive bool
+
+// errNonInteractive is returned when input is needed but prompting is disabled
+var errNonInteractive = errors.New("input required in non-interactive mode")
+
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// isTerminal reports whether f is attached to a terminal. Character devices
+// other than the null device are treated as terminals.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	if null, err := os.Stat(os.DevNull); err == nil && os.SameFile(info, null) {
+		return false
+	}
+	return true
+}
+
+// detectNonInteractive reports whether prompting should be disabled by default
+func detectNonInteractive() bool {
+	if ci := os.Getenv("CI"); ci != "" && ci != "false" && ci != "0" {
+		return true
+	}
+	return !isTerminal(os.Stdin)
+}
+
+// readLine reads one trimmed line from stdin
+func readLine() (string, error) {
+	line, err := stdinReader.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// prompt asks for a value and returns def when the answer is empty. In
+// non-interactive mode it never blocks: def is returned, or an error naming
+// the flag that supplies the value when there is no default.
+func prompt(label, def, flagName string) (string, error) {
+	if nonInteractive {
+		if def != "" {
+			return def, nil
+		}
+		return "", fmt.Errorf("%w: %s is missing (pass --%s)", errNonInteractive, label, flagName)
+	}
+
+	if def != "" {
+		fmt.Printf("Enter %s (default: %s): ", label, def)
+	} else {
+		fmt.Printf("Enter %s: ", label)
+	}
+	answer, err := readLine()
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %v", label, err)
+	}
+	if answer == "" {
+		return def, nil
+	}
+	return answer, nil
+}
+
+// confirm asks a yes/no question. In non-interactive mode it fails instead of
+// guessing, so callers should offer a flag that answers the question.
+func confirm(question string, def bool) (bool, error) {
+	if nonInteractive {
+		return false, fmt.Errorf("%w: cannot confirm %q", errNonInteractive, question)
+	}
+
+	choices := "[y/N]"
+	if def {
+		choices = "[Y/n]"
+	}
+	fmt.Printf("%s %s: ", question, choices)
+	answer, err := readLine()
+	if err != nil {
+		return false, fmt.Errorf("failed to read answer: %v", err)
+	}
+	switch strings.ToLower(answer) {
+	case "":
+		return def, nil
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
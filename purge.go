@@ -0,0 +1,216 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// githubKey is an SSH key registered on a GitHub account
+type githubKey struct {
+	ID    int64  `json:"id"`
+	Key   string `json:"key"`
+	Title string `json:"title"`
+}
+
+// deleteGitHubKey removes the account's public key from GitHub. The token
+// has to belong to the account, since keys can only be deleted by their
+// owner.
+func deleteGitHubKey(account GitHubAccount) error {
+	data, err := os.ReadFile(account.SSHKeyPath + ".pub")
+	if err != nil {
+		return fmt.Errorf("failed to read public key: %v", err)
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 2 {
+		return fmt.Errorf("%s.pub is not a public key", account.SSHKeyPath)
+	}
+	public := fields[0] + " " + fields[1]
+
+	token, err := ownerToken(account)
+	if err != nil {
+		return err
+	}
+	var keys []githubKey
+	if err := githubRequest("GET", "/user/keys", token, nil, &keys); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if key.Key == public {
+			return githubRequest("DELETE", fmt.Sprintf("/user/keys/%d", key.ID), token, nil, nil)
+		}
+	}
+	return fmt.Errorf("the key is not registered on GitHub")
+}
+
+// ownerToken returns the account's token after checking it belongs to the
+// account's GitHub user, which is needed to manage the user's keys
+func ownerToken(account GitHubAccount) (string, error) {
+	token, _, err := tokenFor(account, "", "")
+	if err != nil {
+		return "", err
+	}
+	var user struct {
+		Login string `json:"login"`
+	}
+	if err := githubRequest("GET", "/user", token, nil, &user); err != nil {
+		return "", err
+	}
+	if !strings.EqualFold(user.Login, account.Username) {
+		return "", fmt.Errorf("the GitHub token belongs to %s, not %s", user.Login, account.Username)
+	}
+	return token, nil
+}
+
+// keyShared reports whether another account uses the same key file
+func keyShared(config Config, alias, keyPath string) bool {
+	for other, account := range config.resolvedAccounts() {
+		if other != alias && account.SSHKeyPath == keyPath {
+			return true
+		}
+	}
+	return false
+}
+
+// purgeAccount removes an account together with everything ghs created for
+// it: the key pair on disk and on GitHub, owner rules, the git config
+// fragment and template, and its journal entries. Repositories under the
+// --scan directories that still use the account are listed at the end.
+func purgeAccount(config Config, args []string) (Config, error) {
+	flags := flag.NewFlagSet("purge", flag.ContinueOnError)
+	yes := flags.Bool("yes", false, "purge without asking")
+	keepKey := flags.Bool("keep-key", false, "keep the key pair on disk")
+	skipGitHub := flags.Bool("skip-github", false, "don't remove the key from GitHub")
+	var scanDirs stringList
+	flags.Var(&scanDirs, "scan", "list repositories under this directory that still use the account (repeatable)")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return config, err
+	}
+	if len(positional) != 1 {
+		return config, fmt.Errorf("usage: ghs purge <alias> [--scan <dir>] [--keep-key] [--skip-github] [--yes]")
+	}
+	alias, err := config.exactAlias(positional[0])
+	if err != nil {
+		return config, err
+	}
+	account := config.Accounts[alias]
+	account = config.Defaults.apply(account)
+
+	// Scan first, while the remotes still resolve to the account
+	var repos []string
+	for _, dir := range scanDirs {
+		found, err := findRepos(expandPath(dir))
+		if err != nil {
+			warnf("failed to scan %s: %v", dir, err)
+		}
+		repos = append(repos, found...)
+	}
+	results := make([]repoScan, len(repos))
+	bar := newProgress("Checking repositories", len(repos))
+	forEachParallel(len(repos), defaultJobs(), func(i int) {
+		results[i] = scanRepo(config, repos[i])
+		bar.step()
+	})
+	bar.finish()
+
+	shared := keyShared(config, alias, account.SSHKeyPath)
+	fmt.Printf("Purging account '%s' (%s):\n", alias, account.Username)
+	fmt.Println("  the account, its owner rules and mapped directories")
+	if !*skipGitHub {
+		fmt.Printf("  its key on GitHub (%s.pub)\n", account.SSHKeyPath)
+	}
+	if !*keepKey && !shared {
+		fmt.Printf("  %s and %s.pub\n", account.SSHKeyPath, account.SSHKeyPath)
+	}
+	fmt.Println("  its SSH config block, git config fragment, template and journal entries")
+	if account.KnownHosts {
+		fmt.Printf("  its known_hosts file (%s)\n", account.KnownHostsFile())
+	}
+	for _, scope := range sortedKeys(account.Tokens) {
+		if ref := account.Tokens[scope]; strings.HasPrefix(ref, tokenRefKeyring) {
+			fmt.Printf("  its token for %s in the keyring (%s)\n", scope, strings.TrimPrefix(ref, tokenRefKeyring))
+		}
+	}
+	if !*yes {
+		ok, err := confirm(fmt.Sprintf("Purge account '%s'?", alias), false)
+		if err != nil {
+			return config, fmt.Errorf("%v (pass --yes)", err)
+		}
+		if !ok {
+			return config, fmt.Errorf("aborted")
+		}
+	}
+
+	// The GitHub key goes first: without the local key there is nothing left
+	// to identify it by
+	if !*skipGitHub {
+		if err := deleteGitHubKey(account); err != nil {
+			warnf("key not removed from GitHub: %v", err)
+		} else {
+			fmt.Println("Removed the key from GitHub")
+		}
+	}
+
+	for _, ref := range account.Tokens {
+		deleteKeyringToken(ref)
+	}
+	// Rules may name the account by any of its names
+	var rules []OwnerRule
+	for _, rule := range config.OwnerRules {
+		if owner, _ := config.namedAlias(rule.Account); owner != alias {
+			rules = append(rules, rule)
+		}
+	}
+	config.OwnerRules = rules
+	delete(config.Accounts, alias)
+	if err := updateManagedFiles(config); err != nil {
+		fmt.Printf("Error: %v\n", err)
+	}
+	if err := os.RemoveAll(templateDir(alias)); err != nil {
+		warnf("%v", err)
+	}
+	if account.KnownHosts {
+		if err := os.Remove(account.KnownHostsFile()); err != nil && !os.IsNotExist(err) {
+			warnf("%v", err)
+		}
+	}
+
+	if shared {
+		fmt.Printf("Keeping %s, another account uses it\n", account.SSHKeyPath)
+	} else if !*keepKey {
+		for _, path := range []string{account.SSHKeyPath, account.SSHKeyPath + ".pub"} {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				warnf("%v", err)
+			}
+		}
+	}
+
+	if removed, err := forgetHistory(alias); err != nil {
+		warnf("failed to update %s: %v", filepath.Base(historyPath()), err)
+	} else if removed > 0 {
+		fmt.Printf("Removed %d journal entries\n", removed)
+	}
+
+	var leftovers []repoScan
+	for _, r := range results {
+		uses := strings.EqualFold(r.Email, account.Email)
+		for _, a := range r.Accounts {
+			uses = uses || a == alias
+		}
+		if r.Err == nil && uses {
+			leftovers = append(leftovers, r)
+		}
+	}
+	if len(leftovers) > 0 {
+		fmt.Printf("\nRepositories still referencing '%s':\n", alias)
+		for _, r := range leftovers {
+			fmt.Printf("  %-40s %s\n", r.Repo, r.Email)
+		}
+	}
+
+	fmt.Printf("Account '%s' purged.\n", alias)
+	return config, nil
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// reminderWindow is how long before an expiry reminders start
+const reminderWindow = 30 * 24 * time.Hour
+
+// reminderKinds are the credentials reminders are about, as named in items
+var reminderKinds = map[string]bool{"key-rotation": true, "signing-key": true, "ssh-certificate": true, "token": true}
+
+// reminder is a credential of an account that expires soon
+type reminder struct {
+	// Item is "<alias>:<kind>", the name used to snooze it
+	Item string
+	Text string
+	Due  time.Time
+}
+
+// reminderState records the day a reminder was last shown and the items
+// snoozed until some time
+type reminderState struct {
+	Shown   string               `json:"shown,omitempty"`
+	Snoozed map[string]time.Time `json:"snoozed,omitempty"`
+}
+
+// remindersPath returns the file the reminder state is kept in
+func remindersPath() string {
+	return filepath.Join(stateDir, "reminders.json")
+}
+
+// readReminderState reads the reminder state; a missing or broken file is
+// no state
+func readReminderState() reminderState {
+	state := reminderState{Snoozed: map[string]time.Time{}}
+	if data, err := os.ReadFile(remindersPath()); err == nil {
+		json.Unmarshal(data, &state)
+	}
+	if state.Snoozed == nil {
+		state.Snoozed = map[string]time.Time{}
+	}
+	return state
+}
+
+// writeReminderState stores the reminder state, dropping snoozes that are over
+func writeReminderState(state reminderState) error {
+	for item, until := range state.Snoozed {
+		if time.Now().After(until) {
+			delete(state.Snoozed, item)
+		}
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := mkdirPrivate(stateDir); err != nil {
+		return fmt.Errorf("failed to create %s: %v", stateDir, err)
+	}
+	return writePrivateFile(remindersPath(), data)
+}
+
+// snoozedUntil returns until when a reminder is snoozed, by its item or by
+// its whole account; zero when it isn't
+func (s reminderState) snoozedUntil(item string) time.Time {
+	alias := strings.SplitN(item, ":", 2)[0]
+	until := s.Snoozed[item]
+	if s.Snoozed[alias].After(until) {
+		until = s.Snoozed[alias]
+	}
+	if time.Now().After(until) {
+		return time.Time{}
+	}
+	return until
+}
+
+// expiryText describes a coming or past expiry
+func expiryText(name string, expires time.Time) string {
+	left := time.Until(expires)
+	if left < 0 {
+		return fmt.Sprintf("%s expired %s", name, sinceText(expires))
+	}
+	return fmt.Sprintf("%s expires %s", name, daysText(int(left.Hours()/24)))
+}
+
+// collectReminders returns what expires within reminderWindow, soonest
+// first: the expiries "ghs check" recorded and the accounts' key rotations.
+// Nothing is probed, so it is cheap enough to run before any command.
+func collectReminders(config Config) []reminder {
+	health := readHealth()
+	accounts := config.resolvedAccounts()
+	var reminders []reminder
+	for _, alias := range sortedAliases(accounts) {
+		for name, expires := range health[alias].Expires {
+			if time.Until(expires) < reminderWindow {
+				item := alias + ":" + strings.ReplaceAll(strings.ToLower(name), " ", "-")
+				reminders = append(reminders, reminder{item, alias + ": " + expiryText(name, expires), expires})
+			}
+		}
+		if due, ok := keyRotationDue(accounts[alias]); ok && time.Until(due) < reminderWindow {
+			reminders = append(reminders, reminder{alias + ":key-rotation", alias + ": key rotation " + rotationText(due), due})
+		}
+	}
+	sort.SliceStable(reminders, func(i, j int) bool {
+		return reminders[i].Due.Before(reminders[j].Due)
+	})
+	return reminders
+}
+
+// printDailyReminder prints the reminders that aren't snoozed as a single
+// line on stderr, at most once a day
+func printDailyReminder(config Config) {
+	state := readReminderState()
+	today := time.Now().Format(keyDateFormat)
+	if state.Shown == today {
+		return
+	}
+	var texts []string
+	for _, r := range collectReminders(config) {
+		if state.snoozedUntil(r.Item).IsZero() {
+			texts = append(texts, r.Text)
+		}
+	}
+	if len(texts) == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Reminder: %s (ghs remind to snooze)\n", strings.Join(texts, "; "))
+	state.Shown = today
+	if err := writeReminderState(state); err != nil {
+		logger.Debug("failed to record the reminder", "error", err)
+	}
+}
+
+// listReminders prints every current reminder with its item name
+func listReminders(config Config) {
+	reminders := collectReminders(config)
+	if len(reminders) == 0 {
+		fmt.Println("Nothing expires in the next 30 days.")
+		return
+	}
+	state := readReminderState()
+	for _, r := range reminders {
+		line := fmt.Sprintf("  %-28s %s", r.Item, r.Text)
+		if until := state.snoozedUntil(r.Item); !until.IsZero() {
+			line += " (snoozed until " + until.Format("2006-01-02 15:04") + ")"
+		}
+		fmt.Println(line)
+	}
+	fmt.Println("\nPostpone one with: ghs remind snooze <item> <duration>")
+}
+
+// reminderItem checks that an item names an account, or an account and a
+// kind of reminder, and returns it with the account's alias
+func reminderItem(config Config, item string) (string, error) {
+	parts := strings.SplitN(item, ":", 2)
+	alias, err := config.lookupAlias(parts[0])
+	if err != nil {
+		return "", err
+	}
+	if len(parts) == 1 {
+		return alias, nil
+	}
+	if !reminderKinds[parts[1]] {
+		return "", fmt.Errorf("unknown reminder %q (use key-rotation, signing-key, ssh-certificate or token)", parts[1])
+	}
+	return alias + ":" + parts[1], nil
+}
+
+// runRemindCommand handles "remind [list]", "remind snooze <item> <duration>"
+// and "remind unsnooze <item>"
+func runRemindCommand(config Config, args []string) error {
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+	state := readReminderState()
+	switch args[0] {
+	case "list":
+		listReminders(config)
+		return nil
+	case "snooze":
+		if len(args) != 3 {
+			return fmt.Errorf("usage: ghs remind snooze <alias[:kind]> <duration>")
+		}
+		item, err := reminderItem(config, args[1])
+		if err != nil {
+			return err
+		}
+		d, err := parseSince(args[2])
+		if err != nil {
+			return err
+		}
+		until := time.Now().Add(d)
+		state.Snoozed[item] = until
+		if err := writeReminderState(state); err != nil {
+			return err
+		}
+		fmt.Printf("Snoozed %s until %s\n", item, until.Format("2006-01-02 15:04"))
+		return nil
+	case "unsnooze":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: ghs remind unsnooze <alias[:kind]>")
+		}
+		// Snoozes of removed accounts can still be lifted by their item
+		item := args[1]
+		if _, snoozed := state.Snoozed[item]; !snoozed {
+			if named, err := reminderItem(config, item); err == nil {
+				item = named
+			}
+		}
+		if _, snoozed := state.Snoozed[item]; !snoozed {
+			return fmt.Errorf("%s isn't snoozed", args[1])
+		}
+		delete(state.Snoozed, item)
+		if err := writeReminderState(state); err != nil {
+			return err
+		}
+		fmt.Printf("%s reminds again\n", item)
+		return nil
+	default:
+		return fmt.Errorf("unknown remind subcommand: %s", args[0])
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// Remote URL forms accepted by "remote convert --to"
+const (
+	remoteSSH   = "ssh"
+	remoteHTTPS = "https"
+)
+
+// urlChange is a remote URL rewritten by convertRemote
+type urlChange struct {
+	Remote string
+	Key    string
+	From   string
+	To     string
+}
+
+// convertURL rewrites a GitHub URL into the requested form. The SSH form goes
+// through the account's host alias; URLs of other hosts are returned as is.
+func convertURL(config Config, url, alias, to string) (string, error) {
+	host, owner, repo, ok := parseRemoteURL(url)
+	if !ok || (host != "github.com" && !strings.HasPrefix(host, "github.com-")) {
+		return url, nil
+	}
+	if to == remoteHTTPS {
+		return fmt.Sprintf("https://github.com/%s/%s.git", owner, repo), nil
+	}
+	if alias == "" {
+		alias = matchRemoteAccount(config, host, owner)
+	}
+	if alias == "" {
+		return "", fmt.Errorf("no account matches %s, use --account to choose one", url)
+	}
+	_, account, err := config.lookupAccount(alias)
+	if err != nil {
+		return "", err
+	}
+	return sshRemoteURL(account, owner, repo), nil
+}
+
+// gitConfigValues returns every value of a multi-valued key in the repository
+// at dir
+func gitConfigValues(dir, key string) []string {
+	out, err := execCommand("git", "-C", dir, "config", "--get-all", key).Output()
+	if err != nil {
+		return nil
+	}
+	return strings.Split(strings.TrimSpace(string(out)), "\n")
+}
+
+// convertRemote rewrites the fetch and push URLs of a remote of the
+// repository at dir. Fetch and push URLs are converted separately so
+// repositories that push elsewhere than they fetch keep doing so.
+func convertRemote(config Config, dir, remote, alias, to string, dryRun bool) ([]urlChange, error) {
+	urls := gitConfigValues(dir, "remote."+remote+".url")
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("remote '%s' not found", remote)
+	}
+
+	var changes []urlChange
+	for _, key := range []string{"url", "pushurl"} {
+		fullKey := "remote." + remote + "." + key
+		values := gitConfigValues(dir, fullKey)
+		converted := make([]string, len(values))
+		changed := false
+		for i, value := range values {
+			newValue, err := convertURL(config, value, alias, to)
+			if err != nil {
+				return nil, err
+			}
+			converted[i] = newValue
+			if newValue != value {
+				changed = true
+				changes = append(changes, urlChange{Remote: remote, Key: key, From: value, To: newValue})
+			}
+		}
+		if !changed || dryRun {
+			continue
+		}
+
+		// Rewrite all values to keep their order
+		if err := execCommand("git", "-C", dir, "config", "--unset-all", fullKey).Run(); err != nil {
+			return nil, fmt.Errorf("failed to update %s: %v", fullKey, err)
+		}
+		for _, value := range converted {
+			if err := execCommand("git", "-C", dir, "config", "--add", fullKey, value).Run(); err != nil {
+				return nil, fmt.Errorf("failed to update %s: %v", fullKey, err)
+			}
+		}
+	}
+	return changes, nil
+}
+
+// remoteConvert handles "remote convert [remote]"
+func remoteConvert(config Config, args []string) error {
+	flags := flag.NewFlagSet("remote convert", flag.ContinueOnError)
+	alias := flags.String("account", "", "account whose SSH host to use (default: matched from the URL)")
+	to := flags.String("to", remoteSSH, "target form: ssh or https")
+	dryRun := flags.Bool("dry-run", false, "show the new URLs without changing them")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 1 || (*to != remoteSSH && *to != remoteHTTPS) {
+		return fmt.Errorf("usage: ghs remote convert [remote] [--account <alias>] [--to ssh|https] [--dry-run]")
+	}
+	remote := "origin"
+	if len(positional) == 1 {
+		remote = positional[0]
+	}
+
+	changes, err := convertRemote(config, ".", remote, *alias, *to, *dryRun)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		fmt.Printf("Remote '%s' already uses the %s form\n", remote, *to)
+		return nil
+	}
+	for _, c := range changes {
+		fmt.Printf("%s %s: %s -> %s\n", c.Remote, c.Key, c.From, c.To)
+	}
+	if *dryRun {
+		fmt.Println("Dry run, no changes made")
+	}
+	return nil
+}
+
+// runRemoteCommand handles the "remote" subcommands
+func runRemoteCommand(config Config, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: ghs remote <convert|rewrite> [args]")
+	}
+	switch args[0] {
+	case "convert":
+		return remoteConvert(config, args[1:])
+	case "rewrite":
+		return remoteRewrite(config, args[1:])
+	default:
+		return fmt.Errorf("unknown remote subcommand: %s", args[0])
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// repoRewrite is the outcome of rewriting the remotes of one repository
+type repoRewrite struct {
+	Repo      string
+	Changes   []urlChange
+	Unmatched []string
+	Err       error
+}
+
+// parseAccountMap parses owner=alias rules
+func parseAccountMap(config Config, entries []string) (map[string]string, error) {
+	rules := map[string]string{}
+	for _, entry := range entries {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid --account-map %q, expected owner=alias", entry)
+		}
+		alias, err := config.lookupAlias(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		rules[strings.ToLower(parts[0])] = alias
+	}
+	return rules, nil
+}
+
+// rewriteRepoRemotes converts every GitHub remote of a repository, choosing
+// the account from the owner rules before falling back to username matching
+func rewriteRepoRemotes(config Config, repo string, rules map[string]string, to string, dryRun bool) repoRewrite {
+	result := repoRewrite{Repo: repo}
+	out, err := execCommand("git", "-C", repo, "remote").Output()
+	if err != nil {
+		result.Err = fmt.Errorf("failed to list remotes: %v", err)
+		return result
+	}
+
+	for _, remote := range strings.Fields(string(out)) {
+		urls := gitConfigValues(repo, "remote."+remote+".url")
+		if len(urls) == 0 {
+			continue
+		}
+		host, owner, _, ok := parseRemoteURL(urls[0])
+		if !ok || (host != "github.com" && !strings.HasPrefix(host, "github.com-")) {
+			continue
+		}
+		alias := rules[strings.ToLower(owner)]
+		if alias == "" && to == remoteSSH && matchRemoteAccount(config, host, owner) == "" {
+			result.Unmatched = append(result.Unmatched, remote)
+			continue
+		}
+		changes, err := convertRemote(config, repo, remote, alias, to, dryRun)
+		if err != nil {
+			result.Err = fmt.Errorf("%s: %v", remote, err)
+			return result
+		}
+		result.Changes = append(result.Changes, changes...)
+	}
+	return result
+}
+
+// remoteRewrite handles "remote rewrite <dir>": it scans dir for
+// repositories and converts their remotes in parallel
+func remoteRewrite(config Config, args []string) error {
+	flags := flag.NewFlagSet("remote rewrite", flag.ContinueOnError)
+	var accountMap stringList
+	flags.Var(&accountMap, "account-map", "use an account for every repository of an owner, as owner=alias (repeatable)")
+	to := flags.String("to", remoteSSH, "target form: ssh or https")
+	dryRun := flags.Bool("dry-run", false, "show the changes without making them")
+	jobs := flags.Int("jobs", defaultJobs(), "number of repositories processed in parallel")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 || (*to != remoteSSH && *to != remoteHTTPS) || *jobs < 1 {
+		return fmt.Errorf("usage: ghs remote rewrite <dir> [--account-map owner=alias]... [--to ssh|https] [--dry-run] [--jobs n]")
+	}
+	rules, err := parseAccountMap(config, accountMap)
+	if err != nil {
+		return err
+	}
+
+	repos, err := findRepos(expandPath(positional[0]))
+	if err != nil {
+		return fmt.Errorf("failed to scan %s: %v", positional[0], err)
+	}
+
+	results := make([]repoRewrite, len(repos))
+	bar := newProgress("Rewriting remotes", len(repos))
+	forEachParallel(len(repos), *jobs, func(i int) {
+		results[i] = rewriteRepoRemotes(config, repos[i], rules, *to, *dryRun)
+		bar.step()
+	})
+	bar.finish()
+
+	changedRepos, changedURLs, unmatched, failed := 0, 0, 0, 0
+	for _, r := range results {
+		if len(r.Changes) == 0 && len(r.Unmatched) == 0 && r.Err == nil {
+			continue
+		}
+		fmt.Println(r.Repo)
+		for _, c := range r.Changes {
+			fmt.Printf("  %s %s\n  - %s\n  + %s\n", c.Remote, c.Key, c.From, c.To)
+		}
+		for _, remote := range r.Unmatched {
+			fmt.Printf("  %s: no matching account, skipped\n", remote)
+		}
+		if r.Err != nil {
+			fmt.Printf("  Error: %v\n", r.Err)
+			failed++
+		}
+		if len(r.Changes) > 0 {
+			changedRepos++
+			changedURLs += len(r.Changes)
+		}
+		unmatched += len(r.Unmatched)
+	}
+
+	verb := "Rewrote"
+	if *dryRun {
+		verb = "Would rewrite"
+	}
+	fmt.Printf("\n%s %d URL(s) in %d of %d repositories", verb, changedURLs, changedRepos, len(repos))
+	if unmatched > 0 {
+		fmt.Printf(", %d remote(s) without a matching account", unmatched)
+	}
+	fmt.Println()
+	if failed > 0 {
+		return fmt.Errorf("%d repositories failed", failed)
+	}
+	return nil
+}
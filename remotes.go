@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// remoteInfo describes a git remote and the account it maps to, if any
+type remoteInfo struct {
+	Name  string
+	URL   string
+	Host  string
+	Owner string
+	Repo  string
+	Alias string
+}
+
+// parseRemoteURL splits a git remote URL into host, owner and repository.
+// It understands scp-like SSH (git@host:owner/repo), ssh:// and https:// URLs.
+func parseRemoteURL(url string) (host, owner, repo string, ok bool) {
+	var path string
+	if i := strings.Index(url, "://"); i >= 0 {
+		rest := url[i+3:]
+		slash := strings.Index(rest, "/")
+		if slash < 0 {
+			return "", "", "", false
+		}
+		host, path = rest[:slash], rest[slash+1:]
+	} else if colon := strings.Index(url, ":"); colon >= 0 {
+		host, path = url[:colon], url[colon+1:]
+	} else {
+		return "", "", "", false
+	}
+	if at := strings.LastIndex(host, "@"); at >= 0 {
+		host = host[at+1:]
+	}
+	if colon := strings.Index(host, ":"); colon >= 0 {
+		host = host[:colon]
+	}
+
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", "", false
+	}
+	return host, parts[0], strings.TrimSuffix(parts[1], ".git"), true
+}
+
+// matchRemoteAccount finds the account a remote belongs to: an SSH host
+// alias github.com-<username> names the account directly, otherwise the
+// repository owner is resolved through the owner rules and usernames
+func matchRemoteAccount(config Config, host, owner string) string {
+	if strings.HasPrefix(host, "github.com-") {
+		username := strings.TrimPrefix(host, "github.com-")
+		for _, alias := range sortedAliases(config.Accounts) {
+			if strings.EqualFold(config.Accounts[alias].Username, username) {
+				return alias
+			}
+		}
+		return ""
+	}
+	if host == "github.com" {
+		return resolveOwner(config, owner)
+	}
+	return ""
+}
+
+// repoRemotes lists every remote of the current repository with the account
+// it maps to
+func repoRemotes(config Config) ([]remoteInfo, error) {
+	return repoRemotesIn(config, ".")
+}
+
+// repoRemotesIn lists the remotes of the repository at dir
+func repoRemotesIn(config Config, dir string) ([]remoteInfo, error) {
+	out, err := execCommand("git", "-C", dir, "config", "--get-regexp", `^remote\..*\.url$`).Output()
+	if err != nil {
+		// Exit status 1 means the repository has no remotes
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list remotes: %v", err)
+	}
+
+	var remotes []remoteInfo
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		parts := strings.SplitN(line, " ", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		r := remoteInfo{
+			Name: strings.TrimSuffix(strings.TrimPrefix(parts[0], "remote."), ".url"),
+			URL:  parts[1],
+		}
+		if host, owner, repo, ok := parseRemoteURL(r.URL); ok {
+			r.Host, r.Owner, r.Repo = host, owner, repo
+			r.Alias = matchRemoteAccount(config, host, owner)
+		}
+		remotes = append(remotes, r)
+	}
+	sort.SliceStable(remotes, func(i, j int) bool {
+		// origin first, the rest by name
+		if (remotes[i].Name == "origin") != (remotes[j].Name == "origin") {
+			return remotes[i].Name == "origin"
+		}
+		return remotes[i].Name < remotes[j].Name
+	})
+	return remotes, nil
+}
+
+// remoteAccounts returns the distinct accounts the remotes map to
+func remoteAccounts(remotes []remoteInfo) []string {
+	seen := map[string]bool{}
+	var aliases []string
+	for _, r := range remotes {
+		if r.Alias != "" && !seen[r.Alias] {
+			seen[r.Alias] = true
+			aliases = append(aliases, r.Alias)
+		}
+	}
+	return aliases
+}
+
+// describeRemoteAccounts renders "origin → alias" pairs for messages
+func describeRemoteAccounts(remotes []remoteInfo) string {
+	var pairs []string
+	for _, r := range remotes {
+		if r.Alias != "" {
+			pairs = append(pairs, fmt.Sprintf("%s → %s", r.Name, r.Alias))
+		}
+	}
+	return strings.Join(pairs, ", ")
+}
+
+// remoteVia describes how a remote reaches GitHub and so which credentials
+// it uses
+func remoteVia(config Config, r remoteInfo) string {
+	switch {
+	case strings.HasPrefix(r.Host, "github.com-"):
+		return "ssh host alias " + r.Host
+	case r.Host != "github.com":
+		return ""
+	case strings.HasPrefix(r.URL, "https://"):
+		return "https, token from the credential helper"
+	case config.DefaultHost == defaultHostNone:
+		return "plain github.com, which offers no key"
+	case config.DefaultHost != "":
+		return "plain github.com with the key of '" + config.DefaultHost + "'"
+	}
+	return "plain github.com, whichever agent key GitHub knows first"
+}
+
+// printRemotes shows every remote with its account and warns when the
+// remotes imply different identities or none of them matches email
+func printRemotes(config Config, remotes []remoteInfo, email string) {
+	if len(remotes) == 0 {
+		return
+	}
+	fmt.Println("Remotes:")
+	for _, r := range remotes {
+		account := "no matching account"
+		if r.Alias != "" {
+			account = "account '" + r.Alias + "'"
+		} else if r.Host == "" {
+			account = "not a GitHub URL"
+		}
+		fmt.Printf("  %-10s %s (%s)\n", r.Name, r.URL, account)
+		if via := remoteVia(config, r); via != "" {
+			fmt.Printf("  %-10s via %s\n", "", via)
+		}
+	}
+
+	aliases := remoteAccounts(remotes)
+	if len(aliases) > 1 {
+		warnf("remotes belong to different accounts (%s); check which identity you commit with", describeRemoteAccounts(remotes))
+	}
+	if email == "" || len(aliases) == 0 {
+		return
+	}
+	for _, alias := range aliases {
+		if account, _ := config.account(alias); strings.EqualFold(account.Email, email) {
+			if len(aliases) == 1 {
+				fmt.Printf("Identity and remotes match account '%s'\n", alias)
+			}
+			return
+		}
+	}
+	warnf("user.email %s doesn't belong to any account of the remotes (%s)", email, strings.Join(aliases, ", "))
+}
+
+// autoAccount picks the account implied by the remotes of the current
+// repository, failing when the remotes disagree
+func autoAccount(config Config) (string, error) {
+	remotes, err := repoRemotes(config)
+	if err != nil {
+		return "", err
+	}
+	aliases := remoteAccounts(remotes)
+	switch len(aliases) {
+	case 0:
+		return "", fmt.Errorf("no remote of this repository belongs to a configured account")
+	case 1:
+		return aliases[0], nil
+	}
+	return "", fmt.Errorf("remotes belong to different accounts (%s), run 'ghs switch <alias>' to choose", describeRemoteAccounts(remotes))
+}
+
+// warnRemoteMismatch warns when switching to alias while some remotes
+// belong to other accounts
+func warnRemoteMismatch(config Config, alias string) {
+	remotes, err := repoRemotes(config)
+	if err != nil {
+		return
+	}
+	var others []string
+	for _, r := range remotes {
+		if r.Alias != "" && r.Alias != alias {
+			others = append(others, fmt.Sprintf("%s → %s", r.Name, r.Alias))
+		}
+	}
+	if len(others) > 0 {
+		warnf("some remotes belong to other accounts (%s)", strings.Join(others, ", "))
+	}
+}
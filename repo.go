@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// repoInfo describes the git repository containing the current directory
+type repoInfo struct {
+	GitDir    string // git directory of the current worktree
+	CommonDir string // git directory shared by all worktrees
+	Root      string // top-level directory of the worktree, empty when bare
+	Worktree  bool   // a linked worktree created by "git worktree add"
+	Submodule bool
+	Bare      bool // a repository without a worktree, such as a mirror
+}
+
+// currentRepo detects the repository of the current directory. Unlike
+// checking for a .git directory it works in subdirectories, linked worktrees
+// and submodules, whose .git is a file pointing elsewhere, and in bare
+// repositories, which have no .git at all.
+func currentRepo() (repoInfo, error) {
+	out, err := execCommand("git", "rev-parse", "--path-format=absolute", "--git-dir", "--git-common-dir").Output()
+	if err != nil {
+		return repoInfo{}, fmt.Errorf("current directory is not a git repository")
+	}
+	dirs := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(dirs) != 2 {
+		return repoInfo{}, fmt.Errorf("unexpected output from git rev-parse: %q", out)
+	}
+	repo := repoInfo{GitDir: dirs[0], CommonDir: dirs[1]}
+	repo.Worktree = repo.GitDir != repo.CommonDir
+
+	if out, err := execCommand("git", "rev-parse", "--is-bare-repository").Output(); err == nil {
+		repo.Bare = strings.TrimSpace(string(out)) == "true"
+	}
+	if repo.Bare {
+		return repo, nil
+	}
+	if out, err := execCommand("git", "rev-parse", "--show-toplevel").Output(); err == nil {
+		repo.Root = strings.TrimSpace(string(out))
+	}
+	if out, err := execCommand("git", "rev-parse", "--show-superproject-working-tree").Output(); err == nil {
+		repo.Submodule = strings.TrimSpace(string(out)) != ""
+	}
+	return repo, nil
+}
+
+// gitConfigScope selects where repository settings are written: "--local"
+// shares them with every worktree, "--worktree" limits them to the current one
+var gitConfigScope = "--local"
+
+// gitConfig returns a git config command in the current scope
+func gitConfig(args ...string) *tracedCmd {
+	return execCommand("git", append([]string{"config", gitConfigScope}, args...)...)
+}
+
+// useWorktreeScope makes later settings apply to the current worktree only.
+// Per-worktree config needs the worktreeConfig extension, which is enabled
+// for the whole repository.
+func useWorktreeScope(repo repoInfo) error {
+	if !repo.Worktree {
+		return fmt.Errorf("--worktree needs a linked worktree (see git worktree add)")
+	}
+	if err := execCommand("git", "config", "--local", "extensions.worktreeConfig", "true").Run(); err != nil {
+		return fmt.Errorf("failed to enable extensions.worktreeConfig: %v", err)
+	}
+	gitConfigScope = "--worktree"
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+)
+
+// RetrySettings control how often network operations are retried
+type RetrySettings struct {
+	// Attempts counts the first try; 1 disables retries
+	Attempts int `json:"attempts,omitempty"`
+	// Delay before the second attempt, doubled for every further one
+	Delay string `json:"delay,omitempty"`
+}
+
+// Retry defaults and the upper bound of a single wait
+const (
+	defaultRetryAttempts = 3
+	defaultRetryDelay    = time.Second
+	maxRetryDelay        = 30 * time.Second
+)
+
+var (
+	retryAttempts = defaultRetryAttempts
+	retryDelay    = defaultRetryDelay
+)
+
+// retryProblems checks the config's retries block
+func retryProblems(r *RetrySettings) []fieldProblem {
+	if r == nil {
+		return nil
+	}
+	var problems []fieldProblem
+	if r.Attempts < 0 {
+		problems = append(problems, fieldProblem{"retries.attempts", "must be at least 1"})
+	}
+	if r.Delay != "" {
+		if d, err := time.ParseDuration(r.Delay); err != nil || d < 0 {
+			problems = append(problems, fieldProblem{"retries.delay", fmt.Sprintf("invalid duration %q, expected a value such as 2s", r.Delay)})
+		}
+	}
+	return problems
+}
+
+// setRetryPolicy applies the config's retries block
+func setRetryPolicy(config Config) error {
+	if problems := retryProblems(config.Retries); len(problems) > 0 {
+		return fmt.Errorf("%s: %s", problems[0].Field, problems[0].Msg)
+	}
+	if config.Retries == nil {
+		return nil
+	}
+	if config.Retries.Attempts > 0 {
+		retryAttempts = config.Retries.Attempts
+	}
+	if config.Retries.Delay != "" {
+		retryDelay, _ = time.ParseDuration(config.Retries.Delay)
+	}
+	return nil
+}
+
+// backoff returns the wait before the given attempt, counted from 1
+func backoff(attempt int) time.Duration {
+	wait := retryDelay
+	for i := 2; i < attempt && wait < maxRetryDelay; i++ {
+		wait *= 2
+	}
+	if wait > maxRetryDelay {
+		wait = maxRetryDelay
+	}
+	return wait
+}
+
+// waitForRetry announces and waits for the next attempt after a failure. It
+// returns false when no attempts are left.
+func waitForRetry(what string, attempt int, err error) bool {
+	if attempt >= retryAttempts {
+		return false
+	}
+	wait := backoff(attempt + 1)
+	fmt.Fprintf(os.Stderr, "%s failed (%v), attempt %d/%d in %s...\n", what, err, attempt+1, retryAttempts, wait)
+	logger.Warn("retrying", "operation", what, "attempt", attempt+1, "error", err.Error())
+	time.Sleep(wait)
+	return true
+}
+
+// transientGitError matches git output of network failures worth retrying,
+// as opposed to authentication or missing repositories
+var transientGitError = regexp.MustCompile(`(?i)could not resolve host|temporary failure in name resolution|connection timed out|operation timed out|connection reset|early EOF|RPC failed|remote end hung up unexpectedly|gnutls_handshake|TLS connection|SSL_ERROR|unexpected disconnect`)
+
+// runGitRetrying runs a git network operation, showing its output, and
+// retries it after transient network failures. It returns the error output
+// of the last attempt.
+func runGitRetrying(what string, args ...string) (*bytes.Buffer, error) {
+	for attempt := 1; ; attempt++ {
+		cmd := execForeground("git", args...)
+		cmd.Stdout = os.Stdout
+		var stderr *bytes.Buffer
+		cmd.Stderr, stderr = teeStderr()
+		err := cmd.Run()
+		if err == nil || !transientGitError.Match(stderr.Bytes()) || !waitForRetry(what, attempt, err) {
+			return stderr, err
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// allowRoot lets commands change files while running as root for another
+// user, set by --allow-root
+var allowRoot bool
+
+// readOnlyCommands don't write the config, the SSH config or git config, so
+// they are safe under sudo. Commands that write only with some subcommands
+// or flags are left to readOnly.
+var readOnlyCommands = map[string]bool{
+	"list": true, "current": true, "status": true, "which": true, "resolve": true,
+	"verify": true, "scan": true, "check": true, "doctor": true,
+	"stats": true, "help": true, "env": true, "exec": true,
+	"config": true, "export": true,
+}
+
+// readOnly reports whether a command line writes no files
+func readOnly(args []string) bool {
+	switch args[0] {
+	case "credential":
+		// git calls get, store and erase; setup and remove edit the git config
+		return len(args) > 1 && (args[1] == "get" || args[1] == "store" || args[1] == "erase" || args[1] == "status")
+	case "test":
+		// --fix rewrites the SSH config
+		return !hasFlag(args[1:], "fix")
+	}
+	return readOnlyCommands[args[0]]
+}
+
+// rootMismatch explains why running as root would write to the wrong place,
+// or returns "" when ghs doesn't run as root for someone else: under sudo
+// the config and SSH config are either root's instead of the user's, or the
+// user's but left owned by root
+func rootMismatch() string {
+	if os.Geteuid() != 0 {
+		return ""
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	owner, known := fileOwner(home)
+	user := os.Getenv("SUDO_USER")
+	switch {
+	case user != "" && user != "root" && known && owner != 0:
+		return fmt.Sprintf("running as root through sudo with %s's HOME %s; files ghs writes there would be owned by root", user, home)
+	case user != "" && user != "root":
+		return fmt.Sprintf("running as root through sudo for %s; ghs would use root's config and SSH config in %s, not %s's", user, home, user)
+	case known && owner != 0:
+		return fmt.Sprintf("running as root with HOME %s owned by uid %d; files ghs writes there would be owned by root", home, owner)
+	}
+	return ""
+}
+
+// checkRoot warns when ghs runs as root for another user and refuses
+// command lines that write files unless --allow-root is given
+func checkRoot(args []string) error {
+	problem := rootMismatch()
+	if problem == "" {
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "WARNING: %s\n", problem)
+	if readOnly(args) || allowRoot {
+		return nil
+	}
+	return fmt.Errorf("refusing to run %s as root; run ghs as yourself without sudo, or pass --allow-root if this is intended", strings.Join(args[:min(len(args), 2)], " "))
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// scanSkipDirs are directory names never descended into while scanning
+var scanSkipDirs = map[string]bool{
+	"node_modules": true,
+	"vendor":       true,
+	".cache":       true,
+}
+
+// findRepos returns the sorted paths of git repositories below root,
+// including bare ones. Nested repositories inside a found repository's
+// worktree are not reported. The directories directly below root are walked
+// in parallel.
+func findRepos(root string) ([]string, error) {
+	if isRepoDir(root) {
+		return []string{root}, nil
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	var dirs []string
+	for _, entry := range entries {
+		if entry.IsDir() && !scanSkipDirs[entry.Name()] {
+			dirs = append(dirs, filepath.Join(root, entry.Name()))
+		}
+	}
+
+	found := make([][]string, len(dirs))
+	forEachParallel(len(dirs), defaultJobs(), func(i int) {
+		found[i] = walkRepos(dirs[i])
+	})
+	var repos []string
+	for _, f := range found {
+		repos = append(repos, f...)
+	}
+	sort.Strings(repos)
+	return repos, nil
+}
+
+// walkRepos finds repositories below dir in a single goroutine
+func walkRepos(dir string) []string {
+	var repos []string
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Unreadable directories are skipped, not fatal
+			if d != nil && d.IsDir() && path != dir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != dir && scanSkipDirs[d.Name()] {
+			return filepath.SkipDir
+		}
+		if isRepoDir(path) {
+			repos = append(repos, path)
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return repos
+}
+
+// isRepoDir reports whether dir is a repository with a worktree or a bare one
+func isRepoDir(dir string) bool {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+		return true
+	}
+	return isBareRepo(dir)
+}
+
+// isBareRepo reports whether dir looks like a bare repository: a HEAD file
+// next to objects and refs directories
+func isBareRepo(dir string) bool {
+	if info, err := os.Stat(filepath.Join(dir, "HEAD")); err != nil || info.IsDir() {
+		return false
+	}
+	for _, sub := range []string{"objects", "refs"} {
+		if info, err := os.Stat(filepath.Join(dir, sub)); err != nil || !info.IsDir() {
+			return false
+		}
+	}
+	return true
+}
+
+// repoScan is the identity state of one repository found by scan
+type repoScan struct {
+	Repo     string
+	Accounts []string
+	Email    string
+	Status   string
+	Err      error
+}
+
+// Scan statuses
+const (
+	scanOK        = "ok"
+	scanMismatch  = "mismatch"
+	scanUnmanaged = "unmanaged"
+)
+
+// scanRepo compares the identity configured in a repository with the
+// accounts its remotes belong to
+func scanRepo(config Config, repo string) repoScan {
+	result := repoScan{Repo: repo, Status: scanUnmanaged}
+	remotes, err := repoRemotesIn(config, repo)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.Accounts = remoteAccounts(remotes)
+	out, _ := execCommand("git", "-C", repo, "config", "user.email").Output()
+	result.Email = strings.TrimSpace(string(out))
+	if len(result.Accounts) == 0 {
+		return result
+	}
+
+	result.Status = scanMismatch
+	for _, alias := range result.Accounts {
+		if account, _ := config.account(alias); strings.EqualFold(account.Email, result.Email) {
+			result.Status = scanOK
+		}
+	}
+	return result
+}
+
+// scanRepos handles "scan <dir>...": it lists every repository below the
+// directories with the accounts of its remotes and whether its identity
+// matches
+func scanRepos(config Config, args []string) error {
+	flags := flag.NewFlagSet("scan", flag.ContinueOnError)
+	jobs := flags.Int("jobs", defaultJobs(), "number of repositories checked in parallel")
+	problems := flags.Bool("problems", false, "only show repositories whose identity doesn't match")
+	dirs, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(dirs) == 0 {
+		return fmt.Errorf("usage: ghs scan <dir>... [--jobs n] [--problems]")
+	}
+
+	var repos []string
+	for _, dir := range dirs {
+		found, err := findRepos(expandPath(dir))
+		if err != nil {
+			warnf("failed to scan %s: %v", dir, err)
+		}
+		repos = append(repos, found...)
+	}
+
+	results := make([]repoScan, len(repos))
+	bar := newProgress("Checking repositories", len(repos))
+	forEachParallel(len(repos), *jobs, func(i int) {
+		results[i] = scanRepo(config, repos[i])
+		bar.step()
+	})
+	bar.finish()
+
+	counts := map[string]int{}
+	for _, r := range results {
+		if r.Err != nil {
+			fmt.Printf("%-10s %s: %v\n", "error", r.Repo, r.Err)
+			counts["error"]++
+			continue
+		}
+		counts[r.Status]++
+		if *problems && r.Status != scanMismatch {
+			continue
+		}
+		accounts := strings.Join(r.Accounts, ",")
+		if accounts == "" {
+			accounts = "-"
+		}
+		fmt.Printf("%-10s %-40s %-15s %s\n", r.Status, r.Repo, accounts, r.Email)
+	}
+	fmt.Printf("\n%d repositories: %d ok, %d mismatched, %d without a matching account\n",
+		len(results), counts[scanOK], counts[scanMismatch], counts[scanUnmanaged])
+	if counts["error"] > 0 {
+		return fmt.Errorf("%d repositories could not be read", counts["error"])
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// secretServiceStore keeps secrets with the freedesktop secret service API,
+// which GNOME Keyring and KWallet implement, through libsecret's secret-tool
+type secretServiceStore struct{}
+
+// openSecretService checks that secret-tool is installed and a session bus
+// is there to reach the keyring on
+func openSecretService() (secretStore, error) {
+	if _, err := exec.LookPath("secret-tool"); err != nil {
+		return nil, fmt.Errorf("the secret service needs secret-tool (package libsecret-tools or libsecret)")
+	}
+	if os.Getenv("DBUS_SESSION_BUS_ADDRESS") == "" {
+		if _, err := os.Stat(filepath.Join(os.Getenv("XDG_RUNTIME_DIR"), "bus")); os.Getenv("XDG_RUNTIME_DIR") == "" || err != nil {
+			return nil, fmt.Errorf("no D-Bus session to reach the secret service on; log in to a desktop session or start one with dbus-run-session")
+		}
+	}
+	return secretServiceStore{}, nil
+}
+
+func (secretServiceStore) Name() string { return "secret service" }
+
+func (secretServiceStore) Get(name string) (string, error) {
+	cmd := execCommand("secret-tool", "lookup", "service", keyringService, "account", name)
+	cmd.secretOutput = true
+	out, err := cmd.Output()
+	if err != nil || len(out) == 0 {
+		return "", fmt.Errorf("%s not found in the secret service", name)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (secretServiceStore) Set(name, secret string) error {
+	cmd := execCommand("secret-tool", "store", "--label", "ghs: "+name, "service", keyringService, "account", name)
+	cmd.Stdin = strings.NewReader(secret)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("secret-tool: %s", errorLine(string(out), err))
+	}
+	return nil
+}
+
+func (secretServiceStore) Delete(name string) error {
+	if out, err := execCommand("secret-tool", "clear", "service", keyringService, "account", name).CombinedOutput(); err != nil {
+		return fmt.Errorf("secret-tool: %s", errorLine(string(out), err))
+	}
+	return nil
+}
+
+func (secretServiceStore) List() ([]string, error) {
+	cmd := execCommand("secret-tool", "search", "--all", "service", keyringService)
+	cmd.secretOutput = true
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		// Nothing found exits with status 1 and no output
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 && len(out) == 0 {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("secret-tool: %s", errorLine(string(out), err))
+	}
+	var names []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if name, ok := strings.CutPrefix(strings.TrimSpace(line), "attribute.account = "); ok {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
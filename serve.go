@@ -0,0 +1,159 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const defaultServeAddr = "127.0.0.1:7717"
+
+func defaultServeTokenFile() string {
+	return filepath.Join(stateDir, "serve.token")
+}
+
+// serveToken reads the API token, creating a random one on first use
+func serveToken(path string) (string, error) {
+	if data, err := os.ReadFile(path); err == nil {
+		if token := strings.TrimSpace(string(data)); token != "" {
+			return token, nil
+		}
+		return "", fmt.Errorf("%s is empty", path)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+	if err := mkdirPrivate(filepath.Dir(path)); err != nil {
+		return "", err
+	}
+	if err := writePrivateFile(path, []byte(token+"\n")); err != nil {
+		return "", err
+	}
+	fmt.Printf("Created API token in %s\n", path)
+	return token, nil
+}
+
+// loopbackAddr rejects addresses other machines could reach
+func loopbackAddr(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid address %q: %v", addr, err)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("%s is not a loopback address; the API only listens on localhost", addr)
+	}
+	return nil
+}
+
+// writeJSON answers with v, using status 400 for failed daemon responses
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	if resp, ok := v.(daemonResponse); ok && !resp.OK && status == http.StatusOK {
+		status = http.StatusBadRequest
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// serveHandler routes the API, answering only requests with the token
+func serveHandler(state *daemonState, token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/accounts", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, handleDaemonRequest(state, daemonRequest{Op: "list"}))
+	})
+	mux.HandleFunc("/v1/status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, handleDaemonRequest(state, daemonRequest{Op: "which", Dir: r.URL.Query().Get("dir")}))
+	})
+	mux.HandleFunc("/v1/switch", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeJSON(w, http.StatusMethodNotAllowed, daemonResponse{Error: "switch needs POST"})
+			return
+		}
+		var req daemonRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, daemonResponse{Error: "invalid request: " + err.Error()})
+			return
+		}
+		req.Op = "switch"
+		writeJSON(w, http.StatusOK, handleDaemonRequest(state, req))
+	})
+	mux.HandleFunc("/v1/doctor", func(w http.ResponseWriter, r *http.Request) {
+		var args []string
+		if alias := r.URL.Query().Get("alias"); alias != "" {
+			args = []string{alias}
+		}
+		results, err := runDoctor(state.current(), args)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, daemonResponse{Error: err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, newDoctorReport(results))
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			logger.Warn("api request rejected", "path", r.URL.Path, "remote", r.RemoteAddr)
+			writeJSON(w, http.StatusUnauthorized, daemonResponse{Error: "missing or wrong token"})
+			return
+		}
+		logger.Debug("api request", "method", r.Method, "path", r.URL.Path)
+		if _, pattern := mux.Handler(r); pattern == "" {
+			writeJSON(w, http.StatusNotFound, daemonResponse{Error: "unknown endpoint " + r.URL.Path})
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// runServe handles "serve": an HTTP API on localhost for dev portals, GUIs
+// and tray apps, with the operations of the daemon and the doctor report
+func runServe(config Config, args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := flags.String("addr", defaultServeAddr, "loopback address to listen on")
+	tokenFile := flags.String("token-file", defaultServeTokenFile(), "file holding the bearer token")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return fmt.Errorf("usage: ghs serve [--addr 127.0.0.1:7717] [--token-file <path>]")
+	}
+	if err := loopbackAddr(*addr); err != nil {
+		return err
+	}
+	token, err := serveToken(expandPath(*tokenFile))
+	if err != nil {
+		return fmt.Errorf("failed to read API token: %v", err)
+	}
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", *addr, err)
+	}
+
+	state := &daemonState{config: config}
+	if info, err := os.Stat(storedConfigPath()); err == nil {
+		state.modified = info.ModTime()
+	}
+	server := &http.Server{Handler: serveHandler(state, token), ReadHeaderTimeout: 10 * time.Second}
+	fmt.Printf("Serving the API on http://%s (token in %s)\n", listener.Addr(), expandPath(*tokenFile))
+	logger.Info("api started", "addr", listener.Addr().String())
+	return server.Serve(listener)
+}
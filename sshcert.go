@@ -0,0 +1,172 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// certExpiryWarning is how long before expiry doctor warns about a
+// certificate
+const certExpiryWarning = time.Hour
+
+// certificatePath returns the certificate file of an account: the configured
+// one, or where ssh looks for it next to the key
+func certificatePath(account GitHubAccount) string {
+	if account.SSHCertificate != "" {
+		return account.SSHCertificate
+	}
+	return account.SSHKeyPath + "-cert.pub"
+}
+
+// certValidity reads the validity period of an SSH certificate. to is zero
+// for certificates valid forever.
+func certValidity(path string) (from, to time.Time, err error) {
+	out, err := execCommand("ssh-keygen", "-L", "-f", path).Output()
+	if err != nil {
+		return from, to, fmt.Errorf("failed to read certificate %s: %v", path, err)
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "Valid:") {
+			continue
+		}
+		valid := strings.TrimSpace(strings.TrimPrefix(line, "Valid:"))
+		if valid == "forever" {
+			return from, to, nil
+		}
+		// "from 2024-01-01T00:00:00 to 2024-01-02T00:00:00" in local time
+		fields := strings.Fields(valid)
+		if len(fields) == 4 && fields[0] == "from" && fields[2] == "to" {
+			start, errFrom := time.ParseInLocation("2006-01-02T15:04:05", fields[1], time.Local)
+			end, errTo := time.ParseInLocation("2006-01-02T15:04:05", fields[3], time.Local)
+			if errFrom == nil && errTo == nil {
+				return start, end, nil
+			}
+		}
+		return from, to, fmt.Errorf("unexpected validity %q in %s", valid, path)
+	}
+	return from, to, fmt.Errorf("%s has no validity period", path)
+}
+
+// refreshCertificate runs the account's certificate command and writes its
+// output to the certificate file
+func refreshCertificate(account GitHubAccount) error {
+	if account.SSHCertificateCommand == "" {
+		return fmt.Errorf("no ssh_certificate_command configured")
+	}
+	cmd := execCommand("sh", "-c", account.SSHCertificateCommand)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("certificate command failed: %v", err)
+	}
+	if len(strings.TrimSpace(string(out))) == 0 {
+		// The command wrote the certificate itself
+		return nil
+	}
+	path := certificatePath(account)
+	if err := mkdirPrivate(filepath.Dir(path)); err != nil {
+		return err
+	}
+	return writePrivateFile(path, out)
+}
+
+// applyCertFlags updates the certificate settings of an account from edit
+// flags
+func applyCertFlags(account GitHubAccount, flags *flag.FlagSet, cert, command string) GitHubAccount {
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "ssh-certificate":
+			account.SSHCertificate = cert
+			if cert != "" {
+				account.SSHCertificate = expandPath(cert)
+			}
+		case "ssh-certificate-command":
+			account.SSHCertificateCommand = command
+		}
+	})
+	return account
+}
+
+// runCertCommand handles "cert refresh <alias>|--all"
+func runCertCommand(config Config, args []string) error {
+	if len(args) != 2 || args[0] != "refresh" {
+		return fmt.Errorf("usage: ghs cert refresh <alias|--all>")
+	}
+	accounts := config.resolvedAccounts()
+	aliases := []string{args[1]}
+	if args[1] == "--all" {
+		aliases = nil
+		for _, alias := range sortedAliases(accounts) {
+			if accounts[alias].SSHCertificateCommand != "" {
+				aliases = append(aliases, alias)
+			}
+		}
+	} else {
+		alias, err := config.lookupAlias(args[1])
+		if err != nil {
+			return err
+		}
+		aliases = []string{alias}
+	}
+
+	failed := 0
+	for _, alias := range aliases {
+		account := accounts[alias]
+		if err := refreshCertificate(account); err != nil {
+			fmt.Printf("Error: %s: %v\n", alias, err)
+			failed++
+			continue
+		}
+		if _, to, err := certValidity(certificatePath(account)); err != nil {
+			warnf("%s: %v", alias, err)
+		} else if to.IsZero() {
+			fmt.Printf("%s: certificate refreshed, valid forever\n", alias)
+		} else {
+			fmt.Printf("%s: certificate refreshed, valid until %s\n", alias, to.Format("2006-01-02 15:04"))
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d certificate(s) could not be refreshed", failed)
+	}
+	return nil
+}
+
+// checkSSHCertificate is the doctor check of an account's certificate
+func checkSSHCertificate(alias string, account GitHubAccount) *doctorResult {
+	if account.SSHCertificate == "" && account.SSHCertificateCommand == "" {
+		return nil
+	}
+	path := certificatePath(account)
+	hint := ""
+	if account.SSHCertificateCommand != "" {
+		hint = "ghs cert refresh " + alias
+	}
+	data := map[string]string{"path": path}
+	if _, err := os.Stat(path); err != nil {
+		return &doctorResult{Status: doctorFail, Finding: "not_found", Message: fmt.Sprintf("certificate %s not found", path), Hint: hint, Data: data}
+	}
+	from, to, err := certValidity(path)
+	if err != nil {
+		return &doctorResult{Status: doctorFail, Finding: "unreadable", Message: err.Error(), Data: data}
+	}
+	if !to.IsZero() {
+		data["valid_before"] = to.Format(time.RFC3339)
+	}
+	now := time.Now()
+	switch {
+	case to.IsZero():
+		return &doctorResult{Status: doctorOK, Finding: "ok", Message: "certificate valid forever", Data: data}
+	case now.Before(from):
+		return &doctorResult{Status: doctorFail, Finding: "not_yet_valid", Message: fmt.Sprintf("certificate not valid before %s", from.Format("2006-01-02 15:04")), Hint: "check the system clock", Data: data}
+	case now.After(to):
+		return &doctorResult{Status: doctorFail, Finding: "expired", Message: fmt.Sprintf("certificate expired %s", to.Format("2006-01-02 15:04")), Hint: hint, Data: data}
+	case to.Sub(now) < certExpiryWarning:
+		return &doctorResult{Status: doctorWarn, Finding: "expiring", Message: fmt.Sprintf("certificate expires in %s", to.Sub(now).Round(time.Minute)), Hint: hint, Data: data}
+	}
+	return &doctorResult{Status: doctorOK, Finding: "ok", Message: fmt.Sprintf("certificate valid until %s", to.Format("2006-01-02 15:04")), Data: data}
+}
@@ -0,0 +1,635 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// sshAccountMarker starts every Host block ghs writes
+const sshAccountMarker = "# GitHub account:"
+
+// The managed blocks are wrapped in these markers. BEGIN records a hash of
+// the content so edits made inside the section by hand can be detected.
+const (
+	sshBeginMarker = "# BEGIN ghs managed section"
+	sshEndMarker   = "# END ghs managed section"
+)
+
+var sshBeginPattern = regexp.MustCompile(`\(sha256:([0-9a-f]+)\)`)
+
+// maxSSHConfigLine is the longest SSH config line accepted
+const maxSSHConfigLine = 1024 * 1024
+
+// What to do with a managed section that was edited by hand
+const (
+	sshEditsAsk       = ""
+	sshEditsKeep      = "keep"
+	sshEditsMerge     = "merge"
+	sshEditsOverwrite = "overwrite"
+)
+
+// unmanagedHost is a Host block of the SSH config not written by ghs
+type unmanagedHost struct {
+	Line     int
+	Patterns []string
+}
+
+// sshConfigCopy is the result of copying the unmanaged part of an SSH config
+type sshConfigCopy struct {
+	wrote, lastBlank bool
+	// hosts maps every pattern of unmanaged Host lines to its block
+	hosts map[string]unmanagedHost
+	// section holds the lines of the managed section, which is the only part
+	// of the file kept in memory
+	section []string
+	// edited is set when the section no longer matches its recorded hash
+	edited bool
+}
+
+// sectionHash returns the hash recorded in the BEGIN marker of content
+func sectionHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:8])
+}
+
+// copyUnmanagedSSHConfig streams the SSH config from r to w, leaving out the
+// managed section and the blocks older versions wrote without one: a marker
+// comment, its Host line and the indented lines after it. Unmanaged blocks
+// whose only pattern is in drop are left out too, which is how ghs adopts a
+// hand-written block after confirmation.
+func copyUnmanagedSSHConfig(r io.Reader, w *bufio.Writer, drop map[string]bool) (sshConfigCopy, error) {
+	const (
+		outside = iota
+		afterMarker
+		inBlock
+		inDropped
+		inSection
+	)
+	result := sshConfigCopy{hosts: map[string]unmanagedHost{}}
+	state := outside
+	recordedHash := ""
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxSSHConfigLine)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		if state == inSection {
+			if strings.HasPrefix(trimmed, sshEndMarker) {
+				content := strings.Join(result.section, "\n")
+				result.edited = result.edited || sectionHash(content) != recordedHash
+				state = outside
+			} else {
+				result.section = append(result.section, line)
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, sshBeginMarker) {
+			recordedHash = ""
+			if m := sshBeginPattern.FindStringSubmatch(trimmed); m != nil {
+				recordedHash = m[1]
+			}
+			state = inSection
+			continue
+		}
+		if strings.Contains(line, sshAccountMarker) {
+			state = afterMarker
+			continue
+		}
+		switch state {
+		case afterMarker:
+			if strings.HasPrefix(strings.ToLower(trimmed), "host ") {
+				state = inBlock
+				continue
+			}
+			state = outside
+		case inBlock, inDropped:
+			if trimmed == "" {
+				// The blank line closing a managed block belongs to it
+				state = outside
+				continue
+			}
+			if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+				continue
+			}
+			state = outside
+		}
+
+		if fields := strings.Fields(trimmed); len(fields) > 1 && strings.EqualFold(fields[0], "host") {
+			patterns := fields[1:]
+			if len(patterns) == 1 && drop[patterns[0]] {
+				state = inDropped
+				continue
+			}
+			for _, pattern := range patterns {
+				if _, seen := result.hosts[pattern]; !seen {
+					result.hosts[pattern] = unmanagedHost{Line: lineNo, Patterns: patterns}
+				}
+			}
+		}
+
+		// Keep a single blank line where managed blocks were removed
+		if trimmed == "" && (result.lastBlank || !result.wrote) {
+			continue
+		}
+		if _, err := w.WriteString(line + "\n"); err != nil {
+			return result, err
+		}
+		result.wrote, result.lastBlank = true, trimmed == ""
+	}
+	if state == inSection {
+		// A missing END marker means the section was damaged by hand
+		result.edited = true
+	}
+	return result, scanner.Err()
+}
+
+// scanSSHConfig reads the SSH config without changing it
+func scanSSHConfig() (sshConfigCopy, error) {
+	f, err := os.Open(sshConfigPath)
+	if os.IsNotExist(err) {
+		return sshConfigCopy{hosts: map[string]unmanagedHost{}}, nil
+	}
+	if err != nil {
+		return sshConfigCopy{}, err
+	}
+	defer f.Close()
+	return copyUnmanagedSSHConfig(f, bufio.NewWriter(io.Discard), nil)
+}
+
+// splitSSHBlocks splits managed section lines into blocks keyed by host
+func splitSSHBlocks(lines []string) map[string]string {
+	blocks := map[string]string{}
+	var current []string
+	flush := func() {
+		host := ""
+		for _, line := range current {
+			if fields := strings.Fields(line); len(fields) == 2 && strings.EqualFold(fields[0], "host") {
+				host = fields[1]
+			}
+		}
+		if text := strings.TrimSpace(strings.Join(current, "\n")); text != "" {
+			blocks[host] += text + "\n"
+		}
+		current = nil
+	}
+	for _, line := range lines {
+		if strings.Contains(line, sshAccountMarker) {
+			flush()
+		}
+		current = append(current, line)
+	}
+	flush()
+	return blocks
+}
+
+// chooseSSHEdits asks what to do with a managed section edited by hand. In
+// non-interactive mode the file is kept as is.
+func chooseSSHEdits() (string, error) {
+	fmt.Printf("The ghs managed section of %s was edited by hand.\n", sshConfigPath)
+	if nonInteractive {
+		warnf("leaving the SSH config unchanged; run 'ghs sshconfig update --merge' or '--overwrite'.")
+		return sshEditsKeep, nil
+	}
+	for {
+		answer, err := prompt("[k]eep the file as is, [m]erge your edits as hand-written blocks, or [o]verwrite them", "k", "")
+		if err != nil {
+			return "", err
+		}
+		switch strings.ToLower(answer) {
+		case "k", "keep":
+			return sshEditsKeep, nil
+		case "m", "merge":
+			return sshEditsMerge, nil
+		case "o", "overwrite":
+			return sshEditsOverwrite, nil
+		}
+	}
+}
+
+// updateSSHConfig rewrites the managed Host blocks of the SSH config. The
+// existing file is streamed line by line into a temporary file and a backup,
+// so large configs are never held in memory. Accounts whose host already has
+// a hand-written block are skipped so the user's block keeps working.
+func updateSSHConfig(config Config) error {
+	return writeSSHConfig(config, nil, sshEditsAsk)
+}
+
+// writeSSHConfig rewrites the SSH config, replacing the hand-written blocks
+// of the hosts in adopt with managed ones. onEdit decides what happens when
+// the managed section was edited by hand.
+func writeSSHConfig(config Config, adopt map[string]bool, onEdit string) error {
+	accounts := config.resolvedAccounts()
+	scanned, err := scanSSHConfig()
+	if err != nil {
+		return fmt.Errorf("failed to read SSH config file: %v", err)
+	}
+	if scanned.edited && onEdit == sshEditsAsk {
+		if onEdit, err = chooseSSHEdits(); err != nil {
+			return err
+		}
+	}
+	if scanned.edited && onEdit == sshEditsKeep {
+		return nil
+	}
+
+	if err := prepareControlDir(accounts); err != nil {
+		return err
+	}
+	prepareKnownHosts(accounts)
+
+	blocks, hosts, skipped, err := renderSSHBlocks(config, scanned, adopt)
+	if err != nil {
+		return err
+	}
+	for _, skip := range skipped {
+		warnf("%s", skip.Warning)
+		if skip.Hint != "" {
+			fmt.Println(skip.Hint)
+		}
+	}
+
+	// Merging keeps every edited block as a hand-written block, which then
+	// takes the place of the managed one
+	var kept []string
+	if scanned.edited && onEdit == sshEditsMerge {
+		old := splitSSHBlocks(scanned.section)
+		for _, host := range sortedKeys(old) {
+			if strings.TrimSpace(old[host]) == strings.TrimSpace(blocks[host]) {
+				continue
+			}
+			text := strings.Replace(old[host], sshAccountMarker, "# Edited by hand, formerly managed by ghs for", 1)
+			kept = append(kept, text)
+			delete(blocks, host)
+			fmt.Printf("Kept your version of Host %s as a hand-written block\n", host)
+		}
+	}
+
+	var section strings.Builder
+	for _, host := range hosts {
+		section.WriteString(blocks[host])
+	}
+	content := strings.TrimRight(section.String(), "\n")
+
+	existing, err := os.Open(sshConfigPath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read SSH config file: %v", err)
+	}
+	if existing != nil {
+		defer existing.Close()
+	}
+
+	// Create a temporary file
+	tmpFile, err := os.CreateTemp(filepath.Dir(sshConfigPath), "ssh_config_tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	// The temporary file becomes the SSH config, which ssh wants private
+	if err := tmpFile.Chmod(0600); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("failed to create temporary file: %v", err)
+	}
+	w := bufio.NewWriter(tmpFile)
+
+	// Copy the other configs first, writing the backup on the way
+	var backup *os.File
+	wrote, lastBlank := false, false
+	if existing != nil {
+		backup, err = os.CreateTemp(filepath.Dir(sshConfigPath), "ssh_config_bak")
+		if err != nil {
+			tmpFile.Close()
+			return fmt.Errorf("failed to create backup: %v", err)
+		}
+		defer os.Remove(backup.Name())
+		if err := backup.Chmod(0600); err != nil {
+			tmpFile.Close()
+			backup.Close()
+			return fmt.Errorf("failed to create backup: %v", err)
+		}
+		copied, err := copyUnmanagedSSHConfig(io.TeeReader(existing, backup), w, adopt)
+		if err != nil {
+			tmpFile.Close()
+			backup.Close()
+			return fmt.Errorf("failed to write existing config: %v", err)
+		}
+		wrote, lastBlank = copied.wrote, copied.lastBlank
+	}
+
+	var out strings.Builder
+	if wrote && !lastBlank {
+		out.WriteString("\n")
+	}
+	for _, text := range kept {
+		out.WriteString(text + "\n")
+	}
+	out.WriteString(wrapSSHSection(content))
+	if _, err := w.WriteString(out.String()); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("failed to write SSH config: %v", err)
+	}
+
+	if err := w.Flush(); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("failed to write SSH config: %v", err)
+	}
+	// Close the temporary file
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary file: %v", err)
+	}
+
+	// Keep a backup of the previous config
+	if backup != nil {
+		if err := backup.Close(); err != nil {
+			return fmt.Errorf("failed to create backup: %v", err)
+		}
+		if err := os.Rename(backup.Name(), sshConfigPath+".bak"); err != nil {
+			return fmt.Errorf("failed to create backup: %v", err)
+		}
+	}
+
+	// Move temporary file to SSH config
+	if err := os.Rename(tmpFile.Name(), sshConfigPath); err != nil {
+		return fmt.Errorf("failed to update SSH config: %v", err)
+	}
+	logger.Info("ssh config written", "path", sshConfigPath, "hosts", hosts)
+	return nil
+}
+
+// sshSkip is an account left out of the managed section, with the reason
+// and possibly the command that brings it in
+type sshSkip struct {
+	Warning, Hint string
+}
+
+// multiLineError is a value that would break out of its line in a Host block
+type multiLineError struct{ value string }
+
+func (e *multiLineError) Error() string {
+	return fmt.Sprintf("%q spans several lines", e.value)
+}
+
+// sshLine lets a value into the SSH config template only if it stays on its
+// line, so a value can't add options or Host blocks of its own
+func sshLine(value string) (string, error) {
+	if strings.ContainsAny(value, "\r\n") {
+		return "", &multiLineError{value}
+	}
+	return value, nil
+}
+
+// executeSSHTemplate renders the Host block of an account
+func executeSSHTemplate(tmpl *template.Template, account GitHubAccount) (string, error) {
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, account); err != nil {
+		var multiLine *multiLineError
+		if errors.As(err, &multiLine) {
+			return "", multiLine
+		}
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// renderSSHBlocks renders the Host block of every account and of the
+// default host, in the order they go into the managed section. Hosts with a
+// hand-written block in scanned are skipped unless in adopt.
+func renderSSHBlocks(config Config, scanned sshConfigCopy, adopt map[string]bool) (map[string]string, []string, []sshSkip, error) {
+	accounts := config.resolvedAccounts()
+	tmpl, err := template.New("sshconfig").Funcs(template.FuncMap{"line": sshLine}).Parse(SSHConfigTemplate)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to parse SSH config template: %v", err)
+	}
+
+	blocks := map[string]string{}
+	var hosts []string
+	var skipped []sshSkip
+	for _, alias := range sortedAliases(accounts) {
+		account := accounts[alias]
+		if account.SSHKeyPath == "" && !account.hardwareKey() {
+			skipped = append(skipped, sshSkip{Warning: fmt.Sprintf("Skipping SSH config for account '%s' due to empty key path", alias)})
+			continue
+		}
+
+		host := "github.com-" + account.Username
+		if block, exists := scanned.hosts[host]; exists && !adopt[host] {
+			skipped = append(skipped, sshSkip{
+				Warning: fmt.Sprintf("%s:%d already has a hand-written Host %s; leaving it alone and skipping account '%s'.", sshConfigPath, block.Line, host, alias),
+				Hint:    fmt.Sprintf("Run 'ghs sshconfig adopt %s' to let ghs manage it.", alias),
+			})
+			continue
+		}
+
+		if keyMissing(account) {
+			skipped = append(skipped, sshSkip{Warning: fmt.Sprintf("SSH key not found for account '%s' at %s", alias, account.SSHKeyPath)})
+			continue
+		}
+		if account.IdentityAgent != "" {
+			agent, err := resolveIdentityAgent(account.IdentityAgent)
+			if err != nil {
+				skipped = append(skipped, sshSkip{Warning: fmt.Sprintf("Skipping SSH config for account '%s': %v", alias, err)})
+				continue
+			}
+			account.IdentityAgent = agent
+		}
+
+		block, err := executeSSHTemplate(tmpl, account)
+		var multiLine *multiLineError
+		if errors.As(err, &multiLine) {
+			skipped = append(skipped, sshSkip{Warning: fmt.Sprintf("Skipping SSH config for account '%s': %v", alias, err)})
+			continue
+		} else if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to write SSH config: %v", err)
+		}
+		blocks[host] = block
+		hosts = append(hosts, host)
+	}
+	if config.DefaultHost != "" {
+		if block, exists := scanned.hosts[defaultHost]; exists && !adopt[defaultHost] {
+			skipped = append(skipped, sshSkip{
+				Warning: fmt.Sprintf("%s:%d already has a hand-written Host %s; leaving it alone.", sshConfigPath, block.Line, defaultHost),
+				Hint:    "Run 'ghs sshconfig default-host " + config.DefaultHost + "' to let ghs manage it.",
+			})
+		} else if block, err := defaultHostBlock(config, accounts, tmpl); err != nil {
+			skipped = append(skipped, sshSkip{Warning: fmt.Sprintf("Skipping Host %s: %v", defaultHost, err)})
+		} else {
+			blocks[defaultHost] = block
+			hosts = append(hosts, defaultHost)
+		}
+	}
+	return blocks, hosts, skipped, nil
+}
+
+// wrapSSHSection puts the managed section markers around content, recording
+// its hash; empty content is no section
+func wrapSSHSection(content string) string {
+	if content == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s (sha256:%s) - changes inside are detected, edit outside or use ghs\n%s\n%s\n",
+		sshBeginMarker, sectionHash(content), content, sshEndMarker)
+}
+
+// exportSSHConfig handles "export ssh-config [--ignore-existing]": it prints
+// the managed section "sshconfig update" would write, without writing
+// anything, for review or for configuration management templates.
+// Warnings go to stderr so the output can be piped.
+func exportSSHConfig(config Config, args []string) error {
+	flags := flag.NewFlagSet("export ssh-config", flag.ContinueOnError)
+	ignoreExisting := flags.Bool("ignore-existing", false, "include hosts that have a hand-written block in the local SSH config")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return fmt.Errorf("usage: ghs export ssh-config [--ignore-existing]")
+	}
+	var scanned sshConfigCopy
+	if !*ignoreExisting {
+		if scanned, err = scanSSHConfig(); err != nil {
+			return fmt.Errorf("failed to read SSH config file: %v", err)
+		}
+	}
+	blocks, hosts, skipped, err := renderSSHBlocks(config, scanned, nil)
+	if err != nil {
+		return err
+	}
+	for _, skip := range skipped {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", skip.Warning)
+	}
+	var section strings.Builder
+	for _, host := range hosts {
+		section.WriteString(blocks[host])
+	}
+	fmt.Print(wrapSSHSection(strings.TrimRight(section.String(), "\n")))
+	return nil
+}
+
+// runExportCommand handles "export <format>"
+func runExportCommand(config Config, args []string) error {
+	if err := requireSSH("export"); err != nil {
+		return err
+	}
+	if len(args) < 1 {
+		return fmt.Errorf("usage: ghs export ssh-config")
+	}
+	switch args[0] {
+	case "ssh-config":
+		return exportSSHConfig(config, args[1:])
+	default:
+		return fmt.Errorf("unknown export format: %s", args[0])
+	}
+}
+
+// adoptSSHHost replaces the hand-written Host block of an account with a
+// managed one after confirmation
+func adoptSSHHost(config Config, args []string) error {
+	flags := flag.NewFlagSet("sshconfig adopt", flag.ContinueOnError)
+	yes := flags.Bool("yes", false, "replace the block without asking")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: ghs sshconfig adopt <alias> [--yes]")
+	}
+	alias := positional[0]
+	alias, account, err := config.lookupAccount(alias)
+	if err != nil {
+		return err
+	}
+
+	host := "github.com-" + account.Username
+	scanned, err := scanSSHConfig()
+	if err != nil {
+		return fmt.Errorf("failed to read SSH config file: %v", err)
+	}
+	block, exists := scanned.hosts[host]
+	if !exists {
+		return fmt.Errorf("%s has no hand-written Host %s", sshConfigPath, host)
+	}
+	if len(block.Patterns) > 1 {
+		return fmt.Errorf("the block at %s:%d is shared by Host %s; split it by hand first",
+			sshConfigPath, block.Line, strings.Join(block.Patterns, " "))
+	}
+
+	if !*yes {
+		ok, err := confirm(fmt.Sprintf("Replace your Host %s block at %s:%d with the one ghs manages?", host, sshConfigPath, block.Line), false)
+		if err != nil {
+			return fmt.Errorf("%v (pass --yes)", err)
+		}
+		if !ok {
+			return fmt.Errorf("aborted")
+		}
+	}
+	if err := writeSSHConfig(config, map[string]bool{host: true}, sshEditsAsk); err != nil {
+		return err
+	}
+	fmt.Printf("Host %s is now managed by ghs (previous config saved to %s.bak)\n", host, sshConfigPath)
+	return nil
+}
+
+// updateSSHConfigCommand handles "sshconfig update", which regenerates the
+// managed section and settles hand-made edits inside it
+func updateSSHConfigCommand(config Config, args []string) error {
+	flags := flag.NewFlagSet("sshconfig update", flag.ContinueOnError)
+	merge := flags.Bool("merge", false, "keep blocks edited by hand as hand-written blocks")
+	overwrite := flags.Bool("overwrite", false, "replace blocks edited by hand")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 || (*merge && *overwrite) {
+		return fmt.Errorf("usage: ghs sshconfig update [--merge|--overwrite]")
+	}
+	onEdit := sshEditsAsk
+	if *merge {
+		onEdit = sshEditsMerge
+	} else if *overwrite {
+		onEdit = sshEditsOverwrite
+	}
+	if err := writeSSHConfig(config, nil, onEdit); err != nil {
+		return err
+	}
+	if scanned, err := scanSSHConfig(); err == nil && scanned.edited {
+		// The edits were kept
+		return nil
+	}
+	fmt.Printf("Updated %s\n", sshConfigPath)
+	return nil
+}
+
+// runSSHConfigCommand handles the "sshconfig" subcommands
+func runSSHConfigCommand(config Config, args []string) error {
+	if err := requireSSH("sshconfig"); err != nil {
+		return err
+	}
+	if len(args) < 1 {
+		return fmt.Errorf("usage: ghs sshconfig <update|lint [file]|adopt <alias>|default-host <alias|none|off>|known-hosts <alias>...>")
+	}
+	switch args[0] {
+	case "update":
+		return updateSSHConfigCommand(config, args[1:])
+	case "lint":
+		return runSSHConfigLint(args[1:])
+	case "adopt":
+		return adoptSSHHost(config, args[1:])
+	case "default-host":
+		return setDefaultHost(config, args[1:])
+	case "known-hosts":
+		return refreshKnownHosts(config, args[1:])
+	default:
+		return fmt.Errorf("unknown sshconfig subcommand: %s", args[0])
+	}
+}
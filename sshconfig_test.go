@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// workBlock is a managed Host block as the template writes it
+const workBlock = `# GitHub account: acme-me
+Host github.com-acme-me
+    HostName github.com
+    User git
+    IdentityFile /home/me/.ssh/id_work
+    IdentitiesOnly yes
+`
+
+// copySSHConfig runs copyUnmanagedSSHConfig on content
+func copySSHConfig(t *testing.T, content string, drop map[string]bool) (string, sshConfigCopy) {
+	t.Helper()
+	var out strings.Builder
+	w := bufio.NewWriter(&out)
+	result, err := copyUnmanagedSSHConfig(strings.NewReader(content), w, drop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+	return out.String(), result
+}
+
+func TestWrapSSHSection(t *testing.T) {
+	if got := wrapSSHSection(""); got != "" {
+		t.Errorf("empty section wrapped as %q", got)
+	}
+	content := strings.TrimRight(workBlock, "\n")
+	wrapped := wrapSSHSection(content)
+	lines := strings.Split(strings.TrimSuffix(wrapped, "\n"), "\n")
+	if !strings.HasPrefix(lines[0], sshBeginMarker+" (sha256:"+sectionHash(content)+")") {
+		t.Errorf("BEGIN marker = %q", lines[0])
+	}
+	if lines[len(lines)-1] != sshEndMarker {
+		t.Errorf("END marker = %q", lines[len(lines)-1])
+	}
+	if m := sshBeginPattern.FindStringSubmatch(lines[0]); m == nil || len(m[1]) != 16 {
+		t.Errorf("hash in %q not found or not 16 hex digits", lines[0])
+	}
+	if sectionHash(content) == sectionHash(content+" ") {
+		t.Error("sectionHash ignores a change")
+	}
+}
+
+func TestCopyUnmanagedSSHConfig(t *testing.T) {
+	section := wrapSSHSection(strings.TrimRight(workBlock, "\n"))
+	tests := []struct {
+		name    string
+		content string
+		drop    map[string]bool
+		out     string
+		edited  bool
+		section []string
+		hosts   map[string]unmanagedHost
+	}{
+		{
+			name:    "managed section is left out",
+			content: "Host *\n    ServerAliveInterval 60\n\n" + section + "\nHost example.com\n    User me\n",
+			out:     "Host *\n    ServerAliveInterval 60\n\nHost example.com\n    User me\n",
+			section: strings.Split(strings.TrimRight(workBlock, "\n"), "\n"),
+			hosts: map[string]unmanagedHost{
+				"*":           {Line: 1, Patterns: []string{"*"}},
+				"example.com": {Line: 13, Patterns: []string{"example.com"}},
+			},
+		},
+		{
+			name:    "edit inside the section",
+			content: strings.Replace(section, "id_work", "id_other", 1),
+			edited:  true,
+			section: strings.Split(strings.TrimRight(strings.Replace(workBlock, "id_work", "id_other", 1), "\n"), "\n"),
+			hosts:   map[string]unmanagedHost{},
+		},
+		{
+			name:    "missing END marker",
+			content: strings.Replace(section, sshEndMarker+"\n", "", 1),
+			edited:  true,
+			section: strings.Split(strings.TrimRight(workBlock, "\n"), "\n"),
+			hosts:   map[string]unmanagedHost{},
+		},
+		{
+			name:    "BEGIN marker without a hash",
+			content: sshBeginMarker + "\n" + workBlock + sshEndMarker + "\n",
+			edited:  true,
+			section: strings.Split(strings.TrimRight(workBlock, "\n"), "\n"),
+			hosts:   map[string]unmanagedHost{},
+		},
+		{
+			name:    "blocks of older versions without markers",
+			content: "Host a\n    User a\n\n" + workBlock + "\nHost b c\n    User b\n",
+			out:     "Host a\n    User a\n\nHost b c\n    User b\n",
+			hosts: map[string]unmanagedHost{
+				"a": {Line: 1, Patterns: []string{"a"}},
+				"b": {Line: 11, Patterns: []string{"b", "c"}},
+				"c": {Line: 11, Patterns: []string{"b", "c"}},
+			},
+		},
+		{
+			name:    "dropped hand-written block",
+			content: "Host github.com-acme-me\n    IdentityFile ~/.ssh/old\n\nHost other\n    User me\n",
+			drop:    map[string]bool{"github.com-acme-me": true},
+			out:     "Host other\n    User me\n",
+			hosts: map[string]unmanagedHost{
+				"other": {Line: 4, Patterns: []string{"other"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, result := copySSHConfig(t, tt.content, tt.drop)
+			if out != tt.out {
+				t.Errorf("copied\n%q\nwant\n%q", out, tt.out)
+			}
+			if result.edited != tt.edited {
+				t.Errorf("edited = %v, want %v", result.edited, tt.edited)
+			}
+			if !reflect.DeepEqual(result.section, tt.section) {
+				t.Errorf("section = %q, want %q", result.section, tt.section)
+			}
+			if !reflect.DeepEqual(result.hosts, tt.hosts) {
+				t.Errorf("hosts = %v, want %v", result.hosts, tt.hosts)
+			}
+		})
+	}
+}
+
+func TestSplitSSHBlocks(t *testing.T) {
+	other := strings.Replace(workBlock, "acme-me", "me", 2)
+	lines := strings.Split(strings.TrimRight(workBlock+"\n"+other, "\n"), "\n")
+	blocks := splitSSHBlocks(lines)
+	want := map[string]string{
+		"github.com-acme-me": workBlock,
+		"github.com-me":      other,
+	}
+	if !reflect.DeepEqual(blocks, want) {
+		t.Errorf("blocks = %q, want %q", blocks, want)
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// sshOptionName returns an option's keyword as written on its line, since
+// parseSSHConfig lowercases keywords
+func sshOptionName(lines []string, option sshOption) string {
+	if option.Line < 1 || option.Line > len(lines) {
+		return option.Key
+	}
+	line := strings.TrimSpace(lines[option.Line-1])
+	if i := strings.IndexAny(line, " \t="); i >= 0 {
+		line = line[:i]
+	}
+	if strings.EqualFold(line, option.Key) {
+		return line
+	}
+	return option.Key
+}
+
+// sshHostImport holds the account records made from hand-written Host
+// blocks, with the label, problems and host of each
+type sshHostImport struct {
+	Records []accountRecord
+	Labels  []string
+	Errs    []error
+	Hosts   []string
+	// Owned maps the hosts of existing accounts to their alias
+	Owned map[string]string
+}
+
+// sshHostRecords turns the hand-written github.com-<username> Host blocks of
+// the SSH config into account records
+func sshHostRecords(config Config, name string, emails map[string]string) (sshHostImport, error) {
+	found := sshHostImport{Owned: map[string]string{}}
+	scanned, err := scanSSHConfig()
+	if err != nil {
+		return found, err
+	}
+	blocks, err := parseSSHConfig(sshConfigPath)
+	if os.IsNotExist(err) {
+		return found, nil
+	} else if err != nil {
+		return found, err
+	}
+	data, _ := os.ReadFile(sshConfigPath)
+	lines := strings.Split(string(data), "\n")
+
+	for _, block := range blocks {
+		if block.Match || len(block.Patterns) == 0 {
+			continue
+		}
+		var host string
+		for _, pattern := range block.Patterns {
+			if strings.HasPrefix(pattern, "github.com-") && !isWildcardPattern(pattern) {
+				host = pattern
+			}
+		}
+		// Blocks of the managed section are accounts already
+		if unmanaged, exists := scanned.hosts[host]; host == "" || !exists || unmanaged.Line != block.Line {
+			continue
+		}
+		username := strings.TrimPrefix(host, "github.com-")
+		if owner := aliasForUsername(config, username); owner != "" {
+			found.Owned[host] = owner
+			continue
+		}
+		record := accountRecord{Alias: username, GitHubAccount: GitHubAccount{
+			Name:     config.Defaults.inherit(name),
+			Username: username,
+		}}
+		var problems []string
+		if len(block.Patterns) > 1 {
+			problems = append(problems, fmt.Sprintf("the block is shared by Host %s; split it by hand first", strings.Join(block.Patterns, " ")))
+		}
+		for _, option := range block.Options {
+			switch option.Key {
+			case "hostname":
+				if !strings.EqualFold(option.Value, "github.com") {
+					problems = append(problems, fmt.Sprintf("HostName %s isn't github.com", option.Value))
+				}
+			case "user":
+				if option.Value != "git" {
+					problems = append(problems, fmt.Sprintf("User %s, GitHub only accepts git", option.Value))
+				}
+			case "identityfile":
+				// ssh offers every IdentityFile; the account has one key
+				if record.SSHKeyPath == "" {
+					record.SSHKeyPath = expandKeyPath(option.Value)
+				}
+			case "identitiesonly":
+				// The managed block always sets it
+			default:
+				if record.SSHOptions == nil {
+					record.SSHOptions = map[string]string{}
+				}
+				record.SSHOptions[sshOptionName(lines, option)] = option.Value
+			}
+		}
+		record.Email = emails[username]
+		if record.Email == "" && record.SSHKeyPath != "" {
+			// ssh-keygen -C puts the email in the public key's comment
+			if pub, err := os.ReadFile(record.SSHKeyPath + ".pub"); err == nil {
+				if fields := strings.Fields(string(pub)); len(fields) > 2 && validEmail(fields[2]) {
+					record.Email = fields[2]
+				}
+			}
+		}
+		if record.Email == "" {
+			problems = append(problems, fmt.Sprintf("no email found in the key's comment, pass --email %s=<email>", username))
+		}
+
+		found.Records = append(found.Records, record)
+		found.Labels = append(found.Labels, fmt.Sprintf("Host %s (%s:%d)", host, sshConfigPath, block.Line))
+		found.Hosts = append(found.Hosts, host)
+		if len(problems) > 0 {
+			found.Errs = append(found.Errs, fmt.Errorf("%s", strings.Join(problems, "; ")))
+		} else {
+			found.Errs = append(found.Errs, nil)
+		}
+	}
+	return found, nil
+}
+
+// printOwnedHosts lists the hand-written blocks of existing accounts, which
+// importing leaves to "sshconfig adopt"
+func printOwnedHosts(owned map[string]string) {
+	for _, host := range sortedKeys(owned) {
+		fmt.Printf("Host %s belongs to account '%s' already; 'ghs sshconfig adopt %s' lets ghs manage it\n", host, owned[host], owned[host])
+	}
+}
+
+// parseUsernameEmails parses the username=email values of --email
+func parseUsernameEmails(values []string) (map[string]string, error) {
+	emails := map[string]string{}
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid --email %q, expected username=email", value)
+		}
+		emails[parts[0]] = parts[1]
+	}
+	return emails, nil
+}
+
+// importedName returns the name given to imported accounts: the one
+// passed, or git's user.name when the defaults have no name
+func importedName(config Config, name string) string {
+	if name == "" && (config.Defaults == nil || config.Defaults.Name == "") {
+		if out, err := execCommand("git", "config", "--global", "user.name").Output(); err == nil {
+			return strings.TrimSpace(string(out))
+		}
+	}
+	return name
+}
+
+// importSSHConfig handles "import ssh-config": it creates an account for
+// every hand-written github.com-<username> Host block and lets ghs manage
+// the imported blocks from then on, unless --keep-blocks is given. The config
+// is saved unless it is a dry run.
+func importSSHConfig(config Config, args []string) error {
+	flags := flag.NewFlagSet("import ssh-config", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "show what would be imported without changing anything")
+	onDuplicate := flags.String("on-duplicate", onDuplicateSkip, "what to do with existing aliases: skip, update or fail")
+	keepBlocks := flags.Bool("keep-blocks", false, "leave the Host blocks hand-written instead of managing them")
+	name := flags.String("name", "", "name of the imported accounts (defaults to the configured default or git's user.name)")
+	var emails stringList
+	flags.Var(&emails, "email", "email of an account whose key comment has none, username=email (repeatable)")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return fmt.Errorf("usage: ghs import ssh-config [--dry-run] [--on-duplicate skip|update|fail] [--name <name>] [--email username=email] [--keep-blocks]")
+	}
+	if err := requireSSH("import ssh-config"); err != nil {
+		return err
+	}
+	switch *onDuplicate {
+	case onDuplicateSkip, onDuplicateUpdate, onDuplicateFail:
+	default:
+		return fmt.Errorf("invalid --on-duplicate %q, expected skip, update or fail", *onDuplicate)
+	}
+	byUsername, err := parseUsernameEmails(emails)
+	if err != nil {
+		return err
+	}
+	*name = importedName(config, *name)
+
+	found, err := sshHostRecords(config, *name, byUsername)
+	if err != nil {
+		return fmt.Errorf("failed to read SSH config file: %v", err)
+	}
+	printOwnedHosts(found.Owned)
+	if len(found.Records) == 0 {
+		fmt.Printf("No hand-written github.com-<username> hosts in %s\n", sshConfigPath)
+		return nil
+	}
+
+	if *dryRun {
+		preview := config
+		preview.Accounts = copyAccounts(config.Accounts)
+		fmt.Println("Dry run, no changes will be written:")
+		return printImportSummary(importRecords(preview, found.Records, found.Labels, found.Errs, *onDuplicate))
+	}
+	results := importRecords(config, found.Records, found.Labels, found.Errs, *onDuplicate)
+	if *keepBlocks {
+		if config, err = finishImport(config, results); err != nil {
+			return err
+		}
+		return saveConfig(config)
+	}
+
+	// Adopt the blocks of the accounts just imported, so they aren't
+	// skipped as hand-written
+	adopt := map[string]bool{}
+	for i, r := range results {
+		if r.Status == "added" || r.Status == "updated" {
+			adopt[found.Hosts[i]] = true
+		}
+	}
+	if len(adopt) > 0 {
+		if err := writeSSHConfig(config, adopt, sshEditsAsk); err != nil {
+			fmt.Printf("Error: failed to update SSH config: %v\n", err)
+		} else {
+			fmt.Printf("The imported hosts are now managed by ghs (previous config saved to %s.bak)\n", sshConfigPath)
+		}
+		if err := updateGitConfigFragments(config); err != nil {
+			fmt.Printf("Error: failed to update git config fragments: %v\n", err)
+		}
+	}
+	if err := printImportSummary(results); err != nil {
+		// Accounts whose blocks were adopted must be kept
+		if len(adopt) > 0 {
+			if saveErr := saveConfig(config); saveErr != nil {
+				return fmt.Errorf("failed to save config: %v", saveErr)
+			}
+		}
+		return err
+	}
+	return saveConfig(config)
+}
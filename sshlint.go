@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// sshOption is one keyword line of an SSH config block
+type sshOption struct {
+	Key   string // lowercased keyword
+	Value string
+	Line  int
+}
+
+// sshBlock is a Host or Match block; options before the first one form a
+// block that applies to every host
+type sshBlock struct {
+	Line     int
+	Patterns []string
+	Match    bool
+	Options  []sshOption
+}
+
+// sshShadowedOptions are options whose first value wins, or, for
+// IdentityFile, whose earlier values are offered to the server first
+var sshShadowedOptions = map[string]bool{
+	"identityfile":   true,
+	"identitiesonly": true,
+	"user":           true,
+	"hostname":       true,
+	"port":           true,
+}
+
+// parseSSHConfig reads the blocks of an SSH config file. Include directives
+// are not followed.
+func parseSSHConfig(path string) ([]sshBlock, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	blocks := []sshBlock{{Patterns: []string{"*"}}}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxSSHConfigLine)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// Keywords are separated from values by whitespace or "="
+		key, value := line, ""
+		if i := strings.IndexAny(line, " \t="); i >= 0 {
+			key, value = line[:i], strings.TrimLeft(line[i:], " \t=")
+		}
+		key = strings.ToLower(key)
+		switch key {
+		case "host":
+			blocks = append(blocks, sshBlock{Line: lineNo, Patterns: strings.Fields(value)})
+		case "match":
+			blocks = append(blocks, sshBlock{Line: lineNo, Match: true})
+		default:
+			current := &blocks[len(blocks)-1]
+			current.Options = append(current.Options, sshOption{key, strings.Trim(value, `"`), lineNo})
+		}
+	}
+	return blocks, scanner.Err()
+}
+
+// sshPatternMatch matches a host against an ssh_config pattern with * and ?
+func sshPatternMatch(pattern, host string) bool {
+	expr := regexp.QuoteMeta(pattern)
+	expr = strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(expr)
+	ok, _ := regexp.MatchString("(?i)^"+expr+"$", host)
+	return ok
+}
+
+// matches reports whether a Host block applies to host. Match blocks have
+// conditions that can't be evaluated statically and never match.
+func (b sshBlock) matches(host string) bool {
+	if b.Match {
+		return false
+	}
+	matched := false
+	for _, pattern := range b.Patterns {
+		if strings.HasPrefix(pattern, "!") {
+			if sshPatternMatch(pattern[1:], host) {
+				return false
+			}
+		} else if sshPatternMatch(pattern, host) {
+			matched = true
+		}
+	}
+	return matched
+}
+
+func (b sshBlock) option(key string) (sshOption, bool) {
+	for _, o := range b.Options {
+		if o.Key == key {
+			return o, true
+		}
+	}
+	return sshOption{}, false
+}
+
+// isGitHubBlock reports whether a block configures a GitHub host
+func (b sshBlock) isGitHubBlock() bool {
+	for _, pattern := range b.Patterns {
+		if strings.HasPrefix(strings.ToLower(pattern), "github.com") {
+			return true
+		}
+	}
+	hostName, ok := b.option("hostname")
+	return ok && strings.EqualFold(hostName.Value, "github.com")
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func isWildcardPattern(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?!")
+}
+
+// lintSSHConfig reports problems with the GitHub related parts of an SSH
+// config that make git authenticate as the wrong user
+func lintSSHConfig(path string) ([]configIssue, error) {
+	blocks, err := parseSSHConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var issues []configIssue
+	add := func(line int, field, format string, args ...interface{}) {
+		issues = append(issues, configIssue{Line: line, Field: field, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	// Duplicate Host patterns: only the first block's values take effect
+	firstSeen := map[string]int{}
+	for _, b := range blocks[1:] {
+		for _, pattern := range b.Patterns {
+			if first, seen := firstSeen[strings.ToLower(pattern)]; seen {
+				add(b.Line, "Host "+pattern, "duplicate of the Host block at line %d; its settings only apply where that block sets nothing", first)
+			} else {
+				firstSeen[strings.ToLower(pattern)] = b.Line
+			}
+		}
+	}
+
+	for i, b := range blocks {
+		for _, o := range b.Options {
+			if o.Key != "identityfile" || strings.Contains(o.Value, "%") || o.Value == "none" {
+				continue
+			}
+			if _, err := os.Stat(expandPath(o.Value)); err != nil {
+				add(o.Line, "IdentityFile", "key file %s does not exist", o.Value)
+			}
+		}
+		if i == 0 || !b.isGitHubBlock() {
+			continue
+		}
+
+		if _, hasKey := b.option("identityfile"); hasKey {
+			if only, ok := b.option("identitiesonly"); !ok || !strings.EqualFold(only.Value, "yes") {
+				add(b.Line, "Host "+strings.Join(b.Patterns, " "), "IdentityFile without \"IdentitiesOnly yes\": keys in ssh-agent are offered first and may authenticate as another user")
+			}
+		}
+
+		// Earlier blocks matching this host take precedence
+		for _, pattern := range b.Patterns {
+			if isWildcardPattern(pattern) {
+				continue
+			}
+			for _, earlier := range blocks[:i] {
+				if !earlier.matches(pattern) || containsFold(earlier.Patterns, pattern) {
+					// Blocks with the same pattern are reported as duplicates
+					continue
+				}
+				var shadowed []string
+				for _, o := range earlier.Options {
+					if sshShadowedOptions[o.Key] {
+						shadowed = append(shadowed, o.Key)
+					}
+				}
+				if len(shadowed) == 0 {
+					continue
+				}
+				where := fmt.Sprintf("the Host %s block at line %d", strings.Join(earlier.Patterns, " "), earlier.Line)
+				if earlier.Line == 0 {
+					where = "settings before the first Host block"
+				}
+				add(b.Line, "Host "+pattern, "shadowed by %s, which sets %s first", where, strings.Join(shadowed, ", "))
+			}
+		}
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].Line < issues[j].Line })
+	return issues, nil
+}
+
+// runSSHConfigLint handles "sshconfig lint [file]"
+func runSSHConfigLint(args []string) error {
+	path := sshConfigPath
+	if len(args) > 1 {
+		return fmt.Errorf("usage: ghs sshconfig lint [file]")
+	}
+	if len(args) == 1 {
+		path = expandPath(args[0])
+	}
+
+	issues, err := lintSSHConfig(path)
+	if err != nil {
+		return fmt.Errorf("failed to read SSH config: %v", err)
+	}
+	if len(issues) == 0 {
+		fmt.Printf("%s: OK\n", path)
+		return nil
+	}
+	for _, issue := range issues {
+		fmt.Printf("%s:%d: %s: %s\n", path, issue.Line, issue.Field, issue.Msg)
+	}
+	return fmt.Errorf("found %d problem(s) in %s", len(issues), path)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// sshGreeting matches GitHub's reply to a successful ssh -T
+var sshGreeting = regexp.MustCompile(`Hi ([A-Za-z0-9-]+)!`)
+
+// sshTestResult is the outcome of testing one account's SSH access
+type sshTestResult struct {
+	Alias string
+	OK    bool
+	Msg   string
+	// TooManyKeys is set when GitHub disconnected before ssh offered the
+	// account's key
+	TooManyKeys bool
+}
+
+// testSSH connects to GitHub through an account's SSH host and checks that
+// GitHub greets the account's username
+func testSSH(alias string, account GitHubAccount) sshTestResult {
+	host := "git@github.com-" + account.Username
+	// GitHub closes the session with exit status 1 after greeting, so the
+	// output decides the result
+	out, err := execCommand("ssh", "-T", "-o", "BatchMode=yes", "-o", "ConnectTimeout=10", host).CombinedOutput()
+	output := strings.TrimSpace(string(out))
+	var timeout *timeoutError
+	if errors.As(err, &timeout) {
+		return sshTestResult{Alias: alias, Msg: err.Error()}
+	}
+
+	match := sshGreeting.FindStringSubmatch(output)
+	switch {
+	case tooManyKeysPattern.MatchString(output):
+		return sshTestResult{Alias: alias, Msg: "GitHub disconnected: too many keys offered before the account's", TooManyKeys: true}
+	case match == nil:
+		if output == "" {
+			output = "no response"
+		}
+		return sshTestResult{Alias: alias, Msg: output}
+	case !strings.EqualFold(match[1], account.Username):
+		return sshTestResult{Alias: alias, Msg: fmt.Sprintf("key authenticates as %s, not %s", match[1], account.Username)}
+	}
+	return sshTestResult{Alias: alias, OK: true, Msg: "authenticated as " + match[1]}
+}
+
+// testAccounts handles "test [alias...] [--all] [--tag tag...] [--fix]"
+func testAccounts(config Config, args []string) error {
+	if err := requireSSH("test"); err != nil {
+		return fmt.Errorf("%v; check the tokens with ghs token check", err)
+	}
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	all := flags.Bool("all", false, "test every account")
+	jobs := flags.Int("jobs", 8, "number of accounts tested in parallel")
+	fix := flags.Bool("fix", false, "make ssh offer only the account's key when the agent has too many")
+	var tags stringList
+	flags.Var(&tags, "tag", "test the accounts with this tag (repeatable)")
+	aliases, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	switch {
+	case len(tags) > 0 && (*all || len(aliases) > 0):
+		return fmt.Errorf("usage: ghs test <alias>... | --all | --tag <tag>... [--jobs n] [--fix]")
+	case len(tags) > 0:
+		if aliases = accountsWithTags(config, tags); len(aliases) == 0 {
+			return fmt.Errorf("no accounts tagged %s", strings.Join(tags, ", "))
+		}
+	case *all:
+		aliases = sortedAliases(config.Accounts)
+	}
+	if len(aliases) == 0 {
+		return fmt.Errorf("usage: ghs test <alias>... | --all | --tag <tag>... [--jobs n] [--fix]")
+	}
+	if aliases, err = config.lookupAliases(aliases); err != nil {
+		return err
+	}
+
+	// The first connection is verified one known_hosts file at a time, since
+	// it may ask; BatchMode would refuse an unknown host key anyway
+	verified := map[string]error{}
+	for _, alias := range aliases {
+		account, _ := config.account(alias)
+		if file := accountKnownHosts(account); !hostKnown(file) {
+			if _, done := verified[file]; !done {
+				verified[file] = verifyHostKey(alias, account)
+			}
+		}
+	}
+
+	results := make([]sshTestResult, len(aliases))
+	bar := newProgress("Testing accounts", len(aliases))
+	forEachParallel(len(aliases), *jobs, func(i int) {
+		account, _ := config.account(aliases[i])
+		if err := verified[accountKnownHosts(account)]; err != nil {
+			results[i] = sshTestResult{Alias: aliases[i], Msg: err.Error()}
+		} else {
+			results[i] = testSSH(aliases[i], account)
+		}
+		bar.step()
+	})
+	bar.finish()
+
+	// Refused keys can also look like a plain publickey failure
+	keys := agentKeyCount()
+	failed := 0
+	var tooMany []string
+	for i, r := range results {
+		status := "ok"
+		if !r.OK {
+			status = "FAILED"
+			failed++
+			if account, _ := config.account(r.Alias); !r.TooManyKeys && keys >= sshMaxAuthTries && strings.Contains(r.Msg, "Permission denied (publickey)") {
+				results[i].TooManyKeys, _ = offersAgentKeys(account)
+			}
+			if results[i].TooManyKeys {
+				tooMany = append(tooMany, r.Alias)
+			}
+		}
+		fmt.Printf("%-15s %-7s %s\n", r.Alias, status, r.Msg)
+	}
+	if len(tooMany) > 0 {
+		if keys > 0 {
+			fmt.Printf("\nThe ssh-agent holds %d keys and ssh offers them all; GitHub disconnects after %d.\n", keys, sshMaxAuthTries)
+		} else {
+			fmt.Printf("\nssh offers more keys than GitHub accepts (%d).\n", sshMaxAuthTries)
+		}
+		for _, alias := range tooMany {
+			if !*fix {
+				fmt.Printf("  ghs test %s --fix   # offer only the account's key\n", alias)
+			} else if err := fixAgentKeys(config, alias); err != nil {
+				warnf("%v", err)
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d account(s) failed the SSH test", failed, len(results))
+	}
+	return nil
+}
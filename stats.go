@@ -0,0 +1,173 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseSince parses a time window such as "30d", "2w" or "12h"
+func parseSince(s string) (time.Duration, error) {
+	if n, err := strconv.Atoi(strings.TrimSuffix(s, "d")); err == nil && strings.HasSuffix(s, "d") {
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	if n, err := strconv.Atoi(strings.TrimSuffix(s, "w")); err == nil && strings.HasSuffix(s, "w") {
+		return time.Duration(n) * 7 * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time window %q, use e.g. 30d, 2w or 12h", s)
+	}
+	return d, nil
+}
+
+// countedItem is a name with a count, used for sorted stats tables
+type countedItem struct {
+	Name  string
+	Count int
+}
+
+func sortedCounts(counts map[string]int) []countedItem {
+	items := make([]countedItem, 0, len(counts))
+	for name, count := range counts {
+		items = append(items, countedItem{name, count})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Count != items[j].Count {
+			return items[i].Count > items[j].Count
+		}
+		return items[i].Name < items[j].Name
+	})
+	return items
+}
+
+// commitEmails counts commit author emails in a repository since a time
+func commitEmails(repo string, since time.Time, counts map[string]int) error {
+	out, err := execCommand("git", "-C", repo, "log", "--all", "--since="+since.Format(time.RFC3339), "--format=%ae").Output()
+	if err != nil {
+		return err
+	}
+	for _, email := range strings.Fields(string(out)) {
+		counts[strings.ToLower(email)]++
+	}
+	return nil
+}
+
+func showStats(config Config, args []string) error {
+	flags := flag.NewFlagSet("stats", flag.ContinueOnError)
+	window := flags.String("since", "30d", "time window, e.g. 30d, 2w or 12h")
+	var scanDirs stringList
+	flags.Var(&scanDirs, "scan", "count commits in repositories below this directory (repeatable)")
+	if _, err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	d, err := parseSince(*window)
+	if err != nil {
+		return err
+	}
+	since := time.Now().Add(-d)
+
+	entries, err := readHistory(since)
+	if err != nil {
+		return fmt.Errorf("failed to read history: %v", err)
+	}
+
+	usage := map[string]int{}
+	for _, e := range entries {
+		usage[e.Alias]++
+	}
+	fmt.Printf("Account usage (last %s):\n", *window)
+	if len(usage) == 0 {
+		fmt.Println("  No switches recorded.")
+	}
+	for _, item := range sortedCounts(usage) {
+		fmt.Printf("  %-15s %d switch(es)\n", item.Name, item.Count)
+	}
+
+	// Most recent switch per repository, newest first
+	fmt.Println("\nRecently switched repositories:")
+	seen := map[string]bool{}
+	var repos []string
+	shown := 0
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if e.Repo == "" || seen[e.Repo] {
+			continue
+		}
+		seen[e.Repo] = true
+		repos = append(repos, e.Repo)
+		if shown < 10 {
+			fmt.Printf("  %s  %-15s %s\n", e.Time.Local().Format("2006-01-02 15:04"), e.Alias, e.Repo)
+			shown++
+		}
+	}
+	if shown == 0 {
+		fmt.Println("  None.")
+	}
+
+	// Without --scan, count commits in the repositories from the journal
+	if len(scanDirs) > 0 {
+		repos = nil
+		for _, dir := range scanDirs {
+			found, err := findRepos(dir)
+			if err != nil {
+				warnf("failed to scan %s: %v", dir, err)
+			}
+			repos = append(repos, found...)
+		}
+	}
+
+	perRepo := make([]map[string]int, len(repos))
+	errs := make([]error, len(repos))
+	bar := newProgress("Counting commits", len(repos))
+	forEachParallel(len(repos), defaultJobs(), func(i int) {
+		defer bar.step()
+		if _, err := os.Stat(repos[i]); err != nil {
+			return
+		}
+		perRepo[i] = map[string]int{}
+		errs[i] = commitEmails(repos[i], since, perRepo[i])
+	})
+	bar.finish()
+
+	emails := map[string]int{}
+	scanned := 0
+	for i, repo := range repos {
+		if errs[i] != nil {
+			warnf("failed to read commits in %s: %v", repo, errs[i])
+			continue
+		}
+		if perRepo[i] == nil {
+			continue
+		}
+		for email, count := range perRepo[i] {
+			emails[email] += count
+		}
+		scanned++
+	}
+
+	byAccount := map[string]int{}
+	for email, count := range emails {
+		name := email + " (no account)"
+		for alias, account := range config.Accounts {
+			if strings.EqualFold(account.Email, email) {
+				name = alias
+				break
+			}
+		}
+		byAccount[name] += count
+	}
+
+	fmt.Printf("\nCommits per identity (last %s, %d repositories):\n", *window, scanned)
+	if len(byAccount) == 0 {
+		fmt.Println("  No commits found.")
+	}
+	for _, item := range sortedCounts(byAccount) {
+		fmt.Printf("  %-15s %d\n", item.Name, item.Count)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// statusPorcelainVersion is the version of "status --porcelain". Fields are
+// only ever added to a version; removing or changing one needs a new version,
+// and the old one stays available through --porcelain=v1.
+const statusPorcelainVersion = "v1"
+
+// statusRemote is a remote in the status
+type statusRemote struct {
+	Name  string
+	Alias string
+	URL   string
+}
+
+// repoStatus is the identity that applies in a directory
+type repoStatus struct {
+	Root     string
+	Alias    string
+	Name     string
+	Email    string
+	Source   string
+	Expected string
+	Signing  string
+	Remotes  []statusRemote
+}
+
+// collectStatus asks git for the identity in the current directory and the
+// config for the account it belongs to
+func collectStatus(config Config) (repoStatus, error) {
+	var status repoStatus
+	if repo, err := currentRepo(); err == nil {
+		status.Root = repo.Root
+		if repo.Bare {
+			status.Root = repo.GitDir
+		}
+	}
+	get := func(key string) string {
+		out, _ := execCommand("git", "config", key).Output()
+		return strings.TrimSpace(string(out))
+	}
+	status.Name, status.Signing = get("user.name"), get("user.signingkey")
+
+	out, _ := execCommand("git", "config", "--show-scope", "user.email").Output()
+	scope, email, _ := strings.Cut(strings.TrimSpace(string(out)), "\t")
+	status.Email = email
+	switch scope {
+	case "local", "worktree":
+		status.Source = "repo"
+	case "global", "system", "command":
+		status.Source = scope
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return status, err
+	}
+	// Fragments of mapped directories are included from the global config
+	which := whichAccount(config, dir)
+	if scope == "global" && which.Source == "mapped" && strings.EqualFold(which.Email, email) {
+		status.Source = "mapped"
+	}
+	status.Alias, status.Expected = aliasForEmail(config, email), which.Expected
+
+	if status.Root != "" {
+		remotes, err := repoRemotes(config)
+		if err != nil {
+			return status, err
+		}
+		for _, r := range remotes {
+			status.Remotes = append(status.Remotes, statusRemote{r.Name, r.Alias, r.URL})
+		}
+	}
+	return status, nil
+}
+
+// orDash stands in for empty porcelain values
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// printStatusPorcelain writes the status in the v1 porcelain format: a
+// version line, then one "<key> <value>" per line where the value is the
+// rest of the line and "-" when unset
+func printStatusPorcelain(status repoStatus) {
+	fmt.Printf("# ghs status %s\n", statusPorcelainVersion)
+	fmt.Printf("repo %s\n", orDash(status.Root))
+	fmt.Printf("alias %s\n", orDash(status.Alias))
+	fmt.Printf("name %s\n", orDash(status.Name))
+	fmt.Printf("email %s\n", orDash(status.Email))
+	fmt.Printf("source %s\n", orDash(status.Source))
+	fmt.Printf("expected %s\n", orDash(status.Expected))
+	fmt.Printf("signingkey %s\n", orDash(status.Signing))
+	for _, r := range status.Remotes {
+		fmt.Printf("remote %s %s %s\n", r.Name, orDash(r.Alias), r.URL)
+	}
+}
+
+// runStatus handles "status": it shows which account commits here, and with
+// --porcelain prints it in a format that stays the same across releases
+func runStatus(config Config, args []string) error {
+	flags := flag.NewFlagSet("status", flag.ContinueOnError)
+	porcelain := flags.String("porcelain", "", "print the stable machine-readable format (v1)")
+	// --porcelain alone means the current version
+	for i, arg := range args {
+		if arg == "--porcelain" || arg == "-porcelain" {
+			args[i] = "--porcelain=" + statusPorcelainVersion
+		}
+	}
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return fmt.Errorf("usage: ghs status [--porcelain[=v1]]")
+	}
+	if *porcelain != "" && *porcelain != statusPorcelainVersion {
+		return fmt.Errorf("unknown porcelain version %q, expected %s", *porcelain, statusPorcelainVersion)
+	}
+
+	status, err := collectStatus(config)
+	if err != nil {
+		return err
+	}
+	if *porcelain != "" {
+		printStatusPorcelain(status)
+		return nil
+	}
+
+	if status.Root != "" {
+		fmt.Printf("Repository: %s\n", status.Root)
+	} else {
+		fmt.Println("Not in a git repository")
+	}
+	switch {
+	case status.Email == "":
+		fmt.Println("Identity:   none, git has no user.email here")
+	case status.Alias != "":
+		fmt.Printf("Identity:   %s <%s>, account '%s' (%s config)\n", status.Name, status.Email, status.Alias, status.Source)
+	default:
+		fmt.Printf("Identity:   %s <%s>, no matching account (%s config)\n", status.Name, status.Email, status.Source)
+	}
+	if status.Signing != "" {
+		fmt.Printf("Signing:    %s\n", status.Signing)
+	}
+	if status.Expected != "" && status.Expected != status.Alias {
+		warnf("the origin belongs to account '%s'; run 'ghs switch %s'", status.Expected, status.Expected)
+	}
+	for _, r := range status.Remotes {
+		fmt.Printf("Remote:     %s %s (%s)\n", r.Name, r.URL, orDash(r.Alias))
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// failureContext is what is known about a failed git or ssh operation
+type failureContext struct {
+	Config  Config
+	Alias   string
+	Account GitHubAccount
+	Owner   string
+	Repo    string
+}
+
+// failurePattern recognizes a known failure in stderr and tells how to fix
+// it
+type failurePattern struct {
+	Pattern *regexp.Regexp
+	Cause   string
+	Fix     func(match []string, ctx failureContext) []string
+}
+
+// failurePatterns are tried in order; the first match wins
+var failurePatterns = []failurePattern{
+	{
+		regexp.MustCompile(`REMOTE HOST IDENTIFICATION HAS CHANGED|Host key verification failed`),
+		"the SSH host key of github.com doesn't match your known_hosts",
+		func(_ []string, _ failureContext) []string {
+			return []string{
+				"Check GitHub's published fingerprints: https://docs.github.com/en/authentication/keeping-your-account-and-data-secure/githubs-ssh-key-fingerprints",
+				"then remove the old key: ssh-keygen -R github.com",
+			}
+		},
+	},
+	{
+		regexp.MustCompile(`Permission to (\S+?)(?:\.git)? denied to ([A-Za-z0-9-]+)`),
+		"git authenticated as another GitHub user",
+		func(m []string, ctx failureContext) []string {
+			fixes := []string{fmt.Sprintf("GitHub saw user %s, which has no write access to %s", m[2], m[1])}
+			if other := aliasForUsername(ctx.Config, m[2]); other != "" && other != ctx.Alias {
+				fixes = append(fixes, fmt.Sprintf("%s is account '%s'; its key was offered first", m[2], other))
+			}
+			return append(fixes,
+				"ghs sshconfig lint     # find Host blocks without IdentitiesOnly or shadowed by wildcards",
+				"ssh-add -D             # or drop the other keys from the agent")
+		},
+	},
+	{
+		regexp.MustCompile(`Could not resolve hostname (github\.com-[A-Za-z0-9-]+)`),
+		"the SSH host alias is missing from your SSH config",
+		func(m []string, _ failureContext) []string {
+			return []string{"ghs sshconfig update   # writes the Host " + m[1] + " block"}
+		},
+	},
+	{
+		regexp.MustCompile(`Could not resolve hostname|Connection timed out|Network is unreachable|Connection refused`),
+		"github.com can't be reached",
+		func(_ []string, _ failureContext) []string {
+			return []string{"Check your network, VPN or proxy, then try again"}
+		},
+	},
+	{
+		regexp.MustCompile(`sign_and_send_pubkey: signing failed|agent refused operation`),
+		"the SSH agent or hardware token refused to sign",
+		func(_ []string, ctx failureContext) []string {
+			if ctx.Account.hardwareKey() {
+				return []string{"Insert and unlock the token, then check it: ghs doctor " + ctx.Alias}
+			}
+			return []string{"Unlock the key in your agent: ssh-add " + ctx.Account.SSHKeyPath}
+		},
+	},
+	{
+		tooManyKeysPattern,
+		"the ssh-agent offered too many keys before the account's",
+		func(_ []string, ctx failureContext) []string {
+			if ctx.Alias == "" {
+				return []string{"ssh-add -D             # drop the keys from the agent, or use an account host"}
+			}
+			return []string{"ghs test " + ctx.Alias + " --fix   # offer only the account's key",
+				"ssh-add -D             # or drop the other keys from the agent"}
+		},
+	},
+	{
+		regexp.MustCompile(`Permission denied \(publickey\)`),
+		"GitHub didn't accept any key ssh offered",
+		func(_ []string, ctx failureContext) []string {
+			if ctx.Alias == "" {
+				return []string{"Clone with an account: ghs clone <url> --account <alias>"}
+			}
+			fixes := []string{"ghs test " + ctx.Alias + "    # shows which user the key authenticates as"}
+			if ctx.Account.SSHKeyPath != "" {
+				fixes = append(fixes, fmt.Sprintf("Add %s.pub to https://github.com/settings/keys while logged in as %s",
+					strings.TrimSuffix(ctx.Account.SSHKeyPath, ".pub"), ctx.Account.Username))
+			}
+			return fixes
+		},
+	},
+	{
+		regexp.MustCompile(`(?i)repository not found|not found.*could not read from remote`),
+		"the repository doesn't exist or the account can't see it",
+		func(_ []string, ctx failureContext) []string {
+			target := ctx.Owner + "/" + ctx.Repo
+			fixes := []string{"Check the spelling of " + target}
+			if ctx.Alias != "" {
+				fixes = append(fixes, fmt.Sprintf("Private repositories need an account with access; '%s' is %s", ctx.Alias, ctx.Account.Username))
+			}
+			return append(fixes, "ghs which "+target+"    # shows which account ghs picks and why")
+		},
+	},
+}
+
+// aliasForUsername finds the account of a GitHub user
+func aliasForUsername(config Config, username string) string {
+	for _, alias := range sortedAliases(config.Accounts) {
+		if strings.EqualFold(config.Accounts[alias].Username, username) {
+			return alias
+		}
+	}
+	return ""
+}
+
+// suggestFix prints the cause and fix of the first known failure in stderr.
+// It reports whether one matched.
+func suggestFix(stderr string, ctx failureContext) bool {
+	for _, p := range failurePatterns {
+		if m := p.Pattern.FindStringSubmatch(stderr); m != nil {
+			fmt.Printf("\nLikely cause: %s\n", p.Cause)
+			for _, fix := range p.Fix(m, ctx) {
+				fmt.Printf("  %s\n", fix)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// teeStderr returns a writer showing output on stderr while keeping a copy
+// for suggestFix
+func teeStderr() (io.Writer, *bytes.Buffer) {
+	var buf bytes.Buffer
+	return io.MultiWriter(os.Stderr, &buf), &buf
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// previewSwitch handles "switch --dry-run": it prints the repository
+// settings a switch would set, change or remove, with their old and new
+// values, and the commands it would run, without changing anything
+func previewSwitch(config Config, alias string, worktree, gh bool) error {
+	alias, account, err := config.lookupAccount(alias)
+	if err != nil {
+		return err
+	}
+	account = overrideSigning(account)
+	repo, err := currentRepo()
+	if err != nil {
+		return err
+	}
+
+	var actions []string
+	if worktree {
+		if !repo.Worktree {
+			return fmt.Errorf("--worktree needs a linked worktree (see git worktree add)")
+		}
+		out, _ := execCommand("git", "config", "--local", "extensions.worktreeConfig").Output()
+		if strings.TrimSpace(string(out)) != "true" {
+			actions = append(actions, "git config --local extensions.worktreeConfig true")
+		}
+		gitConfigScope = "--worktree"
+	}
+	if account.LFS != nil {
+		if err := requireGitLFS(alias); err != nil {
+			return err
+		}
+		actions = append(actions, "git lfs install --local")
+	}
+
+	edits, signingKey := switchEdits(config, alias, account, repo)
+	fmt.Printf("Switching to account '%s' (%s, %s) would change %s:\n", alias, account.Name, account.Email, repoConfigPath(repo))
+	changed := 0
+	for _, e := range edits {
+		old, found := repoConfigValue(repo, e.key)
+		switch {
+		case e.unset && found:
+			fmt.Printf("  unset  %-24s %s\n", e.key, old)
+		case e.unset:
+			continue
+		case !found:
+			fmt.Printf("  set    %-24s %s\n", e.key, e.value)
+		case old != e.value:
+			fmt.Printf("  change %-24s %s -> %s\n", e.key, old, e.value)
+		default:
+			continue
+		}
+		changed++
+	}
+	if changed == 0 {
+		fmt.Println("  nothing, the settings already match")
+	}
+
+	if signingKey != "" && signsWithGPG(account) && currentTTY() != "" {
+		actions = append(actions, "gpg-connect-agent updatestartuptty /bye")
+	}
+	if gh {
+		if active, err := ghActiveUser(); err != nil || !strings.EqualFold(active, account.Username) {
+			actions = append(actions, "gh auth switch --hostname github.com --user "+account.Username)
+		}
+	}
+	if len(actions) > 0 {
+		fmt.Println("and run:")
+		for _, action := range actions {
+			fmt.Printf("  %s\n", action)
+		}
+	}
+	fmt.Println("Dry run, no changes made")
+	return nil
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// syncFileName is the name of the config file inside the sync repository
+const syncFileName = "github-switcher.json"
+
+// SyncSettings points at the git repository used to share the config
+type SyncSettings struct {
+	Remote string `json:"remote"`
+}
+
+func syncDir() string {
+	return filepath.Join(stateDir, "sync")
+}
+
+// portable returns the parts of the config that are shared between machines:
+// machine-local state such as the active profile and sync settings is dropped
+func (c Config) portable() Config {
+	c = c.fileView()
+	c.ActiveProfile = ""
+	c.Sync = nil
+	return c
+}
+
+// sharedSettings are the fields of Config besides accounts, profiles and
+// owner rules that are shared between machines
+var sharedSettings = []string{
+	"Defaults", "APICacheTTL", "Retries", "CommandTimeout", "Watch",
+	"Transport", "DefaultHost", "GHAuthSwitch", "SilenceHealthWarnings",
+}
+
+// settingName returns the name of a Config field in the config file
+func settingName(field string) string {
+	f, _ := reflect.TypeOf(Config{}).FieldByName(field)
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	return name
+}
+
+// reconcileSettings copies the shared settings src sets into dst and returns
+// the ones that changed. Settings src leaves unset are kept.
+func reconcileSettings(dst *Config, src Config) (updated []string) {
+	local, remote := reflect.ValueOf(dst).Elem(), reflect.ValueOf(src)
+	for _, field := range sharedSettings {
+		value := remote.FieldByName(field)
+		if value.IsZero() || reflect.DeepEqual(local.FieldByName(field).Interface(), value.Interface()) {
+			continue
+		}
+		local.FieldByName(field).Set(value)
+		updated = append(updated, settingName(field))
+	}
+	return updated
+}
+
+// reconcileOwnerRules copies the owner rules of src into dst, replacing the
+// rules for the same pattern. Rules only present locally are kept and
+// returned by pattern.
+func reconcileOwnerRules(dst, src []OwnerRule) (rules []OwnerRule, added, updated, localOnly []string) {
+	local, remote := map[string]OwnerRule{}, map[string]bool{}
+	for _, rule := range dst {
+		local[rule.Pattern] = rule
+	}
+	for _, rule := range src {
+		remote[rule.Pattern] = true
+	}
+	for _, rule := range dst {
+		if !remote[rule.Pattern] {
+			rules = append(rules, rule)
+			localOnly = append(localOnly, rule.Pattern)
+		}
+	}
+	for _, rule := range src {
+		if existing, exists := local[rule.Pattern]; !exists {
+			added = append(added, rule.Pattern)
+		} else if existing != rule {
+			updated = append(updated, rule.Pattern)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, added, updated, localOnly
+}
+
+// syncGit runs a git command inside the sync repository
+func syncGit(args ...string) error {
+	cmd := execForeground("git", append([]string{"-C", syncDir()}, args...)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func syncInit(config Config, remote string) error {
+	if config.Sync != nil {
+		return fmt.Errorf("sync is already set up with %s", config.Sync.Remote)
+	}
+	if _, err := os.Stat(syncDir()); err == nil {
+		return fmt.Errorf("%s already exists, remove it first", syncDir())
+	}
+	if err := mkdirPrivate(stateDir); err != nil {
+		return fmt.Errorf("failed to create %s: %v", stateDir, err)
+	}
+
+	cmd := execForeground("git", "clone", remote, syncDir())
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to clone sync repository: %v", err)
+	}
+
+	config.Sync = &SyncSettings{Remote: remote}
+	if err := saveConfig(config); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(filepath.Join(syncDir(), syncFileName)); err == nil {
+		fmt.Println("The repository already holds a config. Run 'ghs sync pull' to apply it.")
+	} else {
+		fmt.Println("Sync repository ready. Run 'ghs sync push' to upload this machine's config.")
+	}
+	return nil
+}
+
+func syncPush(config Config) error {
+	data, err := json.MarshalIndent(config.portable(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writePrivateFile(filepath.Join(syncDir(), syncFileName), append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write sync file: %v", err)
+	}
+
+	if err := syncGit("add", syncFileName); err != nil {
+		return fmt.Errorf("failed to stage sync file: %v", err)
+	}
+	// "diff --cached --quiet" exits 0 when nothing changed
+	if execCommand("git", "-C", syncDir(), "diff", "--cached", "--quiet").Run() == nil {
+		fmt.Println("Config unchanged, nothing to push.")
+		return nil
+	}
+
+	host, _ := os.Hostname()
+	if err := syncGit("commit", "-q", "-m", fmt.Sprintf("Update ghs config from %s", host)); err != nil {
+		return fmt.Errorf("failed to commit sync file: %v", err)
+	}
+	if err := syncGit("push", "-q", "origin", "HEAD"); err != nil {
+		return fmt.Errorf("failed to push sync repository: %v", err)
+	}
+	fmt.Println("Config pushed.")
+	return nil
+}
+
+// reconcileAccounts copies accounts from src into dst. Accounts only present
+// locally are kept and returned so the user can push them.
+func reconcileAccounts(dst, src map[string]GitHubAccount) (added, updated, localOnly []string) {
+	for alias, account := range src {
+		if existing, exists := dst[alias]; !exists {
+			added = append(added, alias)
+		} else if !reflect.DeepEqual(existing, account) {
+			updated = append(updated, alias)
+		}
+		dst[alias] = account
+	}
+	for alias := range dst {
+		if _, exists := src[alias]; !exists {
+			localOnly = append(localOnly, alias)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(updated)
+	sort.Strings(localOnly)
+	return added, updated, localOnly
+}
+
+func syncPull(config Config) error {
+	if err := syncGit("pull", "-q", "--ff-only"); err != nil {
+		return fmt.Errorf("failed to pull sync repository: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(syncDir(), syncFileName))
+	if err != nil {
+		return fmt.Errorf("failed to read sync file: %v", err)
+	}
+	if issues := validateConfigData(data); len(issues) > 0 {
+		printConfigIssues(syncFileName, issues)
+		return fmt.Errorf("the sync file has %d problem(s); fix them and push again before pulling", len(issues))
+	}
+	var remote Config
+	if err := json.Unmarshal(data, &remote); err != nil {
+		return fmt.Errorf("failed to parse sync file: %v", err)
+	}
+
+	// Reconcile on the on-disk layout, then reload the active profile
+	active := config.ActiveProfile
+	local := config.fileView()
+	if local.Accounts == nil {
+		local.Accounts = map[string]GitHubAccount{}
+	}
+
+	report := func(section string, added, updated, localOnly []string) {
+		for _, alias := range added {
+			fmt.Printf("  added    %s%s\n", section, alias)
+		}
+		for _, alias := range updated {
+			fmt.Printf("  updated  %s%s\n", section, alias)
+		}
+		for _, alias := range localOnly {
+			fmt.Printf("  local    %s%s (not in sync repository)\n", section, alias)
+		}
+	}
+
+	added, updated, localOnly := reconcileAccounts(local.Accounts, remote.Accounts)
+	report("", added, updated, localOnly)
+	for name, profile := range remote.Profiles {
+		if local.Profiles == nil {
+			local.Profiles = map[string]Profile{}
+		}
+		accounts := local.Profiles[name].Accounts
+		if accounts == nil {
+			accounts = map[string]GitHubAccount{}
+		}
+		added, updated, localOnly := reconcileAccounts(accounts, profile.Accounts)
+		local.Profiles[name] = Profile{Accounts: accounts}
+		report(name+"/", added, updated, localOnly)
+	}
+	var rules []OwnerRule
+	rules, added, updated, localOnly = reconcileOwnerRules(local.OwnerRules, remote.OwnerRules)
+	local.OwnerRules = rules
+	report("owner rule ", added, updated, localOnly)
+	report("", nil, reconcileSettings(&local, remote), nil)
+
+	if err := local.useProfile(active); err != nil {
+		warnf("%v, using default profile", err)
+	}
+	if err := saveConfig(local); err != nil {
+		return err
+	}
+	if err := updateManagedFiles(local); err != nil {
+		fmt.Printf("Error: %v\n", err)
+	}
+	fmt.Println("Config pulled and SSH config regenerated.")
+	return nil
+}
+
+// runSyncCommand handles the "sync" subcommands
+func runSyncCommand(config Config, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: ghs sync <init <repo-url>|push|pull>")
+	}
+
+	if args[0] == "init" {
+		if len(args) < 2 {
+			return fmt.Errorf("usage: ghs sync init <repo-url>")
+		}
+		return syncInit(config, args[1])
+	}
+
+	if config.Sync == nil {
+		return fmt.Errorf("sync is not set up, run 'ghs sync init <repo-url>' first")
+	}
+	switch args[0] {
+	case "push":
+		return syncPush(config)
+	case "pull":
+		return syncPull(config)
+	default:
+		return fmt.Errorf("unknown sync subcommand: %s", args[0])
+	}
+}
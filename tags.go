@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// hasTag reports whether the account carries the given tag
+func (a GitHubAccount) hasTag(tag string) bool {
+	for _, t := range a.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// accountsWithTags returns the sorted aliases of accounts carrying every one
+// of the given tags; with no tags all aliases are returned
+func accountsWithTags(config Config, tags []string) []string {
+	var aliases []string
+	for alias, account := range config.Accounts {
+		matches := true
+		for _, tag := range tags {
+			if !account.hasTag(tag) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			aliases = append(aliases, alias)
+		}
+	}
+	sort.Strings(aliases)
+	return aliases
+}
+
+// addTags adds tags to an account, ignoring ones it already has
+func addTags(account GitHubAccount, tags []string) GitHubAccount {
+	for _, tag := range tags {
+		if !account.hasTag(tag) {
+			account.Tags = append(account.Tags, tag)
+		}
+	}
+	sort.Strings(account.Tags)
+	return account
+}
+
+// removeTags removes tags from an account
+func removeTags(account GitHubAccount, tags []string) GitHubAccount {
+	var kept []string
+	for _, t := range account.Tags {
+		remove := false
+		for _, tag := range tags {
+			if strings.EqualFold(t, tag) {
+				remove = true
+				break
+			}
+		}
+		if !remove {
+			kept = append(kept, t)
+		}
+	}
+	account.Tags = kept
+	return account
+}
+
+// runTagCommand handles "tag add|remove <alias> <tag>..."
+func runTagCommand(config Config, args []string) error {
+	if len(args) < 3 || (args[0] != "add" && args[0] != "remove") {
+		return fmt.Errorf("usage: ghs tag <add|remove> <alias> <tag>...")
+	}
+
+	alias, err := config.lookupAlias(args[1])
+	if err != nil {
+		return err
+	}
+	account := config.Accounts[alias]
+	for _, tag := range args[2:] {
+		if err := validateAlias(tag); err != nil {
+			return fmt.Errorf("invalid tag %q: use letters, digits, '.', '_' or '-'", tag)
+		}
+	}
+
+	if args[0] == "add" {
+		account = addTags(account, args[2:])
+	} else {
+		account = removeTags(account, args[2:])
+	}
+	config.Accounts[alias] = account
+	if err := saveConfig(config); err != nil {
+		return err
+	}
+
+	fmt.Printf("Tags of '%s': %s\n", alias, formatTags(account.Tags))
+	return nil
+}
+
+func formatTags(tags []string) string {
+	if len(tags) == 0 {
+		return "(none)"
+	}
+	return strings.Join(tags, ", ")
+}
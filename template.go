@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// guardHookName is the hook installed into every account template
+const guardHookName = "pre-commit"
+
+// guardHookMarker identifies hooks written by ghs, which may be overwritten
+const guardHookMarker = "# ghs identity guard"
+
+func templateDir(alias string) string {
+	return filepath.Join(stateDir, "templates", alias)
+}
+
+// guardHook returns a pre-commit hook refusing commits whose author email
+// doesn't belong to the account, or to the account GHS_ACCOUNT names as
+// ghs exec and ghs env set it
+func guardHook(alias string, account GitHubAccount) string {
+	self, err := os.Executable()
+	if err != nil {
+		self = "ghs"
+	}
+	return fmt.Sprintf(`#!/bin/sh
+%s for account '%s'. Remove this line to keep local changes.
+account=%s
+expected=%s
+if [ -n "$GHS_ACCOUNT" ]; then
+	account=$GHS_ACCOUNT
+	expected=$(unset GIT_AUTHOR_EMAIL; eval "$(%s env "$GHS_ACCOUNT" 2>/dev/null)" >/dev/null 2>&1; printf '%%s' "$GIT_AUTHOR_EMAIL")
+	if [ -z "$expected" ]; then
+		echo "ghs: account '$account' from GHS_ACCOUNT not found" >&2
+		exit 1
+	fi
+fi
+actual=$(git var GIT_AUTHOR_IDENT | sed 's/^.*<\(.*\)>.*$/\1/')
+if [ "$actual" != "$expected" ]; then
+	echo "ghs: this commit needs account '$account' ($expected) but the author email is '$actual'" >&2
+	echo "ghs: run 'ghs exec $account -- git commit' or commit with --no-verify" >&2
+	exit 1
+fi
+`, guardHookMarker, alias, shellQuote(alias), shellQuote(account.Email), shellQuote(self))
+}
+
+// ensureTemplate creates or refreshes the template directory of an account:
+// hooks/pre-commit with the identity guard and an info/exclude to customize.
+// Files the user edited are left alone.
+func ensureTemplate(alias string, account GitHubAccount) error {
+	dir := templateDir(alias)
+	for _, sub := range []string{"hooks", "info"} {
+		if err := mkdirPrivate(filepath.Join(dir, sub)); err != nil {
+			return fmt.Errorf("failed to create template directory: %v", err)
+		}
+	}
+
+	hook := filepath.Join(dir, "hooks", guardHookName)
+	if data, err := os.ReadFile(hook); err == nil && !containsLine(string(data), guardHookMarker) {
+		// The user took over the hook
+	} else if err := writePrivateHook(hook, []byte(guardHook(alias, account))); err != nil {
+		return fmt.Errorf("failed to write identity guard hook: %v", err)
+	}
+
+	exclude := filepath.Join(dir, "info", "exclude")
+	if _, err := os.Stat(exclude); os.IsNotExist(err) {
+		content := "# Patterns ignored in every repository created for this account\n"
+		if err := writePrivateFile(exclude, []byte(content)); err != nil {
+			return fmt.Errorf("failed to write exclude file: %v", err)
+		}
+	}
+	return nil
+}
+
+// containsLine reports whether text has a line starting with prefix
+func containsLine(text, prefix string) bool {
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
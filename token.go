@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// tokenFeature is a ghs feature that needs a token scope
+type tokenFeature struct {
+	Name   string
+	Scopes []string // any of these is enough
+}
+
+// tokenFeatures lists what each API feature of ghs needs from a classic token
+var tokenFeatures = []tokenFeature{
+	{"init --create (private repositories)", []string{"repo"}},
+	{"init --create (public repositories)", []string{"repo", "public_repo"}},
+	{"purge (delete the SSH key)", []string{"admin:public_key"}},
+}
+
+// impliedScopes maps a scope to the scopes that include it
+var impliedScopes = map[string][]string{
+	"public_repo":      {"repo"},
+	"repo:status":      {"repo"},
+	"read:org":         {"write:org", "admin:org"},
+	"write:org":        {"admin:org"},
+	"read:public_key":  {"write:public_key", "admin:public_key"},
+	"write:public_key": {"admin:public_key"},
+	"read:user":        {"user"},
+	"user:email":       {"user"},
+}
+
+// hasScope reports whether scopes grant want, directly or through a broader
+// scope
+func hasScope(scopes []string, want string) bool {
+	for _, scope := range scopes {
+		if scope == want {
+			return true
+		}
+		for _, broader := range impliedScopes[want] {
+			if scope == broader {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// tokenInfo is what GitHub reports about a token
+type tokenInfo struct {
+	Login  string
+	Scopes []string
+	// Classic is false for fine-grained and app tokens, which have
+	// permissions instead of scopes
+	Classic bool
+	// Expires is when the token expires, zero when it doesn't or GitHub
+	// doesn't say
+	Expires time.Time
+}
+
+// inspectToken asks GitHub who a token belongs to and which scopes it has.
+// The answer is in the response headers, so the API cache is bypassed.
+func inspectToken(token string) (tokenInfo, error) {
+	var info tokenInfo
+	if offline {
+		return info, fmt.Errorf("%w: offline mode is on", errOffline)
+	}
+	req, err := http.NewRequest("GET", githubAPIURL+"/user", nil)
+	if err != nil {
+		return info, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return info, fmt.Errorf("%w: %v", errOffline, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized {
+		return info, fmt.Errorf("GitHub rejected the token (expired or revoked)")
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return info, err
+	}
+	var user struct {
+		Login string `json:"login"`
+	}
+	if err := decodeAPIResponse(data, &user); err != nil || resp.StatusCode >= 300 {
+		return info, fmt.Errorf("GitHub API GET /user: %s", resp.Status)
+	}
+	info.Login = user.Login
+	if header := resp.Header.Get("GitHub-Authentication-Token-Expiration"); header != "" {
+		for _, layout := range []string{"2006-01-02 15:04:05 MST", "2006-01-02 15:04:05 -0700"} {
+			if t, err := time.Parse(layout, header); err == nil {
+				info.Expires = t
+				break
+			}
+		}
+	}
+	if header, ok := resp.Header["X-Oauth-Scopes"]; ok {
+		info.Classic = true
+		for _, scope := range strings.Split(strings.Join(header, ","), ",") {
+			if scope = strings.TrimSpace(scope); scope != "" {
+				info.Scopes = append(info.Scopes, scope)
+			}
+		}
+	}
+	return info, nil
+}
+
+// checkToken prints the scopes of an account's default token and of each of
+// its organization tokens
+func checkToken(alias string, account GitHubAccount) bool {
+	ok := checkTokenScope(alias, account, "", "")
+	for _, scope := range sortedKeys(account.Tokens) {
+		if scope != defaultTokenScope {
+			owner, repo, _ := strings.Cut(scope, "/")
+			ok = checkTokenScope(alias+" "+scope, account, owner, repo) && ok
+		}
+	}
+	return ok
+}
+
+// checkTokenScope prints the scopes of the token used for owner/repo
+// against what the features of ghs need, with hints to fix what's missing.
+// alias labels the output.
+func checkTokenScope(alias string, account GitHubAccount, owner, repo string) bool {
+	token, source, err := tokenFor(account, owner, repo)
+	if err != nil {
+		fmt.Printf("%s: %v\n", alias, err)
+		return false
+	}
+	info, err := inspectToken(token)
+	if err != nil {
+		fmt.Printf("%s: token from %s: %v\n", alias, source, err)
+		return false
+	}
+
+	ok := true
+	fmt.Printf("%s: token from %s belongs to %s\n", alias, source, info.Login)
+	if !strings.EqualFold(info.Login, account.Username) {
+		fmt.Printf("  Warning: the account's username is %s; API calls act as %s\n", account.Username, info.Login)
+		ok = false
+	}
+	if !info.Classic {
+		fmt.Println("  Fine-grained or app token: it has permissions instead of scopes, which GitHub")
+		fmt.Println("  doesn't report. Make sure it can administer repositories and SSH keys as needed.")
+		return ok
+	}
+	if len(info.Scopes) == 0 {
+		fmt.Println("  Scopes: none")
+	} else {
+		fmt.Printf("  Scopes: %s\n", strings.Join(info.Scopes, ", "))
+	}
+
+	var missing []string
+	for _, feature := range tokenFeatures {
+		granted := false
+		for _, scope := range feature.Scopes {
+			granted = granted || hasScope(info.Scopes, scope)
+		}
+		status := "ok"
+		if !granted {
+			status = "missing"
+			missing = append(missing, feature.Scopes[0])
+		}
+		fmt.Printf("  %-8s %-40s needs %s\n", status, feature.Name, strings.Join(feature.Scopes, " or "))
+	}
+	if len(missing) > 0 {
+		if source == "gh auth token" || strings.HasPrefix(source, tokenRefGH+" ") {
+			fmt.Printf("  Fix: gh auth refresh --hostname github.com --scopes %s\n", strings.Join(missing, ","))
+		} else {
+			fmt.Printf("  Fix: add %s to the token at https://github.com/settings/tokens\n", strings.Join(missing, ", "))
+		}
+	}
+	return ok
+}
+
+// runTokenCommand handles the "token" subcommands
+func runTokenCommand(config Config, args []string) (Config, error) {
+	if len(args) < 1 {
+		return config, fmt.Errorf("usage: ghs token <check|set|unset|list|store|forget>")
+	}
+	switch args[0] {
+	case "check":
+		return config, checkTokens(config, args[1:])
+	case "set", "unset":
+		return setAccountToken(config, args[1:], args[0] == "set")
+	case "list":
+		listAccountTokens(config)
+		return config, nil
+	case "store":
+		return storeAccountToken(config, args[1:])
+	case "forget":
+		return config, forgetKeyringToken(args[1:])
+	default:
+		return config, fmt.Errorf("unknown token subcommand: %s", args[0])
+	}
+}
+
+// checkTokens handles "token check [alias]"
+func checkTokens(config Config, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: ghs token check [alias]")
+	}
+	accounts := config.resolvedAccounts()
+	aliases := sortedAliases(accounts)
+	if len(args) == 1 {
+		alias, err := config.lookupAlias(args[0])
+		if err != nil {
+			return err
+		}
+		aliases = []string{alias}
+	}
+
+	failed := 0
+	for _, alias := range aliases {
+		if !checkToken(alias, accounts[alias]) {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d account(s) have token problems", failed)
+	}
+	return nil
+}
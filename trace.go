@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// envTrace names the trace file like --trace
+const envTrace = "GHS_TRACE"
+
+// traceOutputLimit is how much of a command's output a trace record keeps
+const traceOutputLimit = 2048
+
+// tracer records every external command when --trace is given
+var tracer *slog.Logger
+
+// setupTrace appends a JSON record per external command to path
+func setupTrace(path string) error {
+	f, err := openPrivateAppend(expandPath(path))
+	if err != nil {
+		return fmt.Errorf("failed to open trace file: %v", err)
+	}
+	tracer = slog.New(slog.NewJSONHandler(f, nil)).With("pid", os.Getpid())
+	return nil
+}
+
+// Secrets removed from traces: GitHub tokens, credential helper passwords
+// and bearer tokens. Key paths stay, they are what support needs to see.
+var traceSecretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{20,}|github_pat_[A-Za-z0-9_]{20,})`),
+	regexp.MustCompile(`(?i)(password=['"]?)[^\s'"]+`),
+	regexp.MustCompile(`(?i)(bearer\s+)[^\s'"]+`),
+	regexp.MustCompile(`(x-access-token:)[^@\s]+`),
+}
+
+// secretEnvNames match environment variables whose values are redacted
+var secretEnvNames = regexp.MustCompile(`(?i)token|secret|passw|passphrase|key$`)
+
+// redact removes secrets from text
+func redact(text string) string {
+	for _, pattern := range traceSecretPatterns {
+		if pattern.NumSubexp() == 0 {
+			text = pattern.ReplaceAllString(text, "[redacted]")
+		} else {
+			text = pattern.ReplaceAllString(text, "${1}[redacted]")
+		}
+	}
+	return text
+}
+
+// redactArgs removes secrets from a command line, including the values of
+// ssh-keygen's passphrase options
+func redactArgs(args []string) []string {
+	redacted := make([]string, len(args))
+	for i, arg := range args {
+		redacted[i] = redact(arg)
+		if i > 0 && (args[i-1] == "-N" || args[i-1] == "-P") && filepath.Base(args[0]) == "ssh-keygen" {
+			redacted[i] = "[redacted]"
+		}
+	}
+	return redacted
+}
+
+// truncateOutput shortens output for a trace record
+func truncateOutput(out []byte) string {
+	text := redact(string(out))
+	if len(text) > traceOutputLimit {
+		return text[:traceOutputLimit] + fmt.Sprintf("... (%d bytes)", len(out))
+	}
+	return text
+}
+
+func (c *tracedCmd) trace(start time.Time, err error, out []byte) {
+	if tracer == nil {
+		return
+	}
+	args := redactArgs(append([]string{c.Path}, c.Args[1:]...))
+	attrs := []any{
+		"cmd", strings.Join(args, " "),
+		"duration_ms", time.Since(start).Milliseconds(),
+	}
+	if c.Dir != "" {
+		attrs = append(attrs, "dir", c.Dir)
+	}
+	// Only variables ghs adds are of interest; os.Environ() is the rest
+	var env []string
+	for _, entry := range c.Env {
+		name, value, _ := strings.Cut(entry, "=")
+		if os.Getenv(name) == value {
+			continue
+		}
+		if secretEnvNames.MatchString(name) {
+			value = "[redacted]"
+		}
+		env = append(env, name+"="+redact(value))
+	}
+	if len(env) > 0 {
+		attrs = append(attrs, "env", env)
+	}
+
+	exitCode := 0
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		exitCode = exitErr.ExitCode()
+		if len(exitErr.Stderr) > 0 {
+			attrs = append(attrs, "stderr", truncateOutput(exitErr.Stderr))
+		}
+	} else if err != nil {
+		exitCode = -1
+		attrs = append(attrs, "error", redact(err.Error()))
+	}
+	attrs = append(attrs, "exit_code", exitCode)
+	if out != nil && c.secretOutput {
+		attrs = append(attrs, "output", "[redacted]")
+	} else if out != nil {
+		attrs = append(attrs, "output", truncateOutput(out))
+	}
+	tracer.Info("exec", attrs...)
+}
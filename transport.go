@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Transports of the config's "transport"
+const (
+	transportSSH   = "ssh"
+	transportHTTPS = "https"
+)
+
+// httpsOnly is set by "transport": "https". Remotes then use HTTPS URLs that
+// authenticate with account tokens through the credential helper, and ghs
+// neither needs SSH keys nor writes the SSH config.
+var httpsOnly bool
+
+// transportProblem checks the config's transport
+func transportProblem(transport string) string {
+	if transport != "" && transport != transportSSH && transport != transportHTTPS {
+		return fmt.Sprintf("unknown transport %q, expected ssh or https", transport)
+	}
+	return ""
+}
+
+// setTransport applies the config's transport
+func setTransport(config Config) error {
+	if problem := transportProblem(config.Transport); problem != "" {
+		return fmt.Errorf("transport: %s", problem)
+	}
+	httpsOnly = config.Transport == transportHTTPS
+	return nil
+}
+
+// remoteURL returns the URL ghs gives remotes of an account: through the
+// account's SSH host alias, or the plain HTTPS URL in HTTPS mode, where the
+// credential helper picks the account's token by owner
+func remoteURL(account GitHubAccount, owner, repo string) string {
+	if httpsOnly {
+		return fmt.Sprintf("https://github.com/%s/%s.git", owner, repo)
+	}
+	return sshRemoteURL(account, owner, repo)
+}
+
+// requireSSH fails commands that only make sense with SSH in HTTPS mode
+func requireSSH(command string) error {
+	if httpsOnly {
+		return fmt.Errorf("%s needs SSH, but the transport is https; ghs doesn't use SSH keys or the SSH config", command)
+	}
+	return nil
+}
+
+// checkTransport checks that HTTPS mode can authenticate: git has to ask ghs
+// for github.com credentials, with the repository path
+func checkTransport(config Config) *doctorResult {
+	if !httpsOnly {
+		return nil
+	}
+	helpers := githubCredentialHelpers()
+	if len(helpers) == 0 || helpers[0] != ghsCredentialHelper {
+		return &doctorResult{Status: doctorFail, Finding: "no_helper", Message: "HTTPS mode, but git doesn't ask ghs for github.com credentials",
+			Hint: "ghs credential setup", Data: map[string]string{"helpers": strings.Join(helpers, ",")}}
+	}
+	out, _ := execCommand("git", "config", "--get-urlmatch", "credential.useHttpPath", "https://github.com/").Output()
+	if strings.TrimSpace(string(out)) != "true" {
+		return &doctorResult{Status: doctorFail, Finding: "no_http_path", Message: "HTTPS mode, but git doesn't send the repository path, so every owner gets the same token",
+			Hint: "ghs credential setup"}
+	}
+	return &doctorResult{Status: doctorOK, Finding: "ok", Message: "HTTPS mode, credentials from ghs"}
+}
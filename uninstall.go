@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// managedHookMarkers identify the hooks ghs writes into repositories
+var managedHookMarkers = []string{guardHookMarker, pathRuleHookMarker}
+
+// managedHook returns the pre-commit hook of the repository in dir if ghs
+// wrote it
+func managedHook(dir string) (string, bool) {
+	out, err := execCommand("git", "-C", dir, "rev-parse", "--git-path", "hooks").Output()
+	if err != nil {
+		return "", false
+	}
+	hooksDir := strings.TrimSpace(string(out))
+	if !filepath.IsAbs(hooksDir) {
+		hooksDir = filepath.Join(dir, hooksDir)
+	}
+	hook := filepath.Join(hooksDir, "pre-commit")
+	data, err := os.ReadFile(hook)
+	if err != nil {
+		return "", false
+	}
+	for _, marker := range managedHookMarkers {
+		if bytes.Contains(data, []byte(marker)) {
+			return hook, true
+		}
+	}
+	return "", false
+}
+
+// uninstallRepos returns the repositories that may hold ghs hooks or
+// settings: the current one, those below mapped directories and those below
+// the given directories
+func uninstallRepos(config Config, dirs []string) []string {
+	var roots []string
+	if repo, err := currentRepo(); err == nil {
+		roots = append(roots, repo.Root)
+	}
+	for _, account := range config.resolvedAccounts() {
+		roots = append(roots, account.Directories...)
+	}
+	roots = append(roots, dirs...)
+
+	seen := map[string]bool{}
+	var repos []string
+	for _, root := range roots {
+		found, err := findRepos(expandPath(root))
+		if err != nil {
+			continue
+		}
+		for _, repo := range found {
+			if !seen[repo] {
+				seen[repo] = true
+				repos = append(repos, repo)
+			}
+		}
+	}
+	return repos
+}
+
+// uninstall removes everything ghs manages: the managed SSH config section,
+// the git config fragments and their includeIf entries, the hooks and
+// settings it wrote into repositories and its state directory. The config
+// file is only removed with --config.
+func uninstall(config Config, args []string) error {
+	flags := flag.NewFlagSet("uninstall", flag.ContinueOnError)
+	removeConfig := flags.Bool("config", false, "also delete the config file")
+	yes := flags.Bool("yes", false, "remove without asking")
+	dryRun := flags.Bool("dry-run", false, "only show what would be removed")
+	dirs, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+
+	var hooks, repos []string
+	for _, repo := range uninstallRepos(config, dirs) {
+		// Hooks in the state directory go with it
+		if hook, ok := managedHook(repo); ok && !strings.HasPrefix(hook, stateDir+string(filepath.Separator)) {
+			hooks = append(hooks, hook)
+		}
+		if out, err := execCommand("git", "-C", repo, "config", "--local", "--get-regexp", `^ghs\.`).Output(); err == nil && len(out) > 0 {
+			repos = append(repos, repo)
+		}
+	}
+	includes, err := managedIncludes()
+	if err != nil {
+		return fmt.Errorf("failed to read global git config: %v", err)
+	}
+
+	fmt.Println("This removes:")
+	fmt.Printf("  the ghs managed section of %s\n", sshConfigPath)
+	if len(includes) > 0 {
+		fmt.Printf("  %d includeIf entries from the global git config\n", len(includes))
+	}
+	for _, hook := range hooks {
+		fmt.Printf("  %s\n", hook)
+	}
+	for _, repo := range repos {
+		fmt.Printf("  the ghs.* settings of %s\n", repo)
+	}
+	if _, ok := installedGitAlias(); ok {
+		fmt.Println("  alias.ghs from the global git config")
+	}
+	fmt.Printf("  %s\n", stateDir)
+	if *removeConfig {
+		fmt.Printf("  %s\n", storedConfigPath())
+	}
+	if *dryRun {
+		return nil
+	}
+	if !*yes {
+		ok, err := confirm("Uninstall ghs?", false)
+		if err != nil {
+			return fmt.Errorf("%v (pass --yes)", err)
+		}
+		if !ok {
+			return fmt.Errorf("aborted")
+		}
+	}
+
+	var failed []string
+	// Writing an empty account set leaves only the user's own SSH config
+	// and drops every fragment and include
+	if _, err := os.Stat(sshConfigPath); err == nil {
+		if err := writeSSHConfig(Config{}, nil, sshEditsOverwrite); err != nil {
+			failed = append(failed, fmt.Sprintf("SSH config: %v", err))
+		}
+	}
+	if err := updateGitConfigFragments(Config{}); err != nil {
+		failed = append(failed, fmt.Sprintf("git config: %v", err))
+	}
+	for _, hook := range hooks {
+		if err := os.Remove(hook); err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+	for _, repo := range repos {
+		if err := execCommand("git", "-C", repo, "config", "--local", "--remove-section", "ghs").Run(); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: failed to remove ghs settings: %v", repo, err))
+		}
+	}
+	if err := installGitAlias([]string{"--remove"}); err != nil {
+		failed = append(failed, err.Error())
+	}
+	if err := os.RemoveAll(stateDir); err != nil {
+		failed = append(failed, err.Error())
+	}
+	if *removeConfig {
+		if configLocked() && passphraseLocked() {
+			os.Remove(lockedIdentityPath())
+		} else if configLocked() {
+			if store, err := openSecretStore(); err == nil {
+				store.Delete(configIdentityName)
+			}
+		}
+		if err := os.Remove(storedConfigPath()); err != nil && !os.IsNotExist(err) {
+			failed = append(failed, err.Error())
+		}
+	}
+
+	if len(failed) > 0 {
+		for _, msg := range failed {
+			fmt.Printf("Error: %s\n", msg)
+		}
+		return fmt.Errorf("uninstall finished with %d error(s)", len(failed))
+	}
+	fmt.Println("ghs has been uninstalled; the ghs binary itself is left in place.")
+	if !*removeConfig {
+		fmt.Printf("Your accounts are still in %s.\n", storedConfigPath())
+	}
+	return nil
+}
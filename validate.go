@@ -0,0 +1,474 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// configIssue describes a single problem found while validating the config file
+type configIssue struct {
+	Line  int
+	Field string
+	Msg   string
+}
+
+// configValidator walks the raw JSON of a config file, recording the line of
+// every field and reporting fields that don't belong to the schema
+type configValidator struct {
+	data   []byte
+	dec    *json.Decoder
+	lines  map[string]int
+	issues []configIssue
+}
+
+func (v *configValidator) lineAt(offset int64) int {
+	return bytes.Count(v.data[:offset], []byte("\n")) + 1
+}
+
+// nextLine returns the line of the value the decoder reads next, past the
+// comma and whitespace after the previous one
+func (v *configValidator) nextLine() int {
+	offset := v.dec.InputOffset()
+	for offset < int64(len(v.data)) && strings.IndexByte(" \t\r\n,", v.data[offset]) >= 0 {
+		offset++
+	}
+	return v.lineAt(offset)
+}
+
+func (v *configValidator) addIssue(field, format string, args ...interface{}) {
+	line := v.lines[field]
+	// Fall back to the closest parent that has a known position
+	for parent := field; line == 0 && parent != ""; {
+		if idx := strings.LastIndex(parent, "."); idx >= 0 {
+			parent = parent[:idx]
+		} else {
+			parent = ""
+		}
+		line = v.lines[parent]
+	}
+	v.issues = append(v.issues, configIssue{Line: line, Field: field, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (v *configValidator) hasIssue(field string) bool {
+	for _, issue := range v.issues {
+		if issue.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonFieldType returns the type of the struct field serialized under key
+func jsonFieldType(t reflect.Type, key string) (reflect.Type, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if name == key {
+			return f.Type, true
+		}
+	}
+	return nil, false
+}
+
+func joinField(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func describeKind(k reflect.Kind) string {
+	switch k {
+	case reflect.Struct, reflect.Map:
+		return "object"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	}
+	return k.String()
+}
+
+// walk consumes one JSON value from the decoder and checks it against t.
+// A nil t means the value is not part of the schema and is only skipped.
+func (v *configValidator) walk(path string, t reflect.Type) error {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	tok, err := v.dec.Token()
+	if err != nil {
+		return err
+	}
+
+	switch tok := tok.(type) {
+	case json.Delim:
+		switch tok {
+		case '{':
+			if t != nil && t.Kind() != reflect.Struct && t.Kind() != reflect.Map {
+				v.addIssue(path, "expected %s, found object", describeKind(t.Kind()))
+				t = nil
+			}
+			for v.dec.More() {
+				keyTok, err := v.dec.Token()
+				if err != nil {
+					return err
+				}
+				key := keyTok.(string)
+				field := joinField(path, key)
+				v.lines[field] = v.lineAt(v.dec.InputOffset())
+
+				var elem reflect.Type
+				if t != nil {
+					if t.Kind() == reflect.Map {
+						elem = t.Elem()
+					} else if ft, ok := jsonFieldType(t, key); ok {
+						elem = ft
+					} else {
+						v.addIssue(field, "unknown field %q", key)
+					}
+				}
+				if err := v.walk(field, elem); err != nil {
+					return err
+				}
+			}
+		case '[':
+			if t != nil && t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+				v.addIssue(path, "expected %s, found array", describeKind(t.Kind()))
+				t = nil
+			}
+			for i := 0; v.dec.More(); i++ {
+				field := path + "[" + strconv.Itoa(i) + "]"
+				v.lines[field] = v.nextLine()
+				var elem reflect.Type
+				if t != nil {
+					elem = t.Elem()
+				}
+				if err := v.walk(field, elem); err != nil {
+					return err
+				}
+			}
+		}
+		// Consume the closing delimiter
+		if _, err := v.dec.Token(); err != nil {
+			return err
+		}
+	default:
+		if t == nil {
+			return nil
+		}
+		found := ""
+		switch tok.(type) {
+		case string:
+			found = "string"
+		case bool:
+			found = "boolean"
+		case json.Number:
+			found = "number"
+		case nil:
+			// null is accepted for any field
+			return nil
+		}
+		if want := describeKind(t.Kind()); want != found && t.Kind() != reflect.Interface {
+			v.addIssue(path, "expected %s, found %s", want, found)
+		}
+	}
+	return nil
+}
+
+var (
+	aliasPattern    = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+	usernamePattern = regexp.MustCompile(`^[A-Za-z0-9](?:[A-Za-z0-9]|-[A-Za-z0-9]){0,38}$`)
+)
+
+// validateAlias checks that an alias can be used on the command line and in
+// file names without quoting
+func validateAlias(alias string) error {
+	if !aliasPattern.MatchString(alias) {
+		return fmt.Errorf("invalid alias %q: use letters, digits, '.', '_' or '-', starting with a letter or digit", alias)
+	}
+	return nil
+}
+
+// validateUsername checks a GitHub username, which also becomes part of the
+// SSH Host alias github.com-<username>
+func validateUsername(username string) error {
+	if !usernamePattern.MatchString(username) {
+		return fmt.Errorf("invalid GitHub username %q: use letters, digits and single hyphens (max 39 characters)", username)
+	}
+	return nil
+}
+
+// validEmail reports whether s is a bare email address such as user@example.com
+func validEmail(s string) bool {
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Address != s {
+		return false
+	}
+	return strings.Contains(s[strings.LastIndex(s, "@"):], ".")
+}
+
+// fieldProblem describes an invalid field of a single account
+type fieldProblem struct {
+	Field string
+	Msg   string
+}
+
+// accountProblems checks a single account, with defaults already applied,
+// for missing or malformed fields
+func accountProblems(account GitHubAccount) []fieldProblem {
+	var problems []fieldProblem
+
+	required := []struct{ key, value string }{
+		{"name", account.Name},
+		{"email", account.Email},
+		{"username", account.Username},
+	}
+	if !account.hardwareKey() && !httpsOnly {
+		required = append(required, struct{ key, value string }{"ssh_key_path", account.SSHKeyPath})
+	}
+	for _, r := range required {
+		if strings.TrimSpace(r.value) == "" {
+			problems = append(problems, fieldProblem{r.key, "required field is missing or empty"})
+		}
+	}
+
+	if account.Email != "" && !validEmail(account.Email) {
+		problems = append(problems, fieldProblem{"email", fmt.Sprintf("invalid email address %q", account.Email)})
+	}
+	if account.Username != "" {
+		if err := validateUsername(account.Username); err != nil {
+			problems = append(problems, fieldProblem{"username", err.Error()})
+		}
+	}
+	if account.SSHKeyPath != "" && !filepath.IsAbs(account.SSHKeyPath) {
+		problems = append(problems, fieldProblem{"ssh_key_path", fmt.Sprintf("key path %q must be absolute", account.SSHKeyPath)})
+	}
+	if account.PushSigning != "" && !pushSigningModes[account.PushSigning] {
+		problems = append(problems, fieldProblem{"push_signing", fmt.Sprintf("unknown push signing mode %q (use true or if-asked)", account.PushSigning)})
+	}
+	problems = append(problems, settingProblems(account.KeyType, account.Signing, account.SSHOptions, account.GitConfig)...)
+	problems = append(problems, keyRotationProblems(account)...)
+	problems = append(problems, connectionProblems(account.Connection, account.SSHOptions)...)
+	if problem := hostKeyCheckingProblem(account.HostKeyChecking); problem != "" {
+		problems = append(problems, fieldProblem{"host_key_checking", problem})
+	}
+	for key := range account.SSHOptions {
+		if account.KnownHosts && strings.EqualFold(key, "UserKnownHostsFile") {
+			problems = append(problems, fieldProblem{joinField("ssh_options", key), "known_hosts already sets the account's known_hosts file"})
+		}
+		if account.HostKeyChecking != "" && strings.EqualFold(key, "StrictHostKeyChecking") {
+			problems = append(problems, fieldProblem{joinField("ssh_options", key), "host_key_checking already sets it"})
+		}
+	}
+	if account.App != nil {
+		problems = append(problems, appProblems(account.App)...)
+	}
+	for _, scope := range sortedKeys(account.Tokens) {
+		if problem := tokenScopeProblem(scope); problem != "" {
+			problems = append(problems, fieldProblem{"tokens", problem})
+		}
+		if problem := tokenRefProblem(account.Tokens[scope]); problem != "" {
+			problems = append(problems, fieldProblem{joinField("tokens", scope), problem})
+		}
+	}
+	return problems
+}
+
+// checkAccounts validates one set of accounts stored under prefix
+func (v *configValidator) checkAccounts(prefix string, accounts map[string]GitHubAccount, defaults *AccountDefaults) {
+	aliases := make([]string, 0, len(accounts))
+	for alias := range accounts {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+
+	usernames := map[string]string{}
+	for _, alias := range aliases {
+		account := accounts[alias]
+		field := joinField(prefix, alias)
+
+		if err := validateAlias(alias); err != nil {
+			v.addIssue(field, "%v", err)
+		}
+
+		for _, p := range accountProblems(defaults.apply(account)) {
+			// Type mismatches already explain why a field came out empty
+			if !v.hasIssue(joinField(field, p.Field)) {
+				v.addIssue(joinField(field, p.Field), "%s", p.Msg)
+			}
+		}
+		if account.Username != "" {
+			key := strings.ToLower(account.Username)
+			if other, exists := usernames[key]; exists {
+				v.addIssue(joinField(field, "username"), "username %q is already used by account '%s'", account.Username, other)
+			} else {
+				usernames[key] = alias
+			}
+		}
+	}
+	for _, p := range aliasProblems(accounts) {
+		v.addIssue(joinField(prefix, p.Field), "%s", p.Msg)
+	}
+}
+
+// validateConfigData checks raw config file contents against the schema and
+// returns every problem found, ordered by line
+func validateConfigData(data []byte) []configIssue {
+	v := &configValidator{data: data, lines: map[string]int{}}
+	v.dec = json.NewDecoder(bytes.NewReader(data))
+	v.dec.UseNumber()
+
+	if err := v.walk("", reflect.TypeOf(Config{})); err != nil {
+		line := v.lineAt(v.dec.InputOffset())
+		if syntaxErr, ok := err.(*json.SyntaxError); ok {
+			line = v.lineAt(syntaxErr.Offset)
+		}
+		return append(v.issues, configIssue{Line: line, Field: "(file)", Msg: fmt.Sprintf("invalid JSON: %v", err)})
+	}
+
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		// Type mismatches have already been reported by the walk; the decoder
+		// still fills every other field, so keep checking what we can
+		if _, ok := err.(*json.UnmarshalTypeError); !ok {
+			return v.issues
+		}
+	}
+
+	v.checkAccounts("accounts", config.Accounts, config.Defaults)
+	for name, profile := range config.Profiles {
+		v.checkAccounts(joinField(joinField("profiles", name), "accounts"), profile.Accounts, config.Defaults)
+	}
+	if d := config.Defaults; d != nil {
+		for _, p := range settingProblems(d.KeyType, d.Signing, d.SSHOptions, d.GitConfig) {
+			v.addIssue(joinField("defaults", p.Field), "%s", p.Msg)
+		}
+		if problem := keyRotationProblem(d.KeyRotation); problem != "" {
+			v.addIssue(joinField("defaults", "key_rotation"), "%s", problem)
+		}
+	}
+	if config.APICacheTTL != "" {
+		if _, err := parseAPICacheTTL(config.APICacheTTL); err != nil {
+			v.addIssue("api_cache_ttl", "%v", err)
+		}
+	}
+	if config.CommandTimeout != "" {
+		if _, err := parseCommandTimeout(config.CommandTimeout); err != nil {
+			v.addIssue("command_timeout", "%v", err)
+		}
+	}
+	if problem := defaultHostProblem(config); problem != "" {
+		v.addIssue("default_host", "%s", problem)
+	}
+	if problem := transportProblem(config.Transport); problem != "" {
+		v.addIssue("transport", "%s", problem)
+	}
+	for _, p := range watchProblems(config.Watch) {
+		v.addIssue(p.Field, "%s", p.Msg)
+	}
+	for _, p := range retryProblems(config.Retries) {
+		v.addIssue(p.Field, "%s", p.Msg)
+	}
+	for _, p := range ownerRuleProblems(config) {
+		v.addIssue(p.Field, "%s", p.Msg)
+	}
+	if config.ActiveProfile != "" && config.ActiveProfile != defaultProfile {
+		if _, exists := config.Profiles[config.ActiveProfile]; !exists {
+			v.addIssue("active_profile", "profile %q does not exist", config.ActiveProfile)
+		}
+	}
+
+	sort.SliceStable(v.issues, func(i, j int) bool {
+		return v.issues[i].Line < v.issues[j].Line
+	})
+	return v.issues
+}
+
+// validateConfig validates the config file on disk and prints every issue.
+// With a system-wide config, that file is checked on its own and the user's
+// file together with it, since it may only override pieces of its accounts.
+func validateConfig() error {
+	problems := 0
+	if data, err := os.ReadFile(systemConfigPath()); err == nil {
+		problems += printConfigIssues(systemConfigPath(), validateConfigData(data))
+	}
+	data, err := readConfigFile()
+	if err != nil && !(os.IsNotExist(err) && systemConfig != nil) {
+		return fmt.Errorf("failed to read config file: %v", err)
+	} else if err != nil {
+		data = []byte("{}")
+	}
+	if systemConfig != nil {
+		user, err := decodeJSONObject(data)
+		if err == nil {
+			data, _ = json.MarshalIndent(mergeLayers(systemConfig, user), "", "  ")
+		}
+	}
+	issues := validateConfigData(data)
+	if systemConfig != nil {
+		// Lines of the merged config don't exist in either file
+		for i := range issues {
+			issues[i].Line = 0
+		}
+	}
+	problems += printConfigIssues(storedConfigPath(), issues)
+	if problems > 0 {
+		return fmt.Errorf("found %d problem(s)", problems)
+	}
+	return nil
+}
+
+// printConfigIssues prints the issues found in a config file and returns
+// how many there are
+func printConfigIssues(path string, issues []configIssue) int {
+	if len(issues) == 0 {
+		fmt.Printf("%s: OK\n", path)
+		return 0
+	}
+	for _, issue := range issues {
+		if issue.Line > 0 {
+			fmt.Printf("%s:%d: %s: %s\n", path, issue.Line, issue.Field, issue.Msg)
+		} else {
+			fmt.Printf("%s: %s: %s\n", path, issue.Field, issue.Msg)
+		}
+	}
+	return len(issues)
+}
+
+// runConfigCommand handles the "config" subcommands
+func runConfigCommand(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: ghs config validate")
+	}
+	switch args[0] {
+	case "validate":
+		return validateConfig()
+	default:
+		return fmt.Errorf("unknown config subcommand: %s", args[0])
+	}
+}
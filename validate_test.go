@@ -0,0 +1,170 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateConfigData(t *testing.T) {
+	// issue is a configIssue whose message only has to contain Msg
+	type issue struct {
+		Line  int
+		Field string
+		Msg   string
+	}
+	tests := []struct {
+		name string
+		data string
+		want []issue
+	}{
+		{
+			name: "valid",
+			data: `{
+  "accounts": {
+    "work": {
+      "name": "Me",
+      "email": "me@acme.com",
+      "username": "acme-me",
+      "ssh_key_path": "/home/me/.ssh/id_work"
+    }
+  }
+}`,
+		},
+		{
+			name: "unknown field",
+			data: `{
+  "accounts": {
+    "work": {
+      "name": "Me",
+      "email": "me@acme.com",
+      "username": "acme-me",
+      "colour": "red",
+      "ssh_key_path": "/home/me/.ssh/id_work"
+    }
+  },
+  "extra": {"nested": [1, 2]}
+}`,
+			want: []issue{
+				{7, "accounts.work.colour", `unknown field "colour"`},
+				{11, "extra", `unknown field "extra"`},
+			},
+		},
+		{
+			name: "type mismatch hides the missing value",
+			data: `{
+  "accounts": {
+    "work": {
+      "name": 42,
+      "email": "me@acme.com",
+      "username": "acme-me",
+      "ssh_key_path": "/home/me/.ssh/id_work"
+    }
+  }
+}`,
+			want: []issue{
+				{4, "accounts.work.name", "expected string, found number"},
+			},
+		},
+		{
+			name: "object where an array belongs",
+			data: `{
+  "accounts": {},
+  "owner_rules": {"acme": "work"}
+}`,
+			want: []issue{
+				{3, "owner_rules", "expected array, found object"},
+			},
+		},
+		{
+			name: "array elements",
+			data: `{
+  "accounts": {
+    "work": {
+      "name": "Me",
+      "email": "me@acme.com",
+      "username": "acme-me",
+      "ssh_key_path": "/home/me/.ssh/id_work",
+      "tags": [
+        "oss",
+        5
+      ]
+    }
+  }
+}`,
+			want: []issue{
+				{10, "accounts.work.tags[1]", "expected string, found number"},
+			},
+		},
+		{
+			name: "null is accepted",
+			data: `{
+  "accounts": {},
+  "defaults": null
+}`,
+		},
+		{
+			name: "missing fields fall back to the account's line",
+			data: `{
+  "accounts": {
+    "work": {
+      "name": "Me",
+      "email": "not-an-address",
+      "ssh_key_path": "relative/key"
+    }
+  }
+}`,
+			want: []issue{
+				{3, "accounts.work.username", "required field is missing or empty"},
+				{5, "accounts.work.email", `invalid email address "not-an-address"`},
+				{6, "accounts.work.ssh_key_path", "must be absolute"},
+			},
+		},
+		{
+			name: "profile accounts",
+			data: `{
+  "accounts": {},
+  "profiles": {
+    "client": {
+      "accounts": {
+        "acme": {
+          "name": "Me",
+          "email": "me@acme.com",
+          "username": "acme-me",
+          "ssh_key_path": "/home/me/.ssh/id_acme",
+          "signing": "bogus"
+        }
+      }
+    }
+  }
+}`,
+			want: []issue{
+				{11, "profiles.client.accounts.acme.signing", `unknown signing mode "bogus"`},
+			},
+		},
+		{
+			name: "invalid JSON",
+			data: `{
+  "accounts": {
+    "work": {"name": "Me",}
+  }
+}`,
+			want: []issue{
+				{3, "(file)", "invalid JSON"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := validateConfigData([]byte(tt.data))
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d issues %+v, want %d", len(got), got, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if got[i].Line != want.Line || got[i].Field != want.Field || !strings.Contains(got[i].Msg, want.Msg) {
+					t.Errorf("issue %d = %+v, want line %d, field %s, message containing %q", i, got[i], want.Line, want.Field, want.Msg)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Outcomes of verifying a commit
+const (
+	verifyOK       = "ok"
+	verifyUnsigned = "unsigned"
+	verifyForeign  = "foreign"
+	verifyBad      = "bad"
+	verifyUnknown  = "unknown"
+)
+
+// commitSignature is a commit with the signature details git log reports
+type commitSignature struct {
+	Hash    string
+	Status  string // %G?: G good, U good but untrusted, N none, B bad, ...
+	Signer  string
+	Key     string
+	Subject string
+}
+
+// listCommitSignatures runs git log over revs and reads the signature of
+// every commit
+func listCommitSignatures(revs []string) ([]commitSignature, error) {
+	args := append([]string{"log", "--format=%H%x00%G?%x00%GS%x00%GK%x00%GF%x00%GP%x00%s"}, revs...)
+	out, err := execCommand("git", args...).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("git log: %s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("failed to run git log: %v", err)
+	}
+	var commits []commitSignature
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.Split(line, "\x00")
+		if len(fields) != 7 {
+			continue
+		}
+		// The key ID, its fingerprint and the primary key's fingerprint
+		// are all worth matching against the configured signing key
+		keys := strings.Join(fields[3:6], " ")
+		commits = append(commits, commitSignature{Hash: fields[0], Status: fields[1], Signer: fields[2], Key: keys, Subject: fields[6]})
+	}
+	return commits, nil
+}
+
+// signerName names the signer for messages: the signer or the key ID
+func (c commitSignature) signerName() string {
+	if c.Signer != "" {
+		return c.Signer
+	}
+	if keys := strings.Fields(c.Key); len(keys) > 0 {
+		return "key " + keys[0]
+	}
+	return "an unknown key"
+}
+
+// signedBy reports whether the signature belongs to the account: the signer
+// names its email, or the key is the account's signing key
+func signedBy(c commitSignature, account GitHubAccount, signingKey string) bool {
+	if account.Email != "" && strings.Contains(strings.ToLower(c.Signer), strings.ToLower(account.Email)) {
+		return true
+	}
+	signingKey = strings.ToUpper(strings.TrimSuffix(signingKey, "!"))
+	if signingKey == "" {
+		return false
+	}
+	for _, key := range strings.Fields(strings.ToUpper(c.Key)) {
+		if strings.HasSuffix(key, signingKey) || strings.HasSuffix(signingKey, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyStatus classifies a commit for the expected account
+func verifyStatus(c commitSignature, account GitHubAccount, signingKey string) string {
+	switch c.Status {
+	case "N":
+		return verifyUnsigned
+	case "B", "R":
+		return verifyBad
+	case "E":
+		// Missing public key, the signer can't be checked
+		if signedBy(c, account, signingKey) {
+			return verifyOK
+		}
+		return verifyUnknown
+	}
+	if !signedBy(c, account, signingKey) {
+		return verifyForeign
+	}
+	return verifyOK
+}
+
+// verifyCommits handles "verify [rev-range]": it checks that every commit
+// is signed by the account the repository belongs to. Without a range the
+// commits not on any remote are checked, i.e. those the next push sends.
+func verifyCommits(config Config, args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	alias := flags.String("account", "", "account expected to sign instead of the one matched by the remotes")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 1 {
+		return fmt.Errorf("usage: ghs verify [rev-range] [--account <alias>]")
+	}
+	if _, err := currentRepo(); err != nil {
+		return err
+	}
+	if *alias == "" {
+		if *alias, err = autoAccount(config); err != nil {
+			return err
+		}
+	}
+	var account GitHubAccount
+	if *alias, account, err = config.lookupAccount(*alias); err != nil {
+		return err
+	}
+
+	revs := []string{"HEAD", "--not", "--remotes"}
+	if len(positional) == 1 {
+		revs = positional
+	}
+	commits, err := listCommitSignatures(revs)
+	if err != nil {
+		return err
+	}
+	if len(commits) == 0 {
+		fmt.Println("No commits to verify.")
+		return nil
+	}
+
+	signingKey := ""
+	if account.Signing != signingNone {
+		if _, key, err := signingEdits(account); err == nil {
+			signingKey = key
+		}
+	}
+	problems := 0
+	for _, c := range commits {
+		status := verifyStatus(c, account, signingKey)
+		detail := c.Subject
+		if status == verifyForeign || status == verifyUnknown {
+			detail = fmt.Sprintf("%s (signed by %s)", c.Subject, c.signerName())
+		}
+		fmt.Printf("%-8s %s %s\n", status, c.Hash[:12], detail)
+		if status != verifyOK {
+			problems++
+		}
+	}
+	if problems > 0 {
+		return fmt.Errorf("%d of %d commit(s) not signed by account '%s'", problems, len(commits), *alias)
+	}
+	fmt.Printf("\nAll %d commit(s) signed by account '%s'.\n", len(commits), *alias)
+	return nil
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// WatchSettings configure "ghs watch"
+type WatchSettings struct {
+	// Policy is "alert" to report drift or "repair" to also fix it
+	Policy string `json:"policy,omitempty"`
+	// Interval between two looks at the watched files
+	Interval string `json:"interval,omitempty"`
+}
+
+// Watch policies
+const (
+	watchAlert  = "alert"
+	watchRepair = "repair"
+)
+
+const defaultWatchInterval = 5 * time.Second
+
+// watchProblems checks the config's watch block
+func watchProblems(w *WatchSettings) []fieldProblem {
+	if w == nil {
+		return nil
+	}
+	var problems []fieldProblem
+	if w.Policy != "" && w.Policy != watchAlert && w.Policy != watchRepair {
+		problems = append(problems, fieldProblem{"watch.policy", fmt.Sprintf("unknown policy %q, expected alert or repair", w.Policy)})
+	}
+	if w.Interval != "" {
+		if d, err := time.ParseDuration(w.Interval); err != nil || d < time.Second {
+			problems = append(problems, fieldProblem{"watch.interval", fmt.Sprintf("invalid interval %q, expected at least 1s", w.Interval)})
+		}
+	}
+	return problems
+}
+
+// drift is a difference between the state ghs set up and the actual one
+type drift struct {
+	What   string
+	Repair func() error
+}
+
+// watchedRepo is a repository whose identity watch checks
+type watchedRepo struct {
+	Dir    string
+	Alias  string
+	Config string // path of the repository's config file
+}
+
+// sshDrift reports a managed SSH config section that was edited or lost
+// blocks of accounts, e.g. by a tool rewriting ~/.ssh/config
+func sshDrift(config Config) []drift {
+	if !sshConfigUsable() || httpsOnly {
+		return nil
+	}
+	scanned, err := scanSSHConfig()
+	if err != nil {
+		return nil
+	}
+	repair := func() error { return writeSSHConfig(config, nil, sshEditsOverwrite) }
+	if scanned.edited {
+		return []drift{{fmt.Sprintf("the ghs section of %s was edited", sshConfigPath), repair}}
+	}
+	blocks := splitSSHBlocks(scanned.section)
+	accounts := config.resolvedAccounts()
+	for _, alias := range sortedAliases(accounts) {
+		account := accounts[alias]
+		host := "github.com-" + account.Username
+		if _, handWritten := scanned.hosts[host]; handWritten || keyMissing(account) {
+			continue
+		}
+		if _, exists := blocks[host]; !exists {
+			return []drift{{fmt.Sprintf("Host %s of account '%s' is missing from %s", host, alias, sshConfigPath), repair}}
+		}
+	}
+	return nil
+}
+
+// fragmentDrift reports git config fragments and includeIf entries of
+// mapped directories that no longer match the accounts
+func fragmentDrift(config Config) []drift {
+	repair := func() error { return updateGitConfigFragments(config) }
+	includes := map[string]bool{}
+	out, _ := execCommand("git", "config", "--global", "--get-regexp", `^includeif\..*\.path$`).Output()
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		includes[line] = true
+	}
+	accounts := config.resolvedAccounts()
+	for _, alias := range sortedAliases(accounts) {
+		account := accounts[alias]
+		if len(account.Directories) == 0 {
+			continue
+		}
+		if data, err := os.ReadFile(fragmentPath(alias)); err != nil || string(data) != fragmentContent(alias, account) {
+			return []drift{{fmt.Sprintf("the git config fragment of account '%s' was changed", alias), repair}}
+		}
+		for _, dir := range account.Directories {
+			if !includes["includeif."+mappedDirPattern(dir)+".path "+fragmentPath(alias)] {
+				return []drift{{fmt.Sprintf("the global git config no longer includes account '%s' for %s", alias, dir), repair}}
+			}
+		}
+	}
+	return nil
+}
+
+// repoDrift reports a repository whose identity differs from its account's
+func repoDrift(config Config, repo watchedRepo) []drift {
+	account, exists := config.account(repo.Alias)
+	if !exists {
+		return nil
+	}
+	out, err := execCommand("git", "-C", repo.Dir, "config", "--show-scope", "user.email").Output()
+	if err != nil {
+		return nil
+	}
+	scope, email, _ := strings.Cut(strings.TrimSpace(string(out)), "\t")
+	if strings.EqualFold(email, account.Email) {
+		return nil
+	}
+	// Write where the wrong value is, unless that's outside the repository
+	if scope != "worktree" {
+		scope = "local"
+	}
+	return []drift{{
+		fmt.Sprintf("%s commits as %s instead of %s (account '%s')", repo.Dir, email, account.Email, repo.Alias),
+		func() error {
+			for key, value := range map[string]string{"user.name": account.Name, "user.email": account.Email} {
+				if err := execCommand("git", "-C", repo.Dir, "config", "--"+scope, key, value).Run(); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}}
+}
+
+// watchedRepos returns the repositories last switched by ghs and the ones
+// below mapped directories, each with its expected account
+func watchedRepos(config Config) []watchedRepo {
+	aliases := map[string]string{}
+	entries, _ := readHistory(time.Time{})
+	for _, entry := range entries {
+		if entry.Action == "switch" && entry.Repo != "" {
+			aliases[entry.Repo] = entry.Alias
+		}
+	}
+	for alias, account := range config.Accounts {
+		for _, dir := range account.Directories {
+			found, _ := findRepos(dir)
+			for _, repo := range found {
+				aliases[repo] = alias
+			}
+		}
+	}
+	var repos []watchedRepo
+	for _, dir := range sortedKeys(aliases) {
+		out, err := execCommand("git", "-C", dir, "rev-parse", "--path-format=absolute", "--git-path", "config").Output()
+		if err != nil {
+			continue
+		}
+		repos = append(repos, watchedRepo{Dir: dir, Alias: aliases[dir], Config: strings.TrimSpace(string(out))})
+	}
+	return repos
+}
+
+// fingerprint summarizes the size and modification time of files, so
+// changes are noticed without reading them
+func fingerprint(paths []string) string {
+	var b strings.Builder
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			fmt.Fprintf(&b, "%s:%d:%d;", path, info.Size(), info.ModTime().UnixNano())
+		} else {
+			fmt.Fprintf(&b, "%s:-;", path)
+		}
+	}
+	return b.String()
+}
+
+// watchedFiles returns the files whose changes make watch look again
+func watchedFiles(config Config, repos []watchedRepo) []string {
+	files := append([]string{storedConfigPath(), sshConfigPath}, globalGitConfigPaths()...)
+	for _, alias := range sortedAliases(config.Accounts) {
+		files = append(files, fragmentPath(alias))
+	}
+	for _, repo := range repos {
+		files = append(files, repo.Config)
+	}
+	return files
+}
+
+// checkDrift looks for drift and reports or repairs it
+func checkDrift(config Config, repos []watchedRepo, repair bool) int {
+	found := append(sshDrift(config), fragmentDrift(config)...)
+	for _, repo := range repos {
+		found = append(found, repoDrift(config, repo)...)
+	}
+	stamp := time.Now().Format("15:04:05")
+	for _, d := range found {
+		logger.Warn("drift detected", "what", d.What)
+		if !repair {
+			fmt.Printf("[%s] Drift: %s\n", stamp, d.What)
+			continue
+		}
+		if err := d.Repair(); err != nil {
+			fmt.Printf("[%s] Failed to repair: %s: %v\n", stamp, d.What, err)
+			continue
+		}
+		logger.Info("drift repaired", "what", d.What)
+		fmt.Printf("[%s] Repaired: %s\n", stamp, d.What)
+	}
+	return len(found)
+}
+
+// watch handles "watch": it looks at the SSH config, the git config
+// fragments and the identity of managed repositories whenever one of their
+// files changes, and reports or repairs what no longer matches the accounts
+func watch(config Config, args []string) error {
+	settings := WatchSettings{}
+	if config.Watch != nil {
+		settings = *config.Watch
+	}
+	if settings.Policy == "" {
+		settings.Policy = watchAlert
+	}
+	every := defaultWatchInterval
+	if d, err := time.ParseDuration(settings.Interval); err == nil {
+		every = d
+	}
+	flags := flag.NewFlagSet("watch", flag.ContinueOnError)
+	policy := flags.String("policy", settings.Policy, "alert to report drift, repair to also fix it")
+	interval := flags.Duration("interval", every, "how often the files are looked at")
+	once := flags.Bool("once", false, "check once and exit, with status 1 when there is drift")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return fmt.Errorf("usage: ghs watch [--policy alert|repair] [--interval 5s] [--once]")
+	}
+	settings.Policy, settings.Interval = *policy, interval.String()
+	if problems := watchProblems(&settings); len(problems) > 0 {
+		return fmt.Errorf("%s: %s", problems[0].Field, problems[0].Msg)
+	}
+	repair := settings.Policy == watchRepair
+
+	repos := watchedRepos(config)
+	if *once {
+		switch found := checkDrift(config, repos, repair); {
+		case found == 0:
+			fmt.Println("No drift found.")
+		case !repair:
+			return fmt.Errorf("configuration drifted")
+		}
+		return nil
+	}
+
+	fmt.Printf("Watching the SSH config, git config and %d repositories (%s, every %s); Ctrl-C stops\n", len(repos), settings.Policy, *interval)
+	last, lastConfig := "", fingerprint([]string{storedConfigPath()})
+	for ; ; time.Sleep(*interval) {
+		if current := fingerprint([]string{storedConfigPath()}); current != lastConfig {
+			// The accounts changed, and with them what is expected
+			lastConfig = current
+			config = loadConfig()
+			repos = watchedRepos(config)
+		}
+		if fingerprint(watchedFiles(config, repos)) == last {
+			continue
+		}
+		checkDrift(config, repos, repair)
+		// Repairs change the files; remember their state afterwards
+		last = fingerprint(watchedFiles(config, repos))
+	}
+}
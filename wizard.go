@@ -0,0 +1,236 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+)
+
+// wizardStep is a single question asked by runWizard
+type wizardStep struct {
+	Key   string // answer key, also the flag that supplies it
+	Label string
+	// Default computes the suggested answer from the answers given so far
+	Default  func(answers map[string]string) string
+	Validate func(value string) error
+	// Optional steps accept an empty answer
+	Optional bool
+}
+
+// Special answers: go back to the previous question, clear an optional value
+const (
+	wizardBack  = "<"
+	wizardClear = "-"
+)
+
+func (s wizardStep) defaultValue(answers map[string]string) string {
+	if s.Default == nil {
+		return ""
+	}
+	return s.Default(answers)
+}
+
+func (s wizardStep) check(value string) error {
+	if value == "" {
+		if s.Optional {
+			return nil
+		}
+		return fmt.Errorf("%s is required", s.Label)
+	}
+	if s.Validate != nil {
+		return s.Validate(value)
+	}
+	return nil
+}
+
+// ask prompts for a single step until a valid answer is given. It returns
+// back=true when the user asked to return to the previous question.
+func (s wizardStep) ask(answers map[string]string) (value string, back bool, err error) {
+	def := answers[s.Key]
+	if def == "" {
+		def = s.defaultValue(answers)
+	}
+	for {
+		value, err := prompt(s.Label, def, s.Key)
+		if err != nil {
+			return "", false, err
+		}
+		if value == wizardBack {
+			return "", true, nil
+		}
+		if value == wizardClear && s.Optional {
+			return "", false, nil
+		}
+		if err := s.check(value); err != nil {
+			fmt.Printf("  %v\n", err)
+			continue
+		}
+		return value, false, nil
+	}
+}
+
+// checkAnswers fills in defaults and validates answers without prompting
+func checkAnswers(steps []wizardStep, answers map[string]string) error {
+	for _, step := range steps {
+		if answers[step.Key] == "" {
+			answers[step.Key] = step.defaultValue(answers)
+		}
+		if answers[step.Key] == "" && !step.Optional {
+			return fmt.Errorf("%w: %s is missing (pass --%s)", errNonInteractive, step.Label, step.Key)
+		}
+		if err := step.check(answers[step.Key]); err != nil {
+			return fmt.Errorf("invalid --%s: %v", step.Key, err)
+		}
+	}
+	return nil
+}
+
+// guardInterrupt makes Ctrl-C abort the process with a clear message while
+// a wizard is running, so nothing is ever written from half-given answers.
+// The returned function restores the default behaviour.
+func guardInterrupt() func() {
+	interrupts := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(interrupts, os.Interrupt)
+	go func() {
+		select {
+		case <-interrupts:
+			fmt.Println("\nAborted, nothing was written.")
+			os.Exit(130)
+		case <-done:
+		}
+	}()
+	return func() {
+		signal.Stop(interrupts)
+		close(done)
+	}
+}
+
+// runWizard fills answers by asking every step in order. Answers already
+// present (e.g. from flags) are not asked again but are validated and can be
+// edited in the final review. Entering "<" goes back one question.
+func runWizard(steps []wizardStep, answers map[string]string) error {
+	preset := map[string]bool{}
+	for key, value := range answers {
+		preset[key] = value != ""
+	}
+	for _, step := range steps {
+		// Optional steps are skipped unless the user goes back to them
+		if step.Optional {
+			preset[step.Key] = true
+		}
+	}
+
+	if nonInteractive {
+		return checkAnswers(steps, answers)
+	}
+
+	defer guardInterrupt()()
+	fmt.Printf("(Enter %q to go back to the previous question, %q to clear an optional answer, Ctrl-C to abort)\n", wizardBack, wizardClear)
+
+	for i := 0; i < len(steps); {
+		step := steps[i]
+		if preset[step.Key] {
+			if err := step.check(answers[step.Key]); err == nil {
+				i++
+				continue
+			} else {
+				fmt.Printf("  %v\n", err)
+				preset[step.Key] = false
+			}
+		}
+
+		value, back, err := step.ask(answers)
+		if err != nil {
+			return err
+		}
+		if back {
+			// Step back over preset answers too, they can be changed like any other
+			if i > 0 {
+				i--
+				preset[steps[i].Key] = false
+			}
+			continue
+		}
+		answers[step.Key] = value
+		i++
+	}
+
+	return reviewWizard(steps, answers)
+}
+
+// fixAnswers asks again for every answer that fails validation
+func fixAnswers(steps []wizardStep, answers map[string]string) error {
+	for _, step := range steps {
+		err := step.check(answers[step.Key])
+		if err == nil {
+			continue
+		}
+		fmt.Printf("  %v\n", err)
+		value, back, err := step.ask(answers)
+		if err != nil {
+			return err
+		}
+		if !back {
+			answers[step.Key] = value
+		}
+	}
+	return nil
+}
+
+// reviewWizard shows every answer and lets the user edit any of them by
+// number before confirming
+func reviewWizard(steps []wizardStep, answers map[string]string) error {
+	for {
+		fmt.Println("\nPlease review:")
+		for i, step := range steps {
+			fmt.Printf("  %d) %-40s %s\n", i+1, step.Label, answers[step.Key])
+		}
+
+		choice, err := prompt("a number to edit, or press Enter to confirm", "", "")
+		if err != nil {
+			return err
+		}
+		if choice == "" {
+			return nil
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(choice))
+		if err != nil || n < 1 || n > len(steps) {
+			fmt.Printf("  Please enter a number between 1 and %d\n", len(steps))
+			continue
+		}
+
+		value, back, err := steps[n-1].ask(answers)
+		if err != nil {
+			return err
+		}
+		if !back {
+			answers[steps[n-1].Key] = value
+		}
+	}
+}
+
+// reviewAnswers asks for every invalid answer and then lets the user review
+// and edit all of them, until everything validates
+func reviewAnswers(steps []wizardStep, answers map[string]string) error {
+	for {
+		if err := fixAnswers(steps, answers); err != nil {
+			return err
+		}
+		if err := reviewWizard(steps, answers); err != nil {
+			return err
+		}
+		valid := true
+		for _, step := range steps {
+			if step.check(answers[step.Key]) != nil {
+				valid = false
+				break
+			}
+		}
+		if valid {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"runtime"
+	"sync"
+)
+
+// defaultJobs is the default size of worker pools
+func defaultJobs() int {
+	return runtime.NumCPU()
+}
+
+// forEachParallel calls fn for every index below n using at most jobs
+// goroutines. Callers store results by index so output keeps its order.
+func forEachParallel(n, jobs int, fn func(i int)) {
+	if jobs < 1 {
+		jobs = 1
+	}
+	if jobs > n {
+		jobs = n
+	}
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// findX509Cert finds the fingerprint of the signing certificate for the
+// given email in "gpgsm --list-secret-keys --with-colons"
+func findX509Cert(email string) (string, error) {
+	out, err := execCommand("gpgsm", "--list-secret-keys", "--with-colons", email).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to list certificates: %v", err)
+	}
+
+	usable := false
+	for _, line := range strings.Split(string(out), "\n") {
+		// Fields: 1 type, 2 validity, 12 capabilities; the fingerprint is
+		// field 10 of the fpr record after the certificate
+		fields := strings.Split(line, ":")
+		switch {
+		case len(fields) >= 12 && (fields[0] == "crs" || fields[0] == "crt"):
+			usable = fields[0] == "crs" && strings.Contains(fields[11], "s")
+			switch fields[1] {
+			case "r", "e", "d", "i":
+				usable = false
+			}
+		case len(fields) >= 10 && fields[0] == "fpr" && usable:
+			return fields[9], nil
+		}
+	}
+	return "", fmt.Errorf("no signing certificate found for email: %s", email)
+}
+
+// signingEdits returns the git config edits that set up commit signing for
+// the account, and the key they configure
+func signingEdits(account GitHubAccount) ([]configEdit, string, error) {
+	switch account.Signing {
+	case signingNone:
+		// Undo signing left behind by a previously applied account
+		edits := []configEdit{{key: "commit.gpgsign", value: "false"}}
+		if !account.SignTags {
+			return edits, "", nil
+		}
+		// Tags are still signed, git has no signing key for tags only
+		keyID, err := findGPGKeyID(account.Email)
+		if err != nil {
+			return edits, "", err
+		}
+		return append(edits, configEdit{key: "user.signingkey", value: keyID}), keyID, nil
+	case signingX509:
+		fingerprint, err := findX509Cert(account.Email)
+		if err != nil {
+			return nil, "", err
+		}
+		return []configEdit{
+			{key: "gpg.format", value: "x509"},
+			{key: "gpg.x509.program", value: "gpgsm"},
+			{key: "user.signingkey", value: fingerprint},
+			{key: "commit.gpgsign", value: "true"},
+		}, fingerprint, nil
+	}
+	keyID, err := findGPGKeyID(account.Email)
+	if err != nil {
+		return nil, "", err
+	}
+	return []configEdit{
+		{key: "gpg.format", unset: true},
+		{key: "gpg.x509.program", unset: true},
+		{key: "user.signingkey", value: keyID},
+		{key: "commit.gpgsign", value: "true"},
+	}, keyID, nil
+}
+
+// describeSigning summarizes how commits are signed in the current
+// repository: whether commit.gpgsign is on, the mechanism from gpg.format
+// and the signing key
+func describeSigning() string {
+	get := func(key string) string {
+		out, _ := execCommand("git", "config", key).Output()
+		return strings.TrimSpace(string(out))
+	}
+	key := get("user.signingkey")
+	if get("commit.gpgsign") != "true" {
+		if key != "" {
+			return "off (key " + key + " is configured)"
+		}
+		return "off"
+	}
+	mechanism := "gpg"
+	switch get("gpg.format") {
+	case "x509":
+		mechanism = "x509 through " + get("gpg.x509.program")
+		if get("gpg.x509.program") == "" {
+			mechanism = "x509 through gpgsm"
+		}
+	case "ssh":
+		mechanism = "ssh"
+	}
+	if key == "" {
+		return "on, " + mechanism + ", no user.signingkey (the key of the committer email is used)"
+	}
+	return "on, " + mechanism + ", key " + key
+}